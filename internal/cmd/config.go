@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aymanbagabas/go-udiff"
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configRestoreYes    bool
+	configMigrateDryRun bool
+	configMigrateYes    bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the hop config file",
+	Long:  "Inspect and maintain the hop config file and its backups.",
+}
+
+var configRestoreCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "List or restore config backups",
+	Long: `List or restore automatic config backups.
+
+Every save keeps the previous config in a backup ring next to the config file
+(backups/, newest ` + strconv.Itoa(config.MaxBackups) + ` kept). Without an argument the available backups are
+listed. Pass a backup number from that list, or a backup file path, to restore
+it. The config being replaced is backed up first, so a restore can be undone.
+
+Examples:
+  hop config restore         # List backups, newest first
+  hop config restore 1       # Restore the newest backup
+  hop config restore 3 -y    # Restore without confirmation`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runConfigRestore,
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current schema version",
+	Long: `Upgrade the config file to the current schema version.
+
+hop upgrades older config files in memory every time it loads them, and the
+upgrade is written out with the next save. This command performs the upgrade
+explicitly: it lists the migrations that apply, shows a diff of the change and,
+after confirmation, rewrites the file. The previous version is kept in the
+backup ring (see hop config restore).
+
+Examples:
+  hop config migrate --dry-run   # Show what would change
+  hop config migrate -y          # Upgrade without confirmation`,
+	Args: cobra.NoArgs,
+	RunE: runConfigMigrate,
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for config.yaml",
+	Long: `Print a JSON Schema (draft 2020-12) describing config.yaml.
+
+Point your editor's YAML language server at it to get validation and
+completion while editing the config, e.g. with a modeline at the top of
+config.yaml:
+
+  hop config schema > ~/.config/hop/config.schema.json
+  # yaml-language-server: $schema=./config.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := config.JSONSchema()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(schema))
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configRestoreCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	configRestoreCmd.Flags().BoolVarP(&configRestoreYes, "yes", "y", false, "skip confirmation prompt")
+	configMigrateCmd.Flags().BoolVar(&configMigrateDryRun, "dry-run", false, "show the migration diff without writing")
+	configMigrateCmd.Flags().BoolVarP(&configMigrateYes, "yes", "y", false, "skip confirmation prompt")
+}
+
+func runConfigRestore(cmd *cobra.Command, args []string) error {
+	backups, err := config.ListBackups(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	if len(args) == 0 {
+		return printBackups(os.Stdout, backups)
+	}
+
+	backupPath, err := selectBackup(backups, args[0])
+	if err != nil {
+		return err
+	}
+
+	if !configRestoreYes {
+		fmt.Printf("Restore %s? The current config will be backed up first. [y/N] ", filepath.Base(backupPath))
+		reader := bufio.NewReader(os.Stdin)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response != "y" && response != "yes" {
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+	}
+
+	if err := config.RestoreBackup(cfgFile, backupPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s.\n", filepath.Base(backupPath))
+	return nil
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	path := cfgFile
+	if path == "" {
+		path = config.DefaultConfigPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no config file at %s", path)
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	upgraded, applied, err := config.Migrate(data)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Printf("Config is already at version %d.\n", config.CurrentVersion)
+		return nil
+	}
+
+	printMigrationPlan(os.Stdout, path, data, upgraded, applied)
+
+	if configMigrateDryRun {
+		fmt.Println("(dry-run: no changes made)")
+		return nil
+	}
+
+	if !configMigrateYes {
+		fmt.Printf("Upgrade %s to version %d? A backup is written first. [y/N] ", path, config.CurrentVersion)
+		reader := bufio.NewReader(os.Stdin)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response != "y" && response != "yes" {
+			fmt.Println("Migration cancelled.")
+			return nil
+		}
+	}
+
+	if _, err := config.MigrateFile(path); err != nil {
+		return fmt.Errorf("failed to migrate config: %w", err)
+	}
+
+	fmt.Printf("Migrated config to version %d. The previous version is in %s.\n", config.CurrentVersion, config.BackupDir(path))
+	return nil
+}
+
+// printMigrationPlan lists the migrations that apply and a unified diff of
+// the config before and after them.
+func printMigrationPlan(w io.Writer, path string, before, after []byte, applied []config.Migration) {
+	fmt.Fprintf(w, "Migrations for %s:\n", path)
+	for _, m := range applied {
+		fmt.Fprintf(w, "  v%d -> v%d: %s\n", m.From, m.From+1, m.Description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprint(w, udiff.Unified(path, path+" (migrated)", string(before), string(after)))
+	fmt.Fprintln(w)
+}
+
+func printBackups(w io.Writer, backups []config.Backup) error {
+	if len(backups) == 0 {
+		fmt.Fprintln(w, "No config backups found.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "#\tCREATED\tSIZE\tFILE\n")
+	for i, b := range backups {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", i+1, b.Created.Local().Format("2006-01-02 15:04:05"), b.Size, b.Path)
+	}
+	return tw.Flush()
+}
+
+// selectBackup resolves a restore argument, either a 1-based index into
+// backups (as printed by printBackups) or a path to a backup file.
+func selectBackup(backups []config.Backup, arg string) (string, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(backups) {
+			return "", fmt.Errorf("no backup #%d (%d available)", n, len(backups))
+		}
+		return backups[n-1].Path, nil
+	}
+	if _, err := os.Stat(arg); err != nil {
+		return "", fmt.Errorf("backup not found: %s", arg)
+	}
+	return arg, nil
+}
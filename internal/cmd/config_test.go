@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestSelectBackup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml.bak")
+	if err := os.WriteFile(file, []byte("version: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backups := []config.Backup{
+		{Path: "/b/newest"},
+		{Path: "/b/older"},
+	}
+
+	tests := []struct {
+		arg     string
+		want    string
+		wantErr bool
+	}{
+		{arg: "1", want: "/b/newest"},
+		{arg: "2", want: "/b/older"},
+		{arg: "0", wantErr: true},
+		{arg: "3", wantErr: true},
+		{arg: file, want: file},
+		{arg: filepath.Join(dir, "missing.bak"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := selectBackup(backups, tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectBackup(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectBackup(%q) = %q, want %q", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintBackups(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printBackups(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No config backups") {
+		t.Errorf("expected empty message, got %q", buf.String())
+	}
+
+	buf.Reset()
+	backups := []config.Backup{{Path: "/b/config.yaml.x.bak", Created: time.Now(), Size: 42}}
+	if err := printBackups(&buf, backups); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "CREATED") || !strings.Contains(out, "/b/config.yaml.x.bak") || !strings.Contains(out, "42") {
+		t.Errorf("unexpected listing:\n%s", out)
+	}
+}
+
+func TestPrintMigrationPlan(t *testing.T) {
+	before := []byte("connections: []\n")
+	after, applied, err := config.Migrate(before)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	printMigrationPlan(&buf, "config.yaml", before, after, applied)
+	out := buf.String()
+
+	for _, want := range []string{"v0 -> v1", "--- config.yaml", "+version: 1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan missing %q:\n%s", want, out)
+		}
+	}
+}
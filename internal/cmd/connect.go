@@ -117,7 +117,7 @@ func runQuickConnect(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "Connecting to %s (%s)...\n", conn.ID, conn.Host)
 	}
 
-	return ssh.Connect(conn, opts)
+	return connectAndRecord(conn, opts)
 }
 
 func connectToServer(conn *config.Connection, cmd *cobra.Command) error {
@@ -144,7 +144,21 @@ func connectToServer(conn *config.Connection, cmd *cobra.Command) error {
 		fmt.Fprintf(os.Stderr, "Connecting to %s (%s)...\n", conn.ID, conn.Host)
 	}
 
-	return ssh.Connect(conn, opts)
+	return connectAndRecord(conn, opts)
+}
+
+// connectAndRecord runs an interactive session and records it in history
+// with the session's exit status. Dry runs are not recorded.
+func connectAndRecord(conn *config.Connection, opts *ssh.ConnectOptions) error {
+	err := ssh.Connect(conn, opts)
+	if !opts.DryRun {
+		recordUsage(config.Usage{
+			ID:       conn.ID,
+			Kind:     config.UsageInteractive,
+			ExitCode: config.ExitStatus(ssh.ExitCode(err)),
+		})
+	}
+	return err
 }
 
 func loadConfig() (*config.Config, error) {
@@ -157,5 +171,15 @@ func loadConfig() (*config.Config, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
+	// A failing inventory leaves its cached connections, if any; say so
+	// rather than failing every command while the cloud is unreachable.
+	if !quiet {
+		for _, st := range cfg.InventoryStatuses() {
+			if st.Err != nil {
+				fmt.Fprintf(os.Stderr, "warning: inventory %s: %v\n", st.Name, st.Err)
+			}
+		}
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/fuzzy"
+	"github.com/danmartuszewski/hop/internal/resolve"
+	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cpRecursive bool
+	cpParallel  int
+	cpDryRun    bool
+	cpTag       string
+	cpFailFast  bool
+
+	syncDelete   bool
+	syncExclude  []string
+	syncParallel int
+	syncDryRun   bool
+	syncTag      string
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp <local>... <target>:<path> | <target>:<path> <local>",
+	Short: "Copy files to or from servers with scp",
+	Long: `Copy files between this machine and every server a target matches.
+
+The remote side is written <target>:<path>, where target is resolved like
+hop exec (group, project-env, glob or fuzzy ID). Port, user, identity_file,
+proxy_jump and options come from each connection.
+
+Uploading copies the local files to every matched server in parallel.
+Downloading from a single server writes to <local> directly; downloading from
+several writes each server's files to <local>/<id>/ so they don't collide.
+
+Examples:
+  hop cp ./app.conf web:/etc/app/              # upload to one server
+  hop cp -r ./dist production:/srv/app/        # upload a directory to a group
+  hop cp "web*:/var/log/nginx/error.log" ./logs  # logs/web1/, logs/web2/, ...`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t := &ssh.Transfer{Tool: ssh.ToolSCP, Recursive: cpRecursive}
+		return runTransfer(t, args, cpTag, cpDryRun, &ssh.ExecOptions{Parallel: cpParallel, FailFast: cpFailFast})
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync <local> <target>:<path> | <target>:<path> <local> [-- rsync-args...]",
+	Short: "Sync files to or from servers with rsync",
+	Long: `Sync a directory between this machine and every server a target matches,
+using rsync -az over the same ssh settings hop connect uses.
+
+Targets, parallelism and per-server download directories work like hop cp.
+Arguments after -- are passed to rsync. rsync's trailing-slash rules apply:
+"dist/" syncs the contents of dist, "dist" syncs the directory itself.
+
+Examples:
+  hop sync ./dist/ production:/srv/app/ --delete
+  hop sync ./site/ web:/var/www/ --exclude .git -- --checksum
+  hop sync "db*:/var/backups/" ./backups/`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var extra []string
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args, extra = args[:dash], args[dash:]
+		}
+		t := &ssh.Transfer{Tool: ssh.ToolRsync, Delete: syncDelete, Exclude: syncExclude, ExtraArgs: extra}
+		return runTransfer(t, args, syncTag, syncDryRun, &ssh.ExecOptions{Parallel: syncParallel})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd, syncCmd)
+
+	cpCmd.Flags().BoolVarP(&cpRecursive, "recursive", "r", false, "copy directories recursively")
+	cpCmd.Flags().IntVar(&cpParallel, "parallel", 10, "maximum parallel transfers")
+	cpCmd.Flags().BoolVar(&cpDryRun, "dry-run", false, "print scp commands without running them")
+	cpCmd.Flags().StringVar(&cpTag, "tag", "", "filter connections by tag")
+	cpCmd.Flags().BoolVar(&cpFailFast, "fail-fast", false, "stop on first error")
+
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "delete files on the receiving side that are not in the source")
+	syncCmd.Flags().StringArrayVar(&syncExclude, "exclude", nil, "exclude files matching pattern (repeatable)")
+	syncCmd.Flags().IntVar(&syncParallel, "parallel", 10, "maximum parallel transfers")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "print rsync commands without running them")
+	syncCmd.Flags().StringVar(&syncTag, "tag", "", "filter connections by tag")
+}
+
+// parseTransferArgs fills in t's direction, sources and destination from the
+// command line and returns the target. Exactly one side must be remote.
+func parseTransferArgs(t *ssh.Transfer, args []string) (string, error) {
+	if len(args) < 2 {
+		return "", errors.New("expected a source and a destination")
+	}
+	sources, dest := args[:len(args)-1], args[len(args)-1]
+
+	if target, path, ok := ssh.SplitRemotePath(dest); ok {
+		for _, src := range sources {
+			if ssh.IsRemotePath(src) {
+				return "", errors.New("copying between servers is not supported; one side must be local")
+			}
+			if _, err := os.Stat(src); err != nil {
+				return "", err
+			}
+		}
+		t.Upload = true
+		t.Sources = sources
+		t.Dest = path
+		return target, nil
+	}
+
+	if len(sources) != 1 {
+		return "", fmt.Errorf("expected <local>... <target>:<path> or <target>:<path> <local>")
+	}
+	target, path, ok := ssh.SplitRemotePath(sources[0])
+	if !ok {
+		return "", fmt.Errorf("neither %q nor %q is a <target>:<path>", sources[0], dest)
+	}
+	if path == "" {
+		return "", fmt.Errorf("missing remote path in %q", sources[0])
+	}
+	t.Sources = []string{path}
+	t.Dest = dest
+	return target, nil
+}
+
+func runTransfer(t *ssh.Transfer, args []string, tag string, dryRun bool, opts *ssh.ExecOptions) error {
+	target, err := parseTransferArgs(t, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	result, err := resolve.ResolveTarget(target, cfg)
+	if err != nil {
+		return err
+	}
+	connections := result.Connections
+	if tag != "" {
+		connections = fuzzy.MatchByTag(tag, connections)
+		if len(connections) == 0 {
+			return fmt.Errorf("no connections found with tag '%s'", tag)
+		}
+	}
+	if len(connections) == 0 {
+		return fmt.Errorf("no connections matching '%s'", target)
+	}
+	t.PerHost = !t.Upload && len(connections) > 1
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "Would run on %d server(s):\n\n", len(connections))
+		for i := range connections {
+			fmt.Printf("  %s: %s\n", connections[i].ID, ssh.BuildTransferCommandString(&connections[i], t))
+		}
+		return nil
+	}
+
+	verb := "Downloading from"
+	if t.Upload {
+		verb = "Uploading to"
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "%s %d server(s)...\n", verb, len(connections))
+	}
+
+	results := ssh.TransferContext(context.Background(), connections, t, opts)
+	recordUsage(ssh.TransferUsages(results)...)
+	printTransferResults(results, t)
+
+	if n := ssh.CountErrors(results); n > 0 {
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "\n%d of %d server(s) failed\n", n, len(results))
+		}
+		return fmt.Errorf("transfer failed on %d server(s)", n)
+	}
+	return nil
+}
+
+func printTransferResults(results []ssh.ExecResult, t *ssh.Transfer) {
+	for _, r := range results {
+		if r.Error != nil {
+			msg := strings.TrimSpace(r.Stderr)
+			if msg == "" {
+				msg = r.Error.Error()
+			}
+			fmt.Fprintf(os.Stderr, "✗ %s: %s\n", r.Connection.ID, msg)
+			continue
+		}
+		where := r.Connection.ID
+		if !t.Upload {
+			where += " → " + t.LocalDest(r.Connection)
+		}
+		if !quiet {
+			fmt.Printf("✓ %s (%s)\n", where, r.Duration.Round(time.Millisecond))
+		}
+	}
+}
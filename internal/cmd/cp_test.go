@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+func TestParseTransferArgs(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	for _, f := range []string{a, b} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantTarget string
+		want       ssh.Transfer
+		wantErr    bool
+	}{
+		{
+			name:       "upload",
+			args:       []string{a, b, "web*:/srv/"},
+			wantTarget: "web*",
+			want:       ssh.Transfer{Upload: true, Sources: []string{a, b}, Dest: "/srv/"},
+		},
+		{
+			name:       "download",
+			args:       []string{"prod:/var/log/app.log", "logs"},
+			wantTarget: "prod",
+			want:       ssh.Transfer{Sources: []string{"/var/log/app.log"}, Dest: "logs"},
+		},
+		{name: "missing local file", args: []string{filepath.Join(dir, "nope"), "web:/srv/"}, wantErr: true},
+		{name: "remote to remote", args: []string{"db:/x", "web:/srv/"}, wantErr: true},
+		{name: "no remote side", args: []string{a, b}, wantErr: true},
+		{name: "several remote sources", args: []string{"web:/a", "web:/b", "out"}, wantErr: true},
+		{name: "empty remote path", args: []string{"web:", "out"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ssh.Transfer
+			target, err := parseTransferArgs(&got, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if target != tt.wantTarget || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q %+v, want %q %+v", target, got, tt.wantTarget, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/doctor"
+	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+var doctorJSON bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the config and local tools for problems",
+	Long: `Check the config and the local environment for problems.
+
+Reports every config error (the ones that make other commands fail with
+"invalid config") plus warnings, each with the file, line and column it
+refers to:
+
+  - identity files that are missing or readable by other users
+  - proxy_jump hosts that are neither connections nor ~/.ssh/config hosts
+  - connections with the same host, user and port
+  - options keys that ssh does not know
+  - forward_agent on production connections (env or tag prod/production)
+
+It also checks for ssh, mosh (when a connection uses it) and whether hop can
+open tabs in the detected terminal.
+
+Exits 1 if there are errors. Use --json for machine-readable output in CI.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return silent(runDoctor(os.Stdout, true, doctorJSON))
+	},
+}
+
+var configValidateJSON bool
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for errors and warnings",
+	Long: `Check the config file for errors and warnings, with line and column.
+
+Runs the config checks of hop doctor without the local tool checks. Exits 1
+if there are errors.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return silent(runDoctor(os.Stdout, false, configValidateJSON))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "output as JSON")
+	configValidateCmd.Flags().BoolVar(&configValidateJSON, "json", false, "output as JSON")
+}
+
+// doctorReport is the --json output of hop doctor.
+type doctorReport struct {
+	Diagnostics []doctor.Diagnostic `json:"diagnostics"`
+	Errors      int                 `json:"errors"`
+	Warnings    int                 `json:"warnings"`
+}
+
+func runDoctor(w io.Writer, tools, asJSON bool) error {
+	path := cfgFile
+	if path == "" {
+		path = config.DefaultConfigPath()
+	}
+
+	var diags []doctor.Diagnostic
+	cfg, err := config.Load(path)
+	if err != nil {
+		diags = append(diags, doctor.LoadError(path, err))
+	} else {
+		diags = append(diags, doctor.CheckConfig(cfg, sshConfigAliases())...)
+		if tools {
+			diags = append(diags, doctor.CheckTools(cfg, exec.LookPath, ssh.DetectTerminal())...)
+		}
+	}
+
+	errs, warnings := doctor.Counts(diags)
+	if err := printDoctorReport(w, diags, asJSON); err != nil {
+		return err
+	}
+	if errs > 0 {
+		return fmt.Errorf("%d error(s), %d warning(s)", errs, warnings)
+	}
+	return nil
+}
+
+func printDoctorReport(w io.Writer, diags []doctor.Diagnostic, asJSON bool) error {
+	errs, warnings := doctor.Counts(diags)
+
+	if asJSON {
+		report := doctorReport{Diagnostics: diags, Errors: errs, Warnings: warnings}
+		if report.Diagnostics == nil {
+			report.Diagnostics = []doctor.Diagnostic{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	for _, d := range diags {
+		fmt.Fprintln(w, d.String())
+	}
+	if len(diags) > 0 {
+		fmt.Fprintln(w)
+	}
+	if errs == 0 && warnings == 0 {
+		fmt.Fprintln(w, "No problems found.")
+		return nil
+	}
+	fmt.Fprintf(w, "%d error(s), %d warning(s)\n", errs, warnings)
+	return nil
+}
+
+// sshConfigAliases returns the Host names defined in ~/.ssh/config.
+func sshConfigAliases() []string {
+	hosts, err := sshconfig.Parse("")
+	if err != nil {
+		return nil
+	}
+	var aliases []string
+	for _, h := range hosts {
+		aliases = append(aliases, strings.Fields(h.Alias)...)
+		if h.HostName != "" {
+			aliases = append(aliases, h.HostName)
+		}
+	}
+	return aliases
+}
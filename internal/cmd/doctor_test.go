@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/doctor"
+)
+
+func TestPrintDoctorReport(t *testing.T) {
+	diags := []doctor.Diagnostic{
+		{Position: config.Position{File: "/c.yaml", Line: 3, Column: 5}, Severity: doctor.SeverityError, Check: "config", Field: "connections[0].host", Message: "is required"},
+		{Severity: doctor.SeverityWarning, Check: "tools", Field: "terminal", Message: "could not detect the terminal"},
+	}
+
+	var buf bytes.Buffer
+	if err := printDoctorReport(&buf, diags, false); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"/c.yaml:3:5: error: connections[0].host: is required\n",
+		"warning: terminal: could not detect the terminal\n",
+		"1 error(s), 1 warning(s)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := printDoctorReport(&buf, diags, true); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Diagnostics []map[string]any `json:"diagnostics"`
+		Errors      int              `json:"errors"`
+		Warnings    int              `json:"warnings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if report.Errors != 1 || report.Warnings != 1 || len(report.Diagnostics) != 2 {
+		t.Errorf("report = %+v", report)
+	}
+	if d := report.Diagnostics[0]; d["file"] != "/c.yaml" || d["line"] != float64(3) || d["column"] != float64(5) || d["severity"] != "error" {
+		t.Errorf("first diagnostic = %v", d)
+	}
+	if _, ok := report.Diagnostics[1]["file"]; ok {
+		t.Errorf("tool diagnostic should have no file: %v", report.Diagnostics[1])
+	}
+
+	buf.Reset()
+	if err := printDoctorReport(&buf, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"diagnostics": []`) {
+		t.Errorf("empty report should have an empty list: %s", buf.String())
+	}
+}
@@ -1,28 +1,50 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/danmartuszewski/hop/internal/config"
 	"github.com/danmartuszewski/hop/internal/fuzzy"
+	"github.com/danmartuszewski/hop/internal/health"
 	"github.com/danmartuszewski/hop/internal/resolve"
+	"github.com/danmartuszewski/hop/internal/runs"
 	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/danmartuszewski/hop/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 var (
-	execParallel int
-	execTimeout  string
-	execFailFast bool
-	execStream   bool
-	execDryRun   bool
-	execTag      string
+	execParallel  int
+	execTimeout   string
+	execFailFast  bool
+	execStream    bool
+	execDryRun    bool
+	execTag       string
+	execTransport string
+	execOutput    string
+	execGroup     bool
+	execDiff      bool
+	execTUI       bool
+
+	execScript      string
+	execInterpreter string
+	execStdin       bool
+
+	execCanary      int
+	execBatch       int
+	execPause       time.Duration
+	execMaxFail     string
+	execGateTCP     bool
+	execGateCommand string
 )
 
 var execCmd = &cobra.Command{
-	Use:   "exec <target> <command>",
+	Use:   "exec <target> <command> | <target> --script <file> [args...]",
 	Short: "Execute a command on multiple servers",
 	Long: `Execute a command on multiple servers in parallel.
 
@@ -37,8 +59,61 @@ Examples:
   hop exec myapp-prod "df -h" --parallel=2  # Project-env pattern
   hop exec prod "hostname" --stream         # Stream output in real-time
   hop exec "web*" "systemctl restart nginx" # Glob pattern
-  hop exec --tag=database "psql -c 'SELECT 1'" # Filter by tag`,
-	Args: cobra.MinimumNArgs(2),
+  hop exec --tag=database "psql -c 'SELECT 1'" # Filter by tag
+  hop exec prod "uptime" --transport native # In-process SSH, no ssh per host
+  hop exec prod "uptime" -o ndjson | jq .   # One JSON record per host as it finishes
+  hop exec prod "make check" -o junit > report.xml
+  hop exec web --script ./fix.sh -- --force   # Ship and run a local script
+  hop exec db --script ./report.py --interpreter python3
+  cat keys.txt | hop exec web --stdin "cat >> ~/.ssh/authorized_keys"
+  hop exec web "cat /etc/app/version" --group-output
+  hop exec web "sysctl -a" --diff           # Show outliers as diffs
+  hop exec web "apt-get -y upgrade" --tui   # Watch hosts live, cancel stragglers
+
+--group-output prints each distinct output once, under a banner listing the
+hosts that produced it, with the largest group first. Hosts match when their
+stdout and exit code are identical; stderr is shown from the first host of
+each group. --diff also groups, and prints every other group as a unified
+diff against the largest one.
+
+--tui shows a live table of the hosts with their status and duration.
+Select a host to scroll through its output as it arrives; c cancels the
+selected host and C the whole run. The summary is printed when you close
+it.
+
+--output selects the result format: text (default, output grouped under a
+banner per host), table (one summary row per host), json (one document),
+ndjson (one record per line, printed as each host finishes) or junit (a
+testcase per host; non-zero exits are failures, unreachable hosts errors,
+including ssh exiting 255).
+Records carry id, host, user, stdout, stderr, exit_code, signal,
+duration_ms, error and skipped. Progress and the summary go to stderr.
+
+--script sends a local script along with the command and runs it from a
+temporary file that is removed afterwards; arguments after the target (use
+-- before ones that start with "-") are passed to it. Scripts starting
+with #! run with their own interpreter, others with sh, unless
+--interpreter is given. --stdin reads all of hop's standard input first
+and sends it to the command on every host; it works with --script too.
+
+Rolling runs:
+  hop exec web "deploy.sh" --canary 1 --batch 5 --pause 30s --max-fail 10%
+
+--canary N runs N hosts first, then --batch N runs the rest N at a time
+(all at once without --batch). Between batches hop waits --pause, then
+checks the batch that just finished: --gate-tcp requires its hosts to
+accept TCP connections on their SSH port (through their proxy_jump, if
+any), --gate-command runs a command on them that must succeed everywhere. A failed gate stops the run.
+--max-fail (a host count or a percentage of all hosts) stops the run once
+more hosts have failed: running hosts finish, the rest are skipped.
+
+--transport native connects with a built-in SSH client instead of running
+ssh once per host. It uses the connection's port, user, identity_file,
+proxy_jump, forward_agent, ssh-agent and known_hosts (honouring the
+StrictHostKeyChecking, UserKnownHostsFile, IdentitiesOnly and ConnectTimeout
+options), but not ~/.ssh/config. Unknown host keys are rejected unless
+StrictHostKeyChecking is accept-new or no.`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: runExec,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		if len(args) >= 1 {
@@ -58,11 +133,44 @@ func init() {
 	execCmd.Flags().BoolVar(&execStream, "stream", false, "stream output in real-time with host prefixes")
 	execCmd.Flags().BoolVar(&execDryRun, "dry-run", false, "print SSH commands without executing")
 	execCmd.Flags().StringVar(&execTag, "tag", "", "filter connections by tag")
+	execCmd.Flags().StringVar(&execTransport, "transport", "ssh", "how to connect: ssh (run the ssh binary) or native (built-in client)")
+	execCmd.Flags().StringVarP(&execOutput, "output", "o", "text", "output format: text, table, json, ndjson or junit")
+	execCmd.Flags().BoolVar(&execGroup, "group-output", false, "print each distinct output once with the hosts that produced it")
+	execCmd.Flags().BoolVar(&execDiff, "diff", false, "group output and show how each group differs from the majority")
+	execCmd.Flags().BoolVar(&execTUI, "tui", false, "follow the run in an interactive view with live per-host status and output")
+	execCmd.Flags().StringVar(&execScript, "script", "", "run this local script on every host instead of a command")
+	execCmd.Flags().StringVar(&execInterpreter, "interpreter", "", "program that runs the --script (e.g. bash, python3)")
+	execCmd.Flags().BoolVar(&execStdin, "stdin", false, "send hop's standard input to the command on every host")
+	execCmd.Flags().IntVar(&execCanary, "canary", 0, "run this many hosts first, as their own batch")
+	execCmd.Flags().IntVar(&execBatch, "batch", 0, "run hosts in batches of this size")
+	execCmd.Flags().DurationVar(&execPause, "pause", 0, "wait between batches (e.g., 30s)")
+	execCmd.Flags().StringVar(&execMaxFail, "max-fail", "", "stop once more than this many hosts fail (count or percentage, e.g. 10%)")
+	execCmd.Flags().BoolVar(&execGateTCP, "gate-tcp", false, "between batches, require the finished batch's hosts to be reachable")
+	execCmd.Flags().StringVar(&execGateCommand, "gate-command", "", "between batches, run this check on the finished batch's hosts")
+	execCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(
+		[]string{"text", "table", "json", "ndjson", "junit"}, cobra.ShellCompDirectiveNoFileComp))
 }
 
 func runExec(cmd *cobra.Command, args []string) error {
 	groupOrPattern := args[0]
 	command := strings.Join(args[1:], " ")
+	if execScript == "" && len(args) < 2 {
+		return fmt.Errorf("requires a target and a command (or --script)")
+	}
+	if execInterpreter != "" && execScript == "" {
+		return fmt.Errorf("--interpreter can only be used with --script")
+	}
+	var script string
+	if execScript != "" {
+		content, err := os.ReadFile(execScript)
+		if err != nil {
+			return err
+		}
+		if command, err = ssh.ScriptCommand(content, execInterpreter, args[1:]); err != nil {
+			return fmt.Errorf("%s: %w", execScript, err)
+		}
+		script = strings.Join(append([]string{execScript}, args[1:]...), " ")
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -88,6 +196,17 @@ func runExec(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no connections matching '%s'", groupOrPattern)
 	}
 
+	run := runs.New(runs.SourceCLI, groupOrPattern, command, connections)
+	run.Tag = execTag
+	run.Script = script
+	return execOn(cfg, connections, command, run)
+}
+
+// execOn runs command on connections with the exec flags and stores the
+// results in run.
+func execOn(cfg *config.Config, connections []config.Connection, command string, run *runs.Run) error {
+	var err error
+
 	// Parse timeout
 	var timeout time.Duration
 	if execTimeout != "" {
@@ -97,6 +216,45 @@ func runExec(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	transport, err := ssh.ParseTransport(execTransport)
+	if err != nil {
+		return err
+	}
+
+	format, err := ssh.ParseOutputFormat(execOutput)
+	if err != nil {
+		return err
+	}
+	if execStream && format != ssh.OutputText {
+		return fmt.Errorf("--stream can only be used with --output text")
+	}
+	grouped := execGroup || execDiff
+	if grouped && (execStream || format != ssh.OutputText) {
+		return fmt.Errorf("--group-output and --diff can only be used with --output text, without --stream")
+	}
+	if execTUI && (execStream || grouped || format != ssh.OutputText) {
+		return fmt.Errorf("--tui can't be combined with --stream, --group-output, --diff or --output")
+	}
+
+	var maxFail *ssh.FailureThreshold
+	if execMaxFail != "" {
+		if maxFail, err = ssh.ParseFailureThreshold(execMaxFail); err != nil {
+			return err
+		}
+	}
+	batched := execBatch > 0 || execCanary > 0
+	if !batched && (execPause > 0 || execGateTCP || execGateCommand != "") {
+		return fmt.Errorf("--pause, --gate-tcp and --gate-command need --batch or --canary")
+	}
+
+	var stdin []byte
+	if execStdin {
+		if stdin, err = readStdin(); err != nil {
+			return err
+		}
+		run.Stdin = true
+	}
+
 	// Handle dry-run
 	if execDryRun {
 		fmt.Fprintf(os.Stderr, "Would execute on %d server(s):\n\n", len(connections))
@@ -108,7 +266,7 @@ func runExec(cmd *cobra.Command, args []string) error {
 	}
 
 	// Print header
-	if !quiet {
+	if !quiet && !execTUI {
 		fmt.Fprintf(os.Stderr, "Executing on %d server(s)...\n", len(connections))
 		if execStream {
 			fmt.Fprintf(os.Stderr, "\n")
@@ -117,25 +275,64 @@ func runExec(cmd *cobra.Command, args []string) error {
 
 	// Execute
 	opts := &ssh.ExecOptions{
-		Command:  command,
-		Parallel: execParallel,
-		Timeout:  timeout,
-		FailFast: execFailFast,
-		Stream:   execStream,
+		Command:   command,
+		Stdin:     stdin,
+		Parallel:  execParallel,
+		Timeout:   timeout,
+		FailFast:  execFailFast,
+		Stream:    execStream,
+		Transport: transport,
+		Canary:    execCanary,
+		Batch:     execBatch,
+		Pause:     execPause,
+		MaxFail:   maxFail,
+	}
+	if execGateTCP || execGateCommand != "" {
+		opts.Gate = batchGate(execGateTCP, execGateCommand, opts)
+	}
+	if batched && !quiet && !execTUI {
+		opts.OnBatch = func(e ssh.BatchEvent) {
+			printBatchEvent(os.Stderr, e)
+		}
+	}
+	if format == ssh.OutputNDJSON {
+		opts.OnResult = func(r ssh.ExecResult) {
+			ssh.WriteNDJSON(os.Stdout, r)
+		}
 	}
 
-	results := ssh.Execute(connections, opts)
+	start := time.Now()
+	run.Started = start
+	run.Transport = string(transport)
+	var results []ssh.ExecResult
+	if execTUI {
+		if results, err = tui.RunExec(cfg, connections, opts, run.Label()); err != nil {
+			return err
+		}
+	} else {
+		results = ssh.Execute(connections, opts)
+	}
+	recordUsage(ssh.ExecUsages(results)...)
+	run.Finish(results)
+	saved := saveRun(run)
 
 	// Output results
-	if !execStream {
-		fmt.Print(ssh.FormatGroupedOutput(results))
+	if grouped {
+		fmt.Print(ssh.FormatClusteredOutput(results, execDiff))
+	} else if !execStream && !execTUI {
+		if err := writeExecOutput(os.Stdout, format, run.Label(), start, transport, results); err != nil {
+			return err
+		}
 	}
 
 	// Print summary
 	if !quiet {
 		errCount := ssh.CountErrors(results)
 		if errCount > 0 {
-			fmt.Fprintf(os.Stderr, "\n%d of %d server(s) failed\n", errCount, len(results))
+			fmt.Fprintf(os.Stderr, "\n%d of %d server(s) failed%s\n", errCount, len(results), skippedNote(results))
+			if saved {
+				fmt.Fprintf(os.Stderr, "Retry them with: hop runs rerun %s --failed-only\n", run.ID)
+			}
 		} else {
 			fmt.Fprintf(os.Stderr, "\nCompleted on %d server(s)\n", len(results))
 		}
@@ -148,3 +345,124 @@ func runExec(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// readStdin reads all of hop's standard input for --stdin, refusing to
+// wait on a terminal.
+func readStdin() ([]byte, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return nil, fmt.Errorf("--stdin needs input piped or redirected into hop")
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+	return data, nil
+}
+
+// writeExecOutput prints results in format. NDJSON records are printed as
+// hosts finish, so there is nothing left to print for them here.
+func writeExecOutput(w io.Writer, format ssh.OutputFormat, command string, start time.Time, transport ssh.Transport, results []ssh.ExecResult) error {
+	switch format {
+	case ssh.OutputJSON:
+		return ssh.WriteJSON(w, command, results)
+	case ssh.OutputJUnit:
+		return ssh.WriteJUnit(w, command, start, transport, results)
+	case ssh.OutputTable:
+		return ssh.WriteTable(w, results)
+	case ssh.OutputNDJSON:
+		return nil
+	default:
+		_, err := io.WriteString(w, ssh.FormatGroupedOutput(results))
+		return err
+	}
+}
+
+// skippedNote explains hosts that were never run, e.g. " (4 skipped: 3 of
+// 20 hosts failed (max 10%))", or returns "" when every host ran.
+func skippedNote(results []ssh.ExecResult) string {
+	n := 0
+	var reason error
+	for _, r := range results {
+		if r.Skipped {
+			if n == 0 {
+				reason = r.Error
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d skipped: %v)", n, reason)
+}
+
+// batchGate returns the check run on each finished batch before the next
+// one starts.
+func batchGate(tcp bool, command string, opts *ssh.ExecOptions) func(context.Context, []config.Connection) error {
+	return func(ctx context.Context, batch []config.Connection) error {
+		if tcp {
+			var down []string
+			for i, r := range health.CheckAll(ctx, batch, health.DefaultTimeout, opts.Parallel) {
+				if r.Status == health.StatusUnreachable {
+					down = append(down, batch[i].ID)
+				}
+			}
+			if len(down) > 0 {
+				return fmt.Errorf("unreachable: %s", strings.Join(down, ", "))
+			}
+		}
+		if command != "" {
+			results := ssh.ExecuteContext(ctx, batch, &ssh.ExecOptions{
+				Command:   command,
+				Parallel:  opts.Parallel,
+				Timeout:   opts.Timeout,
+				Transport: opts.Transport,
+			})
+			var failed []string
+			for _, r := range results {
+				if r.Error != nil {
+					failed = append(failed, r.Connection.ID)
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("%q failed on %s", command, strings.Join(failed, ", "))
+			}
+		}
+		return nil
+	}
+}
+
+// printBatchEvent writes a line of batch progress.
+func printBatchEvent(w io.Writer, e ssh.BatchEvent) {
+	name := "Batch"
+	if e.Canary {
+		name = "Canary"
+	}
+	pos := fmt.Sprintf("%d/%d", e.Batch, e.Batches)
+	switch e.Kind {
+	case ssh.BatchStarted:
+		fmt.Fprintf(w, "── %s %s: %s\n", name, pos, batchHosts(e.Connections))
+	case ssh.BatchFinished:
+		ok := len(e.Connections) - e.Failed
+		fmt.Fprintf(w, "   %s %s done: %d ok, %d failed (%s)\n", strings.ToLower(name), pos, ok, e.Failed, e.Duration.Round(time.Millisecond))
+	case ssh.BatchPausing:
+		fmt.Fprintf(w, "   pausing %s before batch %s\n", e.Duration, pos)
+	case ssh.BatchGating:
+		fmt.Fprintf(w, "   checking %s before batch %s\n", batchHosts(e.Connections), pos)
+	case ssh.BatchStopped:
+		fmt.Fprintf(w, "Stopped before batch %s: %v\n", pos, e.Err)
+	}
+}
+
+// batchHosts lists a batch's connection IDs, abbreviated for long batches.
+func batchHosts(conns []config.Connection) string {
+	const show = 5
+	ids := make([]string, 0, show)
+	for i, c := range conns {
+		if i == show {
+			return strings.Join(ids, ", ") + fmt.Sprintf(", … (+%d more)", len(conns)-show)
+		}
+		ids = append(ids, c.ID)
+	}
+	return strings.Join(ids, ", ")
+}
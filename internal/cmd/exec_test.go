@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+func TestBatchHosts(t *testing.T) {
+	var conns []config.Connection
+	for i := 1; i <= 7; i++ {
+		conns = append(conns, config.Connection{ID: fmt.Sprintf("web%d", i)})
+	}
+	if got := batchHosts(conns[:2]); got != "web1, web2" {
+		t.Errorf("batchHosts = %q", got)
+	}
+	if got, want := batchHosts(conns), "web1, web2, web3, web4, web5, … (+2 more)"; got != want {
+		t.Errorf("batchHosts = %q, want %q", got, want)
+	}
+}
+
+func TestPrintBatchEvent(t *testing.T) {
+	canary := []config.Connection{{ID: "web1"}}
+	batch := []config.Connection{{ID: "web2"}, {ID: "web3"}}
+	events := []ssh.BatchEvent{
+		{Kind: ssh.BatchStarted, Batch: 1, Batches: 2, Canary: true, Connections: canary},
+		{Kind: ssh.BatchFinished, Batch: 1, Batches: 2, Canary: true, Connections: canary, Duration: 1500 * time.Millisecond},
+		{Kind: ssh.BatchPausing, Batch: 2, Batches: 2, Duration: 30 * time.Second},
+		{Kind: ssh.BatchGating, Batch: 2, Batches: 2, Connections: canary},
+		{Kind: ssh.BatchStarted, Batch: 2, Batches: 2, Connections: batch},
+		{Kind: ssh.BatchFinished, Batch: 2, Batches: 2, Connections: batch, Failed: 1, Duration: time.Second},
+		{Kind: ssh.BatchStopped, Batch: 2, Batches: 2, Err: errors.New("health gate failed: unreachable: web1")},
+	}
+	var buf bytes.Buffer
+	for _, e := range events {
+		printBatchEvent(&buf, e)
+	}
+	want := "── Canary 1/2: web1\n" +
+		"   canary 1/2 done: 1 ok, 0 failed (1.5s)\n" +
+		"   pausing 30s before batch 2/2\n" +
+		"   checking web1 before batch 2/2\n" +
+		"── Batch 2/2: web2, web3\n" +
+		"   batch 2/2 done: 1 ok, 1 failed (1s)\n" +
+		"Stopped before batch 2/2: health gate failed: unreachable: web1\n"
+	if buf.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestSkippedNote(t *testing.T) {
+	stop := errors.New("2 of 4 hosts failed (max 1)")
+	results := []ssh.ExecResult{
+		{Error: errors.New("exit status 1")},
+		{Error: errors.New("exit status 1")},
+		{Error: stop, Skipped: true},
+		{Error: stop, Skipped: true},
+	}
+	if got, want := skippedNote(results), " (2 skipped: 2 of 4 hosts failed (max 1))"; got != want {
+		t.Errorf("skippedNote = %q, want %q", got, want)
+	}
+	if got := skippedNote(results[:2]); got != "" {
+		t.Errorf("skippedNote without skipped hosts = %q", got)
+	}
+}
+
+func TestBatchGateTCPUsesProxyJump(t *testing.T) {
+	port := statusListener(t, "SSH-2.0-OpenSSH_9.6\r\n")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+
+	// The target itself answers, but only the jump host can reach it.
+	direct := config.Connection{ID: "direct", Host: "127.0.0.1", Port: port}
+	behind := config.Connection{ID: "behind", Host: "127.0.0.1", Port: port, ProxyJump: closed}
+	gate := batchGate(true, "", &ssh.ExecOptions{Parallel: 2})
+
+	if err := gate(context.Background(), []config.Connection{direct}); err != nil {
+		t.Errorf("gate(direct) = %v", err)
+	}
+	err = gate(context.Background(), []config.Connection{direct, behind})
+	if err == nil || err.Error() != "unreachable: behind" {
+		t.Errorf("gate(behind) = %v, want the jump host's target unreachable", err)
+	}
+}
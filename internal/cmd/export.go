@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/danmartuszewski/hop/internal/config"
 	"github.com/danmartuszewski/hop/internal/export"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
 	"github.com/spf13/cobra"
 )
 
@@ -17,13 +19,17 @@ var (
 	exportIDs     string
 	exportOutput  string
 	exportAll     bool
+	exportFormat  string
 )
 
 var exportCmd = &cobra.Command{
 	Use:   "export",
-	Short: "Export connections to YAML",
+	Short: "Export connections to YAML or SSH config",
 	Long: `Export connections to a YAML file that can be shared or re-imported.
 
+With --format ssh-config the connections are written as ~/.ssh/config Host
+blocks instead (see hop sshconfig sync to keep ~/.ssh/config up to date).
+
 At least one filter flag or --all is required to prevent accidental full dumps.
 Filters combine with AND logic when multiple are specified.
 
@@ -33,7 +39,8 @@ Examples:
   hop export --project myapp -o myapp.yaml  Export by project
   hop export --tag database                 Export by tag
   hop export --env production               Export by environment
-  hop export --id web-1,web-2               Export specific connections`,
+  hop export --id web-1,web-2               Export specific connections
+  hop export --all --format ssh-config      Export as SSH config Host blocks`,
 	RunE: runExport,
 }
 
@@ -46,12 +53,16 @@ func init() {
 	exportCmd.Flags().StringVar(&exportIDs, "id", "", "export specific connection IDs (comma-separated)")
 	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "output file path (default: stdout)")
 	exportCmd.Flags().BoolVar(&exportAll, "all", false, "export all connections")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "yaml", "output format: yaml or ssh-config")
 }
 
 func runExport(cmd *cobra.Command, args []string) error {
 	if !exportAll && exportProject == "" && exportEnv == "" && exportTag == "" && exportIDs == "" {
 		return fmt.Errorf("at least one filter flag (--project, --env, --tag, --id) or --all is required")
 	}
+	if exportFormat != "yaml" && exportFormat != "ssh-config" {
+		return fmt.Errorf("unknown format %q (want yaml or ssh-config)", exportFormat)
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -95,10 +106,21 @@ func runExport(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no connections match the given filters")
 	}
 
-	exportCfg := export.BuildExportConfig(filtered)
+	write := func(w io.Writer) error {
+		return export.WriteYAML(w, export.BuildExportConfig(filtered))
+	}
+	if exportFormat == "ssh-config" {
+		write = func(w io.Writer) error {
+			skipped, err := sshconfig.WriteHosts(w, filtered, sshconfig.WriteOptions{})
+			for _, id := range skipped {
+				fmt.Fprintf(os.Stderr, "Skipping %q: not usable as an SSH Host alias\n", id)
+			}
+			return err
+		}
+	}
 
 	if exportOutput == "" {
-		return export.WriteYAML(os.Stdout, exportCfg)
+		return write(os.Stdout)
 	}
 
 	f, err := os.Create(exportOutput)
@@ -107,7 +129,7 @@ func runExport(cmd *cobra.Command, args []string) error {
 	}
 	defer f.Close()
 
-	if err := export.WriteYAML(f, exportCfg); err != nil {
+	if err := write(f); err != nil {
 		return fmt.Errorf("failed to write export: %w", err)
 	}
 
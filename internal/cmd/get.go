@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/danmartuszewski/hop/internal/config"
 	"github.com/danmartuszewski/hop/internal/fuzzy"
@@ -19,6 +20,7 @@ type getOpts struct {
 	NoNewline bool
 	Default   string
 	JSON      bool
+	Resolved  bool
 }
 
 // getFieldNames is the canonical, ordered list of supported field names for
@@ -36,6 +38,8 @@ var getFieldNames = []string{
 	"env",
 	"tags",
 	"options",
+	"extends",
+	"source",
 }
 
 // getBareFields are the fields included (when non-empty) in the bare
@@ -52,6 +56,7 @@ var getBareFields = []string{
 	"use_mosh",
 	"project",
 	"env",
+	"source",
 }
 
 // getFieldResolvers returns the value of a single field for a given
@@ -102,6 +107,10 @@ var getFieldResolvers = map[string]func(*config.Config, *config.Connection) stri
 		}
 		return b.String()
 	},
+	"extends": func(_ *config.Config, c *config.Connection) string {
+		return strings.Join(c.Extends, "\n")
+	},
+	"source": func(_ *config.Config, c *config.Connection) string { return c.Source },
 }
 
 // getJSONValueResolvers returns the JSON-typed value for a field. Numeric and
@@ -119,12 +128,15 @@ var getJSONValueResolvers = map[string]func(*config.Config, *config.Connection)
 	"env":           func(_ *config.Config, c *config.Connection) any { return c.Env },
 	"tags":          func(_ *config.Config, c *config.Connection) any { return c.Tags },
 	"options":       func(_ *config.Config, c *config.Connection) any { return c.Options },
+	"extends":       func(_ *config.Config, c *config.Connection) any { return c.Extends },
+	"source":        func(_ *config.Config, c *config.Connection) any { return c.Source },
 }
 
 var (
 	getNoNewline bool
 	getDefault   string
 	getJSON      bool
+	getResolved  bool
 )
 
 var getCmd = &cobra.Command{
@@ -153,6 +165,9 @@ Supported fields:
   tags            Tags, one per line
   options         SSH options as sorted key=value lines
   options.<key>   Single SSH option value (e.g. options.StrictHostKeyChecking)
+  extends         Templates the connection extends, one per line
+  source          Config file the connection is defined in (config.yaml,
+                  an include: file or a conf.d/ file)
 
 Output modes:
   hop get <id> <field>             Print value followed by newline
@@ -164,6 +179,10 @@ Output modes:
 With --json, a single field becomes {"field": value}; multiple fields become
 {"f1": v1, "f2": v2}; bare (no field) emits the full Connection object.
 
+With --resolved (bare form only), every value of the flattened connection is
+listed with where it came from: the connection itself, a template it extends
+(templates:/extends:), or defaults. Tags and options get one line each.
+
 On any error, exits 1 with the message on stderr and nothing on stdout. The
 error lists valid field names (for unknown fields) or fuzzy ID suggestions
 (for unknown IDs).`,
@@ -183,7 +202,10 @@ error lists valid field names (for unknown fields) or fuzzy ID suggestions
   hop get prod host,port --json | jq -r .host
 
   # Read a single SSH option:
-  hop get prod options.StrictHostKeyChecking`,
+  hop get prod options.StrictHostKeyChecking
+
+  # Show which template or default each value comes from:
+  hop get prod --resolved`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := loadConfig()
@@ -201,6 +223,7 @@ error lists valid field names (for unknown fields) or fuzzy ID suggestions
 			NoNewline: getNoNewline,
 			Default:   getDefault,
 			JSON:      getJSON,
+			Resolved:  getResolved,
 		}
 
 		return silent(runGet(cfg, os.Stdout, os.Stderr, id, fieldArg, opts))
@@ -223,6 +246,7 @@ func init() {
 	getCmd.Flags().BoolVarP(&getNoNewline, "no-newline", "n", false, "suppress trailing newline")
 	getCmd.Flags().StringVar(&getDefault, "default", "", "value to print if the requested field is empty")
 	getCmd.Flags().BoolVar(&getJSON, "json", false, "emit JSON output")
+	getCmd.Flags().BoolVar(&getResolved, "resolved", false, "show the flattened connection and where each value comes from")
 }
 
 // runGet implements `hop get`. It writes only on success: any error path
@@ -235,6 +259,13 @@ func runGet(cfg *config.Config, stdout, stderr io.Writer, id string, fieldArg st
 		return reportError(stderr, unknownIDError(id, cfg))
 	}
 
+	if opts.Resolved {
+		if fieldArg != "" {
+			return reportError(stderr, fmt.Errorf("--resolved cannot be combined with field names"))
+		}
+		return runGetResolved(cfg, stdout, conn, opts)
+	}
+
 	// Bare form: `hop get <id>` with no field argument.
 	if fieldArg == "" {
 		return runGetBare(cfg, stdout, conn, opts)
@@ -297,6 +328,74 @@ func runGetBare(cfg *config.Config, stdout io.Writer, conn *config.Connection, o
 	return err
 }
 
+// resolvedValue is one line of `hop get --resolved` output.
+type resolvedValue struct {
+	Field string `json:"field"`
+	Value any    `json:"value"`
+	From  string `json:"from"`
+}
+
+// resolvedValues lists every non-empty value of the flattened connection in
+// field order, tags and options one entry each, with its origin.
+func resolvedValues(cfg *config.Config, conn *config.Connection) []resolvedValue {
+	from := func(field string) string {
+		if origin := conn.Origin(field); origin != "" {
+			return origin
+		}
+		return "connection"
+	}
+
+	var values []resolvedValue
+	for _, name := range getFieldNames {
+		switch name {
+		case "tags":
+			for _, tag := range conn.Tags {
+				values = append(values, resolvedValue{"tags", tag, from("tags." + tag)})
+			}
+		case "options":
+			keys := make([]string, 0, len(conn.Options))
+			for k := range conn.Options {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				values = append(values, resolvedValue{"options." + k, conn.Options[k], from("options." + k)})
+			}
+		case "extends":
+			if len(conn.Extends) > 0 {
+				values = append(values, resolvedValue{"extends", strings.Join(conn.Extends, ", "), "connection"})
+			}
+		default:
+			if getFieldResolvers[name](cfg, conn) == "" {
+				continue
+			}
+			values = append(values, resolvedValue{name, getJSONValueResolvers[name](cfg, conn), from(name)})
+		}
+	}
+	return values
+}
+
+// runGetResolved prints the flattened connection as "field value origin"
+// lines, or as a JSON array of {field, value, from} objects with opts.JSON.
+func runGetResolved(cfg *config.Config, stdout io.Writer, conn *config.Connection, opts getOpts) error {
+	values := resolvedValues(cfg, conn)
+
+	if opts.JSON {
+		data, err := json.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("marshal connection: %w", err)
+		}
+		_, err = stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s\t%v\t%s\n", v.Field, v.Value, v.From)
+	}
+	return w.Flush()
+}
+
 // runGetPlain handles single and bulk-comma plain text output.
 func runGetPlain(cfg *config.Config, stdout io.Writer, conn *config.Connection, fields []string, opts getOpts) error {
 	values := make([]string, len(fields))
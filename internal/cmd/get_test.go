@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -293,6 +294,26 @@ func TestRunGet_SingleField_ID(t *testing.T) {
 	}
 }
 
+func TestRunGet_SingleField_Source(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.FindConnection("prod").Source = "/etc/hop/conf.d/team.yaml"
+	var stdout, stderr bytes.Buffer
+	if err := runGet(cfg, &stdout, &stderr, "prod", "source", getOpts{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := stdout.String(), "/etc/hop/conf.d/team.yaml\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	if err := runGet(cfg, &stdout, &stderr, "prod", "", getOpts{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "source /etc/hop/conf.d/team.yaml\n") {
+		t.Errorf("bare output missing source line:\n%s", stdout.String())
+	}
+}
+
 func TestRunGet_BulkComma(t *testing.T) {
 	cfg := newTestConfig()
 	var stdout, stderr bytes.Buffer
@@ -599,3 +620,77 @@ func TestMain(m *testing.M) {
 	_ = os.Getenv("USER")
 	os.Exit(m.Run())
 }
+
+func TestRunGet_Resolved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `version: 1
+defaults:
+  port: 22
+templates:
+  base:
+    user: deploy
+    tags: [managed]
+connections:
+  - id: app
+    host: app.example.com
+    extends: [base]
+    tags: [web]
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := runGet(cfg, &stdout, &stderr, "app", "", getOpts{Resolved: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Compare with column padding collapsed.
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	for _, want := range []string{
+		"host app.example.com connection",
+		"user deploy template base",
+		"port 22 defaults",
+		"tags managed template base",
+		"tags web connection",
+		"extends base connection",
+	} {
+		found := false
+		for _, line := range lines {
+			if line == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %q in:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if err := runGet(cfg, &stdout, &stderr, "app", "", getOpts{Resolved: true, JSON: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var values []resolvedValue
+	if err := json.Unmarshal(stdout.Bytes(), &values); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout.String())
+	}
+	found := false
+	for _, v := range values {
+		if v.Field == "user" && v.Value == "deploy" && v.From == "template base" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("JSON output missing user from template base: %s", stdout.String())
+	}
+
+	if err := runGet(cfg, &stdout, &stderr, "app", "host", getOpts{Resolved: true}); err == nil {
+		t.Error("expected error combining --resolved with a field")
+	}
+}
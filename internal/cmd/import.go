@@ -3,50 +3,125 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/importer"
 	"github.com/danmartuszewski/hop/internal/sshconfig"
 	"github.com/spf13/cobra"
 )
 
 var (
-	importFile   string
-	importDryRun bool
-	importYes    bool
+	importFile    string
+	importDryRun  bool
+	importYes     bool
+	importSync    bool
+	importPrune   bool
+	importManage  bool
+	importFrom    string
+	importColumns map[string]string
 )
 
 var importCmd = &cobra.Command{
 	Use:   "import",
-	Short: "Import connections from SSH config",
+	Short: "Import connections from SSH config and other inventories",
 	Long: `Import SSH connections from ~/.ssh/config into hop.
 
 By default, imports from ~/.ssh/config. Use --file to specify a different path.
+--from reads another format instead:
+  ssh-config   OpenSSH client config (default)
+  ansible      Ansible inventory, INI or YAML (default: /etc/ansible/hosts);
+               groups become hop groups
+  known-hosts  hosts ssh has connected to (default: ~/.ssh/known_hosts);
+               hashed entries are skipped
+  csv          CSV with a header row; --columns maps fields to headers hop
+               doesn't recognise, e.g. --columns host=Address,id=Label
+  putty        PuTTY sessions from "reg export" of
+               HKCU\Software\SimonTatham\PuTTY\Sessions
 
 Wildcard host patterns (*, ?) are automatically skipped.
-Existing connections with the same ID are renamed with -imported suffix.`,
+Existing connections with the same ID are renamed with -imported suffix.
+Imported connections are marked as managed by their SSH config host
+(ssh_config_host).
+
+With --sync, import updates hop instead of adding duplicates. Each host is
+matched to the connection it manages, else to one with the host's name as
+its ID, else to one with the same host, user and port. import then shows
+what is new, what changed field by field, and which managed connections
+are gone from the SSH config, and asks about each change. Values the SSH
+config doesn't set are left alone. Removed hosts are only deleted with
+--prune; --manage marks matched connections as managed, so later syncs
+can prune them too.
+
+Examples:
+  hop import                           # Add hosts from ~/.ssh/config
+  hop import --sync --dry-run          # Show what changed upstream
+  hop import --sync --manage           # Update, and adopt matching connections
+  hop import --sync --prune -y         # Apply everything, deleting removed hosts
+  hop import --from ansible -f inventory.ini
+  hop import --from csv -f servers.csv --columns host=Address`,
 	RunE: runImport,
 }
 
 func init() {
 	rootCmd.AddCommand(importCmd)
 
-	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "SSH config file path (default: ~/.ssh/config)")
+	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "File to import (default: ~/.ssh/config, or the format's usual location)")
+	importCmd.Flags().StringVar(&importFrom, "from", importer.DefaultFormat, "Format to import: "+strings.Join(importer.Names(), ", "))
+	importCmd.Flags().StringToStringVar(&importColumns, "columns", nil, "CSV column for each field, e.g. host=Address,id=Name")
 	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Preview imports without saving")
 	importCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "Skip confirmation prompt")
+	importCmd.Flags().BoolVar(&importSync, "sync", false, "Update existing connections instead of adding duplicates")
+	importCmd.Flags().BoolVar(&importPrune, "prune", false, "With --sync, delete managed connections whose host is gone")
+	importCmd.Flags().BoolVar(&importManage, "manage", false, "With --sync, mark matched connections as managed by the SSH config")
+
+	importCmd.RegisterFlagCompletionFunc("from", cobra.FixedCompletions(
+		importer.Names(), cobra.ShellCompDirectiveNoFileComp))
 }
 
 func runImport(cmd *cobra.Command, args []string) error {
-	// Parse SSH config
-	hosts, err := sshconfig.Parse(importFile)
+	if (importPrune || importManage) && !importSync {
+		return fmt.Errorf("--prune and --manage require --sync")
+	}
+	imp, err := importer.Lookup(importFrom)
+	if err != nil {
+		return err
+	}
+	if len(importColumns) > 0 && imp.Name() != "csv" {
+		return fmt.Errorf("--columns only applies to --from csv")
+	}
+
+	if importSync {
+		if imp.Name() != importer.DefaultFormat {
+			return fmt.Errorf("--sync only works with --from %s", importer.DefaultFormat)
+		}
+		hosts, err := sshconfig.Parse(importFile)
+		if err != nil {
+			return fmt.Errorf("failed to parse SSH config: %w", err)
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		return runImportSync(cfg.Connections, hosts)
+	}
+
+	res, err := imp.Import(importFile, importer.Options{Columns: importColumns})
 	if err != nil {
-		return fmt.Errorf("failed to parse SSH config: %w", err)
+		return fmt.Errorf("failed to import %s: %w", imp.Name(), err)
+	}
+	for _, s := range res.Skipped {
+		fmt.Printf("  Skipping %s\n", s)
 	}
 
-	if len(hosts) == 0 {
-		fmt.Println("No importable connections found in SSH config.")
-		fmt.Println("(Wildcard patterns like Host * are automatically skipped)")
+	if len(res.Connections) == 0 {
+		fmt.Println("No importable connections found.")
+		if imp.Name() == importer.DefaultFormat {
+			fmt.Println("(Wildcard patterns like Host * are automatically skipped)")
+		}
 		return nil
 	}
 
@@ -70,12 +145,11 @@ func runImport(cmd *cobra.Command, args []string) error {
 	}
 
 	var imports []importItem
-	for _, host := range hosts {
-		conn := host.ToConnection()
+	for _, conn := range res.Connections {
 		originalID := conn.ID
 
 		// Skip entries whose host/user/proxy-jump could be interpreted as an ssh
-		// option — an SSH config (or an Include'd file) is an untrusted source and
+		// option — an inventory (or an Include'd file) is an untrusted source and
 		// such a value would enable local command execution (CWE-88).
 		if err := conn.CheckSafety(); err != nil {
 			fmt.Printf("  Skipping %q: %v\n", originalID, err)
@@ -124,6 +198,19 @@ func runImport(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Println()
 
+	if len(res.Groups) > 0 {
+		names := make([]string, 0, len(res.Groups))
+		for name := range res.Groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println("Groups:")
+		for _, name := range names {
+			fmt.Printf("  %s (%d)\n", name, len(res.Groups[name]))
+		}
+		fmt.Println()
+	}
+
 	if importDryRun {
 		fmt.Println("(dry-run: no changes made)")
 		return nil
@@ -144,16 +231,223 @@ func runImport(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Add connections
-	for _, item := range imports {
-		cfg.AddConnection(item.connection)
+	// Add connections under the config lock, re-checking IDs against the
+	// current file in case another hop process changed it meanwhile.
+	_, err = config.Update(cfgFile, func(c *config.Config) error {
+		taken := make(map[string]bool)
+		for _, conn := range c.Connections {
+			taken[conn.ID] = true
+		}
+		added := make(map[string]string) // original ID -> ID it was added under
+		for _, item := range imports {
+			conn := item.connection
+			if taken[conn.ID] {
+				conn.ID = sshconfig.ResolveConflict(conn.ID, taken)
+			}
+			taken[conn.ID] = true
+			added[item.original] = conn.ID
+			c.AddConnection(conn)
+		}
+		importer.AddGroups(c, renameGroupMembers(res.Groups, added))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	// Save config
-	if err := cfg.Save(cfgFile); err != nil {
+	fmt.Printf("Successfully imported %d connection(s).\n", len(imports))
+	return nil
+}
+
+// renameGroupMembers maps imported group members to the IDs they were
+// added under, dropping members that weren't added.
+func renameGroupMembers(groups map[string][]string, added map[string]string) map[string][]string {
+	renamed := make(map[string][]string, len(groups))
+	for name, members := range groups {
+		for _, id := range members {
+			if newID, ok := added[id]; ok {
+				renamed[name] = append(renamed[name], newID)
+			}
+		}
+	}
+	return renamed
+}
+
+// runImportSync shows how the SSH config differs from the connections and
+// applies the changes the user accepts.
+func runImportSync(conns []config.Connection, hosts []sshconfig.ParsedHost) error {
+	plan := sshconfig.PlanImport(conns, hosts)
+	for _, s := range plan.Skipped {
+		fmt.Printf("  Skipping %q: %v\n", s.Alias, s.Err)
+	}
+
+	unmanaged := 0
+	if importManage {
+		for _, conn := range conns {
+			if _, ok := plan.Matched[conn.ID]; ok && conn.SSHConfigHost == "" {
+				unmanaged++
+			}
+		}
+	}
+
+	if plan.Empty() && unmanaged == 0 {
+		fmt.Println("Connections are in sync with the SSH config.")
+		return nil
+	}
+	printImportPlan(os.Stdout, &plan, importPrune)
+	if unmanaged > 0 {
+		fmt.Printf("%d matched connection(s) will be marked as managed by the SSH config.\n\n", unmanaged)
+	}
+
+	if importDryRun {
+		fmt.Println("(dry-run: no changes made)")
+		return nil
+	}
+
+	for i := range plan.Removed {
+		plan.Removed[i].Accept = importPrune
+	}
+	if !importYes {
+		if err := confirmImportPlan(bufio.NewReader(os.Stdin), os.Stdout, &plan, importPrune); err != nil {
+			return err
+		}
+	}
+	if !plan.Accepted() && unmanaged == 0 {
+		fmt.Println("Import cancelled.")
+		return nil
+	}
+
+	var res sshconfig.ImportResult
+	_, err := config.Update(cfgFile, func(c *config.Config) error {
+		res = plan.Apply(c, importManage)
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	fmt.Printf("Successfully imported %d connection(s).\n", len(imports))
+	fmt.Printf("Added %d, updated %d, removed %d connection(s).\n", res.Added, res.Updated, res.Removed)
+	if res.Marked > 0 {
+		fmt.Printf("Marked %d connection(s) as managed by the SSH config.\n", res.Marked)
+	}
+	return nil
+}
+
+// printImportPlan lists new hosts, changed fields and removed hosts.
+func printImportPlan(w io.Writer, plan *sshconfig.ImportPlan, prune bool) {
+	if len(plan.New) > 0 {
+		fmt.Fprintf(w, "New (%d):\n", len(plan.New))
+		for _, ch := range plan.New {
+			id := ch.ID
+			if ch.ID != ch.Alias {
+				id = fmt.Sprintf("%s -> %s (renamed, original ID exists)", ch.Alias, ch.ID)
+			}
+			fmt.Fprintf(w, "  + %s  %s\n", id, importTarget(&ch.Connection))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(plan.Changed) > 0 {
+		fmt.Fprintf(w, "Changed (%d):\n", len(plan.Changed))
+		for _, ch := range plan.Changed {
+			if ch.ID != ch.Alias {
+				fmt.Fprintf(w, "  ~ %s (from %s)\n", ch.ID, ch.Alias)
+			} else {
+				fmt.Fprintf(w, "  ~ %s\n", ch.ID)
+			}
+			for _, f := range ch.Fields {
+				fmt.Fprintf(w, "      %s: %s -> %s\n", f.Field, unsetIfEmpty(f.Old), unsetIfEmpty(f.New))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	if len(plan.Removed) > 0 {
+		fmt.Fprintf(w, "Removed from the SSH config (%d):\n", len(plan.Removed))
+		for _, ch := range plan.Removed {
+			fmt.Fprintf(w, "  - %s\n", ch.ID)
+		}
+		if !prune {
+			fmt.Fprintln(w, "  (kept; use --prune to delete them)")
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// confirmImportPlan asks whether to add the new hosts, about each changed
+// field and, with prune, whether to delete the removed hosts.
+func confirmImportPlan(r *bufio.Reader, w io.Writer, plan *sshconfig.ImportPlan, prune bool) error {
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(w, prompt)
+		response, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || response == "") {
+			return "", err
+		}
+		return strings.ToLower(strings.TrimSpace(response)), nil
+	}
+	yes := func(response string) bool {
+		return response == "y" || response == "yes"
+	}
+
+	if len(plan.New) > 0 {
+		response, err := ask(fmt.Sprintf("Add %d new connection(s)? [y/N] ", len(plan.New)))
+		if err != nil {
+			return err
+		}
+		for i := range plan.New {
+			plan.New[i].Accept = yes(response)
+		}
+	}
+
+	// a accepts the rest of the updates, q declines them.
+	rest := ""
+	for i := range plan.Changed {
+		ch := &plan.Changed[i]
+		for j := range ch.Fields {
+			f := &ch.Fields[j]
+			if rest != "" {
+				f.Accept = rest == "a"
+				continue
+			}
+			response, err := ask(fmt.Sprintf("Update %s %s: %s -> %s? [y/n/a/q] ",
+				ch.ID, f.Field, unsetIfEmpty(f.Old), unsetIfEmpty(f.New)))
+			if err != nil {
+				return err
+			}
+			switch response {
+			case "a", "all":
+				rest = "a"
+			case "q", "quit":
+				rest = "q"
+			}
+			f.Accept = yes(response) || rest == "a"
+		}
+	}
+
+	if prune && len(plan.Removed) > 0 {
+		response, err := ask(fmt.Sprintf("Delete %d connection(s) removed from the SSH config? [y/N] ", len(plan.Removed)))
+		if err != nil {
+			return err
+		}
+		for i := range plan.Removed {
+			plan.Removed[i].Accept = yes(response)
+		}
+	}
 	return nil
 }
+
+func importTarget(conn *config.Connection) string {
+	target := conn.Host
+	if conn.User != "" {
+		target = conn.User + "@" + target
+	}
+	if conn.Port != 0 && conn.Port != 22 {
+		target += fmt.Sprintf(":%d", conn.Port)
+	}
+	return target
+}
+
+func unsetIfEmpty(s string) string {
+	if s == "" {
+		return "(unset)"
+	}
+	return s
+}
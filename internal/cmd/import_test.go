@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+)
+
+func TestConfirmImportPlan(t *testing.T) {
+	existing := []config.Connection{
+		{ID: "web", Host: "10.0.0.1", Port: 22},
+		{ID: "db", Host: "10.0.0.2", Port: 22},
+		{ID: "old", Host: "10.0.0.9", SSHConfigHost: "old"},
+	}
+	hosts := []sshconfig.ParsedHost{
+		{Alias: "web", HostName: "10.0.0.1", User: "deploy", Port: 2222},
+		{Alias: "db", HostName: "10.0.0.2", User: "admin", ProxyJump: "bastion"},
+		{Alias: "cache", HostName: "10.0.0.3"},
+	}
+	plan := sshconfig.PlanImport(existing, hosts)
+
+	// Add the new host; decline web's user, accept the rest with a; prune.
+	answers := "y\nn\na\ny\n"
+	if err := confirmImportPlan(bufio.NewReader(strings.NewReader(answers)), io.Discard, &plan, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.New[0].Accept {
+		t.Error("new host not accepted")
+	}
+	var got []string
+	for _, ch := range plan.Changed {
+		for _, f := range ch.Fields {
+			if f.Accept {
+				got = append(got, ch.ID+"."+f.Field)
+			}
+		}
+	}
+	if want := "web.port db.user db.proxy_jump"; strings.Join(got, " ") != want {
+		t.Errorf("accepted fields = %v, want %s", got, want)
+	}
+	if !plan.Removed[0].Accept {
+		t.Error("removal not accepted")
+	}
+}
+
+func TestPrintImportPlan(t *testing.T) {
+	plan := sshconfig.PlanImport(
+		[]config.Connection{{ID: "old", Host: "10.0.0.9", SSHConfigHost: "old"}},
+		[]sshconfig.ParsedHost{{Alias: "cache", HostName: "10.0.0.3", User: "ops"}},
+	)
+	var b strings.Builder
+	printImportPlan(&b, &plan, false)
+	for _, want := range []string{"+ cache  ops@10.0.0.3", "- old", "use --prune"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Show and refresh dynamic inventories",
+	Long: `Inventories are commands that print connections as JSON, in the shape of
+hop list --json or with the config's keys (proxy_jump, identity_file, ...).
+Entries with unknown keys are skipped. They are listed under inventories:
+in the config:
+
+  inventories:
+    - name: aws
+      command: ~/bin/hop-aws-inventory
+      args: [--region, eu-west-1]
+      ttl: 10m
+
+Their connections are merged into every command, the dashboard and the MCP
+server, labelled with the inventory as their source. They are read-only:
+they come back from the next run, so they can't be edited or deleted.
+Output is cached next to the config for the inventory's ttl (default 5m).
+When a command fails, the last cached output is used.
+
+Examples:
+  hop inventory              # Show each inventory's state
+  hop inventory refresh      # Run every inventory now
+  hop inventory refresh aws  # Run one inventory now`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if len(cfg.Inventories) == 0 {
+			fmt.Println("No inventories configured.")
+			return nil
+		}
+		return printInventories(os.Stdout, cfg.InventoryStatuses(), time.Now())
+	},
+}
+
+var inventoryRefreshCmd = &cobra.Command{
+	Use:   "refresh [name...]",
+	Short: "Run inventory commands now, ignoring their cache",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := cfg.RefreshInventories(args...); err != nil {
+			return err
+		}
+
+		named := make(map[string]bool)
+		for _, name := range args {
+			named[name] = true
+		}
+		failed := 0
+		for _, st := range cfg.InventoryStatuses() {
+			if len(named) > 0 && !named[st.Name] {
+				continue
+			}
+			if st.Err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", st.Name, st.Err)
+				continue
+			}
+			if !quiet {
+				fmt.Printf("✓ %s: %d connection(s)\n", st.Name, st.Connections)
+			}
+			if verbose {
+				for _, s := range st.Skipped {
+					fmt.Printf("  skipped %s\n", s)
+				}
+			}
+		}
+		if failed > 0 {
+			return silent(fmt.Errorf("%d inventory(s) failed", failed))
+		}
+		return nil
+	},
+	ValidArgsFunction: inventoryNameCompletion,
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.AddCommand(inventoryRefreshCmd)
+}
+
+// printInventories writes one line per inventory: its connection count,
+// the age of the output in use and any error or skipped entries.
+func printInventories(out io.Writer, statuses []config.InventoryStatus, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tCONNECTIONS\tFETCHED\tSTATUS\n")
+	for _, st := range statuses {
+		fetched := "never"
+		if !st.Fetched.IsZero() {
+			fetched = now.Sub(st.Fetched).Truncate(time.Second).String() + " ago"
+		}
+		status := "ok"
+		switch {
+		case st.Err != nil:
+			status = "error: " + st.Err.Error()
+		case len(st.Skipped) > 0:
+			status = fmt.Sprintf("%d skipped", len(st.Skipped))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", st.Name, st.Connections, fetched, status)
+	}
+	return w.Flush()
+}
+
+func inventoryNameCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	given := make(map[string]bool)
+	for _, name := range args {
+		given[name] = true
+	}
+	var names []string
+	for _, inv := range cfg.Inventories {
+		if !given[inv.Name] {
+			names = append(names, inv.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestPrintInventories(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	statuses := []config.InventoryStatus{
+		{Name: "aws", Connections: 12, Fetched: now.Add(-90 * time.Second)},
+		{Name: "gcp", Connections: 3, Fetched: now.Add(-time.Hour), Err: errors.New("gcloud: exit status 1")},
+		{Name: "lab", Skipped: []string{"x: no host"}},
+	}
+	var buf bytes.Buffer
+	if err := printInventories(&buf, statuses, now); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("output:\n%s", buf.String())
+	}
+	for i, want := range []string{
+		"aws 12 1m30s ago ok",
+		"gcp 3 1h0m0s ago error: gcloud: exit status 1",
+		"lab 0 never 1 skipped",
+	} {
+		if got := strings.Join(strings.Fields(lines[i+1]), " "); got != want {
+			t.Errorf("row %d = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/fuzzy"
+	"github.com/danmartuszewski/hop/internal/resolve"
+	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	muxTag      string
+	muxParallel int
+)
+
+var muxCmd = &cobra.Command{
+	Use:   "mux",
+	Short: "Manage shared ssh master connections",
+	Long: `Manage the ssh master connections (ControlMaster) hop keeps for
+connections with multiplex enabled.
+
+With multiplex: true (per connection or under defaults), the first ssh to a
+host opens a master connection that stays up for ` + ssh.DefaultControlPersist + ` after the
+last session; later connects, hop exec runs and tabs reuse it and skip the
+handshake. Sockets live in a private hop runtime directory.`,
+}
+
+var muxStatusCmd = &cobra.Command{
+	Use:   "status [target]",
+	Short: "List live master connections",
+	Long: `List the master connection state of multiplexed connections matching
+target (all multiplexed connections when omitted).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conns, err := muxConnections(args)
+		if err != nil {
+			return err
+		}
+		masters := make([]ssh.MuxMaster, len(conns))
+		for i := range conns {
+			masters[i] = ssh.CheckMaster(&conns[i])
+		}
+		return printMuxStatus(os.Stdout, masters)
+	},
+	ValidArgsFunction: muxArgsCompletion,
+}
+
+var muxStopCmd = &cobra.Command{
+	Use:   "stop [target]",
+	Short: "Close master connections",
+	Long: `Close the master connections of multiplexed connections matching target
+(all of them when omitted). Sessions still using a master are closed too.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conns, err := muxConnections(args)
+		if err != nil {
+			return err
+		}
+		stopped, failed := 0, 0
+		for i := range conns {
+			ok, err := ssh.StopMaster(&conns[i])
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "%s: %v\n", conns[i].ID, err)
+				failed++
+			case ok:
+				fmt.Printf("Stopped %s\n", conns[i].ID)
+				stopped++
+			}
+		}
+		if !quiet && stopped == 0 && failed == 0 {
+			fmt.Fprintln(os.Stderr, "No master connections running.")
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to stop %d master(s)", failed)
+		}
+		return nil
+	},
+	ValidArgsFunction: muxArgsCompletion,
+}
+
+var muxWarmCmd = &cobra.Command{
+	Use:   "warm <target>",
+	Short: "Open master connections ahead of time",
+	Long: `Open master connections for the multiplexed connections matching target,
+so the next connect or hop exec starts without a handshake. Target is
+resolved like hop exec.`,
+	Args:              cobra.ExactArgs(1),
+	RunE:              runMuxWarm,
+	ValidArgsFunction: muxArgsCompletion,
+}
+
+func init() {
+	rootCmd.AddCommand(muxCmd)
+	muxCmd.AddCommand(muxStatusCmd, muxStopCmd, muxWarmCmd)
+
+	for _, c := range []*cobra.Command{muxStatusCmd, muxStopCmd, muxWarmCmd} {
+		c.Flags().StringVar(&muxTag, "tag", "", "filter connections by tag")
+	}
+	muxWarmCmd.Flags().IntVar(&muxParallel, "parallel", 10, "maximum parallel connections")
+}
+
+func muxArgsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) >= 1 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return getConnectionCompletions(toComplete)
+}
+
+// muxConnections resolves the optional target argument to the multiplexed
+// connections it matches.
+func muxConnections(args []string) ([]config.Connection, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conns := cfg.Connections
+	if len(args) > 0 {
+		result, err := resolve.ResolveTarget(args[0], cfg)
+		if err != nil {
+			return nil, err
+		}
+		conns = result.Connections
+	}
+	if muxTag != "" {
+		conns = fuzzy.MatchByTag(muxTag, conns)
+	}
+
+	var out []config.Connection
+	for _, c := range conns {
+		if c.Multiplexed() {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("no connections matching '%s' have multiplex enabled", args[0])
+		}
+		return nil, fmt.Errorf("no connections have multiplex enabled (set multiplex: true on a connection or under defaults)")
+	}
+	return out, nil
+}
+
+func runMuxWarm(cmd *cobra.Command, args []string) error {
+	conns, err := muxConnections(args)
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Opening master connections to %d server(s)...\n", len(conns))
+	}
+	results := ssh.Execute(conns, &ssh.ExecOptions{
+		Command:  "true",
+		Parallel: muxParallel,
+	})
+
+	for _, r := range results {
+		if r.Error != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Connection.ID, r.Error)
+			continue
+		}
+		fmt.Printf("Warmed %s (%s)\n", r.Connection.ID, r.Duration.Round(time.Millisecond))
+	}
+	if n := ssh.CountErrors(results); n > 0 {
+		return fmt.Errorf("failed to open %d of %d master(s)", n, len(results))
+	}
+	return nil
+}
+
+func printMuxStatus(w io.Writer, masters []ssh.MuxMaster) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tPID\tSOCKET")
+	for _, m := range masters {
+		status, pid := "stopped", "-"
+		if m.Running {
+			status = "running"
+			if m.PID > 0 {
+				pid = strconv.Itoa(m.PID)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Connection.ID, status, pid, m.Path)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+func TestPrintMuxStatus(t *testing.T) {
+	masters := []ssh.MuxMaster{
+		{Connection: &config.Connection{ID: "web1"}, Path: "/run/hop/aa", Running: true, PID: 4242},
+		{Connection: &config.Connection{ID: "web2"}, Path: "/run/hop/bb"},
+	}
+	var buf bytes.Buffer
+	if err := printMuxStatus(&buf, masters); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := [][]string{
+		{"ID", "STATUS", "PID", "SOCKET"},
+		{"web1", "running", "4242", "/run/hop/aa"},
+		{"web2", "stopped", "-", "/run/hop/bb"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
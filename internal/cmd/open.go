@@ -223,6 +223,8 @@ func openTabs(connections []config.Connection, terminal ssh.TerminalType, remote
 		if err := terminal.OpenNewTab(cmdStr); err != nil {
 			return fmt.Errorf("failed to open tab for %s: %w", conn.ID, err)
 		}
+		// The session runs in another terminal, so its exit status is unknown.
+		recordUsage(config.Usage{ID: conn.ID, Kind: config.UsageTab})
 
 		// Add delay between tabs (except for the last one)
 		if i < len(connections)-1 && openDelay > 0 {
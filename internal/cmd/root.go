@@ -58,16 +58,19 @@ func Execute() error {
 	rootCmd.InitDefaultHelpCmd()
 	err := rootCmd.Execute()
 	if err != nil {
+		// A silent error comes from a command that ran and already reported
+		// its failure, even when a flag precedes the command name.
+		var s silentErr
+		if errors.As(err, &s) {
+			os.Exit(1)
+		}
 		// Check if this was an unknown command error - if so, treat the
 		// original os.Args as a quick-connect query
 		args := os.Args[1:]
 		if len(args) > 0 && !isKnownCommand(args[0]) {
 			return runQuickConnect(rootCmd, args)
 		}
-		var s silentErr
-		if !errors.As(err, &s) {
-			fmt.Fprintln(os.Stderr, err)
-		}
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	return nil
@@ -88,7 +91,7 @@ func runDashboard() error {
 		return err
 	}
 
-	return tui.Run(cfg, Version)
+	return tui.Run(cfg, Version, cfgFile)
 }
 
 func init() {
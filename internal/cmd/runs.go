@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/runs"
+	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runsLimit      int
+	runsShowOutput string
+	runsFailedOnly bool
+)
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List, inspect and re-run past hop exec runs",
+	Long: `Every hop exec run is stored under ~/.config/hop/runs: the target, the
+hosts it resolved to, the command, who ran it, and each host's output, exit
+code and timing. The newest 200 runs are kept.
+
+Run IDs can be shortened to any unique prefix.
+
+Examples:
+  hop runs ls
+  hop runs show 20260102-150405-ab12
+  hop runs rerun 20260102-150405-ab12 --failed-only`,
+}
+
+var runsLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List stored runs, newest first",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := runs.List()
+		if err != nil {
+			return err
+		}
+		if runsLimit > 0 && len(list) > runsLimit {
+			list = list[:runsLimit]
+		}
+		return printRuns(os.Stdout, list)
+	},
+}
+
+var runsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a run's details and per-host results",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		run, err := runs.Load(args[0])
+		if err != nil {
+			return err
+		}
+		format, err := ssh.ParseOutputFormat(runsShowOutput)
+		if err != nil {
+			return err
+		}
+		if format == ssh.OutputText {
+			if err := printRunHeader(os.Stdout, run); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		if format == ssh.OutputNDJSON {
+			for _, r := range run.ExecResults() {
+				if err := ssh.WriteNDJSON(os.Stdout, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// Runs stored before the transport was recorded used ssh.
+		transport, _ := ssh.ParseTransport(run.Transport)
+		return writeExecOutput(os.Stdout, format, run.Label(), run.Started, transport, run.ExecResults())
+	},
+	ValidArgsFunction: runIDCompletions,
+}
+
+var runsRerunCmd = &cobra.Command{
+	Use:   "rerun <id>",
+	Short: "Run a stored run's command again on the same hosts",
+	Long: `Run a stored run's command again on the hosts it ran on, looked up by ID
+in the current config. With --failed-only, only hosts that failed or were
+skipped are run. The new run is stored too and records which run it
+repeats.
+
+The transport is the original run's unless --transport is given; other
+exec flags take their usual defaults. Input sent with --stdin isn't
+stored, so rerunning such a run needs --stdin and the input again.`,
+	Args:              cobra.ExactArgs(1),
+	RunE:              runRerun,
+	ValidArgsFunction: runIDCompletions,
+}
+
+func init() {
+	rootCmd.AddCommand(runsCmd)
+	runsCmd.AddCommand(runsLsCmd, runsShowCmd, runsRerunCmd)
+
+	runsLsCmd.Flags().IntVarP(&runsLimit, "limit", "n", 20, "number of runs to list (0 for all)")
+	runsShowCmd.Flags().StringVarP(&runsShowOutput, "output", "o", "text", "output format: text, table, json, ndjson or junit")
+
+	f := runsRerunCmd.Flags()
+	f.BoolVar(&runsFailedOnly, "failed-only", false, "only run hosts that failed or were skipped")
+	f.IntVar(&execParallel, "parallel", 10, "maximum parallel connections")
+	f.StringVar(&execTimeout, "timeout", "", "command timeout (e.g., 30s, 5m)")
+	f.BoolVar(&execFailFast, "fail-fast", false, "stop on first error")
+	f.BoolVar(&execStream, "stream", false, "stream output in real-time with host prefixes")
+	f.StringVar(&execTransport, "transport", "ssh", "how to connect: ssh (run the ssh binary) or native (built-in client)")
+	f.StringVarP(&execOutput, "output", "o", "text", "output format: text, table, json, ndjson or junit")
+	f.BoolVar(&execStdin, "stdin", false, "send hop's standard input to the command on every host")
+	f.BoolVar(&execTUI, "tui", false, "follow the run in an interactive view with live per-host status and output")
+}
+
+func runRerun(cmd *cobra.Command, args []string) error {
+	prev, err := runs.Load(args[0])
+	if err != nil {
+		return err
+	}
+	ids := prev.Hosts
+	if runsFailedOnly {
+		ids = prev.FailedHosts()
+		if len(ids) == 0 {
+			fmt.Fprintf(os.Stderr, "No hosts failed in run %s.\n", prev.ID)
+			return nil
+		}
+	}
+	if prev.Stdin && !execStdin {
+		return fmt.Errorf("run %s read its input from stdin, which isn't stored; pipe it in again and pass --stdin", prev.ID)
+	}
+	if !cmd.Flags().Changed("transport") && prev.Transport != "" {
+		execTransport = prev.Transport
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	connections, missing := rerunConnections(cfg, ids)
+	for _, id := range missing {
+		fmt.Fprintf(os.Stderr, "warning: skipping %s: no longer in config\n", id)
+	}
+	if len(connections) == 0 {
+		return fmt.Errorf("none of the hosts of run %s are in the config", prev.ID)
+	}
+
+	run := runs.New(runs.SourceCLI, prev.Target, prev.Command, connections)
+	run.Tag = prev.Tag
+	run.Script = prev.Script
+	run.RerunOf = prev.ID
+	return execOn(cfg, connections, prev.Command, run)
+}
+
+// rerunConnections looks up ids in cfg, returning the connections found
+// and the IDs that no longer exist.
+func rerunConnections(cfg *config.Config, ids []string) ([]config.Connection, []string) {
+	var conns []config.Connection
+	var missing []string
+	for _, id := range ids {
+		if c := cfg.FindConnection(id); c != nil {
+			conns = append(conns, *c)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return conns, missing
+}
+
+func printRuns(w io.Writer, list []*runs.Run) error {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "No runs stored yet.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTARTED\tTARGET\tHOSTS\tFAILED\tDURATION\tCOMMAND")
+	for _, r := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			r.ID,
+			r.Started.Local().Format("2006-01-02 15:04:05"),
+			r.Target,
+			len(r.Hosts),
+			r.Failed,
+			runDuration(r),
+			truncateCommand(r.Label(), 50),
+		)
+	}
+	return tw.Flush()
+}
+
+func printRunHeader(w io.Writer, r *runs.Run) error {
+	target := r.Target
+	if r.Tag != "" {
+		target += " (tag " + r.Tag + ")"
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "Run:\t%s\n", r.ID)
+	if r.RerunOf != "" {
+		fmt.Fprintf(tw, "Rerun of:\t%s\n", r.RerunOf)
+	}
+	fmt.Fprintf(tw, "Command:\t%s\n", r.Label())
+	if r.Stdin {
+		fmt.Fprintf(tw, "Stdin:\tyes (not stored)\n")
+	}
+	fmt.Fprintf(tw, "Target:\t%s\n", target)
+	fmt.Fprintf(tw, "Hosts:\t%s\n", strings.Join(r.Hosts, ", "))
+	fmt.Fprintf(tw, "By:\t%s (%s)\n", r.User, r.Source)
+	fmt.Fprintf(tw, "Started:\t%s\n", r.Started.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(tw, "Duration:\t%s\n", runDuration(r))
+	if r.Transport != "" {
+		fmt.Fprintf(tw, "Transport:\t%s\n", r.Transport)
+	}
+	fmt.Fprintf(tw, "Failed:\t%d of %d\n", r.Failed, len(r.Results))
+	return tw.Flush()
+}
+
+func runDuration(r *runs.Run) string {
+	return (time.Duration(r.DurationMS) * time.Millisecond).Round(time.Millisecond).String()
+}
+
+// truncateCommand shortens a command to max runes for one-line listings.
+func truncateCommand(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+func runIDCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) >= 1 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	list, _ := runs.List()
+	var ids []string
+	for _, r := range list {
+		if strings.HasPrefix(r.ID, toComplete) {
+			ids = append(ids, r.ID+"\t"+truncateCommand(r.Label(), 40))
+		}
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
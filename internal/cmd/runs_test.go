@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/runs"
+)
+
+func TestPrintRuns(t *testing.T) {
+	list := []*runs.Run{{
+		ID:         "20260102-150405-ab12",
+		Target:     "web",
+		Command:    "systemctl   restart\n nginx",
+		Hosts:      []string{"web1", "web2"},
+		Failed:     1,
+		Started:    time.Date(2026, 1, 2, 15, 4, 5, 0, time.Local),
+		DurationMS: 1500,
+	}}
+	var buf bytes.Buffer
+	if err := printRuns(&buf, list); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output:\n%s", buf.String())
+	}
+	want := []string{"20260102-150405-ab12", "2026-01-02", "15:04:05", "web", "2", "1", "1.5s", "systemctl", "restart", "nginx"}
+	if got := strings.Fields(lines[1]); !reflect.DeepEqual(got, want) {
+		t.Errorf("row = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	printRuns(&buf, nil)
+	if !strings.Contains(buf.String(), "No runs") {
+		t.Errorf("empty list output = %q", buf.String())
+	}
+}
+
+func TestRerunConnections(t *testing.T) {
+	cfg := &config.Config{Connections: []config.Connection{{ID: "web1"}, {ID: "web3"}}}
+	conns, missing := rerunConnections(cfg, []string{"web1", "web2", "web3"})
+	if len(conns) != 2 || conns[0].ID != "web1" || conns[1].ID != "web3" {
+		t.Errorf("connections = %v", conns)
+	}
+	if !reflect.DeepEqual(missing, []string{"web2"}) {
+		t.Errorf("missing = %v", missing)
+	}
+}
+
+func TestTruncateCommand(t *testing.T) {
+	if got := truncateCommand("echo  héllo\nworld", 10); got != "echo héll…" {
+		t.Errorf("truncateCommand = %q", got)
+	}
+	if got := truncateCommand("uptime", 10); got != "uptime" {
+		t.Errorf("truncateCommand = %q", got)
+	}
+}
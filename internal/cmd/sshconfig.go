@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sshconfigFile        string
+	sshconfigConfigD     bool
+	sshconfigRemove      bool
+	sshconfigNoRemoteDir bool
+	sshconfigDryRun      bool
+	sshconfigYes         bool
+)
+
+var sshconfigCmd = &cobra.Command{
+	Use:   "sshconfig",
+	Short: "Keep ~/.ssh/config in step with hop",
+	Long: `Write hop's connections to your SSH config, so plain ssh, scp, rsync,
+VS Code Remote and Ansible reach hosts by the same names.`,
+}
+
+var sshconfigSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Write hop's connections to a managed section of ~/.ssh/config",
+	Long: `Write a Host block for every hop connection to your SSH config.
+
+The blocks go in a section between "# BEGIN hop" and "# END hop" that hop
+owns: sync replaces it and leaves the rest of the file alone. A new section
+is added before the first Host or Match block, so "Host *" defaults at the
+end of the file don't override it. With --config-d the section is written
+to ~/.ssh/config.d/hop.conf instead; ~/.ssh/config needs an Include for it,
+and sync says so if it is missing.
+
+Each block sets HostName, User, Port, IdentityFile, ProxyJump, ForwardAgent,
+the shared master of multiplexed connections and the connection's options.
+A remote_dir becomes a RemoteCommand with RequestTTY, like hop connect;
+because ssh then refuses command lines and scp for that host (unless given
+-o RemoteCommand=none), --no-remote-dir leaves it out. Connections whose ID
+has spaces or pattern characters are skipped. hop import ignores the
+section, so hosts don't come back as duplicates.
+
+sync shows a diff of the change and asks before writing.
+
+Examples:
+  hop sshconfig sync --dry-run     # Show what would change
+  hop sshconfig sync               # Update ~/.ssh/config
+  hop sshconfig sync --config-d -y # Write ~/.ssh/config.d/hop.conf
+  hop sshconfig sync --remove      # Take the section out again`,
+	Args: cobra.NoArgs,
+	RunE: runSSHConfigSync,
+}
+
+func init() {
+	rootCmd.AddCommand(sshconfigCmd)
+	sshconfigCmd.AddCommand(sshconfigSyncCmd)
+
+	sshconfigSyncCmd.Flags().StringVarP(&sshconfigFile, "file", "f", "", "SSH config file to write (default: ~/.ssh/config)")
+	sshconfigSyncCmd.Flags().BoolVar(&sshconfigConfigD, "config-d", false, "write ~/.ssh/config.d/hop.conf instead of a section of ~/.ssh/config")
+	sshconfigSyncCmd.Flags().BoolVar(&sshconfigRemove, "remove", false, "remove the hop section")
+	sshconfigSyncCmd.Flags().BoolVar(&sshconfigNoRemoteDir, "no-remote-dir", false, "don't turn remote_dir into a RemoteCommand")
+	sshconfigSyncCmd.Flags().BoolVar(&sshconfigDryRun, "dry-run", false, "show the diff without writing")
+	sshconfigSyncCmd.Flags().BoolVarP(&sshconfigYes, "yes", "y", false, "skip confirmation prompt")
+	sshconfigSyncCmd.MarkFlagsMutuallyExclusive("file", "config-d")
+}
+
+func runSSHConfigSync(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	path := sshconfigFile
+	if sshconfigConfigD {
+		path = sshconfig.ConfigDPath()
+	} else if path == "" {
+		path = sshconfig.DefaultPath()
+	}
+	if path == "" {
+		return fmt.Errorf("cannot determine the SSH config path")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	before := string(data)
+
+	block := ""
+	if !sshconfigRemove {
+		var skipped []string
+		block, skipped = sshconfig.ManagedBlock(cfg.Connections, sshconfig.WriteOptions{SkipRemoteDir: sshconfigNoRemoteDir})
+		for _, id := range skipped {
+			fmt.Fprintf(os.Stderr, "Skipping %q: not usable as an SSH Host alias\n", id)
+		}
+	}
+
+	var after string
+	if sshconfigConfigD {
+		// The whole file is hop's.
+		after = block
+	} else if after, err = sshconfig.ReplaceManaged(before, block); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if after == before {
+		fmt.Printf("%s is up to date.\n", path)
+	} else {
+		printSSHConfigDiff(os.Stdout, path, before, after)
+		if sshconfigDryRun {
+			fmt.Println("(dry-run: no changes made)")
+			return nil
+		}
+		if !sshconfigYes {
+			fmt.Printf("Write these changes to %s? [y/N] ", path)
+			reader := bufio.NewReader(os.Stdin)
+			response, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			response = strings.ToLower(strings.TrimSpace(response))
+			if response != "y" && response != "yes" {
+				fmt.Println("Sync cancelled.")
+				return nil
+			}
+		}
+		if sshconfigConfigD && after == "" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else if err := sshconfig.WriteFile(path, after); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Printf("Updated %s.\n", path)
+	}
+
+	if sshconfigConfigD && !sshconfigRemove {
+		main := sshconfig.DefaultPath()
+		if ok, err := sshconfig.Includes(main, path); err == nil && !ok {
+			fmt.Fprintf(os.Stderr, "Note: %s doesn't include %s yet. Add this line at the top of it:\n  Include config.d/*.conf\n", main, path)
+		}
+	}
+	return nil
+}
+
+func printSSHConfigDiff(w io.Writer, path, before, after string) {
+	fmt.Fprint(w, udiff.Unified(path, path+" (synced)", before, after))
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/fuzzy"
+	"github.com/danmartuszewski/hop/internal/health"
+	"github.com/danmartuszewski/hop/internal/resolve"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusJSON     bool
+	statusSummary  bool
+	statusTimeout  time.Duration
+	statusParallel int
+	statusTag      string
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [target]",
+	Short: "Check which connections are reachable",
+	Long: `Check whether each connection's SSH server answers, without logging in
+to it.
+
+hop connects to the SSH port and waits for the server's banner. Hosts
+behind a proxy_jump are checked through it with "ssh -W", which logs in to
+the jump host (or reuses its shared master) and reads ~/.ssh/config. There
+a port that answers without a banner shows as unreachable. STATUS is one of:
+  reachable    an SSH server answered; BANNER shows its version
+  port_open    the port accepts connections but no SSH banner came back
+  unreachable  the connection failed; ERROR says why
+
+RTT is how long the TCP connect took. Without a target every connection is
+checked; targets resolve as for hop exec.
+
+hop status exits 0 when every host is reachable and 1 otherwise, so it can
+gate scripts and cron jobs. --summary prints one line of counts plus the
+hosts that aren't reachable; with --quiet nothing is printed unless JSON is
+asked for.
+
+Examples:
+  hop status
+  hop status production
+  hop status "web*" --json
+  hop status prod --summary --timeout 5s
+  hop status prod -q || notify "prod hosts down"`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStatus,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= 1 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return getConnectionCompletions(toComplete)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "output as JSON")
+	statusCmd.Flags().BoolVar(&statusSummary, "summary", false, "print only counts and the hosts that aren't reachable")
+	statusCmd.Flags().DurationVar(&statusTimeout, "timeout", health.DefaultTimeout, "how long to wait for each connect and banner")
+	statusCmd.Flags().IntVar(&statusParallel, "parallel", health.DefaultParallel, "maximum hosts checked at once")
+	statusCmd.Flags().StringVar(&statusTag, "tag", "", "filter connections by tag")
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	conns := cfg.Connections
+	if len(args) > 0 {
+		result, err := resolve.ResolveTarget(args[0], cfg)
+		if err != nil {
+			return err
+		}
+		conns = result.Connections
+	}
+	if statusTag != "" {
+		conns = fuzzy.MatchByTag(statusTag, conns)
+		if len(conns) == 0 {
+			return fmt.Errorf("no connections found with tag '%s'", statusTag)
+		}
+	}
+	if len(conns) == 0 {
+		if len(args) > 0 {
+			return fmt.Errorf("no connections matching '%s'", args[0])
+		}
+		return fmt.Errorf("no connections configured")
+	}
+
+	results := health.CheckAll(context.Background(), conns, statusTimeout, statusParallel)
+	records := make([]health.Record, len(conns))
+	for i := range conns {
+		records[i] = health.NewRecord(&conns[i], results[i])
+	}
+
+	switch {
+	case statusJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(records)
+	case quiet:
+	case statusSummary:
+		err = printStatusSummary(os.Stdout, records)
+	default:
+		err = printStatus(os.Stdout, records)
+	}
+	if err != nil {
+		return err
+	}
+
+	if sum := health.Summarize(records); sum.Down() > 0 {
+		err := fmt.Errorf("%d of %d host(s) not reachable", sum.Down(), sum.Checked)
+		if quiet || statusSummary {
+			return silent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+func printStatus(w io.Writer, records []health.Record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tHOST\tSTATUS\tRTT\tBANNER\tVIA\tERROR\n")
+	for _, r := range records {
+		rtt := "-"
+		if r.RTTMS > 0 {
+			rtt = fmt.Sprintf("%.1fms", r.RTTMS)
+		}
+		fmt.Fprintf(tw, "%s\t%s:%d\t%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Host, r.Port, r.Status, rtt, dashIfEmpty(r.Banner), dashIfEmpty(r.Via), r.Error)
+	}
+	return tw.Flush()
+}
+
+// printStatusSummary prints the counts, then a line for each host that
+// isn't reachable.
+func printStatusSummary(w io.Writer, records []health.Record) error {
+	fmt.Fprintln(w, health.Summarize(records))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range records {
+		if r.Status != health.StatusReachable.String() {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", r.ID, r.Status, r.Error)
+		}
+	}
+	return tw.Flush()
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/health"
+)
+
+func TestPrintStatus(t *testing.T) {
+	records := []health.Record{
+		{ID: "web1", Host: "web1.example.com", Port: 22, Status: "reachable", RTTMS: 12.34, Banner: "SSH-2.0-OpenSSH_9.6"},
+		{ID: "db", Host: "10.0.0.5", Port: 22, Status: "unreachable", Via: "bastion", Error: "refused"},
+	}
+	var buf bytes.Buffer
+	if err := printStatus(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := [][]string{
+		{"ID", "HOST", "STATUS", "RTT", "BANNER", "VIA", "ERROR"},
+		{"web1", "web1.example.com:22", "reachable", "12.3ms", "SSH-2.0-OpenSSH_9.6", "-"},
+		{"db", "10.0.0.5:22", "unreachable", "-", "-", "bastion", "refused"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestPrintStatusSummary(t *testing.T) {
+	records := []health.Record{
+		{ID: "web1", Status: "reachable"},
+		{ID: "web2", Status: "port_open", Error: "no SSH banner"},
+		{ID: "db", Status: "unreachable", Error: "refused"},
+	}
+	var buf bytes.Buffer
+	if err := printStatusSummary(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"3 checked: 1 reachable, 1 port open, 1 unreachable",
+		"web2 port_open no SSH banner",
+		"db unreachable refused",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+// statusListener accepts connections and answers each with banner, or
+// nothing when it's empty. It returns the listener's port.
+func statusListener(t *testing.T, banner string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				nc.Write([]byte(banner))
+				time.Sleep(2 * time.Second)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestRunStatusLowParallel(t *testing.T) {
+	silentPort := statusListener(t, "")
+	sshdPort := statusListener(t, "SSH-2.0-OpenSSH_9.6\r\n")
+
+	// With two slots the silent hosts take four rounds of the timeout
+	// before the healthy ones are checked.
+	var yaml strings.Builder
+	yaml.WriteString("version: 1\nconnections:\n")
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(&yaml, "  - id: silent%d\n    host: 127.0.0.1\n    port: %d\n", i, silentPort)
+	}
+	for i := 0; i < 2; i++ {
+		fmt.Fprintf(&yaml, "  - id: web%d\n    host: 127.0.0.1\n    port: %d\n", i, sshdPort)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldCfg, oldQuiet, oldTimeout, oldParallel := cfgFile, quiet, statusTimeout, statusParallel
+	t.Cleanup(func() {
+		cfgFile, quiet, statusTimeout, statusParallel = oldCfg, oldQuiet, oldTimeout, oldParallel
+	})
+	cfgFile, quiet, statusTimeout, statusParallel = path, true, 200*time.Millisecond, 2
+
+	err := runStatus(statusCmd, nil)
+	if err == nil || err.Error() != "8 of 10 host(s) not reachable" {
+		t.Errorf("runStatus() = %v, want only the silent hosts down", err)
+	}
+	if err := runStatus(statusCmd, []string{"web0"}); err != nil {
+		t.Errorf("runStatus(web0) = %v, want success", err)
+	}
+}
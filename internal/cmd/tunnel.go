@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/fuzzy"
+	"github.com/danmartuszewski/hop/internal/resolve"
+	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/danmartuszewski/hop/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+var tunnelTag string
+
+// tunnelStartTimeout is how long hop tunnel up waits for a forward to come
+// up before reporting it as still starting.
+const tunnelStartTimeout = 15 * time.Second
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Run port forwards in the background",
+	Long: `Run the port forwards defined under a connection's forwards: as
+background ssh processes.
+
+Each forward gets a supervisor that restarts ssh with backoff (1s up to 1m)
+when it exits or the forward stops listening, so a tunnel survives network
+drops and server restarts until it is brought down. Tunnels keep running
+after the terminal is closed; the dashboard shows how many are up per
+connection.
+
+Example config:
+  connections:
+    - id: db1
+      host: db1.example.com
+      forwards:
+        - name: postgres
+          listen_port: 5432
+          target: localhost:5432
+        - name: socks
+          type: dynamic
+          listen_port: 1080`,
+}
+
+var tunnelUpCmd = &cobra.Command{
+	Use:   "up <target> [name]",
+	Short: "Start forwards",
+	Long: `Start the forwards of every connection target matches, or only the
+forward called name. Target is resolved like hop exec. Forwards that are
+already running are left alone.`,
+	Args:              cobra.RangeArgs(1, 2),
+	RunE:              runTunnelUp,
+	ValidArgsFunction: tunnelArgsCompletion,
+}
+
+var tunnelDownCmd = &cobra.Command{
+	Use:               "down <target> [name]",
+	Short:             "Stop forwards",
+	Long:              `Stop the running forwards of the connections target matches, or only the forward called name.`,
+	Args:              cobra.RangeArgs(1, 2),
+	RunE:              runTunnelDown,
+	ValidArgsFunction: tunnelArgsCompletion,
+}
+
+var tunnelLsCmd = &cobra.Command{
+	Use:     "ls [target]",
+	Aliases: []string{"list"},
+	Short:   "List forwards and their state",
+	Long: `List the forwards of the connections target matches (all connections
+when omitted), with the state of the running ones.`,
+	Args:              cobra.MaximumNArgs(1),
+	RunE:              runTunnelLs,
+	ValidArgsFunction: tunnelArgsCompletion,
+}
+
+// tunnelRunCmd is the supervisor process hop tunnel up starts in the
+// background.
+var tunnelRunCmd = &cobra.Command{
+	Use:    "run <id> <name>",
+	Short:  "Supervise one forward in the foreground",
+	Hidden: true,
+	Args:   cobra.ExactArgs(2),
+	RunE:   runTunnelRun,
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+	tunnelCmd.AddCommand(tunnelUpCmd, tunnelDownCmd, tunnelLsCmd, tunnelRunCmd)
+
+	for _, c := range []*cobra.Command{tunnelUpCmd, tunnelDownCmd, tunnelLsCmd} {
+		c.Flags().StringVar(&tunnelTag, "tag", "", "filter connections by tag")
+	}
+}
+
+func tunnelArgsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) >= 1 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return getConnectionCompletions(toComplete)
+}
+
+// tunnelRef is one forward of one connection.
+type tunnelRef struct {
+	conn *config.Connection
+	fwd  *config.Forward
+}
+
+// tunnelTargets returns the connections target matches (all connections
+// when target is empty), filtered by --tag.
+func tunnelTargets(cfg *config.Config, target string) ([]config.Connection, error) {
+	conns := cfg.Connections
+	if target != "" {
+		result, err := resolve.ResolveTarget(target, cfg)
+		if err != nil {
+			return nil, err
+		}
+		conns = result.Connections
+	}
+	if tunnelTag != "" {
+		conns = fuzzy.MatchByTag(tunnelTag, conns)
+	}
+	return conns, nil
+}
+
+// tunnelForwards returns the forwards of conns, or only those called name.
+func tunnelForwards(conns []config.Connection, name string) []tunnelRef {
+	var refs []tunnelRef
+	for i := range conns {
+		for j := range conns[i].Forwards {
+			if name == "" || conns[i].Forwards[j].Name == name {
+				refs = append(refs, tunnelRef{conn: &conns[i], fwd: &conns[i].Forwards[j]})
+			}
+		}
+	}
+	return refs
+}
+
+func runTunnelUp(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conns, err := tunnelTargets(cfg, args[0])
+	if err != nil {
+		return err
+	}
+	name := ""
+	if len(args) > 1 {
+		name = args[1]
+	}
+	refs := tunnelForwards(conns, name)
+	if len(refs) == 0 {
+		if name != "" {
+			return fmt.Errorf("no forward named '%s' on connections matching '%s'", name, args[0])
+		}
+		return fmt.Errorf("no connections matching '%s' have forwards", args[0])
+	}
+
+	// Supervisors load the config themselves, so they must see the same file.
+	var baseArgs []string
+	if cfgFile != "" {
+		path, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return err
+		}
+		baseArgs = []string{"--config", path}
+	}
+
+	rows := make([]tunnelRow, len(refs))
+	failed := 0
+	for i, ref := range refs {
+		rows[i] = newTunnelRow(ref.conn.ID, ref.fwd, tunnel.Load(ref.conn.ID, ref.fwd.Name))
+		if rows[i].state != nil {
+			continue
+		}
+		logPath := tunnel.LogPath(ref.conn.ID, ref.fwd.Name)
+		exited, err := tunnel.Spawn(append(baseArgs, "tunnel", "run", ref.conn.ID, ref.fwd.Name), logPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s/%s: %v\n", ref.conn.ID, ref.fwd.Name, err)
+			failed++
+			continue
+		}
+		st := tunnel.Wait(ref.conn.ID, ref.fwd.Name, exited, tunnelStartTimeout)
+		rows[i].state = st
+		switch {
+		case st == nil:
+			fmt.Fprintf(os.Stderr, "%s/%s: failed to start (see %s)\n", ref.conn.ID, ref.fwd.Name, logPath)
+			failed++
+		case st.Status != tunnel.StatusUp:
+			failed++
+		}
+	}
+
+	if !quiet {
+		printTunnels(os.Stdout, rows, time.Now())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d forward(s) not up; failing ones keep retrying until 'hop tunnel down'", failed)
+	}
+	return nil
+}
+
+func runTunnelDown(cmd *cobra.Command, args []string) error {
+	states, err := tunnel.List()
+	if err != nil {
+		return err
+	}
+
+	// A tunnel can outlive its connection in the config, so the target also
+	// matches running tunnels by exact ID.
+	ids := map[string]bool{args[0]: true}
+	if cfg, err := loadConfig(); err == nil {
+		if conns, err := tunnelTargets(cfg, args[0]); err == nil {
+			for _, c := range conns {
+				ids[c.ID] = true
+			}
+		}
+	}
+
+	stopped, failed := 0, 0
+	for i := range states {
+		st := &states[i]
+		if !ids[st.Connection] || (len(args) > 1 && st.Name != args[1]) {
+			continue
+		}
+		if err := tunnel.Stop(st); err != nil {
+			fmt.Fprintf(os.Stderr, "%s/%s: %v\n", st.Connection, st.Name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Stopped %s/%s\n", st.Connection, st.Name)
+		stopped++
+	}
+	if !quiet && stopped == 0 && failed == 0 {
+		fmt.Fprintln(os.Stderr, "No matching tunnels running.")
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d tunnel(s)", failed)
+	}
+	return nil
+}
+
+func runTunnelLs(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	target := ""
+	if len(args) > 0 {
+		target = args[0]
+	}
+	conns, err := tunnelTargets(cfg, target)
+	if err != nil {
+		return err
+	}
+	states, err := tunnel.List()
+	if err != nil {
+		return err
+	}
+
+	var rows []tunnelRow
+	listed := make(map[[2]string]bool)
+	for _, ref := range tunnelForwards(conns, "") {
+		rows = append(rows, newTunnelRow(ref.conn.ID, ref.fwd, tunnel.Load(ref.conn.ID, ref.fwd.Name)))
+		listed[[2]string{ref.conn.ID, ref.fwd.Name}] = true
+	}
+	// Running tunnels whose forward was since removed from the config.
+	if target == "" && tunnelTag == "" {
+		for i := range states {
+			if !listed[[2]string{states[i].Connection, states[i].Name}] {
+				rows = append(rows, tunnelRow{id: states[i].Connection, name: states[i].Name, spec: states[i].Spec, state: &states[i]})
+			}
+		}
+	}
+	if len(rows) == 0 {
+		if !quiet {
+			fmt.Fprintln(os.Stderr, "No forwards configured. Add forwards: to a connection (see hop tunnel --help).")
+		}
+		return nil
+	}
+	return printTunnels(os.Stdout, rows, time.Now())
+}
+
+func runTunnelRun(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conn := cfg.FindConnection(args[0])
+	if conn == nil {
+		return fmt.Errorf("connection '%s' not found", args[0])
+	}
+	fwd := conn.FindForward(args[1])
+	if fwd == nil {
+		return fmt.Errorf("connection '%s' has no forward named '%s'", args[0], args[1])
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	s := &tunnel.Supervisor{
+		Connection: conn,
+		Forward:    fwd,
+		Log:        log.New(os.Stderr, "", log.LstdFlags),
+	}
+	return s.Run(ctx)
+}
+
+// tunnelRow is one line of hop tunnel ls; state is nil when the forward is
+// not running.
+type tunnelRow struct {
+	id, name, spec string
+	state          *tunnel.State
+}
+
+func newTunnelRow(id string, fwd *config.Forward, st *tunnel.State) tunnelRow {
+	flag, spec := ssh.ForwardSpec(fwd)
+	return tunnelRow{id: id, name: fwd.Name, spec: flag + " " + spec, state: st}
+}
+
+func printTunnels(w io.Writer, rows []tunnelRow, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tFORWARD\tSTATUS\tPID\tRESTARTS\tLAST ERROR")
+	for _, r := range rows {
+		status, pid, restarts, lastErr := "down", "-", "-", ""
+		if st := r.state; st != nil {
+			status = fmt.Sprintf("%s %s", st.Status, formatAge(now.Sub(st.Since)))
+			pid = strconv.Itoa(st.PID)
+			restarts = strconv.Itoa(st.Restarts)
+			lastErr = st.LastError
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.id, r.name, r.spec, status, pid, restarts, lastErr)
+	}
+	return tw.Flush()
+}
+
+// formatAge renders d the way ps and docker do: "45s", "12m", "3h", "2d".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/tunnel"
+)
+
+func TestPrintTunnels(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	rows := []tunnelRow{
+		newTunnelRow("db1", &config.Forward{Name: "pg", ListenPort: 5432, Target: "localhost:5432"}, &tunnel.State{
+			PID: 4242, Status: tunnel.StatusUp, Since: now.Add(-90 * time.Minute),
+		}),
+		newTunnelRow("db1", &config.Forward{Name: "socks", Type: config.ForwardDynamic, ListenPort: 1080}, &tunnel.State{
+			PID: 4343, Status: tunnel.StatusRetrying, Restarts: 3, LastError: "Connection refused", Since: now.Add(-5 * time.Second),
+		}),
+		newTunnelRow("web1", &config.Forward{Name: "app", ListenPort: 8080, Target: "localhost:80"}, nil),
+	}
+	var buf bytes.Buffer
+	if err := printTunnels(&buf, rows, now); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := [][]string{
+		{"ID", "NAME", "FORWARD", "STATUS", "PID", "RESTARTS", "LAST", "ERROR"},
+		{"db1", "pg", "-L", "5432:localhost:5432", "up", "1h", "4242", "0"},
+		{"db1", "socks", "-D", "1080", "retrying", "5s", "4343", "3", "Connection", "refused"},
+		{"web1", "app", "-L", "8080:localhost:80", "down", "-", "-"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want fields %v", i, line, want[i])
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := map[time.Duration]string{
+		42 * time.Second: "42s",
+		12 * time.Minute: "12m",
+		5 * time.Hour:    "5h",
+		72 * time.Hour:   "3d",
+	}
+	for d, want := range tests {
+		if got := formatAge(d); got != want {
+			t.Errorf("formatAge(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
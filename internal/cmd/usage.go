@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/runs"
+)
+
+// recordUsage writes usages to the history file. History is best-effort: a
+// failure never changes the outcome of the command, it is only reported with
+// --verbose.
+func recordUsage(usages ...config.Usage) {
+	if len(usages) == 0 {
+		return
+	}
+	if _, err := config.RecordUsages(usages...); err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "warning: failed to record history: %v\n", err)
+	}
+}
+
+// saveRun stores a finished hop exec run and reports whether it was saved.
+// Like recordUsage, failures are only reported with --verbose.
+func saveRun(run *runs.Run) bool {
+	if err := runs.Save(run); err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "warning: failed to save run: %v\n", err)
+		}
+		return false
+	}
+	return true
+}
@@ -4,28 +4,46 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Version     int                 `yaml:"version"`
-	ThemePreset string              `yaml:"theme_preset,omitempty"`
-	Theme       map[string]string   `yaml:"theme,omitempty"`
-	ThemeDark   map[string]string   `yaml:"theme_dark,omitempty"`
-	ThemeLight  map[string]string   `yaml:"theme_light,omitempty"`
-	Defaults    Defaults            `yaml:"defaults,omitempty"`
-	Connections []Connection        `yaml:"connections"`
-	Groups      map[string][]string `yaml:"groups,omitempty"`
+	Version     int                   `yaml:"version"`
+	Include     []string              `yaml:"include,omitempty"`
+	ThemePreset string                `yaml:"theme_preset,omitempty"`
+	Theme       map[string]string     `yaml:"theme,omitempty"`
+	ThemeDark   map[string]string     `yaml:"theme_dark,omitempty"`
+	ThemeLight  map[string]string     `yaml:"theme_light,omitempty"`
+	Defaults    Defaults              `yaml:"defaults,omitempty"`
+	Connections []Connection          `yaml:"connections"`
+	Groups      map[string][]string   `yaml:"groups,omitempty"`
+	Templates   map[string]Connection `yaml:"templates,omitempty"`
+	Inventories []Inventory           `yaml:"inventories,omitempty"`
+
+	path            string            // file the config was loaded from
+	doc             *document         // source document, for patching on save
+	layers          []*Config         // included files, in merge order
+	groupSources    map[string]string // group name -> included file defining it
+	inventoryStatus []InventoryStatus // how each inventory was last loaded
 }
 
 type Defaults struct {
 	User        string `yaml:"user,omitempty"`
 	Port        int    `yaml:"port,omitempty"`
 	UseMosh     bool   `yaml:"use_mosh,omitempty"`
+	Multiplex   bool   `yaml:"multiplex,omitempty"`
 	HealthCheck *bool  `yaml:"health_check,omitempty"`
+	// HealthInterval is how often the dashboard re-checks hosts, as a Go
+	// duration ("30s", "2m"); "0" checks only on start.
+	HealthInterval string `yaml:"health_interval,omitempty"`
 }
 
+// DefaultHealthInterval is how often the dashboard re-checks hosts when
+// health_interval is unset.
+const DefaultHealthInterval = 30 * time.Second
+
 // HealthCheckEnabled returns whether health checks are enabled (default: true).
 func (d *Defaults) HealthCheckEnabled() bool {
 	if d.HealthCheck == nil {
@@ -34,9 +52,23 @@ func (d *Defaults) HealthCheckEnabled() bool {
 	return *d.HealthCheck
 }
 
+// HealthCheckInterval returns how often hosts are re-checked, or 0 for
+// never. Invalid values, which Validate reports, fall back to the default.
+func (d *Defaults) HealthCheckInterval() time.Duration {
+	if d.HealthInterval == "" {
+		return DefaultHealthInterval
+	}
+	v, err := time.ParseDuration(d.HealthInterval)
+	if err != nil || v < 0 {
+		return DefaultHealthInterval
+	}
+	return v
+}
+
 type Connection struct {
 	ID           string            `yaml:"id"`
 	Host         string            `yaml:"host"`
+	Extends      []string          `yaml:"extends,omitempty"`
 	User         string            `yaml:"user,omitempty"`
 	Port         int               `yaml:"port,omitempty"`
 	Project      string            `yaml:"project,omitempty"`
@@ -46,8 +78,24 @@ type Connection struct {
 	ProxyJump    string            `yaml:"proxy_jump,omitempty"`
 	ForwardAgent bool              `yaml:"forward_agent,omitempty"`
 	UseMosh      *bool             `yaml:"use_mosh,omitempty"`
+	Multiplex    *bool             `yaml:"multiplex,omitempty"`
 	Tags         []string          `yaml:"tags,omitempty"`
 	Options      map[string]string `yaml:"options,omitempty"`
+	Forwards     []Forward         `yaml:"forwards,omitempty"`
+
+	// SSHConfigHost marks the connection as managed by the SSH config host
+	// of that name: hop import --sync updates it from the host and can
+	// remove it once the host is gone.
+	SSHConfigHost string `yaml:"ssh_config_host,omitempty"`
+
+	// Source is the config file the connection was loaded from. Saving
+	// writes the connection back to that file; new connections go to the
+	// main config. Connections from an inventory have the source
+	// "inventory:<name>" and are never saved (see Inventory).
+	Source string `yaml:"-"`
+
+	doc     *docEntry
+	origins map[string]string // field -> where an inherited value came from
 }
 
 func DefaultConfigPath() string {
@@ -61,52 +109,138 @@ func DefaultConfigPath() string {
 	return filepath.Join(home, ".config", "hop", "config.yaml")
 }
 
+// Load reads the config at path, merges its included files and then the
+// connections of its inventories, running inventory commands whose cached
+// output has expired.
 func Load(path string) (*Config, error) {
+	cfg, err := loadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg.loadInventories(nil)
+	return cfg, nil
+}
+
+// loadFile reads the config at path and its included files.
+func loadFile(path string) (*Config, error) {
 	if path == "" {
 		path = DefaultConfigPath()
 	}
 
 	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg *Config
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Return empty config if no config file exists
-			cfg := &Config{
-				Version:     1,
-				Connections: []Connection{},
-				Groups:      make(map[string][]string),
-			}
-			cfg.applyDefaults()
-			return cfg, nil
+		// Return empty config if no config file exists
+		cfg = &Config{
+			Version:     CurrentVersion,
+			Connections: []Connection{},
+			Groups:      make(map[string][]string),
 		}
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		cfg.applyDefaults()
+	} else if cfg, err = parse(data); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	cfg.path = path
+	for i := range cfg.Connections {
+		cfg.Connections[i].Source = path
+	}
+	if err := cfg.loadIncludes(path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parse upgrades a config document to CurrentVersion, decodes it and applies
+// defaults. The (upgraded) source is kept so a later Save only rewrites what
+// changed (see document); an upgrade is therefore persisted by the next save.
+func parse(data []byte) (*Config, error) {
+	data, _, err := Migrate(data)
+	if err != nil {
+		return nil, err
 	}
 
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, err
 	}
 
 	cfg.applyDefaults()
+	cfg.attachDocument(data)
 	return &cfg, nil
 }
 
+// Update performs a locked read-modify-write of the config at path: it takes
+// the config lock, loads the current file, applies fn and saves the result.
+// Use it instead of Load+Save whenever another hop process could be writing
+// the same file, so concurrent edits are never lost. If fn returns an error
+// nothing is written. Inventory connections come from their cached output
+// only, so no inventory command runs while the lock is held.
+func Update(path string, fn func(*Config) error) (*Config, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	if err := ensureConfigDir(path); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockPath(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cfg, err := loadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// fn sees the inventory connections, e.g. to refuse a clashing ID.
+	cfg.loadCachedInventories()
+	if err := fn(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.write(path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 func (c *Config) applyDefaults() {
 	if c.Defaults.Port == 0 {
 		c.Defaults.Port = 22
 	}
 
 	for i := range c.Connections {
-		conn := &c.Connections[i]
-		if conn.User == "" {
-			conn.User = c.Defaults.User
-		}
-		if conn.Port == 0 {
-			conn.Port = c.Defaults.Port
-		}
-		if conn.UseMosh == nil && c.Defaults.UseMosh {
-			v := true
-			conn.UseMosh = &v
-		}
+		c.resolveConnection(&c.Connections[i])
+	}
+}
+
+// resolveConnection fills in conn's inherited values: first from the
+// templates it extends, then from defaults.
+func (c *Config) resolveConnection(conn *Connection) {
+	c.resolveTemplates(conn)
+
+	if conn.User == "" && c.Defaults.User != "" {
+		conn.User = c.Defaults.User
+		conn.setOrigin("user", OriginDefaults)
+	}
+	if conn.Port == 0 {
+		conn.Port = c.Defaults.Port
+		conn.setOrigin("port", OriginDefaults)
+	}
+	if conn.UseMosh == nil && c.Defaults.UseMosh {
+		v := true
+		conn.UseMosh = &v
+		conn.setOrigin("use_mosh", OriginDefaults)
+	}
+	if conn.Multiplex == nil && c.Defaults.Multiplex {
+		v := true
+		conn.Multiplex = &v
+		conn.setOrigin("multiplex", OriginDefaults)
 	}
 }
 
@@ -123,6 +257,15 @@ func (c *Connection) SetMosh(v bool) {
 	c.UseMosh = &v
 }
 
+// Multiplexed returns whether ssh connections to this host share a
+// hop-managed ControlMaster.
+func (c *Connection) Multiplexed() bool {
+	if c.Multiplex == nil {
+		return false
+	}
+	return *c.Multiplex
+}
+
 func (c *Connection) EffectiveUser() string {
 	if c.User != "" {
 		return c.User
@@ -130,38 +273,99 @@ func (c *Connection) EffectiveUser() string {
 	return os.Getenv("USER")
 }
 
+// Save writes the config to path. The write is atomic (temp file + rename),
+// serialized with other hop processes through the config lock, and the
+// previous content is kept in the backup ring (see ListBackups).
 func (c *Config) Save(path string) error {
 	if path == "" {
 		path = DefaultConfigPath()
 	}
+	if err := ensureConfigDir(path); err != nil {
+		return err
+	}
 
-	// Ensure directory exists
-	dir := filepath.Dir(path)
-	// 0700/0600: the config holds the full infrastructure inventory, so keep it
-	// readable only by the owner, matching SSH's own conventions for ~/.ssh.
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+	unlock, err := lockPath(path)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	data, err := yaml.Marshal(c)
+	return c.write(path)
+}
+
+// write marshals the config and replaces the file at path, along with any
+// included file whose connections or groups changed. Callers must hold the
+// lock on path. Files loaded from disk are written by patching them, so
+// comments, ordering and formatting the user wrote are preserved.
+func (c *Config) write(path string) error {
+	if err := c.writeLayers(path); err != nil {
+		return err
+	}
+
+	data, err := c.view(nil).marshal()
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
+	if err := writeConfigFile(path, data); err != nil {
+		return err
+	}
 
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+	// Re-attach to what was written so the next save diffs against it.
+	fresh, err := loadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read back written config: %w", err)
 	}
+	c.path, c.doc, c.layers, c.groupSources = fresh.path, fresh.doc, fresh.layers, fresh.groupSources
 
+	type key struct{ source, id string }
+	written := make(map[key][]Connection)
+	for _, conn := range fresh.Connections {
+		k := key{conn.Source, conn.ID}
+		written[k] = append(written[k], conn)
+	}
+	for i := range c.Connections {
+		conn := &c.Connections[i]
+		if c.layerFor(conn.Source) == nil && !conn.ReadOnly() {
+			conn.Source = path
+		}
+		conn.doc = nil
+		k := key{conn.Source, conn.ID}
+		if entries := written[k]; len(entries) > 0 {
+			conn.doc, written[k] = entries[0].doc, entries[1:]
+		}
+	}
+	return nil
+}
+
+// ensureConfigDir creates the directory holding the config at path.
+func ensureConfigDir(path string) error {
+	// 0700/0600: the config holds the full infrastructure inventory, so keep it
+	// readable only by the owner, matching SSH's own conventions for ~/.ssh.
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
 	return nil
 }
 
 // Clone returns a deep copy of the connection. Reference-type fields (Tags,
-// Options) and the UseMosh pointer are copied into fresh backing storage so the
+// Options, Forwards) and the UseMosh and Multiplex pointers are copied into fresh backing storage so the
 // clone shares no mutable state with the source. This matters for duplication,
 // where the source and the copy must be fully independent config entries.
+// The clone is not tied to the source's entry in the config file, so saving
+// it adds a new entry.
 func (c Connection) Clone() Connection {
 	clone := c
+	clone.doc = nil
 
+	if c.Extends != nil {
+		clone.Extends = append([]string(nil), c.Extends...)
+	}
+	if c.origins != nil {
+		clone.origins = make(map[string]string, len(c.origins))
+		for k, v := range c.origins {
+			clone.origins[k] = v
+		}
+	}
 	if c.Tags != nil {
 		clone.Tags = append([]string(nil), c.Tags...)
 	}
@@ -171,10 +375,17 @@ func (c Connection) Clone() Connection {
 			clone.Options[k] = v
 		}
 	}
+	if c.Forwards != nil {
+		clone.Forwards = append([]Forward(nil), c.Forwards...)
+	}
 	if c.UseMosh != nil {
 		mosh := *c.UseMosh
 		clone.UseMosh = &mosh
 	}
+	if c.Multiplex != nil {
+		mux := *c.Multiplex
+		clone.Multiplex = &mux
+	}
 
 	return clone
 }
@@ -203,6 +414,12 @@ func (c *Config) SuggestDuplicateID(sourceID string) string {
 func (c *Config) UpdateConnection(id string, conn Connection) bool {
 	for i, existing := range c.Connections {
 		if existing.ID == id {
+			if conn.doc == nil {
+				conn.doc = existing.doc
+			}
+			if conn.Source == "" {
+				conn.Source = existing.Source
+			}
 			c.Connections[i] = conn
 			return true
 		}
@@ -142,6 +142,37 @@ connections:
 	}
 }
 
+func TestLoadWithMultiplex(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	content := `version: 1
+defaults:
+  multiplex: true
+connections:
+  - id: shared
+    host: example.com
+  - id: opted-out
+    host: other.example.com
+    multiplex: false
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !cfg.Connections[0].Multiplexed() {
+		t.Error("Connections[0].Multiplexed() = false, want true from defaults")
+	}
+	if cfg.Connections[1].Multiplexed() {
+		t.Error("Connections[1].Multiplexed() = true, want false")
+	}
+}
+
 func TestSaveOmitsUseMoshWhenFalse(t *testing.T) {
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "config.yaml")
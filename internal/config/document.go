@@ -0,0 +1,867 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// document is the source a Config was loaded from. Save patches this source
+// instead of re-marshalling the whole Config, so hand-written comments, key
+// order, anchors and blank lines survive dashboard and import edits. Only the
+// parts of the file that actually changed are rewritten; everything else is
+// kept byte-for-byte.
+//
+// Change detection works on snapshots taken at load time: each top-level key
+// and each field of each connection is recorded in its marshalled form, and
+// compared against the in-memory value when saving.
+type document struct {
+	src     []byte
+	fields  map[string]string
+	entries []*docEntry
+}
+
+// docEntry links a loaded connection to its item in the connections sequence
+// of the document it came from.
+type docEntry struct {
+	owner  *document
+	index  int
+	fields map[string]string
+}
+
+// edit replaces src[start:end] with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// yamlField describes one yaml-tagged struct field.
+type yamlField struct {
+	key       string
+	index     int
+	omitEmpty bool
+}
+
+var (
+	configFields     = yamlFields(reflect.TypeOf(Config{}))
+	connectionFields = yamlFields(reflect.TypeOf(Connection{}))
+)
+
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		field := yamlField{key: parts[0], index: i}
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				field.omitEmpty = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// snapshot records the marshalled form of each field of v.
+func snapshot(v reflect.Value, fields []yamlField) map[string]string {
+	out := make(map[string]string, len(fields))
+	for _, f := range fields {
+		out[f.key] = marshalValue(v.Field(f.index))
+	}
+	return out
+}
+
+func marshalValue(v reflect.Value) string {
+	data, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// isEmptyValue mirrors yaml's omitempty rules for the field types used in
+// the config.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// attachDocument records data as the source of c and links every connection
+// to its item in the document. Documents hop cannot patch safely (not a
+// mapping, or a connections list whose items don't line up with the decoded
+// connections) are left unattached and saved by plain marshalling.
+func (c *Config) attachDocument(data []byte) {
+	root, err := parseRoot(data)
+	if err != nil || root == nil {
+		return
+	}
+
+	doc := &document{
+		src:    data,
+		fields: snapshot(reflect.ValueOf(c).Elem(), configFields),
+	}
+
+	if _, seq := mappingValue(root, "connections"); seq != nil && seq.Kind == yaml.SequenceNode {
+		if len(seq.Content) != len(c.Connections) {
+			return
+		}
+		for i := range c.Connections {
+			entry := &docEntry{
+				owner:  doc,
+				index:  i,
+				fields: snapshot(reflect.ValueOf(c.Connections[i]), connectionFields),
+			}
+			doc.entries = append(doc.entries, entry)
+			c.Connections[i].doc = entry
+		}
+	} else if len(c.Connections) != 0 {
+		return
+	}
+
+	c.doc = doc
+}
+
+// parseRoot returns the root mapping node of data, or nil if the document is
+// empty or not a mapping.
+func parseRoot(data []byte) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	if n.Kind != yaml.DocumentNode || len(n.Content) == 0 || n.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	return n.Content[0], nil
+}
+
+// mappingValue returns the index of key in mapping m and its value node.
+func mappingValue(m *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i, m.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+// marshal renders the config for writing. Configs loaded from a file are
+// patched in place; others are marshalled from scratch.
+func (c *Config) marshal() ([]byte, error) {
+	if c.doc != nil {
+		if data, err := c.patchDocument(); err == nil {
+			return data, nil
+		}
+	}
+	return yaml.Marshal(c)
+}
+
+// patchDocument returns the source document with every change made to c
+// since it was loaded applied.
+func (c *Config) patchDocument() ([]byte, error) {
+	d := c.doc
+	root, err := parseRoot(d.src)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("config document is not a mapping")
+	}
+	p := &patcher{src: d.src, root: root}
+
+	cv := reflect.ValueOf(c).Elem()
+	for _, f := range configFields {
+		if f.key == "connections" {
+			continue
+		}
+		v := cv.Field(f.index)
+		if marshalValue(v) == d.fields[f.key] {
+			continue
+		}
+		if err := p.setTopLevel(f, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.patchConnections(c); err != nil {
+		return nil, err
+	}
+
+	return p.apply(), nil
+}
+
+// stripDefaults returns conn with every value it would inherit anyway (from
+// its templates or from defaults) cleared, so entries are written the way a
+// user would write them and keep following the templates and defaults.
+func (c *Config) stripDefaults(conn Connection) Connection {
+	base := Connection{Extends: conn.Extends}
+	c.resolveConnection(&base)
+
+	out := conn
+	out.origins = nil
+	ov, bv := reflect.ValueOf(&out).Elem(), reflect.ValueOf(base)
+	for _, f := range connectionFields {
+		switch f.key {
+		case "id", "host", "extends":
+		case "tags":
+			out.Tags = nil
+			for _, tag := range conn.Tags {
+				if !containsString(base.Tags, tag) {
+					out.Tags = append(out.Tags, tag)
+				}
+			}
+		case "options":
+			out.Options = nil
+			for k, v := range conn.Options {
+				if bo, ok := base.Options[k]; ok && bo == v {
+					continue
+				}
+				if out.Options == nil {
+					out.Options = make(map[string]string)
+				}
+				out.Options[k] = v
+			}
+		case "forwards":
+			out.Forwards = nil
+			for _, f := range conn.Forwards {
+				if bf := base.FindForward(f.Name); bf != nil && *bf == f {
+					continue
+				}
+				out.Forwards = append(out.Forwards, f)
+			}
+		default:
+			if reflect.DeepEqual(ov.Field(f.index).Interface(), bv.Field(f.index).Interface()) {
+				ov.Field(f.index).Set(reflect.Zero(ov.Field(f.index).Type()))
+			}
+		}
+	}
+	return out
+}
+
+// patcher accumulates byte-range edits against src.
+type patcher struct {
+	src   []byte
+	root  *yaml.Node
+	edits []edit
+}
+
+func (p *patcher) apply() []byte {
+	sort.SliceStable(p.edits, func(i, j int) bool { return p.edits[i].start > p.edits[j].start })
+	out := append([]byte(nil), p.src...)
+	for _, e := range p.edits {
+		var buf bytes.Buffer
+		buf.Write(out[:e.start])
+		buf.WriteString(e.text)
+		buf.Write(out[e.end:])
+		out = buf.Bytes()
+	}
+	return out
+}
+
+// lineStart returns the byte offset of the start of 1-based line.
+func (p *patcher) lineStart(line int) int {
+	off := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(p.src[off:], '\n')
+		if i < 0 {
+			return len(p.src)
+		}
+		off += i + 1
+	}
+	return off
+}
+
+// offset converts a node's 1-based line and (rune) column into a byte offset.
+func (p *patcher) offset(line, column int) int {
+	off := p.lineStart(line)
+	for col := 1; col < column && off < len(p.src) && p.src[off] != '\n'; col++ {
+		_, size := utf8.DecodeRune(p.src[off:])
+		off += size
+	}
+	return off
+}
+
+// lineAt returns the text of the line starting at off, without newline.
+func (p *patcher) lineAt(off int) string {
+	end := bytes.IndexByte(p.src[off:], '\n')
+	if end < 0 {
+		return string(p.src[off:])
+	}
+	return string(p.src[off : off+end])
+}
+
+// prevLineStart returns the start offset of the line before the one starting
+// at off, or -1 at the beginning of the file.
+func (p *patcher) prevLineStart(off int) int {
+	if off == 0 {
+		return -1
+	}
+	i := bytes.LastIndexByte(p.src[:off-1], '\n')
+	return i + 1
+}
+
+// hasBlankLine reports whether s, a run of whole lines, contains an empty
+// one.
+func hasBlankLine(s string) bool {
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" && strings.TrimSpace(line) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankOrComment(line string) bool {
+	t := strings.TrimSpace(line)
+	return t == "" || strings.HasPrefix(t, "#")
+}
+
+// trimBack moves end (a line start) back over trailing blank and comment-only
+// lines, never before floor. Those lines belong to whatever follows.
+func (p *patcher) trimBack(end, floor int) int {
+	for end > floor {
+		prev := p.prevLineStart(end)
+		if prev < floor || !isBlankOrComment(p.lineAt(prev)) {
+			break
+		}
+		end = prev
+	}
+	return end
+}
+
+// nextKeyStart returns the offset where the root key following key index i
+// begins, or the end of the file.
+func (p *patcher) nextKeyStart(i int) int {
+	if i+2 < len(p.root.Content) {
+		return p.lineStart(p.root.Content[i+2].Line)
+	}
+	return len(p.src)
+}
+
+// keyBlock returns the byte range of root key i and its value.
+func (p *patcher) keyBlock(i int) (int, int) {
+	start := p.lineStart(p.root.Content[i].Line)
+	return start, p.trimBack(p.nextKeyStart(i), start)
+}
+
+// ensureNewline prefixes text with a newline when inserting at an offset that
+// does not start a line (a file without a trailing newline).
+func (p *patcher) ensureNewline(off int, text string) string {
+	if off > 0 && p.src[off-1] != '\n' {
+		return "\n" + text
+	}
+	return text
+}
+
+// setTopLevel updates, inserts or removes a root key.
+func (p *patcher) setTopLevel(f yamlField, v reflect.Value) error {
+	i, old := mappingValue(p.root, f.key)
+
+	if f.omitEmpty && isEmptyValue(v) {
+		if i >= 0 {
+			start, end := p.keyBlock(i)
+			p.edits = append(p.edits, edit{start: start, end: end})
+		}
+		return nil
+	}
+
+	var val yaml.Node
+	if err := val.Encode(v.Interface()); err != nil {
+		return err
+	}
+
+	if i < 0 {
+		return p.insertTopLevel(f.key, &val)
+	}
+
+	key := p.root.Content[i]
+	if old.Kind == yaml.ScalarNode && val.Kind == yaml.ScalarNode && old.Line == key.Line &&
+		old.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		// Replace just the scalar token so the rest of the line (e.g. a
+		// trailing comment) is kept.
+		start := p.offset(old.Line, old.Column)
+		end := start + scalarTokenLen(p.lineAt(p.lineStart(old.Line))[start-p.lineStart(old.Line):], old.Style)
+		keepStyle(old, &val)
+		text, err := encodeScalar(&val)
+		if err != nil {
+			return err
+		}
+		p.edits = append(p.edits, edit{start: start, end: end, text: text})
+		return nil
+	}
+
+	if old.Kind == yaml.MappingNode && val.Kind == yaml.MappingNode {
+		mergeMapping(old, &val)
+	} else {
+		keepStyle(old, &val)
+		p.root.Content[i+1] = &val
+	}
+	text, err := renderPair(key, p.root.Content[i+1])
+	if err != nil {
+		return err
+	}
+	start, end := p.keyBlock(i)
+	p.edits = append(p.edits, edit{start: start, end: end, text: text})
+	return nil
+}
+
+// insertTopLevel adds a new root key, placed before the first existing key
+// that follows it in Config field order (together with that key's comments),
+// or at the end of the file.
+func (p *patcher) insertTopLevel(key string, val *yaml.Node) error {
+	text, err := renderPair(&yaml.Node{Kind: yaml.ScalarNode, Value: key}, val)
+	if err != nil {
+		return err
+	}
+
+	after := false
+	for _, f := range configFields {
+		if f.key == key {
+			after = true
+			continue
+		}
+		if !after {
+			continue
+		}
+		if i, _ := mappingValue(p.root, f.key); i >= 0 {
+			off := p.lineStart(p.root.Content[i].Line)
+			// Step above the comment block attached to that key.
+			for prev := p.prevLineStart(off); prev >= 0; prev = p.prevLineStart(off) {
+				t := strings.TrimSpace(p.lineAt(prev))
+				if !strings.HasPrefix(t, "#") {
+					break
+				}
+				off = prev
+			}
+			if prev := p.prevLineStart(off); prev >= 0 && strings.TrimSpace(p.lineAt(prev)) == "" {
+				text += "\n"
+			}
+			p.edits = append(p.edits, edit{start: off, end: off, text: text})
+			return nil
+		}
+	}
+
+	off := len(p.src)
+	p.edits = append(p.edits, edit{start: off, end: off, text: p.ensureNewline(off, text)})
+	return nil
+}
+
+// patchConnections rewrites only the connection items that were added,
+// changed or deleted since load.
+func (p *patcher) patchConnections(c *Config) error {
+	d := c.doc
+	keyIdx, seq := mappingValue(p.root, "connections")
+
+	// Pair in-memory connections with the document items they came from.
+	byEntry := make(map[*docEntry]*Connection)
+	var added []*Connection
+	for i := range c.Connections {
+		conn := &c.Connections[i]
+		if e := conn.doc; e != nil && e.owner == d && byEntry[e] == nil && seq != nil && e.index < len(seq.Content) {
+			byEntry[e] = conn
+			continue
+		}
+		added = append(added, conn)
+	}
+
+	type itemChange struct {
+		index   int
+		deleted bool
+		node    *yaml.Node
+	}
+	var changes []itemChange
+	for _, e := range d.entries {
+		conn := byEntry[e]
+		if conn == nil {
+			changes = append(changes, itemChange{index: e.index, deleted: true})
+			continue
+		}
+		node, changed, err := c.updateItem(seq.Content[e.index], conn, e)
+		if err != nil {
+			return err
+		}
+		if changed {
+			seq.Content[e.index] = node
+			changes = append(changes, itemChange{index: e.index, node: node})
+		}
+	}
+
+	var newNodes []*yaml.Node
+	for _, conn := range added {
+		var n yaml.Node
+		if err := n.Encode(c.stripDefaults(*conn)); err != nil {
+			return err
+		}
+		newNodes = append(newNodes, &n)
+	}
+
+	if len(changes) == 0 && len(newNodes) == 0 {
+		return nil
+	}
+
+	// No usable block sequence to splice into: render the whole key.
+	if keyIdx < 0 || seq.Kind != yaml.SequenceNode || seq.Style&yaml.FlowStyle != 0 || len(seq.Content) == 0 {
+		out := &yaml.Node{Kind: yaml.SequenceNode}
+		deleted := make(map[int]bool)
+		for _, ch := range changes {
+			if ch.deleted {
+				deleted[ch.index] = true
+			}
+		}
+		if seq != nil && seq.Kind == yaml.SequenceNode {
+			for i, n := range seq.Content {
+				if !deleted[i] {
+					out.Content = append(out.Content, n)
+				}
+			}
+		}
+		out.Content = append(out.Content, newNodes...)
+		if keyIdx < 0 {
+			return p.insertTopLevel("connections", out)
+		}
+		text, err := renderPair(p.root.Content[keyIdx], out)
+		if err != nil {
+			return err
+		}
+		start, end := p.keyBlock(keyIdx)
+		p.edits = append(p.edits, edit{start: start, end: end, text: text})
+		return nil
+	}
+
+	items := seq.Content
+	seqEnd := p.nextKeyStart(keyIdx)
+	starts := make([]int, len(items))
+	for i, n := range items {
+		starts[i] = p.itemStart(n)
+	}
+	itemEnd := func(i int) int {
+		boundary := seqEnd
+		if i+1 < len(items) {
+			boundary = starts[i+1]
+		}
+		return p.trimBack(boundary, starts[i])
+	}
+	indent := p.itemIndent(items[0])
+
+	for _, ch := range changes {
+		start, end := starts[ch.index], itemEnd(ch.index)
+		if ch.deleted {
+			start, end = p.deletionRange(start, end, ch.index == 0)
+			p.edits = append(p.edits, edit{start: start, end: end})
+			continue
+		}
+		text, err := renderItem(ch.node, indent)
+		if err != nil {
+			return err
+		}
+		p.edits = append(p.edits, edit{start: start, end: end, text: text})
+	}
+
+	if len(newNodes) > 0 {
+		// Mirror the blank-line spacing used between existing items.
+		sep := ""
+		if len(items) > 1 && hasBlankLine(string(p.src[itemEnd(0):starts[1]])) {
+			sep = "\n"
+		}
+		var b strings.Builder
+		for _, n := range newNodes {
+			text, err := renderItem(n, indent)
+			if err != nil {
+				return err
+			}
+			b.WriteString(sep)
+			b.WriteString(text)
+		}
+		off := itemEnd(len(items) - 1)
+		p.edits = append(p.edits, edit{start: off, end: off, text: p.ensureNewline(off, b.String())})
+	}
+
+	return nil
+}
+
+// updateItem applies the fields of conn that changed since load to the
+// item's mapping node, leaving unchanged keys (and their comments) alone.
+func (c *Config) updateItem(node *yaml.Node, conn *Connection, e *docEntry) (*yaml.Node, bool, error) {
+	cv := reflect.ValueOf(*conn)
+	var changed []yamlField
+	for _, f := range connectionFields {
+		if marshalValue(cv.Field(f.index)) != e.fields[f.key] {
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) == 0 {
+		return node, false, nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		// Aliases and other exotic items are replaced wholesale.
+		var n yaml.Node
+		if err := n.Encode(c.stripDefaults(*conn)); err != nil {
+			return nil, false, err
+		}
+		return &n, true, nil
+	}
+
+	// Write only what the connection sets itself, not what it inherits.
+	own := reflect.ValueOf(c.stripDefaults(*conn))
+	for _, f := range changed {
+		v := own.Field(f.index)
+		i, old := mappingValue(node, f.key)
+		if f.omitEmpty && isEmptyValue(v) {
+			if i >= 0 {
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			}
+			continue
+		}
+		var val yaml.Node
+		if err := val.Encode(v.Interface()); err != nil {
+			return nil, false, err
+		}
+		if i >= 0 {
+			keepStyle(old, &val)
+			node.Content[i+1] = &val
+		} else {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, &val)
+		}
+	}
+	return node, true, nil
+}
+
+// itemStart returns the offset of the start of the line holding the "-" of a
+// sequence item.
+func (p *patcher) itemStart(n *yaml.Node) int {
+	off := p.offset(n.Line, n.Column)
+	for off > 0 {
+		off--
+		switch p.src[off] {
+		case '-':
+			return p.lineStartOf(off)
+		case ' ', '\t', '\n', '\r':
+		default:
+			return p.lineStartOf(off)
+		}
+	}
+	return 0
+}
+
+func (p *patcher) lineStartOf(off int) int {
+	return bytes.LastIndexByte(p.src[:off], '\n') + 1
+}
+
+// itemIndent returns the column of the "-" of a sequence item.
+func (p *patcher) itemIndent(n *yaml.Node) int {
+	start := p.itemStart(n)
+	line := p.lineAt(start)
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// deletionRange widens an item's range to take its own head comment (unless
+// it is the first item, whose comment usually describes the whole list) and
+// the blank line that separated it from its successor.
+func (p *patcher) deletionRange(start, end int, first bool) (int, int) {
+	if !first {
+		for prev := p.prevLineStart(start); prev >= 0; prev = p.prevLineStart(start) {
+			if !strings.HasPrefix(strings.TrimSpace(p.lineAt(prev)), "#") {
+				break
+			}
+			start = prev
+		}
+	}
+	prev := p.prevLineStart(start)
+	if first || (prev >= 0 && strings.TrimSpace(p.lineAt(prev)) == "") {
+		for end < len(p.src) && strings.TrimSpace(p.lineAt(end)) == "" {
+			next := bytes.IndexByte(p.src[end:], '\n')
+			if next < 0 {
+				end = len(p.src)
+				break
+			}
+			end += next + 1
+		}
+	}
+	return start, end
+}
+
+// keepStyle carries the presentation of an existing value (quoting, flow
+// style, trailing comment) over to its replacement.
+func keepStyle(old, val *yaml.Node) {
+	if old == nil {
+		return
+	}
+	if old.Kind == val.Kind {
+		switch val.Kind {
+		case yaml.ScalarNode:
+			if old.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+				val.Style = old.Style
+			}
+		case yaml.SequenceNode, yaml.MappingNode:
+			val.Style = old.Style & yaml.FlowStyle
+		}
+	}
+	val.LineComment = old.LineComment
+}
+
+// mergeMapping updates mapping old in place to hold the content of val.
+// Keys whose value did not change keep their original nodes and comments.
+func mergeMapping(old, val *yaml.Node) {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(val.Content); i += 2 {
+		k, v := val.Content[i], val.Content[i+1]
+		if j, ov := mappingValue(old, k.Value); j >= 0 {
+			if sameValue(ov, v) {
+				content = append(content, old.Content[j], ov)
+				continue
+			}
+			if ov.Kind == yaml.MappingNode && v.Kind == yaml.MappingNode {
+				mergeMapping(ov, v)
+				content = append(content, old.Content[j], ov)
+				continue
+			}
+			keepStyle(ov, v)
+			content = append(content, old.Content[j], v)
+			continue
+		}
+		content = append(content, k, v)
+	}
+	// Keep the original key order: existing keys first as they were, new
+	// keys after them.
+	ordered := make([]*yaml.Node, 0, len(content))
+	for i := 0; i+1 < len(old.Content); i += 2 {
+		if j, _ := mappingValue(&yaml.Node{Content: content}, old.Content[i].Value); j >= 0 {
+			ordered = append(ordered, content[j], content[j+1])
+		}
+	}
+	for i := 0; i+1 < len(content); i += 2 {
+		if j, _ := mappingValue(old, content[i].Value); j < 0 {
+			ordered = append(ordered, content[i], content[i+1])
+		}
+	}
+	old.Content = ordered
+}
+
+// sameValue reports whether two nodes decode to the same value.
+func sameValue(a, b *yaml.Node) bool {
+	var av, bv any
+	if a.Decode(&av) != nil || b.Decode(&bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// encodeNode renders n as YAML with two-space indentation.
+func encodeNode(n *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// encodeScalar renders a scalar node as a single-line token.
+func encodeScalar(n *yaml.Node) (string, error) {
+	scalar := *n
+	scalar.LineComment = ""
+	text, err := encodeNode(&scalar)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(text, "\n"), nil
+}
+
+// renderPair renders "key: value" for a root key. Comments that sit above or
+// below the block stay in the source, so they are not re-emitted here.
+func renderPair(key, val *yaml.Node) (string, error) {
+	k := *key
+	k.HeadComment, k.FootComment = "", ""
+	v := *val
+	v.FootComment = ""
+	return encodeNode(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{&k, &v}})
+}
+
+// renderItem renders a connection item as a "- " sequence entry indented by
+// indent spaces.
+func renderItem(n *yaml.Node, indent int) (string, error) {
+	item := *n
+	item.HeadComment, item.FootComment = "", ""
+	if len(item.Content) > 0 {
+		content := append([]*yaml.Node(nil), item.Content...)
+		first := *content[0]
+		first.HeadComment = ""
+		content[0] = &first
+		last := *content[len(content)-1]
+		last.FootComment = ""
+		content[len(content)-1] = &last
+		item.Content = content
+	}
+	text, err := encodeNode(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{&item}})
+	if err != nil {
+		return "", err
+	}
+	if indent == 0 {
+		return text, nil
+	}
+	pad := strings.Repeat(" ", indent)
+	lines := strings.SplitAfter(text, "\n")
+	var b strings.Builder
+	for _, l := range lines {
+		if l != "" && l != "\n" {
+			b.WriteString(pad)
+		}
+		b.WriteString(l)
+	}
+	return b.String(), nil
+}
+
+// scalarTokenLen returns the length in bytes of the scalar token at the
+// start of s.
+func scalarTokenLen(s string, style yaml.Style) int {
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				return i + 1
+			}
+		}
+	case style&yaml.SingleQuotedStyle != 0:
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+	default:
+		end := len(s)
+		if i := strings.Index(s, " #"); i >= 0 {
+			end = i
+		}
+		return len(strings.TrimRight(s[:end], " \t\r"))
+	}
+	return len(s)
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const documentFixture = `# hop config — maintained by hand
+version: 1
+
+# Look and feel
+theme_preset: dracula # favourite
+
+defaults:
+  user: deploy
+
+connections:
+  # Production web tier
+  - id: web1
+    host: web1.example.com # primary
+    project: shop
+    env: prod
+    tags: [web, prod]
+
+  # Database, do not touch
+  - id: db
+    host: db.example.com
+    port: 2222
+    options:
+      ServerAliveInterval: "30"
+
+  - id: cache
+    host: cache.example.com
+
+groups:
+  # everything customer facing
+  frontend: [web1, cache]
+`
+
+func loadFixture(t *testing.T, content string) (string, *Config) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestFile(t, path, content)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return path, cfg
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestSaveUnchangedIsByteIdentical(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got := readFile(t, path); got != documentFixture {
+		t.Errorf("unchanged save rewrote the file:\n%s", got)
+	}
+}
+
+func TestSaveUpdatesOnlyChangedField(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	conn := *cfg.FindConnection("db")
+	conn.Host = "db2.example.com"
+	cfg.UpdateConnection("db", conn)
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	want := strings.Replace(documentFixture, "host: db.example.com", "host: db2.example.com", 1)
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSaveKeepsLineCommentsAndFlowStyle(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	conn := *cfg.FindConnection("web1")
+	conn.Host = "web1.internal"
+	conn.Tags = append(conn.Tags, "edge")
+	cfg.UpdateConnection("web1", conn)
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	want := strings.Replace(documentFixture,
+		"    host: web1.example.com # primary\n", "    host: web1.internal # primary\n", 1)
+	want = strings.Replace(want, "tags: [web, prod]", "tags: [web, prod, edge]", 1)
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSaveDoesNotBakeInDefaults(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	cfg.AddConnection(Connection{ID: "new", Host: "new.example.com", User: "deploy", Port: 22})
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got := readFile(t, path)
+	want := strings.Replace(documentFixture,
+		"    host: cache.example.com\n",
+		"    host: cache.example.com\n\n  - id: new\n    host: new.example.com\n", 1)
+	if got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+	if strings.Count(got, "user: deploy") != 1 {
+		t.Errorf("default user was written into connections:\n%s", got)
+	}
+}
+
+func TestSaveDeleteRemovesItemAndItsComment(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	cfg.DeleteConnection("db")
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	want := strings.Replace(documentFixture, `  # Database, do not touch
+  - id: db
+    host: db.example.com
+    port: 2222
+    options:
+      ServerAliveInterval: "30"
+
+`, "", 1)
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSaveDuplicateAppendsCopy(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	dup := cfg.FindConnection("cache").Clone()
+	dup.ID = cfg.SuggestDuplicateID("cache")
+	cfg.AddConnection(dup)
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got := readFile(t, path)
+	if !strings.Contains(got, "  - id: cache\n    host: cache.example.com\n\n  - id: cache-copy\n    host: cache.example.com\n\ngroups:") {
+		t.Errorf("duplicate not appended after source:\n%s", got)
+	}
+	if !strings.HasPrefix(got, documentFixture[:strings.Index(documentFixture, "  - id: cache")]) {
+		t.Errorf("content before the edit changed:\n%s", got)
+	}
+}
+
+func TestSaveTopLevelScalars(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	cfg.ThemePreset = "nord"
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	want := strings.Replace(documentFixture, "theme_preset: dracula # favourite", "theme_preset: nord # favourite", 1)
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+
+	cfg.ThemePreset = ""
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got := readFile(t, path); strings.Contains(got, "theme_preset") {
+		t.Errorf("cleared theme_preset still present:\n%s", got)
+	}
+}
+
+func TestSaveInsertsNewTopLevelKeyInOrder(t *testing.T) {
+	path, cfg := loadFixture(t, "version: 1\n\n# servers\nconnections:\n  - id: a\n    host: a.example.com\n")
+
+	cfg.ThemePreset = "nord"
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	want := "version: 1\n\ntheme_preset: nord\n\n# servers\nconnections:\n  - id: a\n    host: a.example.com\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSaveMergesGroupsKeepingComments(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	cfg.Groups["backend"] = []string{"db"}
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got := readFile(t, path)
+	if !strings.Contains(got, "  # everything customer facing\n  frontend: [web1, cache]\n  backend:\n    - db\n") {
+		t.Errorf("groups not merged in place:\n%s", got)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(reloaded.Groups) != 2 {
+		t.Errorf("Groups = %v, want 2 groups", reloaded.Groups)
+	}
+}
+
+func TestSaveRepeatedEditsStayAttached(t *testing.T) {
+	path, cfg := loadFixture(t, documentFixture)
+
+	cfg.AddConnection(Connection{ID: "new", Host: "new.example.com"})
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("first Save() error = %v", err)
+	}
+
+	// The same in-memory config must diff against what was just written.
+	conn := *cfg.FindConnection("new")
+	conn.Host = "renamed.example.com"
+	cfg.UpdateConnection("new", conn)
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("second Save() error = %v", err)
+	}
+
+	got := readFile(t, path)
+	if strings.Count(got, "id: new") != 1 || !strings.Contains(got, "host: renamed.example.com") {
+		t.Errorf("second save did not update the added entry:\n%s", got)
+	}
+}
+
+func TestSaveFlowConnectionsRewritesKey(t *testing.T) {
+	path, cfg := loadFixture(t, "# header\nversion: 1\nconnections: []\n")
+
+	cfg.AddConnection(Connection{ID: "a", Host: "a.example.com"})
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	want := "# header\nversion: 1\nconnections:\n  - id: a\n    host: a.example.com\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxBackups is the number of timestamped config backups kept in the backup
+// ring. Older backups are pruned whenever a new one is written.
+const MaxBackups = 10
+
+// backupTimeLayout is the timestamp embedded in backup file names. It sorts
+// lexically in chronological order and has nanosecond precision so that
+// back-to-back saves never collide.
+const backupTimeLayout = "20060102-150405.000000000"
+
+// Backup describes one entry in the config backup ring.
+type Backup struct {
+	Path    string
+	Created time.Time
+	Size    int64
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path and renames it into place, so readers only ever observe the old or the
+// new content and a crash mid-write can never leave a truncated file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once the rename has succeeded
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself; best-effort since not every filesystem
+	// supports syncing a directory.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// BackupDir returns the directory holding backups of the config at path.
+func BackupDir(path string) string {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	return filepath.Join(filepath.Dir(path), "backups")
+}
+
+// backupRing is where the backups of one file live: files named
+// <name>.<timestamp>.bak in dir.
+type backupRing struct {
+	dir  string
+	name string
+}
+
+// ringFor returns the backup ring of the config at path.
+func ringFor(path string) backupRing {
+	return backupRing{dir: BackupDir(path), name: filepath.Base(path)}
+}
+
+// includeRing returns the backup ring of a file included by the config at
+// main. It shares main's backup directory, so included files never get a
+// backups directory of their own; the name is the file's path relative to
+// main's directory, escaped so that it is a single path element and can't
+// collide with another include's.
+func includeRing(main, path string) backupRing {
+	name := path
+	if rel, err := filepath.Rel(filepath.Dir(main), path); err == nil && !strings.HasPrefix(rel, "..") {
+		name = rel
+	}
+	return backupRing{dir: BackupDir(main), name: url.QueryEscape(filepath.ToSlash(name))}
+}
+
+// backupFile copies the current content of path into ring and prunes the ring
+// to MaxBackups entries. A missing file, or one identical to the newest
+// backup, is not backed up again.
+func backupFile(path string, ring backupRing) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	backups, err := ring.list()
+	if err != nil {
+		return err
+	}
+	if len(backups) > 0 {
+		if latest, err := os.ReadFile(backups[0].Path); err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(ring.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	name := fmt.Sprintf("%s.%s.bak", ring.name, time.Now().UTC().Format(backupTimeLayout))
+	if err := writeFileAtomic(filepath.Join(ring.dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return ring.prune(MaxBackups)
+}
+
+// prune removes all but the newest keep backups in the ring.
+func (r backupRing) prune(keep int) error {
+	backups, err := r.list()
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBackups returns the backups of the config at path, newest first.
+func ListBackups(path string) ([]Backup, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	return ringFor(path).list()
+}
+
+// list returns the backups in the ring, newest first.
+func (r backupRing) list() ([]Backup, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	prefix := r.name + "."
+	var backups []Backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bak")
+		created, err := time.Parse(backupTimeLayout, stamp)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{
+			Path:    filepath.Join(r.dir, name),
+			Created: created,
+			Size:    info.Size(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// RestoreBackup replaces the config at path with the content of backupPath.
+// The backup must parse as a config file. The current config is itself backed
+// up first, so a restore can always be undone.
+func RestoreBackup(path, backupPath string) error {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if _, err := parse(data); err != nil {
+		return fmt.Errorf("backup %s is not a valid config: %w", filepath.Base(backupPath), err)
+	}
+
+	unlock, err := lockPath(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeConfigFile(path, data)
+}
+
+// writeConfigFile backs up the current file at path and atomically replaces
+// it with data. Callers must hold the lock on path.
+func writeConfigFile(path string, data []byte) error {
+	return writeBackedUp(path, ringFor(path), data)
+}
+
+// writeBackedUp is writeConfigFile with the backup kept in ring.
+func writeBackedUp(path string, ring backupRing, data []byte) error {
+	if err := backupFile(path, ring); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
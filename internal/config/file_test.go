@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, path, "old")
+
+	if err := writeFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("content = %q, want %q", data, "new")
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// No temp files may be left behind.
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only config.yaml in dir, got %v", names)
+	}
+}
+
+func TestSaveKeepsBackupRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	cfg := &Config{Version: 1}
+	for i := 0; i < MaxBackups+3; i++ {
+		cfg.Connections = append(cfg.Connections, Connection{ID: fmt.Sprintf("s%d", i), Host: "h"})
+		if err := cfg.Save(path); err != nil {
+			t.Fatalf("Save() #%d error = %v", i, err)
+		}
+	}
+
+	backups, err := ListBackups(path)
+	if err != nil {
+		t.Fatalf("ListBackups() error = %v", err)
+	}
+	if len(backups) != MaxBackups {
+		t.Fatalf("expected %d backups, got %d", MaxBackups, len(backups))
+	}
+	for i := 1; i < len(backups); i++ {
+		if backups[i].Created.After(backups[i-1].Created) {
+			t.Errorf("backups not sorted newest first at %d", i)
+		}
+	}
+
+	// The newest backup holds the config as it was before the last save.
+	restored, err := Load(backups[0].Path)
+	if err != nil {
+		t.Fatalf("Load(backup) error = %v", err)
+	}
+	if got, want := len(restored.Connections), MaxBackups+2; got != want {
+		t.Errorf("newest backup has %d connections, want %d", got, want)
+	}
+}
+
+func TestSaveSkipsIdenticalBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := &Config{Version: 1, Connections: []Connection{{ID: "a", Host: "h"}}}
+
+	for i := 0; i < 3; i++ {
+		if err := cfg.Save(path); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	backups, _ := ListBackups(path)
+	if len(backups) != 1 {
+		t.Errorf("expected 1 backup for unchanged saves, got %d", len(backups))
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	first := &Config{Version: 1, Connections: []Connection{{ID: "first", Host: "h"}}}
+	if err := first.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	second := &Config{Version: 1, Connections: []Connection{{ID: "second", Host: "h"}}}
+	if err := second.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := ListBackups(path)
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %d", len(backups))
+	}
+	if err := RestoreBackup(path, backups[0].Path); err != nil {
+		t.Fatalf("RestoreBackup() error = %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FindConnection("first") == nil {
+		t.Error("expected restored config to contain 'first'")
+	}
+
+	// The replaced config was backed up, so the restore can be undone.
+	backups, _ = ListBackups(path)
+	if len(backups) != 2 {
+		t.Errorf("expected 2 backups after restore, got %d", len(backups))
+	}
+}
+
+func TestRestoreBackupRejectsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, path, "version: 1\nconnections: []\n")
+	bad := filepath.Join(dir, "bad.bak")
+	writeTestFile(t, bad, "connections: [unterminated\n")
+
+	err := RestoreBackup(path, bad)
+	if err == nil || !strings.Contains(err.Error(), "not a valid config") {
+		t.Fatalf("expected invalid backup error, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "version: 1\nconnections: []\n" {
+		t.Error("config must be untouched when restore fails")
+	}
+}
+
+func TestUpdate_ConcurrentWritersKeepAllEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestFile(t, path, "version: 1\nconnections: []\n")
+
+	const writers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := Update(path, func(c *Config) error {
+				c.AddConnection(Connection{ID: fmt.Sprintf("w%d", i), Host: "h"})
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Update() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Connections) != writers {
+		t.Errorf("expected %d connections, got %d (lost updates)", writers, len(cfg.Connections))
+	}
+}
+
+func TestUpdate_ErrorWritesNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := "version: 1\nconnections: []\n"
+	writeTestFile(t, path, original)
+
+	_, err := Update(path, func(c *Config) error {
+		c.AddConnection(Connection{ID: "x", Host: "h"})
+		return fmt.Errorf("abort")
+	})
+	if err == nil {
+		t.Fatal("expected error from Update")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != original {
+		t.Errorf("config changed despite error:\n%s", data)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ForwardType is the kind of port forward: ssh -L, -R or -D.
+type ForwardType string
+
+const (
+	// ForwardLocal listens on this machine and connects to Target from the
+	// server (ssh -L). It is the default.
+	ForwardLocal ForwardType = "local"
+	// ForwardRemote listens on the server and connects to Target from this
+	// machine (ssh -R).
+	ForwardRemote ForwardType = "remote"
+	// ForwardDynamic runs a SOCKS proxy on this machine that connects out
+	// from the server (ssh -D).
+	ForwardDynamic ForwardType = "dynamic"
+)
+
+// Forward is a named port forward that hop tunnel keeps open over a
+// connection.
+type Forward struct {
+	Name        string      `yaml:"name"`
+	Type        ForwardType `yaml:"type,omitempty"`
+	BindAddress string      `yaml:"bind_address,omitempty"`
+	ListenPort  int         `yaml:"listen_port"`
+	Target      string      `yaml:"target,omitempty"`
+}
+
+// EffectiveType returns the forward's type, ForwardLocal when unset.
+func (f *Forward) EffectiveType() ForwardType {
+	if f.Type == "" {
+		return ForwardLocal
+	}
+	return f.Type
+}
+
+// FindForward returns the connection's forward with the given name, or nil.
+func (c *Connection) FindForward(name string) *Forward {
+	for i := range c.Forwards {
+		if c.Forwards[i].Name == name {
+			return &c.Forwards[i]
+		}
+	}
+	return nil
+}
+
+// mergeForwards adds src's forwards to dst, replacing forwards with the same
+// name, so a connection can add to or override the forwards it inherits.
+func mergeForwards(dst, src []Forward) []Forward {
+	for _, f := range src {
+		replaced := false
+		for i := range dst {
+			if dst[i].Name == f.Name {
+				dst[i] = f
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst = append(dst, f)
+		}
+	}
+	return dst
+}
+
+// validateForwards checks the connection's forwards; field names are
+// relative to the connection.
+func (c *Connection) validateForwards() ValidationErrors {
+	var errs ValidationErrors
+	seen := make(map[string]bool)
+	for i, f := range c.Forwards {
+		field := fmt.Sprintf("forwards[%d]", i)
+		add := func(key, msg string) {
+			errs = append(errs, ValidationError{Field: field + key, Message: msg})
+		}
+
+		switch {
+		case f.Name == "":
+			add(".name", "is required")
+		case seen[f.Name]:
+			add(".name", fmt.Sprintf("duplicate forward '%s'", f.Name))
+		}
+		seen[f.Name] = true
+
+		if f.ListenPort < 1 || f.ListenPort > 65535 {
+			add(".listen_port", "must be between 1 and 65535")
+		}
+
+		switch f.EffectiveType() {
+		case ForwardLocal, ForwardRemote:
+			if f.Target == "" {
+				add(".target", "is required (host:port)")
+			} else if host, port, err := net.SplitHostPort(f.Target); err != nil || host == "" || !validPort(port) {
+				add(".target", fmt.Sprintf("%q is not host:port", f.Target))
+			}
+		case ForwardDynamic:
+			if f.Target != "" {
+				add(".target", "is not used by dynamic forwards")
+			}
+		default:
+			add(".type", fmt.Sprintf("unknown type %q (want local, remote or dynamic)", f.Type))
+		}
+	}
+	return errs
+}
+
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 1 && n <= 65535
+}
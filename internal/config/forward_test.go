@@ -0,0 +1,120 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const forwardFixture = `version: 1
+templates:
+  postgres:
+    forwards:
+      - name: pg
+        listen_port: 5432
+        target: localhost:5432
+      - name: metrics
+        listen_port: 9187
+        target: localhost:9187
+connections:
+  - id: db1
+    host: db1.internal
+    extends: [postgres]
+    forwards:
+      - name: pg
+        listen_port: 15432
+        target: localhost:5432
+      - name: socks
+        type: dynamic
+        listen_port: 1080
+`
+
+func TestForwardsMergeByName(t *testing.T) {
+	cfg, err := parse([]byte(forwardFixture))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	db := cfg.FindConnection("db1")
+	want := []Forward{
+		{Name: "pg", ListenPort: 15432, Target: "localhost:5432"},
+		{Name: "metrics", ListenPort: 9187, Target: "localhost:9187"},
+		{Name: "socks", Type: ForwardDynamic, ListenPort: 1080},
+	}
+	if !reflect.DeepEqual(db.Forwards, want) {
+		t.Errorf("forwards = %+v, want %+v", db.Forwards, want)
+	}
+	if got := db.Origin("forwards.metrics"); got != TemplateOrigin("postgres") {
+		t.Errorf("Origin(forwards.metrics) = %q", got)
+	}
+	if got := db.Origin("forwards.pg"); got != "" {
+		t.Errorf("Origin(forwards.pg) = %q, want the connection's own", got)
+	}
+	if f := db.FindForward("socks"); f == nil || f.EffectiveType() != ForwardDynamic {
+		t.Errorf("FindForward(socks) = %+v", f)
+	}
+}
+
+func TestSaveKeepsInheritedForwardsOut(t *testing.T) {
+	path, cfg := loadFixture(t, forwardFixture)
+
+	dup := cfg.FindConnection("db1").Clone()
+	dup.ID = "db2"
+	cfg.AddConnection(dup)
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	added := readFile(t, path)[len(forwardFixture):]
+	if strings.Contains(added, "metrics") {
+		t.Errorf("inherited forward written to the new entry:\n%s", added)
+	}
+	if !strings.Contains(added, "name: pg") || !strings.Contains(added, "name: socks") {
+		t.Errorf("own forwards missing from the new entry:\n%s", added)
+	}
+}
+
+func TestValidateForwards(t *testing.T) {
+	tests := []struct {
+		name    string
+		forward Forward
+		wantErr string
+	}{
+		{"valid local", Forward{Name: "a", ListenPort: 8080, Target: "app:80"}, ""},
+		{"valid ipv6 target", Forward{Name: "a", ListenPort: 8080, Target: "[fd00::1]:80"}, ""},
+		{"missing name", Forward{ListenPort: 8080, Target: "app:80"}, "forwards[0].name: is required"},
+		{"bad port", Forward{Name: "a", ListenPort: 70000, Target: "app:80"}, "forwards[0].listen_port"},
+		{"missing target", Forward{Name: "a", Type: ForwardRemote, ListenPort: 8080}, "forwards[0].target: is required"},
+		{"target without port", Forward{Name: "a", ListenPort: 8080, Target: "app"}, "is not host:port"},
+		{"dynamic with target", Forward{Name: "a", Type: ForwardDynamic, ListenPort: 1080, Target: "app:80"}, "not used by dynamic"},
+		{"unknown type", Forward{Name: "a", Type: "udp", ListenPort: 1080}, "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Version: CurrentVersion, Connections: []Connection{
+				{ID: "db1", Host: "db1", Forwards: []Forward{tt.forward}},
+			}}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg := Config{Version: CurrentVersion, Connections: []Connection{{ID: "db1", Host: "db1", Forwards: []Forward{
+		{Name: "a", ListenPort: 1, Target: "x:1"},
+		{Name: "a", ListenPort: 2, Target: "x:2"},
+	}}}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "duplicate forward 'a'") {
+		t.Errorf("Validate() = %v, want duplicate forward", err)
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,9 +17,39 @@ type History struct {
 
 // HistoryEntry represents a single connection usage record
 type HistoryEntry struct {
-	ID        string    `yaml:"id"`
-	LastUsed  time.Time `yaml:"last_used"`
-	UseCount  int       `yaml:"use_count"`
+	ID           string    `yaml:"id"`
+	LastUsed     time.Time `yaml:"last_used"`
+	UseCount     int       `yaml:"use_count"`
+	LastKind     UsageKind `yaml:"last_kind,omitempty"`
+	LastExitCode *int      `yaml:"last_exit_code,omitempty"`
+}
+
+// UsageKind describes how a connection was accessed.
+type UsageKind string
+
+const (
+	// UsageInteractive is an interactive ssh/mosh session (dashboard, hop <query>, hop connect).
+	UsageInteractive UsageKind = "interactive"
+	// UsageExec is a non-interactive command run via hop exec or the MCP exec_command tool.
+	UsageExec UsageKind = "exec"
+	// UsageTab is a session opened in a new terminal tab via hop open.
+	UsageTab UsageKind = "tab"
+	// UsageTransfer is a file copy via hop cp or hop sync.
+	UsageTransfer UsageKind = "transfer"
+)
+
+// Usage is a single access to a connection, as recorded by RecordUsages.
+// ExitCode is nil when the exit status is not observable (e.g. a session
+// launched in a separate terminal tab).
+type Usage struct {
+	ID       string
+	Kind     UsageKind
+	ExitCode *int
+}
+
+// ExitStatus returns a pointer to code, for use in Usage literals.
+func ExitStatus(code int) *int {
+	return &code
 }
 
 // DefaultHistoryPath returns the default path for the history file
@@ -72,27 +103,81 @@ func (h *History) SaveToPath(path string) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0600)
+	return writeFileAtomic(path, data, 0600)
 }
 
 // RecordUsage records a connection usage
 func (h *History) RecordUsage(id string) {
-	now := time.Now()
+	h.entry(id).touch()
+}
+
+// Record records a connection usage along with its kind and exit status.
+func (h *History) Record(u Usage) {
+	e := h.entry(u.ID)
+	e.touch()
+	e.LastKind = u.Kind
+	e.LastExitCode = nil
+	if u.ExitCode != nil {
+		e.LastExitCode = ExitStatus(*u.ExitCode)
+	}
+}
 
+// entry returns the entry for id, appending a new zero-use entry if needed.
+func (h *History) entry(id string) *HistoryEntry {
 	for i := range h.Entries {
 		if h.Entries[i].ID == id {
-			h.Entries[i].LastUsed = now
-			h.Entries[i].UseCount++
-			return
+			return &h.Entries[i]
 		}
 	}
+	h.Entries = append(h.Entries, HistoryEntry{ID: id})
+	return &h.Entries[len(h.Entries)-1]
+}
 
-	// New entry
-	h.Entries = append(h.Entries, HistoryEntry{
-		ID:        id,
-		LastUsed:  now,
-		UseCount:  1,
-	})
+func (e *HistoryEntry) touch() {
+	e.LastUsed = time.Now()
+	e.UseCount++
+}
+
+// RecordUsages records one or more connection usages in the default history
+// file. See RecordUsagesToPath.
+func RecordUsages(usages ...Usage) (*History, error) {
+	return RecordUsagesToPath(DefaultHistoryPath(), usages...)
+}
+
+// RecordUsagesToPath is the single entry point every access path (dashboard,
+// quick connect, connect, open, exec, MCP) uses to update the history file.
+// The file is re-read under an exclusive lock, updated and written back, so
+// concurrent hop processes never drop each other's records. It returns the
+// updated history.
+func RecordUsagesToPath(path string, usages ...Usage) (*History, error) {
+	if path == "" {
+		return nil, fmt.Errorf("history path is not set")
+	}
+	if len(usages) == 0 {
+		return LoadHistoryFromPath(path)
+	}
+	// 0700: see SaveToPath.
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockPath(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	h, err := LoadHistoryFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range usages {
+		h.Record(u)
+	}
+	if err := h.SaveToPath(path); err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
 // GetRecent returns the most recently used connection IDs
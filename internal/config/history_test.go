@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -173,3 +174,80 @@ func TestHistory_SaveCreatesDirectory(t *testing.T) {
 		t.Error("expected history file to exist")
 	}
 }
+
+func TestHistory_RecordKindAndExitCode(t *testing.T) {
+	h := &History{}
+
+	h.Record(Usage{ID: "server1", Kind: UsageExec, ExitCode: ExitStatus(3)})
+	e := h.Entries[0]
+	if e.LastKind != UsageExec {
+		t.Errorf("LastKind = %q, want %q", e.LastKind, UsageExec)
+	}
+	if e.LastExitCode == nil || *e.LastExitCode != 3 {
+		t.Errorf("LastExitCode = %v, want 3", e.LastExitCode)
+	}
+
+	// A tab launch has no observable exit status and must clear the old one.
+	h.Record(Usage{ID: "server1", Kind: UsageTab})
+	e = h.Entries[0]
+	if e.UseCount != 2 {
+		t.Errorf("UseCount = %d, want 2", e.UseCount)
+	}
+	if e.LastKind != UsageTab {
+		t.Errorf("LastKind = %q, want %q", e.LastKind, UsageTab)
+	}
+	if e.LastExitCode != nil {
+		t.Errorf("LastExitCode = %v, want nil", *e.LastExitCode)
+	}
+}
+
+func TestRecordUsagesToPath(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "hop", "history.yaml")
+
+	h, err := RecordUsagesToPath(historyPath,
+		Usage{ID: "web1", Kind: UsageExec, ExitCode: ExitStatus(0)},
+		Usage{ID: "web2", Kind: UsageExec, ExitCode: ExitStatus(1)},
+	)
+	if err != nil {
+		t.Fatalf("RecordUsagesToPath() error = %v", err)
+	}
+	if len(h.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(h.Entries))
+	}
+
+	loaded, err := LoadHistoryFromPath(historyPath)
+	if err != nil {
+		t.Fatalf("failed to load history: %v", err)
+	}
+	if got := loaded.GetUseCount("web2"); got != 1 {
+		t.Errorf("web2 use count = %d, want 1", got)
+	}
+	if code := loaded.Entries[1].LastExitCode; code == nil || *code != 1 {
+		t.Errorf("web2 exit code = %v, want 1", code)
+	}
+}
+
+func TestRecordUsagesToPath_Concurrent(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "history.yaml")
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := RecordUsagesToPath(historyPath, Usage{ID: "shared", Kind: UsageInteractive}); err != nil {
+				t.Errorf("RecordUsagesToPath() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	loaded, err := LoadHistoryFromPath(historyPath)
+	if err != nil {
+		t.Fatalf("failed to load history: %v", err)
+	}
+	if got := loaded.GetUseCount("shared"); got != writers {
+		t.Errorf("use count = %d, want %d (lost updates)", got, writers)
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfDirName is the drop-in directory next to config.yaml whose *.yaml and
+// *.yml files are merged after the main config and its include: patterns.
+const ConfDirName = "conf.d"
+
+// ConfDir returns the drop-in directory for the config at path.
+func ConfDir(path string) string {
+	return filepath.Join(filepath.Dir(path), ConfDirName)
+}
+
+// IncludedFiles returns the files merged into the config at path, in merge
+// order: every include: pattern (matches of one glob sorted by name), then the
+// conf.d directory. Relative patterns are resolved against the directory of
+// the main config. The main file itself and repeated matches are skipped.
+func (c *Config) IncludedFiles(path string) ([]string, error) {
+	baseDir := filepath.Dir(path)
+	seen := map[string]bool{filepath.Clean(path): true}
+	var files []string
+
+	add := func(matches []string) {
+		sort.Strings(matches)
+		for _, m := range matches {
+			m = filepath.Clean(m)
+			if seen[m] {
+				continue
+			}
+			if info, err := os.Stat(m); err != nil || info.IsDir() {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+
+	for _, pattern := range c.Include {
+		pattern = ExpandHome(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %q: %w", pattern, err)
+		}
+		add(matches)
+	}
+
+	var dropIns []string
+	for _, ext := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(ConfDir(path), ext))
+		if err != nil {
+			return nil, err
+		}
+		dropIns = append(dropIns, matches...)
+	}
+	add(dropIns)
+
+	return files, nil
+}
+
+// loadIncludes merges the connections and groups of every included file into
+// c. Included files are fragments: only their connections and groups are
+// used, with the main config's defaults and templates applied. Version,
+// theme, defaults, templates and include: are read from the main config only.
+func (c *Config) loadIncludes(path string) error {
+	files, err := c.IncludedFiles(path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read included config: %w", err)
+		}
+
+		var layer Config
+		if err := yaml.Unmarshal(data, &layer); err != nil {
+			return fmt.Errorf("failed to parse included config %s: %w", file, err)
+		}
+		layer.Defaults = c.Defaults
+		layer.Templates = c.Templates
+		layer.applyDefaults()
+		layer.attachDocument(data)
+		layer.path = file
+
+		for _, conn := range layer.Connections {
+			conn.Source = file
+			c.Connections = append(c.Connections, conn)
+		}
+		for name, members := range layer.Groups {
+			if _, exists := c.Groups[name]; exists {
+				// The first definition wins; Validate reports the clash.
+				continue
+			}
+			if c.Groups == nil {
+				c.Groups = make(map[string][]string)
+			}
+			if c.groupSources == nil {
+				c.groupSources = make(map[string]string)
+			}
+			c.Groups[name] = members
+			c.groupSources[name] = file
+		}
+		c.layers = append(c.layers, &layer)
+	}
+	return nil
+}
+
+// layerFor returns the included file config that owns source, or nil when
+// source belongs to the main config.
+func (c *Config) layerFor(source string) *Config {
+	if source == "" {
+		return nil
+	}
+	for _, l := range c.layers {
+		if l.path == source {
+			return l
+		}
+	}
+	return nil
+}
+
+// view returns the part of c stored in layer (nil for the main config):
+// its own connections and groups, with the layer's document attached.
+// Inventory connections belong to no file.
+func (c *Config) view(layer *Config) *Config {
+	var v Config
+	if layer == nil {
+		v = *c
+	} else {
+		v = *layer
+	}
+	v.layers, v.inventoryStatus = nil, nil
+	v.Connections = nil
+	for _, conn := range c.Connections {
+		if c.layerFor(conn.Source) == layer && !conn.ReadOnly() {
+			v.Connections = append(v.Connections, conn)
+		}
+	}
+
+	v.Groups = nil
+	for name, members := range c.Groups {
+		if c.layerFor(c.groupSources[name]) != layer {
+			continue
+		}
+		if v.Groups == nil {
+			v.Groups = make(map[string][]string)
+		}
+		v.Groups[name] = members
+	}
+	return &v
+}
+
+// writeLayers writes back every included file whose content changed, keeping
+// their backups alongside those of the main config at path. Callers must hold
+// the lock on path.
+func (c *Config) writeLayers(path string) error {
+	for _, layer := range c.layers {
+		data, err := c.view(layer).marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", layer.path, err)
+		}
+		if old, err := os.ReadFile(layer.path); err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err := writeBackedUp(layer.path, includeRing(path, layer.path), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectionField returns the field prefix used in validation messages for
+// connection i, naming the included file or inventory it comes from when it
+// isn't the main config.
+func (c *Config) connectionField(i int) string {
+	source := c.Connections[i].Source
+	if c.layerFor(source) == nil && !c.Connections[i].ReadOnly() {
+		return fmt.Sprintf("connections[%d]", i)
+	}
+	n := 0
+	for j := 0; j < i; j++ {
+		if c.Connections[j].Source == source {
+			n++
+		}
+	}
+	return fmt.Sprintf("%s: connections[%d]", source, n)
+}
+
+// ExpandHome replaces a leading ~ in path with the user's home directory.
+func ExpandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
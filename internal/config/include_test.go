@@ -0,0 +1,259 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// layeredFixture writes a main config including team/*.yaml plus a conf.d
+// drop-in and returns the main config path.
+func layeredFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, d := range []string{"team", ConfDirName} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), `version: 1
+include:
+  - team/*.yaml
+defaults:
+  user: deploy
+connections:
+  - id: mine
+    host: mine.example.com
+groups:
+  personal: [mine]
+`)
+	writeTestFile(t, filepath.Join(dir, "team", "b.yaml"), `# shared team inventory
+connections:
+  - id: team-db
+    host: db.example.com
+`)
+	writeTestFile(t, filepath.Join(dir, "team", "a.yaml"), `connections:
+  - id: team-web
+    host: web.example.com # behind the LB
+groups:
+  team: [team-web, team-db]
+`)
+	writeTestFile(t, filepath.Join(dir, ConfDirName, "laptop.yml"), `connections:
+  - id: laptop
+    host: laptop.local
+    port: 2222
+`)
+	return filepath.Join(dir, "config.yaml")
+}
+
+func TestLoadMergesIncludesInOrder(t *testing.T) {
+	path := layeredFixture(t)
+	dir := filepath.Dir(path)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	want := []struct{ id, source string }{
+		{"mine", path},
+		{"team-web", filepath.Join(dir, "team", "a.yaml")},
+		{"team-db", filepath.Join(dir, "team", "b.yaml")},
+		{"laptop", filepath.Join(dir, ConfDirName, "laptop.yml")},
+	}
+	if len(cfg.Connections) != len(want) {
+		t.Fatalf("got %d connections, want %d", len(cfg.Connections), len(want))
+	}
+	for i, w := range want {
+		conn := cfg.Connections[i]
+		if conn.ID != w.id || conn.Source != w.source {
+			t.Errorf("connections[%d] = %s from %s, want %s from %s", i, conn.ID, conn.Source, w.id, w.source)
+		}
+	}
+
+	// Defaults from the main config apply to included connections.
+	if u := cfg.FindConnection("team-db").User; u != "deploy" {
+		t.Errorf("team-db user = %q, want deploy", u)
+	}
+	if p := cfg.FindConnection("laptop").Port; p != 2222 {
+		t.Errorf("laptop port = %d, want 2222", p)
+	}
+	if len(cfg.Groups["team"]) != 2 || len(cfg.Groups["personal"]) != 1 {
+		t.Errorf("Groups = %v, want personal and team merged", cfg.Groups)
+	}
+}
+
+func TestSaveWritesBackToOwningFile(t *testing.T) {
+	path := layeredFixture(t)
+	dir := filepath.Dir(path)
+	teamA := filepath.Join(dir, "team", "a.yaml")
+	teamB := filepath.Join(dir, "team", "b.yaml")
+	mainBefore := readFile(t, path)
+	teamBBefore := readFile(t, teamB)
+
+	_, err := Update(path, func(c *Config) error {
+		conn := *c.FindConnection("team-web")
+		conn.Host = "web2.example.com"
+		c.UpdateConnection("team-web", conn)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if got := readFile(t, teamA); !strings.Contains(got, "host: web2.example.com # behind the LB") {
+		t.Errorf("team/a.yaml not updated in place:\n%s", got)
+	}
+	if got := readFile(t, path); got != mainBefore {
+		t.Errorf("main config changed:\n%s", got)
+	}
+	if got := readFile(t, teamB); got != teamBBefore {
+		t.Errorf("team/b.yaml changed:\n%s", got)
+	}
+	if backups, _ := includeRing(path, teamB).list(); len(backups) != 0 {
+		t.Errorf("untouched include was backed up: %v", backups)
+	}
+	if backups, _ := includeRing(path, teamA).list(); len(backups) != 1 || filepath.Dir(backups[0].Path) != BackupDir(path) {
+		t.Errorf("backups of team/a.yaml = %v, want 1 in %s", backups, BackupDir(path))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "team", "backups")); !os.IsNotExist(err) {
+		t.Errorf("included file got its own backup directory: %v", err)
+	}
+	if backups, _ := ListBackups(path); len(backups) != 1 {
+		t.Errorf("ListBackups(main) = %v, want only the main config's backup", backups)
+	}
+}
+
+func TestIncludeRingNames(t *testing.T) {
+	main := filepath.Join("/home/u/.config/hop", "config.yaml")
+	names := map[string]bool{}
+	for _, path := range []string{
+		"/home/u/.config/hop/team/a.yaml",
+		"/home/u/.config/hop/team_a.yaml",
+		"/home/u/.config/hop/conf.d/a.yaml",
+		"/etc/hop/team/a.yaml",
+	} {
+		ring := includeRing(main, path)
+		if ring.dir != BackupDir(main) {
+			t.Errorf("includeRing(%q).dir = %q, want %q", path, ring.dir, BackupDir(main))
+		}
+		if strings.Contains(ring.name, "/") || names[ring.name] {
+			t.Errorf("includeRing(%q).name = %q, want a unique file name", path, ring.name)
+		}
+		names[ring.name] = true
+	}
+}
+
+func TestSaveNewConnectionGoesToMain(t *testing.T) {
+	path := layeredFixture(t)
+	dir := filepath.Dir(path)
+	laptop := filepath.Join(dir, ConfDirName, "laptop.yml")
+	laptopBefore := readFile(t, laptop)
+
+	cfg, err := Update(path, func(c *Config) error {
+		c.AddConnection(Connection{ID: "extra", Host: "extra.example.com"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if got := readFile(t, path); !strings.Contains(got, "id: extra") {
+		t.Errorf("new connection not written to main config:\n%s", got)
+	}
+	if got := readFile(t, laptop); got != laptopBefore {
+		t.Errorf("conf.d file changed:\n%s", got)
+	}
+	if src := cfg.FindConnection("extra").Source; src != path {
+		t.Errorf("Source = %q, want %q", src, path)
+	}
+}
+
+func TestSaveDeleteFromIncludedFile(t *testing.T) {
+	path := layeredFixture(t)
+	teamB := filepath.Join(filepath.Dir(path), "team", "b.yaml")
+
+	_, err := Update(path, func(c *Config) error {
+		c.DeleteConnection("team-db")
+		c.Groups["team"] = []string{"team-web"}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if got := readFile(t, teamB); strings.Contains(got, "team-db") || !strings.Contains(got, "# shared team inventory") {
+		t.Errorf("team/b.yaml = %q, want connection removed and comment kept", got)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.FindConnection("team-db") != nil {
+		t.Error("team-db still present after delete")
+	}
+	if got := cfg.Groups["team"]; len(got) != 1 || got[0] != "team-web" {
+		t.Errorf("team group = %v, want [team-web]", got)
+	}
+	if strings.Contains(readFile(t, path), "team:") {
+		t.Error("group owned by an include was written to the main config")
+	}
+}
+
+func TestValidateReportsIncludeConflicts(t *testing.T) {
+	path := layeredFixture(t)
+	dup := filepath.Join(ConfDir(path), "dup.yaml")
+	writeTestFile(t, dup, `connections:
+  - id: mine
+    host: other.example.com
+groups:
+  personal: [mine]
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want duplicate id and group errors")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, dup+": connections[0].id: duplicate id 'mine'") {
+		t.Errorf("duplicate id error does not name the file:\n%s", msg)
+	}
+	if !strings.Contains(msg, dup+": groups.personal: already defined in "+path) {
+		t.Errorf("duplicate group not reported:\n%s", msg)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	path := layeredFixture(t)
+	writeTestFile(t, filepath.Join(ConfDir(path), "broken.yaml"), "connections: [\n")
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "broken.yaml") {
+		t.Errorf("Load() error = %v, want parse error naming broken.yaml", err)
+	}
+}
+
+func TestIncludedFilesWithoutMainConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ConfDirName), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, ConfDirName, "only.yaml"), "connections:\n  - id: solo\n    host: solo.example.com\n")
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.FindConnection("solo") == nil {
+		t.Error("conf.d connection not loaded when config.yaml is missing")
+	}
+}
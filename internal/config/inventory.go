@@ -0,0 +1,516 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Inventory is a dynamic source of connections: a local executable that
+// prints a JSON list of connections on stdout, in the shape of
+// `hop list --json` or with the config file's keys. Its connections are
+// merged into Config.Connections on load but never written back; they are
+// replaced by the next run.
+type Inventory struct {
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args,omitempty"`
+	// TTL is how long the command's output is cached, as a Go duration
+	// ("5m", "1h"); "0" runs the command on every load.
+	TTL string `yaml:"ttl,omitempty"`
+	// Timeout bounds a run of the command.
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+const (
+	// DefaultInventoryTTL is how long inventory output is cached when ttl
+	// is unset.
+	DefaultInventoryTTL = 5 * time.Minute
+	// DefaultInventoryTimeout bounds an inventory command when timeout is
+	// unset.
+	DefaultInventoryTimeout = 30 * time.Second
+)
+
+// inventorySourcePrefix marks the Source of connections an inventory
+// produced, e.g. "inventory:aws".
+const inventorySourcePrefix = "inventory:"
+
+// InventorySource returns the Source label of connections produced by the
+// named inventory.
+func InventorySource(name string) string {
+	return inventorySourcePrefix + name
+}
+
+// Inventory returns the name of the inventory the connection came from, or
+// "" for connections stored in a config file.
+func (c *Connection) Inventory() string {
+	if name, ok := strings.CutPrefix(c.Source, inventorySourcePrefix); ok {
+		return name
+	}
+	return ""
+}
+
+// ReadOnly reports whether the connection can't be edited or deleted,
+// because it is regenerated by an inventory on every load.
+func (c *Connection) ReadOnly() bool {
+	return c.Inventory() != ""
+}
+
+// CacheTTL returns how long the inventory's output stays fresh. Invalid
+// values, which Validate reports, fall back to the default.
+func (inv *Inventory) CacheTTL() time.Duration {
+	if inv.TTL == "" {
+		return DefaultInventoryTTL
+	}
+	d, err := time.ParseDuration(inv.TTL)
+	if err != nil || d < 0 {
+		return DefaultInventoryTTL
+	}
+	return d
+}
+
+// CommandTimeout returns how long a run of the inventory's command may take.
+func (inv *Inventory) CommandTimeout() time.Duration {
+	if inv.Timeout == "" {
+		return DefaultInventoryTimeout
+	}
+	d, err := time.ParseDuration(inv.Timeout)
+	if err != nil || d <= 0 {
+		return DefaultInventoryTimeout
+	}
+	return d
+}
+
+// validate reports problems with the inventory's own settings; field is the
+// prefix for messages.
+func (inv *Inventory) validate(field string) ValidationErrors {
+	var errs ValidationErrors
+	switch {
+	case inv.Name == "":
+		errs = append(errs, ValidationError{Field: field + ".name", Message: "is required"})
+	case inv.Name == "." || inv.Name == ".." || strings.ContainsAny(inv.Name, `/\`):
+		// The name is also the cache file's name.
+		errs = append(errs, ValidationError{Field: field + ".name", Message: fmt.Sprintf("invalid name %q", inv.Name)})
+	}
+	if inv.Command == "" {
+		errs = append(errs, ValidationError{Field: field + ".command", Message: "is required"})
+	}
+	if v := inv.TTL; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			errs = append(errs, ValidationError{
+				Field:   field + ".ttl",
+				Message: fmt.Sprintf("invalid duration %q (e.g. 5m, 1h, or 0 to disable caching)", v),
+			})
+		}
+	}
+	if v := inv.Timeout; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			errs = append(errs, ValidationError{
+				Field:   field + ".timeout",
+				Message: fmt.Sprintf("invalid duration %q (e.g. 30s, 2m)", v),
+			})
+		}
+	}
+	return errs
+}
+
+// validateInventories reports invalid and duplicate inventory entries.
+func (c *Config) validateInventories() ValidationErrors {
+	var errs ValidationErrors
+	seen := make(map[string]bool)
+	for i := range c.Inventories {
+		inv := &c.Inventories[i]
+		field := fmt.Sprintf("inventories[%d]", i)
+		pos := c.KeyPosition("inventories")
+		for _, ve := range inv.validate(field) {
+			ve.Pos = pos
+			errs = append(errs, ve)
+		}
+		if inv.Name != "" && seen[inv.Name] {
+			errs = append(errs, ValidationError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("duplicate inventory '%s'", inv.Name),
+				Pos:     pos,
+			})
+		}
+		seen[inv.Name] = true
+	}
+	return errs
+}
+
+// InventoryStatus describes how an inventory's connections were loaded.
+type InventoryStatus struct {
+	Name string
+	// Connections is the number of connections merged into the config.
+	Connections int
+	// Fetched is when the command produced the output that was used; zero
+	// if there is none.
+	Fetched time.Time
+	// Ran reports whether the command ran during this load, rather than
+	// the output coming from the cache.
+	Ran bool
+	// Skipped describes entries that were left out, e.g. for clashing
+	// with an existing connection ID.
+	Skipped []string
+	// Err is why the command failed. Connections from a stale cache, if
+	// any, are used instead.
+	Err error
+}
+
+// InventoryStatuses returns how each inventory was loaded, in config order.
+func (c *Config) InventoryStatuses() []InventoryStatus {
+	return c.inventoryStatus
+}
+
+// InventoryCacheDir returns the directory caching inventory output for the
+// config at path.
+func InventoryCacheDir(path string) string {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	return filepath.Join(filepath.Dir(path), "cache", "inventories")
+}
+
+// RefreshInventories runs the named inventories' commands (all of them when
+// no names are given) regardless of their cache and replaces their
+// connections. Inventories whose command already ran while loading c are not
+// run again. Failures are reported in InventoryStatuses, as on load.
+func (c *Config) RefreshInventories(names ...string) error {
+	refresh := make(map[string]bool)
+	for _, name := range names {
+		if c.findInventory(name) == nil {
+			return fmt.Errorf("unknown inventory '%s'", name)
+		}
+		refresh[name] = true
+	}
+	if len(names) == 0 {
+		for _, inv := range c.Inventories {
+			refresh[inv.Name] = true
+		}
+	}
+	ran := make(map[string]bool)
+	for _, st := range c.inventoryStatus {
+		if st.Ran && st.Err == nil {
+			ran[st.Name] = true
+			delete(refresh, st.Name)
+		}
+	}
+
+	var static []Connection
+	for _, conn := range c.Connections {
+		if !conn.ReadOnly() {
+			static = append(static, conn)
+		}
+	}
+	c.Connections = static
+	c.loadInventories(refresh)
+	for i := range c.inventoryStatus {
+		if ran[c.inventoryStatus[i].Name] {
+			c.inventoryStatus[i].Ran = true
+		}
+	}
+	return nil
+}
+
+func (c *Config) findInventory(name string) *Inventory {
+	for i := range c.Inventories {
+		if c.Inventories[i].Name == name {
+			return &c.Inventories[i]
+		}
+	}
+	return nil
+}
+
+// inventoryCache is an inventory's cached output.
+type inventoryCache struct {
+	// Command is the command line that produced Output; a cache written
+	// for another command is ignored.
+	Command []string        `json:"command"`
+	Fetched time.Time       `json:"fetched_at"`
+	Output  json.RawMessage `json:"output"`
+}
+
+// inventoryRun says when loadInventory runs an inventory's command.
+type inventoryRun int
+
+const (
+	runStale  inventoryRun = iota // when the cached output is older than the TTL
+	runAlways                     // regardless of the cache
+	runNever                      // use the cached output however old, if any
+)
+
+// loadInventories merges the connections of every inventory into c, running
+// commands whose cached output is older than their TTL. Inventories named in
+// refresh run regardless of their cache. Failures don't fail the load: they
+// are recorded in InventoryStatuses and stale output is used when there is
+// some.
+func (c *Config) loadInventories(refresh map[string]bool) {
+	c.inventoryStatus = nil
+	for i := range c.Inventories {
+		inv := &c.Inventories[i]
+		if len(inv.validate("")) > 0 {
+			// Validate reports it.
+			continue
+		}
+		when := runStale
+		if refresh[inv.Name] {
+			when = runAlways
+		}
+		c.inventoryStatus = append(c.inventoryStatus, c.loadInventory(inv, when))
+	}
+}
+
+// loadCachedInventories merges the connections of every inventory's cached
+// output into c, however old, without running any command.
+func (c *Config) loadCachedInventories() {
+	c.inventoryStatus = nil
+	for i := range c.Inventories {
+		inv := &c.Inventories[i]
+		if len(inv.validate("")) > 0 {
+			continue
+		}
+		c.inventoryStatus = append(c.inventoryStatus, c.loadInventory(inv, runNever))
+	}
+}
+
+func (c *Config) loadInventory(inv *Inventory, when inventoryRun) InventoryStatus {
+	st := InventoryStatus{Name: inv.Name}
+	cachePath := filepath.Join(InventoryCacheDir(c.path), inv.Name+".json")
+	command := append([]string{inv.Command}, inv.Args...)
+
+	var entries []inventoryEntry
+	cache, cacheErr := readInventoryCache(cachePath, command)
+	if cacheErr == nil && (when == runNever || when == runStale && time.Since(cache.Fetched) < inv.CacheTTL()) {
+		entries, cacheErr = parseInventoryOutput(cache.Output)
+		st.Fetched = cache.Fetched
+	}
+	if (entries == nil || cacheErr != nil) && when != runNever {
+		output, err := c.runInventory(inv)
+		if err == nil {
+			entries, err = parseInventoryOutput(output)
+		}
+		st.Ran = true
+		if err != nil {
+			st.Err = err
+			// Fall back to the last good output.
+			entries = nil
+			if cacheErr == nil {
+				if stale, err := parseInventoryOutput(cache.Output); err == nil {
+					entries, st.Fetched = stale, cache.Fetched
+				}
+			}
+		} else {
+			st.Fetched = time.Now()
+			// The cache only saves runs; a failure to write it is harmless.
+			_ = writeInventoryCache(cachePath, inventoryCache{Command: command, Fetched: st.Fetched, Output: output})
+		}
+	}
+
+	ids := make(map[string]bool, len(c.Connections))
+	for _, conn := range c.Connections {
+		ids[conn.ID] = true
+	}
+	for i, e := range entries {
+		conn := e.conn
+		var reason string
+		if e.err != nil {
+			reason = e.err.Error()
+		} else {
+			reason = c.checkInventoryConnection(&conn, ids)
+		}
+		if reason != "" {
+			name := conn.ID
+			if name == "" {
+				name = fmt.Sprintf("entry %d", i)
+			}
+			st.Skipped = append(st.Skipped, fmt.Sprintf("%s: %s", name, reason))
+			continue
+		}
+		conn.Source = InventorySource(inv.Name)
+		conn.doc, conn.origins = nil, nil
+		c.resolveConnection(&conn)
+		ids[conn.ID] = true
+		c.Connections = append(c.Connections, conn)
+		st.Connections++
+	}
+	return st
+}
+
+// checkInventoryConnection returns why conn can't be merged, or "". Bad
+// entries are skipped rather than failing validation of the whole config,
+// since the user can't fix them in their config.
+func (c *Config) checkInventoryConnection(conn *Connection, ids map[string]bool) string {
+	switch {
+	case conn.ID == "":
+		return "no id"
+	case ids[conn.ID]:
+		return "id already used by another connection"
+	case conn.Host == "":
+		return "no host"
+	}
+	if err := conn.CheckSafety(); err != nil {
+		return err.Error()
+	}
+	if errs := c.validateExtends("", conn.Extends); len(errs) > 0 {
+		return errs[0].Message
+	}
+	if errs := conn.validateForwards(); len(errs) > 0 {
+		return errs[0].Error()
+	}
+	return ""
+}
+
+// runInventory runs the inventory's command in the config's directory and
+// returns its stdout. Commands with a relative path are resolved against
+// that directory; bare names are looked up in PATH.
+func (c *Config) runInventory(inv *Inventory) ([]byte, error) {
+	dir := filepath.Dir(c.path)
+	command := ExpandHome(inv.Command)
+	if !filepath.IsAbs(command) && strings.ContainsRune(command, filepath.Separator) {
+		command = filepath.Join(dir, command)
+	}
+
+	timeout := inv.CommandTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, inv.Args...)
+	cmd.Dir = dir
+	// Don't wait for children of a killed command that still hold stdout.
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", inv.Command, timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if msg := lastLine(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", inv.Command, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", inv.Command, err)
+	}
+	if err != nil {
+		// Starting the command failed; the error names it.
+		return nil, err
+	}
+	return out, nil
+}
+
+// inventoryEntry is one entry of an inventory's output: the connection it
+// decodes to, or why it can't be used.
+type inventoryEntry struct {
+	conn Connection
+	err  error
+}
+
+// parseInventoryOutput decodes a JSON list of connections. Keys may be
+// written as in hop list --json ("ProxyJump") or as in the config file
+// ("proxy_jump"), in any case. Entries with unknown keys or values of the
+// wrong type come back with an error, so they are skipped rather than
+// merged without the setting.
+func parseInventoryOutput(data []byte) ([]inventoryEntry, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid output: %w", err)
+	}
+	entries := make([]inventoryEntry, len(raw))
+	for i, r := range raw {
+		entries[i].conn, entries[i].err = decodeInventoryConnection(r)
+	}
+	return entries, nil
+}
+
+// decodeInventoryConnection decodes one inventory entry strictly. Config
+// file keys are turned into Go field names by dropping their underscores,
+// which encoding/json then matches case-insensitively. On error the
+// connection carries only its ID, if it has one, to name the entry.
+func decodeInventoryConnection(raw json.RawMessage) (Connection, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return Connection{}, errors.New("not a JSON object")
+	}
+	keys := make(map[string]string) // normalized -> as written
+	fields = normalizeInventoryKeys(fields, keys)
+	if forwards, ok := fields["forwards"]; ok {
+		var list []map[string]json.RawMessage
+		if json.Unmarshal(forwards, &list) == nil {
+			for i := range list {
+				list[i] = normalizeInventoryKeys(list[i], keys)
+			}
+			fields["forwards"], _ = json.Marshal(list)
+		}
+	}
+
+	var conn Connection
+	data, err := json.Marshal(fields)
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&conn)
+	}
+	if err != nil {
+		var id string
+		_ = json.Unmarshal(fields["id"], &id)
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			if key, uerr := strconv.Unquote(name); uerr == nil {
+				err = fmt.Errorf("unknown key %q", keys[key])
+			}
+		}
+		return Connection{ID: id}, err
+	}
+	return conn, nil
+}
+
+// normalizeInventoryKeys returns fields with the underscores dropped from
+// its keys and lower-cased, recording the keys as written in keys.
+func normalizeInventoryKeys(fields map[string]json.RawMessage, keys map[string]string) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		key := strings.ToLower(strings.ReplaceAll(k, "_", ""))
+		keys[key] = k
+		out[key] = v
+	}
+	return out
+}
+
+func readInventoryCache(path string, command []string) (*inventoryCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cache inventoryCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	if strings.Join(cache.Command, "\x00") != strings.Join(command, "\x00") {
+		return nil, errors.New("cache is for another command")
+	}
+	return &cache, nil
+}
+
+func writeInventoryCache(path string, cache inventoryCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	// 0700/0600 like the config: the output is an infrastructure inventory.
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inventoryFixture writes a config whose "cloud" inventory runs a script
+// standing in for a cloud API: it prints the JSON in cloud.json and counts
+// its runs in runs.log. It returns the config path.
+func inventoryFixture(t *testing.T, ttl string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "cloud.sh"), `#!/bin/sh
+echo run >> runs.log
+if [ -f fail ]; then
+  echo "cloud API unavailable" >&2
+  exit 3
+fi
+cat cloud.json
+`)
+	if err := os.Chmod(filepath.Join(dir, "cloud.sh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "cloud.json"), `[
+  {"ID": "web-1", "Host": "10.0.0.1", "Tags": ["web"], "Source": "ignored"},
+  {"id": "web-2", "host": "10.0.0.2", "port": 2222, "user": "ubuntu"}
+]`)
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), `version: 1
+defaults:
+  user: deploy
+connections:
+  - id: static
+    host: static.example.com
+inventories:
+  - name: cloud
+    command: ./cloud.sh
+    ttl: `+ttl+`
+`)
+	return filepath.Join(dir, "config.yaml")
+}
+
+func inventoryRuns(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "runs.log"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "run\n")
+}
+
+func TestLoadMergesInventory(t *testing.T) {
+	path := inventoryFixture(t, "5m")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := len(cfg.Connections); got != 3 {
+		t.Fatalf("got %d connections, want 3", got)
+	}
+
+	web1 := cfg.FindConnection("web-1")
+	if web1 == nil {
+		t.Fatal("web-1 not merged")
+	}
+	if web1.Source != "inventory:cloud" || web1.Inventory() != "cloud" || !web1.ReadOnly() {
+		t.Errorf("web-1 source = %q, inventory = %q, read-only = %v", web1.Source, web1.Inventory(), web1.ReadOnly())
+	}
+	if web1.User != "deploy" || web1.Port != 22 {
+		t.Errorf("web-1 = %s@%s:%d, want defaults applied", web1.User, web1.Host, web1.Port)
+	}
+	if web2 := cfg.FindConnection("web-2"); web2 == nil || web2.User != "ubuntu" || web2.Port != 2222 {
+		t.Errorf("web-2 = %+v, want lower-case keys decoded", web2)
+	}
+	if cfg.FindConnection("static").ReadOnly() {
+		t.Error("static connection reported read-only")
+	}
+
+	sts := cfg.InventoryStatuses()
+	if len(sts) != 1 || sts[0].Name != "cloud" || sts[0].Connections != 2 || !sts[0].Ran || sts[0].Err != nil {
+		t.Errorf("InventoryStatuses() = %+v", sts)
+	}
+}
+
+func TestInventoryCache(t *testing.T) {
+	path := inventoryFixture(t, "1h")
+
+	for i := 0; i < 2; i++ {
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Connections) != 3 {
+			t.Fatalf("load %d: got %d connections, want 3", i, len(cfg.Connections))
+		}
+	}
+	if got := inventoryRuns(t, path); got != 1 {
+		t.Errorf("command ran %d times within the TTL, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join(InventoryCacheDir(path), "cloud.json")); err != nil {
+		t.Errorf("cache not written: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.InventoryStatuses()[0].Ran {
+		t.Error("cached load reported the command as run")
+	}
+	writeTestFile(t, filepath.Join(filepath.Dir(path), "cloud.json"), `[{"id": "web-3", "host": "10.0.0.3"}]`)
+	if err := cfg.RefreshInventories(); err != nil {
+		t.Fatalf("RefreshInventories() error = %v", err)
+	}
+	if got := inventoryRuns(t, path); got != 2 {
+		t.Errorf("command ran %d times after refresh, want 2", got)
+	}
+	if cfg.FindConnection("web-1") != nil || cfg.FindConnection("web-3") == nil || len(cfg.Connections) != 2 {
+		t.Errorf("after refresh connections = %v, want static and web-3", connectionIDs(cfg))
+	}
+	if err := cfg.RefreshInventories("nope"); err == nil {
+		t.Error("RefreshInventories(unknown) succeeded")
+	}
+}
+
+func TestInventoryTTLZeroRunsEveryLoad(t *testing.T) {
+	path := inventoryFixture(t, "0")
+	for i := 0; i < 2; i++ {
+		if _, err := Load(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := inventoryRuns(t, path); got != 2 {
+		t.Errorf("command ran %d times, want 2", got)
+	}
+}
+
+func TestInventoryFailureUsesStaleCache(t *testing.T) {
+	path := inventoryFixture(t, "0")
+	dir := filepath.Dir(path)
+	writeTestFile(t, filepath.Join(dir, "fail"), "")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() with a failing inventory error = %v", err)
+	}
+	st := cfg.InventoryStatuses()[0]
+	if st.Err == nil || !strings.Contains(st.Err.Error(), "cloud API unavailable") {
+		t.Errorf("Err = %v, want the command's stderr", st.Err)
+	}
+	if len(cfg.Connections) != 1 || !st.Fetched.IsZero() {
+		t.Errorf("without a cache got %v, fetched %v", connectionIDs(cfg), st.Fetched)
+	}
+
+	os.Remove(filepath.Join(dir, "fail"))
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "fail"), "")
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = cfg.InventoryStatuses()[0]
+	if st.Err == nil || st.Fetched.IsZero() || st.Connections != 2 {
+		t.Errorf("status = %+v, want the error and the stale connections", st)
+	}
+}
+
+func TestInventorySkipsBadEntries(t *testing.T) {
+	path := inventoryFixture(t, "5m")
+	writeTestFile(t, filepath.Join(filepath.Dir(path), "cloud.json"), `[
+  {"id": "static", "host": "10.0.0.9"},
+  {"id": "nohost"},
+  {"host": "10.0.0.8"},
+  {"id": "evil", "host": "-oProxyCommand=touch /tmp/pwned"},
+  {"id": "tmpl", "host": "10.0.0.7", "extends": ["missing"]},
+  {"id": "ok", "host": "10.0.0.6"},
+  {"id": "ok", "host": "10.0.0.5"}
+]`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := strings.Join(connectionIDs(cfg), ","); got != "static,ok" {
+		t.Errorf("connections = %s, want static,ok", got)
+	}
+	if got := cfg.FindConnection("static").Host; got != "static.example.com" {
+		t.Errorf("static host = %s, inventory overrode it", got)
+	}
+	if skipped := cfg.InventoryStatuses()[0].Skipped; len(skipped) != 6 {
+		t.Errorf("skipped = %q, want 6 entries", skipped)
+	}
+}
+
+func TestInventoryConfigKeys(t *testing.T) {
+	path := inventoryFixture(t, "5m")
+	writeTestFile(t, filepath.Join(filepath.Dir(path), "cloud.json"), `[
+  {"id": "db", "host": "10.0.0.5", "proxy_jump": "bastion", "identity_file": "~/.ssh/db",
+   "forward_agent": true, "remote_dir": "/srv", "use_mosh": false,
+   "forwards": [{"name": "pg", "listen_port": 5432, "target": "localhost:5432", "bind_address": "127.0.0.1"}]},
+  {"ID": "api", "Host": "10.0.0.6", "ProxyJump": "bastion", "RemoteDir": "/srv/api"},
+  {"id": "typo", "host": "10.0.0.7", "proxyjumps": "bastion"},
+  {"id": "badport", "host": "10.0.0.8", "port": "ssh"},
+  "web-9"
+]`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := cfg.FindConnection("db")
+	if db == nil {
+		t.Fatalf("db not merged; skipped = %q", cfg.InventoryStatuses()[0].Skipped)
+	}
+	if db.ProxyJump != "bastion" || db.IdentityFile != "~/.ssh/db" || !db.ForwardAgent || db.RemoteDir != "/srv" ||
+		db.UseMosh == nil || *db.UseMosh {
+		t.Errorf("db = %+v, want the config keys decoded", db)
+	}
+	if len(db.Forwards) != 1 || db.Forwards[0].ListenPort != 5432 || db.Forwards[0].BindAddress != "127.0.0.1" {
+		t.Errorf("db forwards = %+v", db.Forwards)
+	}
+	if api := cfg.FindConnection("api"); api == nil || api.ProxyJump != "bastion" || api.RemoteDir != "/srv/api" {
+		t.Errorf("api = %+v, want hop list --json keys decoded", api)
+	}
+
+	skipped := cfg.InventoryStatuses()[0].Skipped
+	want := []string{`typo: unknown key "proxyjumps"`, "badport: ", "entry 4: not a JSON object"}
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped = %q, want %d entries", skipped, len(want))
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(skipped[i], w) {
+			t.Errorf("skipped[%d] = %q, want prefix %q", i, skipped[i], w)
+		}
+	}
+}
+
+func TestInventoryConnectionsAreNotSaved(t *testing.T) {
+	path := inventoryFixture(t, "5m")
+	// Update only merges cached inventory output.
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Update(path, func(c *Config) error {
+		c.AddConnection(Connection{ID: "added", Host: "added.example.com"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if cfg.FindConnection("web-1") == nil || cfg.FindConnection("web-1").Source != "inventory:cloud" {
+		t.Error("Update() dropped or relabelled the inventory connections")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "web-1") || !strings.Contains(string(data), "id: added") {
+		t.Errorf("saved config:\n%s", data)
+	}
+}
+
+func TestUpdateDoesNotRunInventories(t *testing.T) {
+	path := inventoryFixture(t, "0")
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache is expired, but Update holds the config lock and must not
+	// wait on the command.
+	cfg, err := Update(path, func(c *Config) error {
+		if c.FindConnection("web-1") == nil {
+			t.Error("fn didn't see the cached inventory connections")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := inventoryRuns(t, path); got != 1 {
+		t.Errorf("command ran %d times, want only the Load's run", got)
+	}
+	if cfg.FindConnection("web-2") == nil || cfg.InventoryStatuses()[0].Ran {
+		t.Errorf("Update() connections = %v, statuses = %+v", connectionIDs(cfg), cfg.InventoryStatuses())
+	}
+}
+
+func TestValidateInventories(t *testing.T) {
+	cfg := &Config{
+		Version: CurrentVersion,
+		Inventories: []Inventory{
+			{Name: "a", Command: "x", TTL: "soon"},
+			{Name: "a", Command: "x"},
+			{Name: "../up", Command: "x"},
+			{Name: "b", Timeout: "0"},
+		},
+	}
+	err := cfg.Validate()
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Validate() = %v, want ValidationErrors", err)
+	}
+	var fields []string
+	for _, ve := range verrs {
+		fields = append(fields, ve.Field)
+	}
+	want := "inventories[0].ttl,inventories[1].name,inventories[2].name,inventories[3].command,inventories[3].timeout"
+	if got := strings.Join(fields, ","); got != want {
+		t.Errorf("fields = %s, want %s", got, want)
+	}
+}
+
+func connectionIDs(c *Config) []string {
+	var ids []string
+	for _, conn := range c.Connections {
+		ids = append(ids, conn.ID)
+	}
+	return ids
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package config
+
+// lockPath is a no-op on platforms without flock(2). hop only ships for
+// Linux and macOS; this keeps the package buildable elsewhere.
+func lockPath(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config schema version this build reads and writes.
+// Older files are upgraded on load by the migration chain below.
+const CurrentVersion = 1
+
+// Migration upgrades a config document from version From to From+1. Apply
+// edits the root mapping node in place, so comments survive the upgrade; the
+// version key is updated by the caller.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(root *yaml.Node) error
+}
+
+// migrations is the upgrade chain, ordered by From. To change the config
+// format, bump CurrentVersion and append a migration from the previous
+// version.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "add the version key (files written before versioning)",
+		Apply:       func(root *yaml.Node) error { return nil },
+	},
+}
+
+// Migrations returns the migration chain.
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// Migrate upgrades a config document to CurrentVersion. It returns the
+// upgraded document and the migrations that were applied; a document that is
+// already current (or empty) is returned unchanged. Documents from a newer
+// hop are rejected rather than guessed at.
+func Migrate(data []byte) ([]byte, []Migration, error) {
+	return migrate(data, migrations, CurrentVersion)
+}
+
+func migrate(data []byte, chain []Migration, target int) ([]byte, []Migration, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return data, nil, nil
+	}
+	root := doc.Content[0]
+
+	version, err := documentVersion(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > target {
+		return nil, nil, fmt.Errorf("config version %d is newer than this hop supports (%d); upgrade hop", version, target)
+	}
+	if version == target {
+		return data, nil, nil
+	}
+
+	before, err := encodeNode(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	var applied []Migration
+	for version < target {
+		m, ok := findMigration(chain, version)
+		if !ok {
+			return nil, nil, fmt.Errorf("no migration from config version %d", version)
+		}
+		if err := m.Apply(root); err != nil {
+			return nil, nil, fmt.Errorf("migrate config from version %d: %w", version, err)
+		}
+		version++
+		applied = append(applied, m)
+	}
+
+	// When the migrations only bump the version, patch that into the
+	// original bytes: re-encoding would drop blank lines and restyle the
+	// rest of the file.
+	after, err := encodeNode(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if after == before {
+		if out, ok := patchVersion(data, root, version); ok {
+			return out, applied, nil
+		}
+	}
+
+	setVersion(root, version)
+	out, err := encodeNode(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(out), applied, nil
+}
+
+// patchVersion sets the version key in data, whose root mapping is root: it
+// rewrites an existing block-style value, or inserts the key on its own line
+// before the first key. It reports false when the document's layout doesn't
+// allow a plain edit.
+func patchVersion(data []byte, root *yaml.Node, version int) ([]byte, bool) {
+	if root.Style&yaml.FlowStyle != 0 || len(root.Content) == 0 {
+		return nil, false
+	}
+	value := strconv.Itoa(version)
+	p := &patcher{src: data, root: root}
+
+	if _, v := mappingValue(root, "version"); v != nil {
+		if v.Kind != yaml.ScalarNode || v.Style != 0 {
+			return nil, false
+		}
+		start := p.offset(v.Line, v.Column)
+		p.edits = append(p.edits, edit{start: start, end: start + len(v.Value), text: value})
+		return p.apply(), true
+	}
+
+	first := root.Content[0]
+	newline := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+	line := strings.Repeat(" ", first.Column-1) + "version: " + value + newline
+	start := p.lineStart(first.Line)
+	p.edits = append(p.edits, edit{start: start, end: start, text: line})
+	return p.apply(), true
+}
+
+func findMigration(chain []Migration, from int) (Migration, bool) {
+	for _, m := range chain {
+		if m.From == from {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// documentVersion reads the version key of a root mapping; a missing key is
+// version 0.
+func documentVersion(root *yaml.Node) (int, error) {
+	_, v := mappingValue(root, "version")
+	if v == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(v.Value)
+	if err != nil || v.Kind != yaml.ScalarNode {
+		return 0, fmt.Errorf("version: must be an integer, got %q", v.Value)
+	}
+	return version, nil
+}
+
+// setVersion sets the version key, adding it as the first key if missing.
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if _, v := mappingValue(root, "version"); v != nil {
+		v.Value, v.Tag, v.Style = value, "!!int", 0
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: "version"}
+	val := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: value}
+	// Move a comment heading the file above the new first key.
+	if len(root.Content) > 0 {
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, val}, root.Content...)
+}
+
+// MigrateFile upgrades the config at path in place, under the config lock.
+// The previous file is kept in the backup ring. It returns the migrations
+// applied, which is empty when the file was already current.
+func MigrateFile(path string) ([]Migration, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	unlock, err := lockPath(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	upgraded, applied, err := Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+	if _, err := parse(upgraded); err != nil {
+		return nil, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+	if err := writeConfigFile(path, upgraded); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
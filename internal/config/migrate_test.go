@@ -0,0 +1,135 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateAddsMissingVersion(t *testing.T) {
+	in := "# my servers\nconnections:\n  - id: a\n    host: a.example.com\n"
+
+	out, applied, err := Migrate([]byte(in))
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if len(applied) != 1 || applied[0].From != 0 {
+		t.Fatalf("applied = %+v, want the 0 -> 1 migration", applied)
+	}
+	want := "# my servers\nversion: 1\nconnections:\n  - id: a\n    host: a.example.com\n"
+	if string(out) != want {
+		t.Errorf("Migrate() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestMigrateVersionKeepsLayout(t *testing.T) {
+	in := "# header\n\nconnections:\n  - id: a\n    host: a.example.com\n    tags: [web,  prod]\n\ngroups:\n  g: [a]\n"
+	out, _, err := Migrate([]byte(in))
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	want := "# header\n\nversion: 1\nconnections:\n  - id: a\n    host: a.example.com\n    tags: [web,  prod]\n\ngroups:\n  g: [a]\n"
+	if string(out) != want {
+		t.Errorf("Migrate() =\n%s\nwant\n%s", out, want)
+	}
+
+	chain := []Migration{{From: 1, Description: "noop", Apply: func(root *yaml.Node) error { return nil }}}
+	in = "version: 1 # schema\n\nconnections: []\n"
+	out, _, err = migrate([]byte(in), chain, 2)
+	if err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+	if want := "version: 2 # schema\n\nconnections: []\n"; string(out) != want {
+		t.Errorf("migrate() = %q, want %q", out, want)
+	}
+}
+
+func TestMigrateCurrentIsUnchanged(t *testing.T) {
+	in := "version: 1\n\n# keep me\nconnections: []\n"
+	out, applied, err := Migrate([]byte(in))
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if len(applied) != 0 || string(out) != in {
+		t.Errorf("Migrate() = %q, %d migrations; want input unchanged", out, len(applied))
+	}
+}
+
+func TestMigrateRejectsNewerVersion(t *testing.T) {
+	_, _, err := Migrate([]byte("version: 99\n"))
+	if err == nil || !strings.Contains(err.Error(), "newer than this hop supports") {
+		t.Errorf("Migrate() error = %v, want newer-version error", err)
+	}
+}
+
+func TestMigrateChain(t *testing.T) {
+	chain := []Migration{
+		{From: 1, Description: "rename hosts to connections", Apply: func(root *yaml.Node) error {
+			if i, _ := mappingValue(root, "hosts"); i >= 0 {
+				root.Content[i].Value = "connections"
+			}
+			return nil
+		}},
+		{From: 2, Description: "noop", Apply: func(root *yaml.Node) error { return nil }},
+	}
+	in := "version: 1\nhosts:\n  # primary\n  - id: a\n    host: a.example.com\n"
+
+	out, applied, err := migrate([]byte(in), chain, 3)
+	if err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("applied %d migrations, want 2", len(applied))
+	}
+	want := "version: 3\nconnections:\n  # primary\n  - id: a\n    host: a.example.com\n"
+	if string(out) != want {
+		t.Errorf("migrate() =\n%s\nwant\n%s", out, want)
+	}
+
+	if _, _, err := migrate([]byte("version: 0\n"), chain, 3); err == nil {
+		t.Error("migrate() with a gap in the chain succeeded, want error")
+	}
+}
+
+func TestLoadMigratesAndMigrateFileBacksUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	old := "connections:\n  - id: a\n    host: a.example.com\n"
+	writeTestFile(t, path, old)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() after in-memory migration = %v", err)
+	}
+	if got := readFile(t, path); got != old {
+		t.Errorf("Load() rewrote the file:\n%s", got)
+	}
+
+	applied, err := MigrateFile(path)
+	if err != nil {
+		t.Fatalf("MigrateFile() error = %v", err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("MigrateFile() applied %d migrations, want 1", len(applied))
+	}
+	if got := readFile(t, path); !strings.HasPrefix(got, "version: 1\n") {
+		t.Errorf("migrated file =\n%s", got)
+	}
+
+	backups, err := ListBackups(path)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("ListBackups() = %v, %v; want one backup", backups, err)
+	}
+	if got := readFile(t, backups[0].Path); got != old {
+		t.Errorf("backup = %q, want the pre-migration file", got)
+	}
+
+	applied, err = MigrateFile(path)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second MigrateFile() = %v, %v; want no-op", applied, err)
+	}
+}
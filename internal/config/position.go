@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a location in a config file. Line and Column are 1-based and
+// zero when unknown.
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+func (p Position) String() string {
+	switch {
+	case p.Line > 0:
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	default:
+		return p.File
+	}
+}
+
+// ConnectionPosition returns where key (a yaml key such as "host"; "" for the
+// entry itself) of conn is defined. When the connection does not set key the
+// position of the entry is returned.
+func (c *Config) ConnectionPosition(conn *Connection, key string) Position {
+	pos := Position{File: conn.Source}
+	if conn.doc == nil {
+		return pos
+	}
+	root, err := parseRoot(conn.doc.owner.src)
+	if err != nil || root == nil {
+		return pos
+	}
+	_, seq := mappingValue(root, "connections")
+	if seq == nil || conn.doc.index >= len(seq.Content) {
+		return pos
+	}
+	item := seq.Content[conn.doc.index]
+	pos.Line, pos.Column = item.Line, item.Column
+	if key != "" && item.Kind == yaml.MappingNode {
+		if i, _ := mappingValue(item, key); i >= 0 {
+			pos.Line, pos.Column = item.Content[i].Line, item.Content[i].Column
+		}
+	}
+	return pos
+}
+
+// KeyPosition returns where a key path of the main config is defined, e.g.
+// ("groups", "web") or ("templates", "base", "extends"). It stops at the
+// deepest key that exists.
+func (c *Config) KeyPosition(path ...string) Position {
+	pos := Position{File: c.path}
+	if len(path) > 0 && path[0] == "groups" && len(path) > 1 {
+		if layer := c.layerFor(c.groupSources[path[1]]); layer != nil {
+			pos.File = layer.path
+			return keyPosition(pos, layer.doc, path)
+		}
+	}
+	return keyPosition(pos, c.doc, path)
+}
+
+func keyPosition(pos Position, doc *document, path []string) Position {
+	var src []byte
+	if doc != nil {
+		src = doc.src
+	} else if data, err := os.ReadFile(pos.File); err == nil {
+		src = data
+	}
+	node, err := parseRoot(src)
+	if err != nil || node == nil {
+		return pos
+	}
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		i, v := mappingValue(node, key)
+		if i < 0 {
+			break
+		}
+		pos.Line, pos.Column = node.Content[i].Line, node.Content[i].Column
+		node = v
+	}
+	return pos
+}
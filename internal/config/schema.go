@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaID is the $id of the published config JSON Schema.
+const SchemaID = "https://github.com/danmartuszewski/hop/config.schema.json"
+
+// schemaDescriptions documents config keys in the generated schema, keyed by
+// "<definition>.<yaml key>". Editors show these as hover text.
+var schemaDescriptions = map[string]string{
+	"config.version":      "Config schema version. Older files are upgraded with `hop config migrate`.",
+	"config.include":      "Extra config files to merge (globs, relative to the config directory). conf.d/*.yaml is always merged.",
+	"config.theme_preset": "Built-in color theme for the dashboard.",
+	"config.theme":        "Color overrides applied on top of the theme preset.",
+	"config.theme_dark":   "Color overrides used on dark terminals.",
+	"config.theme_light":  "Color overrides used on light terminals.",
+	"config.defaults":     "Values used by connections that don't set them.",
+	"config.connections":  "SSH connections.",
+	"config.groups":       "Named lists of connection IDs, usable as targets.",
+	"config.templates":    "Named partial connections that connections pull values from with extends.",
+	"config.inventories":  "Commands printing connections as JSON (the `hop list --json` shape), merged read-only into the connections.",
+
+	"defaults.user":            "Default SSH user.",
+	"defaults.port":            "Default SSH port (22 when unset).",
+	"defaults.use_mosh":        "Use mosh instead of ssh for interactive sessions.",
+	"defaults.multiplex":       "Share one ssh master connection per host (ControlMaster) so repeated commands skip the handshake.",
+	"defaults.health_check":    "Run background health checks in the dashboard (default true).",
+	"defaults.health_interval": "How often the dashboard re-checks hosts, e.g. 30s or 2m (default 30s; 0 checks only on start).",
+
+	"connection.id":              "Unique connection ID, used as the target name.",
+	"connection.host":            "Hostname or IP address.",
+	"connection.extends":         "Templates to inherit values from; later entries override earlier ones.",
+	"connection.user":            "SSH user.",
+	"connection.port":            "SSH port.",
+	"connection.project":         "Project label, used for grouping and project-env targets.",
+	"connection.env":             "Environment label (e.g. prod, staging).",
+	"connection.identity_file":   "Private key passed to ssh -i.",
+	"connection.remote_dir":      "Directory to cd into after connecting.",
+	"connection.proxy_jump":      "Jump host passed to ssh -J.",
+	"connection.forward_agent":   "Forward the SSH agent (ssh -A). Only for trusted hosts.",
+	"connection.use_mosh":        "Use mosh for interactive sessions; overrides defaults.use_mosh.",
+	"connection.multiplex":       "Share a hop-managed ssh master connection; overrides defaults.multiplex.",
+	"connection.tags":            "Free-form tags for filtering.",
+	"connection.options":         "Extra ssh -o options, e.g. ServerAliveInterval.",
+	"connection.forwards":        "Named port forwards started with `hop tunnel up`. Forwards from templates are merged by name.",
+	"connection.ssh_config_host": "SSH config host this connection is managed by; set by `hop import --sync`.",
+
+	"inventory.name":    "Inventory name, shown as the source of its connections.",
+	"inventory.command": "Executable to run; relative paths are resolved against the config directory.",
+	"inventory.args":    "Arguments passed to the command.",
+	"inventory.ttl":     "How long the output is cached, e.g. 5m or 1h (default 5m; 0 runs the command on every load).",
+	"inventory.timeout": "How long the command may run, e.g. 30s (default 30s).",
+
+	"forward.name":         "Forward name, used by `hop tunnel up <target> <name>`.",
+	"forward.type":         "local (ssh -L, default), remote (ssh -R) or dynamic (ssh -D, SOCKS proxy).",
+	"forward.bind_address": "Address to listen on (default: loopback).",
+	"forward.listen_port":  "Port to listen on: on this machine for local and dynamic, on the server for remote.",
+	"forward.target":       "host:port to connect to: from the server for local, from this machine for remote.",
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing config.yaml,
+// generated from the Config types so it cannot drift from what Load accepts.
+// Templates share the connection properties but require none of them.
+func JSONSchema() ([]byte, error) {
+	connection := objectSchema(reflect.TypeOf(Connection{}), "connection", true)
+	template := objectSchema(reflect.TypeOf(Connection{}), "connection", false)
+	delete(template["properties"].(map[string]any), "id")
+
+	root := objectSchema(reflect.TypeOf(Config{}), "config", false)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = SchemaID
+	root["title"] = "hop config"
+	props := root["properties"].(map[string]any)
+	props["version"].(map[string]any)["const"] = CurrentVersion
+	props["defaults"] = withDescription(objectSchema(reflect.TypeOf(Defaults{}), "defaults", false), "config.defaults")
+	props["connections"] = withDescription(map[string]any{
+		"type":  "array",
+		"items": map[string]any{"$ref": "#/$defs/connection"},
+	}, "config.connections")
+	props["templates"] = withDescription(map[string]any{
+		"type":                 "object",
+		"additionalProperties": map[string]any{"$ref": "#/$defs/template"},
+	}, "config.templates")
+	root["$defs"] = map[string]any{
+		"connection": connection,
+		"template":   template,
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// objectSchema describes a struct by its yaml tags. Fields without omitempty
+// are required when required is true. Unknown keys are rejected so typos are
+// flagged by editors.
+func objectSchema(t reflect.Type, def string, required bool) map[string]any {
+	props := make(map[string]any)
+	var req []string
+	for _, f := range yamlFields(t) {
+		props[f.key] = withDescription(typeSchema(t.Field(f.index).Type), def+"."+f.key)
+		if required && !f.omitEmpty {
+			req = append(req, f.key)
+		}
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(req) > 0 {
+		schema["required"] = req
+	}
+	return schema
+}
+
+// typeSchema maps a Go field type to a JSON Schema type.
+func typeSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return objectSchema(t, strings.ToLower(t.Name()), true)
+	default:
+		return map[string]any{}
+	}
+}
+
+func withDescription(schema map[string]any, key string) map[string]any {
+	if d, ok := schemaDescriptions[key]; ok {
+		schema["description"] = d
+	}
+	return schema
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+
+	var schema struct {
+		Properties           map[string]map[string]any `json:"properties"`
+		AdditionalProperties bool                      `json:"additionalProperties"`
+		Defs                 map[string]struct {
+			Properties map[string]map[string]any `json:"properties"`
+			Required   []string                  `json:"required"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	for _, f := range configFields {
+		if _, ok := schema.Properties[f.key]; !ok {
+			t.Errorf("schema missing top-level key %q", f.key)
+		}
+	}
+	if schema.AdditionalProperties {
+		t.Error("top level must reject unknown keys")
+	}
+	if v := schema.Properties["version"]["const"]; v != float64(CurrentVersion) {
+		t.Errorf("version const = %v, want %d", v, CurrentVersion)
+	}
+
+	conn := schema.Defs["connection"]
+	for _, f := range connectionFields {
+		if _, ok := conn.Properties[f.key]; !ok {
+			t.Errorf("connection schema missing %q", f.key)
+		}
+	}
+	if !reflect.DeepEqual(conn.Required, []string{"id", "host"}) {
+		t.Errorf("connection required = %v, want [id host]", conn.Required)
+	}
+	if got := conn.Properties["port"]["type"]; got != "integer" {
+		t.Errorf("port type = %v, want integer", got)
+	}
+
+	tmpl := schema.Defs["template"]
+	if len(tmpl.Required) != 0 {
+		t.Errorf("template required = %v, want none", tmpl.Required)
+	}
+	if _, ok := tmpl.Properties["id"]; ok {
+		t.Error("template schema must not allow id")
+	}
+}
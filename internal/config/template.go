@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Templates are named, partial connections that other connections (and other
+// templates) pull values from with extends:
+//
+//	templates:
+//	  base:
+//	    user: deploy
+//	    identity_file: ~/.ssh/work
+//	  behind-bastion:
+//	    extends: [base]
+//	    proxy_jump: bastion
+//	connections:
+//	  - id: app1
+//	    host: app1.internal
+//	    extends: [behind-bastion]
+//
+// Precedence, highest first: the connection's own values, then its templates
+// with later entries of extends: overriding earlier ones (a template's own
+// values override the templates it extends), then defaults:. Tags are
+// combined from every level and options are merged key by key.
+
+// Origin values reported by Connection.Origin for values that were not set on
+// the connection itself.
+const (
+	OriginDefaults = "defaults"
+	originTemplate = "template "
+)
+
+// TemplateOrigin returns the Origin value for a value taken from template.
+func TemplateOrigin(template string) string {
+	return originTemplate + template
+}
+
+// Origin reports where the resolved value of field came from: "" when it was
+// set on the connection itself (or is unset), OriginDefaults, or
+// TemplateOrigin(name). Individual tags and options are looked up as
+// "tags.<tag>" and "options.<key>".
+func (c *Connection) Origin(field string) string {
+	return c.origins[field]
+}
+
+// resolveTemplates replaces conn's fields with its flattened templates
+// overlaid by its own values. Unknown templates and cycles are skipped here
+// and reported by Validate.
+func (c *Config) resolveTemplates(conn *Connection) {
+	if len(conn.Extends) == 0 {
+		return
+	}
+
+	base, origins := c.flatten(conn.Extends, make(map[string]bool))
+	own := *conn
+	own.origins = nil
+	overlay(&base, origins, own, "")
+	base.ID, base.Extends, base.Source, base.doc = conn.ID, conn.Extends, conn.Source, conn.doc
+	base.origins = origins
+	*conn = base
+}
+
+// flatten merges the named templates, in order, into one partial connection.
+func (c *Config) flatten(names []string, visiting map[string]bool) (Connection, map[string]string) {
+	var out Connection
+	origins := make(map[string]string)
+	for _, name := range names {
+		tmpl, ok := c.Templates[name]
+		if !ok || visiting[name] {
+			continue
+		}
+		visiting[name] = true
+		resolved, resolvedOrigins := c.flatten(tmpl.Extends, visiting)
+		overlay(&resolved, resolvedOrigins, tmpl, TemplateOrigin(name))
+		visiting[name] = false
+
+		for field, origin := range resolvedOrigins {
+			origins[field] = origin
+		}
+		overlay(&out, nil, resolved, "")
+	}
+	return out, origins
+}
+
+// overlay copies every non-empty value of src onto dst, recording origin for
+// each value taken from src when origins is non-nil. Tags are appended,
+// options merged and forwards merged by name rather than replaced.
+func overlay(dst *Connection, origins map[string]string, src Connection, origin string) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src)
+	for _, f := range connectionFields {
+		if f.key == "id" || f.key == "extends" {
+			continue
+		}
+		v := sv.Field(f.index)
+		if isEmptyValue(v) {
+			continue
+		}
+		switch f.key {
+		case "tags":
+			for _, tag := range src.Tags {
+				if !containsString(dst.Tags, tag) {
+					dst.Tags = append(dst.Tags, tag)
+				}
+				setOrigin(origins, "tags."+tag, origin)
+			}
+		case "options":
+			if dst.Options == nil {
+				dst.Options = make(map[string]string, len(src.Options))
+			}
+			for k, val := range src.Options {
+				dst.Options[k] = val
+				setOrigin(origins, "options."+k, origin)
+			}
+		case "forwards":
+			dst.Forwards = mergeForwards(dst.Forwards, src.Forwards)
+			for _, f := range src.Forwards {
+				setOrigin(origins, "forwards."+f.Name, origin)
+			}
+		default:
+			dv.Field(f.index).Set(v)
+			setOrigin(origins, f.key, origin)
+		}
+	}
+}
+
+func (c *Connection) setOrigin(field, origin string) {
+	if c.origins == nil {
+		c.origins = make(map[string]string)
+	}
+	c.origins[field] = origin
+}
+
+func setOrigin(origins map[string]string, field, origin string) {
+	if origins == nil {
+		return
+	}
+	if origin == "" {
+		delete(origins, field)
+		return
+	}
+	origins[field] = origin
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTemplates reports templates that set an id, extends: entries naming
+// unknown templates, and inheritance cycles.
+func (c *Config) validateTemplates() ValidationErrors {
+	var errs ValidationErrors
+
+	names := make([]string, 0, len(c.Templates))
+	for name := range c.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tmpl := c.Templates[name]
+		field := "templates." + name
+		if tmpl.ID != "" {
+			errs = append(errs, ValidationError{
+				Field:   field + ".id",
+				Message: "is not allowed in a template",
+				Pos:     c.KeyPosition("templates", name, "id"),
+			})
+		}
+		for _, ve := range c.validateExtends(field, tmpl.Extends) {
+			ve.Pos = c.KeyPosition("templates", name, "extends")
+			errs = append(errs, ve)
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, name := range names {
+		if cycle := c.findCycle(name, nil); cycle != nil {
+			key := cycleKey(cycle)
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+			errs = append(errs, ValidationError{
+				Field:   "templates." + cycle[0] + ".extends",
+				Message: "inheritance cycle " + strings.Join(cycle, " -> "),
+				Pos:     c.KeyPosition("templates", cycle[0], "extends"),
+			})
+		}
+	}
+	return errs
+}
+
+// validateExtends reports entries of extends that name no template.
+func (c *Config) validateExtends(field string, extends []string) ValidationErrors {
+	var errs ValidationErrors
+	for _, name := range extends {
+		if _, ok := c.Templates[name]; !ok {
+			errs = append(errs, ValidationError{
+				Field:   field + ".extends",
+				Message: fmt.Sprintf("unknown template '%s'", name),
+			})
+		}
+	}
+	return errs
+}
+
+// findCycle returns the chain of template names that leads from name back
+// into path, or nil if name's inheritance is acyclic.
+func (c *Config) findCycle(name string, path []string) []string {
+	for i, p := range path {
+		if p == name {
+			return append(append([]string(nil), path[i:]...), name)
+		}
+	}
+	tmpl, ok := c.Templates[name]
+	if !ok {
+		return nil
+	}
+	path = append(path, name)
+	for _, parent := range tmpl.Extends {
+		if cycle := c.findCycle(parent, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// cycleKey identifies a cycle independently of the template it was found
+// from, so a -> b -> a and b -> a -> b are reported once.
+func cycleKey(cycle []string) string {
+	members := append([]string(nil), cycle[:len(cycle)-1]...)
+	sort.Strings(members)
+	return strings.Join(members, ",")
+}
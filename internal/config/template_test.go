@@ -0,0 +1,164 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const templateFixture = `version: 1
+defaults:
+  user: admin
+  port: 22
+templates:
+  base:
+    user: deploy
+    identity_file: ~/.ssh/work
+    tags: [managed]
+    options:
+      ServerAliveInterval: "30"
+      StrictHostKeyChecking: "yes"
+  bastion:
+    extends: [base]
+    proxy_jump: jump.example.com
+    options:
+      StrictHostKeyChecking: "no"
+  highport:
+    port: 2222
+connections:
+  - id: app
+    host: app.internal
+    extends: [bastion, highport]
+    tags: [web]
+    options:
+      ServerAliveInterval: "10"
+  - id: own-user
+    host: own.internal
+    user: root
+    extends: [base]
+  - id: plain
+    host: plain.example.com
+`
+
+func TestTemplatesResolve(t *testing.T) {
+	cfg, err := parse([]byte(templateFixture))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	app := cfg.FindConnection("app")
+	if app.User != "deploy" || app.IdentityFile != "~/.ssh/work" || app.ProxyJump != "jump.example.com" || app.Port != 2222 {
+		t.Errorf("app resolved to %+v", app)
+	}
+	if !reflect.DeepEqual(app.Tags, []string{"managed", "web"}) {
+		t.Errorf("app tags = %v, want [managed web]", app.Tags)
+	}
+	wantOptions := map[string]string{"ServerAliveInterval": "10", "StrictHostKeyChecking": "no"}
+	if !reflect.DeepEqual(app.Options, wantOptions) {
+		t.Errorf("app options = %v, want %v", app.Options, wantOptions)
+	}
+
+	origins := map[string]string{
+		"user":                          TemplateOrigin("base"),
+		"identity_file":                 TemplateOrigin("base"),
+		"proxy_jump":                    TemplateOrigin("bastion"),
+		"port":                          TemplateOrigin("highport"),
+		"tags.managed":                  TemplateOrigin("base"),
+		"tags.web":                      "",
+		"options.ServerAliveInterval":   "",
+		"options.StrictHostKeyChecking": TemplateOrigin("bastion"),
+		"host":                          "",
+	}
+	for field, want := range origins {
+		if got := app.Origin(field); got != want {
+			t.Errorf("app.Origin(%q) = %q, want %q", field, got, want)
+		}
+	}
+
+	own := cfg.FindConnection("own-user")
+	if own.User != "root" || own.Origin("user") != "" {
+		t.Errorf("own-user user = %q from %q, want root from the connection", own.User, own.Origin("user"))
+	}
+	if own.Port != 22 || own.Origin("port") != OriginDefaults {
+		t.Errorf("own-user port = %d from %q, want 22 from defaults", own.Port, own.Origin("port"))
+	}
+
+	plain := cfg.FindConnection("plain")
+	if plain.User != "admin" || plain.Origin("user") != OriginDefaults {
+		t.Errorf("plain user = %q from %q, want admin from defaults", plain.User, plain.Origin("user"))
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	cfg, err := parse([]byte(`version: 1
+templates:
+  a:
+    extends: [b]
+  b:
+    extends: [a]
+  c:
+    id: not-allowed
+    extends: [missing]
+connections:
+  - id: x
+    host: x.example.com
+    extends: [a, nope]
+`))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"templates.a.extends: inheritance cycle a -> b -> a",
+		"templates.c.id: is not allowed in a template",
+		"templates.c.extends: unknown template 'missing'",
+		"connections[0].extends: unknown template 'nope'",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Validate() missing %q in:\n%s", want, msg)
+		}
+	}
+	if strings.Count(msg, "inheritance cycle") != 1 {
+		t.Errorf("cycle reported more than once:\n%s", msg)
+	}
+}
+
+func TestSaveTemplatedConnectionKeepsInheritance(t *testing.T) {
+	path, cfg := loadFixture(t, templateFixture)
+
+	conn := *cfg.FindConnection("app")
+	conn.Host = "app2.internal"
+	cfg.UpdateConnection("app", conn)
+
+	dup := cfg.FindConnection("app").Clone()
+	dup.ID = "app-copy"
+	cfg.AddConnection(dup)
+
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got := readFile(t, path)
+	want := strings.Replace(templateFixture, "host: app.internal", "host: app2.internal", 1)
+	want += `  - id: app-copy
+    host: app2.internal
+    extends:
+      - bastion
+      - highport
+    tags:
+      - web
+    options:
+      ServerAliveInterval: "10"
+`
+	if got != want {
+		t.Errorf("Save() =\n%s\nwant\n%s", got, want)
+	}
+}
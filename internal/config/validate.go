@@ -3,11 +3,15 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type ValidationError struct {
 	Field   string
 	Message string
+	// Pos is where the offending value is defined, when known. It is not
+	// part of Error(); hop doctor uses it to point at the line.
+	Pos Position
 }
 
 func (e ValidationError) Error() string {
@@ -52,44 +56,90 @@ func (c *Connection) CheckSafety() error {
 func (c *Config) Validate() error {
 	var errs ValidationErrors
 
-	if c.Version != 1 {
+	if c.Version != CurrentVersion {
 		errs = append(errs, ValidationError{
 			Field:   "version",
-			Message: "must be 1",
+			Message: fmt.Sprintf("must be %d", CurrentVersion),
+			Pos:     c.KeyPosition("version"),
 		})
 	}
 
+	if v := c.Defaults.HealthInterval; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			errs = append(errs, ValidationError{
+				Field:   "defaults.health_interval",
+				Message: fmt.Sprintf("invalid duration %q (e.g. 30s, 2m, or 0 to disable)", v),
+				Pos:     c.KeyPosition("defaults", "health_interval"),
+			})
+		}
+	}
+
 	seenIDs := make(map[string]bool)
-	for i, conn := range c.Connections {
-		prefix := fmt.Sprintf("connections[%d]", i)
+	for i := range c.Connections {
+		conn := &c.Connections[i]
+		prefix := c.connectionField(i)
+		pos := func(key string) Position { return c.ConnectionPosition(conn, key) }
 
 		if conn.ID == "" {
 			errs = append(errs, ValidationError{
 				Field:   prefix + ".id",
 				Message: "is required",
+				Pos:     pos("id"),
 			})
 		} else if seenIDs[conn.ID] {
 			errs = append(errs, ValidationError{
 				Field:   prefix + ".id",
 				Message: fmt.Sprintf("duplicate id '%s'", conn.ID),
+				Pos:     pos("id"),
 			})
 		} else {
 			seenIDs[conn.ID] = true
 		}
 
+		for _, ve := range c.validateExtends(prefix, conn.Extends) {
+			ve.Pos = pos("extends")
+			errs = append(errs, ve)
+		}
+
 		if conn.Host == "" {
 			errs = append(errs, ValidationError{
 				Field:   prefix + ".host",
 				Message: "is required",
+				Pos:     pos("host"),
 			})
 		}
 
 		if err := conn.CheckSafety(); err != nil {
 			if ve, ok := err.(ValidationError); ok {
+				ve.Pos = pos(ve.Field)
 				ve.Field = prefix + "." + ve.Field
 				errs = append(errs, ve)
 			} else {
-				errs = append(errs, ValidationError{Field: prefix, Message: err.Error()})
+				errs = append(errs, ValidationError{Field: prefix, Message: err.Error(), Pos: pos("")})
+			}
+		}
+
+		for _, ve := range conn.validateForwards() {
+			ve.Field = prefix + "." + ve.Field
+			ve.Pos = pos("forwards")
+			errs = append(errs, ve)
+		}
+	}
+
+	errs = append(errs, c.validateTemplates()...)
+	errs = append(errs, c.validateInventories()...)
+
+	for _, layer := range c.layers {
+		for name := range layer.Groups {
+			if owner := c.groupSources[name]; owner != layer.path {
+				if owner == "" {
+					owner = c.path
+				}
+				errs = append(errs, ValidationError{
+					Field:   fmt.Sprintf("%s: groups.%s", layer.path, name),
+					Message: fmt.Sprintf("already defined in %s", owner),
+					Pos:     keyPosition(Position{File: layer.path}, layer.doc, []string{"groups", name}),
+				})
 			}
 		}
 	}
@@ -100,6 +150,7 @@ func (c *Config) Validate() error {
 				errs = append(errs, ValidationError{
 					Field:   fmt.Sprintf("groups.%s", name),
 					Message: fmt.Sprintf("references unknown connection '%s'", member),
+					Pos:     c.KeyPosition("groups", name),
 				})
 			}
 		}
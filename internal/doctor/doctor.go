@@ -0,0 +1,367 @@
+// Package doctor checks a hop config and the local environment for problems
+// that would only show up when connecting: broken keys, dangling jump hosts,
+// typos in ssh options, missing tools. Every finding carries the file, line
+// and column it refers to when there is one.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+// Severity ranks a diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityOK      Severity = "ok"
+)
+
+// Diagnostic is a single finding.
+type Diagnostic struct {
+	config.Position
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Field    string   `json:"field,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		b.WriteString(d.Position.String())
+		b.WriteString(": ")
+	}
+	b.WriteString(string(d.Severity))
+	b.WriteString(": ")
+	if d.Field != "" {
+		b.WriteString(d.Field)
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// Counts returns the number of errors and warnings in diags.
+func Counts(diags []Diagnostic) (errs, warnings int) {
+	for _, d := range diags {
+		switch d.Severity {
+		case SeverityError:
+			errs++
+		case SeverityWarning:
+			warnings++
+		}
+	}
+	return errs, warnings
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+)`)
+
+// LoadError turns a failure to load the config at path into a diagnostic,
+// picking the line out of YAML syntax errors.
+func LoadError(path string, err error) Diagnostic {
+	d := Diagnostic{
+		Position: config.Position{File: path},
+		Severity: SeverityError,
+		Check:    "config",
+		Message:  err.Error(),
+	}
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		d.Line, _ = strconv.Atoi(m[1])
+	}
+	return d
+}
+
+// CheckConfig reports validation errors and warnings for cfg. sshAliases are
+// the Host names from ~/.ssh/config, which are valid proxy_jump targets.
+func CheckConfig(cfg *config.Config, sshAliases []string) []Diagnostic {
+	var diags []Diagnostic
+
+	var verrs config.ValidationErrors
+	if err := cfg.Validate(); err != nil && !errors.As(err, &verrs) {
+		diags = append(diags, Diagnostic{Severity: SeverityError, Check: "config", Message: err.Error()})
+	}
+	for _, ve := range verrs {
+		diags = append(diags, Diagnostic{
+			Position: ve.Pos,
+			Severity: SeverityError,
+			Check:    "config",
+			Field:    ve.Field,
+			Message:  ve.Message,
+		})
+	}
+
+	diags = append(diags, checkIdentityFiles(cfg)...)
+	diags = append(diags, checkProxyJumps(cfg, sshAliases)...)
+	diags = append(diags, checkDuplicateEndpoints(cfg)...)
+	diags = append(diags, checkOptions(cfg)...)
+	diags = append(diags, checkForwardAgent(cfg)...)
+	diags = append(diags, checkInventories(cfg)...)
+
+	return dedupe(diags)
+}
+
+// checkInventories reports inventory commands that failed on load and
+// entries they printed that were skipped.
+func checkInventories(cfg *config.Config) []Diagnostic {
+	var diags []Diagnostic
+	for _, st := range cfg.InventoryStatuses() {
+		add := func(msg string) {
+			diags = append(diags, Diagnostic{
+				Position: cfg.KeyPosition("inventories"),
+				Severity: SeverityWarning,
+				Check:    "inventory",
+				Field:    "inventories." + st.Name,
+				Message:  msg,
+			})
+		}
+		if st.Err != nil {
+			msg := st.Err.Error()
+			if !st.Fetched.IsZero() {
+				msg += fmt.Sprintf(" (using output from %s)", st.Fetched.Format(time.DateTime))
+			}
+			add(msg)
+		}
+		for _, s := range st.Skipped {
+			add("skipped " + s)
+		}
+	}
+	return diags
+}
+
+// fieldPosition points at where conn's value for key is written: the
+// connection itself, or the template it was inherited from.
+func fieldPosition(cfg *config.Config, conn *config.Connection, key string) config.Position {
+	origin := conn.Origin(key)
+	if name, ok := strings.CutPrefix(origin, config.TemplateOrigin("")); ok {
+		return cfg.KeyPosition("templates", name, strings.SplitN(key, ".", 2)[0])
+	}
+	if origin == config.OriginDefaults {
+		return cfg.KeyPosition("defaults", key)
+	}
+	return cfg.ConnectionPosition(conn, strings.SplitN(key, ".", 2)[0])
+}
+
+func warning(cfg *config.Config, conn *config.Connection, check, key, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Position: fieldPosition(cfg, conn, key),
+		Severity: SeverityWarning,
+		Check:    check,
+		Field:    conn.ID + "." + key,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func checkIdentityFiles(cfg *config.Config) []Diagnostic {
+	var diags []Diagnostic
+	for i := range cfg.Connections {
+		conn := &cfg.Connections[i]
+		if conn.IdentityFile == "" {
+			continue
+		}
+		path := config.ExpandHome(conn.IdentityFile)
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			diags = append(diags, warning(cfg, conn, "identity_file", "identity_file", "%s does not exist", conn.IdentityFile))
+		case err != nil:
+			diags = append(diags, warning(cfg, conn, "identity_file", "identity_file", "cannot read %s: %v", conn.IdentityFile, err))
+		case info.IsDir():
+			diags = append(diags, warning(cfg, conn, "identity_file", "identity_file", "%s is a directory", conn.IdentityFile))
+		case info.Mode().Perm()&0077 != 0:
+			diags = append(diags, warning(cfg, conn, "identity_file", "identity_file",
+				"%s has permissions %04o; ssh refuses keys readable by others (chmod 600 %s)",
+				conn.IdentityFile, info.Mode().Perm(), conn.IdentityFile))
+		}
+	}
+	return diags
+}
+
+// jumpHosts splits a ProxyJump value ("user@host:port,host2") into bare
+// host names.
+func jumpHosts(proxyJump string) []string {
+	var hosts []string
+	for _, hop := range strings.Split(proxyJump, ",") {
+		hop = strings.TrimSpace(hop)
+		if i := strings.LastIndex(hop, "@"); i >= 0 {
+			hop = hop[i+1:]
+		}
+		if strings.HasPrefix(hop, "[") {
+			if end := strings.Index(hop, "]"); end > 0 {
+				hop = hop[1:end]
+			}
+		} else if i := strings.LastIndex(hop, ":"); i >= 0 && strings.Count(hop, ":") == 1 {
+			hop = hop[:i]
+		}
+		if hop != "" {
+			hosts = append(hosts, hop)
+		}
+	}
+	return hosts
+}
+
+func checkProxyJumps(cfg *config.Config, sshAliases []string) []Diagnostic {
+	known := make(map[string]bool)
+	for _, alias := range sshAliases {
+		known[strings.ToLower(alias)] = true
+	}
+	byID := make(map[string]*config.Connection)
+	for i := range cfg.Connections {
+		conn := &cfg.Connections[i]
+		known[strings.ToLower(conn.Host)] = true
+		byID[conn.ID] = conn
+	}
+
+	var diags []Diagnostic
+	for i := range cfg.Connections {
+		conn := &cfg.Connections[i]
+		for _, host := range jumpHosts(conn.ProxyJump) {
+			if known[strings.ToLower(host)] {
+				continue
+			}
+			if target, ok := byID[host]; ok {
+				diags = append(diags, warning(cfg, conn, "proxy_jump", "proxy_jump",
+					"%q is a hop connection ID, but ssh -J needs a hostname or ~/.ssh/config alias (use %q)", host, target.Host))
+				continue
+			}
+			diags = append(diags, warning(cfg, conn, "proxy_jump", "proxy_jump",
+				"jump host %q is not a known connection or ~/.ssh/config host", host))
+		}
+	}
+	return diags
+}
+
+func checkDuplicateEndpoints(cfg *config.Config) []Diagnostic {
+	first := make(map[string]string)
+	var diags []Diagnostic
+	for i := range cfg.Connections {
+		conn := &cfg.Connections[i]
+		if conn.Host == "" {
+			continue
+		}
+		endpoint := fmt.Sprintf("%s:%d", conn.Host, conn.Port)
+		if user := conn.EffectiveUser(); user != "" {
+			endpoint = user + "@" + endpoint
+		}
+		key := strings.ToLower(endpoint)
+		if id, ok := first[key]; ok {
+			diags = append(diags, warning(cfg, conn, "duplicate", "host",
+				"same host, user and port as '%s' (%s)", id, endpoint))
+			continue
+		}
+		first[key] = conn.ID
+	}
+	return diags
+}
+
+func checkOptions(cfg *config.Config) []Diagnostic {
+	var diags []Diagnostic
+	for i := range cfg.Connections {
+		conn := &cfg.Connections[i]
+		keys := make([]string, 0, len(conn.Options))
+		for k := range conn.Options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !IsSSHOption(k) {
+				diags = append(diags, warning(cfg, conn, "options", "options."+k,
+					"%q is not an ssh option; ssh will refuse to connect", k))
+			}
+		}
+	}
+	return diags
+}
+
+// isProd reports whether a connection looks like production, by env or tag.
+func isProd(conn *config.Connection) bool {
+	for _, v := range append([]string{conn.Env}, conn.Tags...) {
+		switch strings.ToLower(v) {
+		case "prod", "production", "prd":
+			return true
+		}
+	}
+	return false
+}
+
+func checkForwardAgent(cfg *config.Config) []Diagnostic {
+	var diags []Diagnostic
+	for i := range cfg.Connections {
+		conn := &cfg.Connections[i]
+		if conn.ForwardAgent && isProd(conn) {
+			diags = append(diags, warning(cfg, conn, "forward_agent", "forward_agent",
+				"agent forwarding on a production host exposes your keys to anyone with root there; prefer proxy_jump"))
+		}
+	}
+	return diags
+}
+
+// LookPathFunc finds an executable, like exec.LookPath.
+type LookPathFunc func(file string) (string, error)
+
+// CheckTools reports whether the local tools hop shells out to are available:
+// ssh always, mosh when a connection uses it, and a terminal hop can open
+// tabs in.
+func CheckTools(cfg *config.Config, lookPath LookPathFunc, terminal ssh.TerminalType) []Diagnostic {
+	var diags []Diagnostic
+	tool := func(name string, sev Severity, why string) {
+		if path, err := lookPath(name); err == nil {
+			diags = append(diags, Diagnostic{Severity: SeverityOK, Check: "tools", Field: name, Message: "found " + path})
+		} else {
+			diags = append(diags, Diagnostic{Severity: sev, Check: "tools", Field: name, Message: "not found in PATH; " + why})
+		}
+	}
+
+	tool("ssh", SeverityError, "hop cannot connect without it")
+
+	usesMosh := cfg.Defaults.UseMosh
+	for i := range cfg.Connections {
+		usesMosh = usesMosh || cfg.Connections[i].Mosh()
+	}
+	if usesMosh {
+		tool("mosh", SeverityWarning, "connections with use_mosh will fail")
+		tool("mosh-client", SeverityWarning, "connections with use_mosh will fail")
+	}
+
+	switch {
+	case terminal == ssh.TerminalUnknown:
+		diags = append(diags, Diagnostic{Severity: SeverityWarning, Check: "tools", Field: "terminal",
+			Message: "could not detect the terminal; set HOP_TERMINAL so hop open can open tabs"})
+	case !terminal.SupportsNewTab():
+		diags = append(diags, Diagnostic{Severity: SeverityWarning, Check: "tools", Field: "terminal",
+			Message: terminal.String() + " cannot open tabs; hop open will not work"})
+	default:
+		diags = append(diags, Diagnostic{Severity: SeverityOK, Check: "tools", Field: "terminal",
+			Message: terminal.String() + " (tabs supported)"})
+	}
+	return diags
+}
+
+// dedupe drops repeated findings, e.g. one missing key inherited from a
+// template by many connections.
+func dedupe(diags []Diagnostic) []Diagnostic {
+	seen := make(map[string]bool)
+	out := diags[:0]
+	for _, d := range diags {
+		key := d.Position.String() + "|" + d.Check + "|" + d.Message
+		if d.Line == 0 {
+			key += "|" + d.Field
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, d)
+	}
+	return out
+}
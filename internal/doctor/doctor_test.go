@@ -0,0 +1,241 @@
+package doctor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+func loadConfig(t *testing.T, content string) (string, *config.Config) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return path, cfg
+}
+
+func find(diags []Diagnostic, check, field string) *Diagnostic {
+	for i := range diags {
+		if diags[i].Check == check && diags[i].Field == field {
+			return &diags[i]
+		}
+	}
+	return nil
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	goodKey := filepath.Join(dir, "good")
+	openKey := filepath.Join(dir, "open")
+	if err := os.WriteFile(goodKey, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(openKey, []byte("key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, cfg := loadConfig(t, `version: 1
+templates:
+  base:
+    identity_file: `+filepath.Join(dir, "missing")+`
+connections:
+  - id: bastion
+    host: 10.0.0.1
+    identity_file: `+goodKey+`
+  - id: app
+    host: app.example.com
+    user: deploy
+    extends: [base]
+    proxy_jump: bastion
+  - id: app2
+    host: app.example.com
+    user: deploy
+    identity_file: `+openKey+`
+    proxy_jump: jump.example.com
+    options:
+      ServerAliveInterval: "30"
+      Bogus: "1"
+  - id: db
+    host: db.example.com
+    env: prod
+    forward_agent: true
+    proxy_jump: deploy@alias:2222
+groups:
+  web: [app, zz]
+`)
+	diags := CheckConfig(cfg, []string{"alias", "jump.example.com"})
+
+	tests := []struct {
+		check, field string
+		severity     Severity
+		line, column int
+		message      string
+	}{
+		{"config", "groups.web", SeverityError, 28, 3, "unknown connection 'zz'"},
+		{"identity_file", "app.identity_file", SeverityWarning, 4, 5, "does not exist"},
+		{"identity_file", "app2.identity_file", SeverityWarning, 17, 5, "permissions 0644"},
+		{"proxy_jump", "app.proxy_jump", SeverityWarning, 13, 5, `use "10.0.0.1"`},
+		{"duplicate", "app2.host", SeverityWarning, 15, 5, "same host, user and port as 'app'"},
+		{"options", "app2.options.Bogus", SeverityWarning, 19, 5, `"Bogus" is not an ssh option`},
+		{"forward_agent", "db.forward_agent", SeverityWarning, 25, 5, "production"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			d := find(diags, tt.check, tt.field)
+			if d == nil {
+				t.Fatalf("no %s diagnostic for %s in %v", tt.check, tt.field, diags)
+			}
+			if d.Severity != tt.severity {
+				t.Errorf("severity = %s, want %s", d.Severity, tt.severity)
+			}
+			if d.File != path || d.Line != tt.line || d.Column != tt.column {
+				t.Errorf("position = %s, want %s:%d:%d", d.Position, path, tt.line, tt.column)
+			}
+			if !strings.Contains(d.Message, tt.message) {
+				t.Errorf("message = %q, want it to contain %q", d.Message, tt.message)
+			}
+		})
+	}
+
+	if d := find(diags, "identity_file", "bastion.identity_file"); d != nil {
+		t.Errorf("unexpected diagnostic for a 0600 key: %v", d)
+	}
+	if d := find(diags, "proxy_jump", "app2.proxy_jump"); d != nil {
+		t.Errorf("unexpected diagnostic for an ssh config alias: %v", d)
+	}
+	if d := find(diags, "proxy_jump", "db.proxy_jump"); d != nil {
+		t.Errorf("unexpected diagnostic for user@alias:port: %v", d)
+	}
+	if errs, warnings := Counts(diags); errs != 1 || warnings != 6 {
+		t.Errorf("Counts = %d errors, %d warnings, want 1, 6", errs, warnings)
+	}
+}
+
+func TestCheckConfig_Inventories(t *testing.T) {
+	path, cfg := loadConfig(t, `version: 1
+connections: []
+inventories:
+  - name: cloud
+    command: ./missing.sh
+`)
+	diags := CheckConfig(cfg, nil)
+	d := find(diags, "inventory", "inventories.cloud")
+	if d == nil {
+		t.Fatalf("no inventory warning in %v", diags)
+	}
+	if d.Severity != SeverityWarning || d.File != path || d.Line != 3 || !strings.Contains(d.Message, "missing.sh") {
+		t.Errorf("got %+v", *d)
+	}
+}
+
+func TestCheckConfig_InheritedWarningReportedOnce(t *testing.T) {
+	_, cfg := loadConfig(t, `version: 1
+templates:
+  base:
+    identity_file: /nonexistent/key
+connections:
+  - id: a
+    host: a.example.com
+    extends: [base]
+  - id: b
+    host: b.example.com
+    extends: [base]
+`)
+	var n int
+	for _, d := range CheckConfig(cfg, nil) {
+		if d.Check == "identity_file" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("got %d identity_file diagnostics, want 1", n)
+	}
+}
+
+func TestJumpHosts(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"bastion", []string{"bastion"}},
+		{"user@bastion:2222", []string{"bastion"}},
+		{"a, user@b:22,c", []string{"a", "b", "c"}},
+		{"[::1]:22", []string{"::1"}},
+		{"fe80::1", []string{"fe80::1"}},
+	}
+	for _, tt := range tests {
+		if got := jumpHosts(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("jumpHosts(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsSSHOption(t *testing.T) {
+	for _, k := range []string{"ServerAliveInterval", "serveraliveinterval", "StrictHostKeyChecking", "UseKeychain"} {
+		if !IsSSHOption(k) {
+			t.Errorf("IsSSHOption(%q) = false, want true", k)
+		}
+	}
+	for _, k := range []string{"", "ServerAlive", "Bogus", "Host", "Match"} {
+		if IsSSHOption(k) {
+			t.Errorf("IsSSHOption(%q) = true, want false", k)
+		}
+	}
+}
+
+func TestCheckTools(t *testing.T) {
+	cfg := &config.Config{Connections: []config.Connection{{ID: "a", Host: "a"}}}
+	onlySSH := func(file string) (string, error) {
+		if file == "ssh" {
+			return "/usr/bin/ssh", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	diags := CheckTools(cfg, onlySSH, ssh.TerminalKitty)
+	if d := find(diags, "tools", "ssh"); d == nil || d.Severity != SeverityOK {
+		t.Errorf("ssh = %v, want ok", d)
+	}
+	if d := find(diags, "tools", "mosh"); d != nil {
+		t.Errorf("mosh checked although no connection uses it: %v", d)
+	}
+	if d := find(diags, "tools", "terminal"); d == nil || d.Severity != SeverityOK {
+		t.Errorf("terminal = %v, want ok", d)
+	}
+
+	cfg.Defaults.UseMosh = true
+	diags = CheckTools(cfg, onlySSH, ssh.TerminalUnknown)
+	if d := find(diags, "tools", "mosh"); d == nil || d.Severity != SeverityWarning {
+		t.Errorf("mosh = %v, want warning", d)
+	}
+	if d := find(diags, "tools", "terminal"); d == nil || d.Severity != SeverityWarning {
+		t.Errorf("terminal = %v, want warning", d)
+	}
+
+	none := func(string) (string, error) { return "", errors.New("not found") }
+	if errs, _ := Counts(CheckTools(cfg, none, ssh.TerminalKitty)); errs != 1 {
+		t.Errorf("missing ssh gave %d errors, want 1", errs)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	d := LoadError("/c.yaml", errors.New("failed to parse config: yaml: line 7: did not find expected key"))
+	if d.Severity != SeverityError || d.File != "/c.yaml" || d.Line != 7 {
+		t.Errorf("LoadError = %+v", d)
+	}
+	if got := d.String(); !strings.HasPrefix(got, "/c.yaml:7:0: error: ") {
+		t.Errorf("String() = %q", got)
+	}
+}
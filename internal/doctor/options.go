@@ -0,0 +1,50 @@
+package doctor
+
+import "strings"
+
+// sshOptions are the ssh_config(5) keywords accepted by OpenSSH's ssh -o,
+// lowercased. Unknown keywords make ssh exit before connecting, and so do Host
+// and Match, which only open blocks in a config file.
+var sshOptions = map[string]bool{}
+
+func init() {
+	for _, k := range []string{
+		"AddKeysToAgent", "AddressFamily", "BatchMode", "BindAddress", "BindInterface",
+		"CanonicalDomains", "CanonicalizeFallbackLocal", "CanonicalizeHostname",
+		"CanonicalizeMaxDots", "CanonicalizePermittedCNAMEs", "CASignatureAlgorithms",
+		"CertificateFile", "ChannelTimeout", "CheckHostIP", "Ciphers", "ClearAllForwardings",
+		"Compression", "ConnectionAttempts", "ConnectTimeout", "ControlMaster",
+		"ControlPath", "ControlPersist", "DynamicForward", "EnableEscapeCommandline",
+		"EnableSSHKeysign", "EscapeChar", "ExitOnForwardFailure", "FingerprintHash",
+		"ForkAfterAuthentication", "ForwardAgent", "ForwardX11", "ForwardX11Timeout",
+		"ForwardX11Trusted", "GatewayPorts", "GlobalKnownHostsFile", "GSSAPIAuthentication",
+		"GSSAPIDelegateCredentials", "HashKnownHosts", "HostbasedAcceptedAlgorithms",
+		"HostbasedAuthentication", "HostKeyAlgorithms", "HostKeyAlias", "Hostname",
+		"IdentitiesOnly", "IdentityAgent", "IdentityFile", "IgnoreUnknown", "Include",
+		"IPQoS", "KbdInteractiveAuthentication", "KbdInteractiveDevices", "KexAlgorithms",
+		"KnownHostsCommand", "LocalCommand", "LocalForward", "LogLevel", "LogVerbose",
+		"MACs", "NoHostAuthenticationForLocalhost", "NumberOfPasswordPrompts",
+		"ObscureKeystrokeTiming", "PasswordAuthentication", "PermitLocalCommand",
+		"PermitRemoteOpen", "PKCS11Provider", "Port", "PreferredAuthentications",
+		"ProxyCommand", "ProxyJump", "ProxyUseFdpass", "PubkeyAcceptedAlgorithms",
+		"PubkeyAuthentication", "RekeyLimit", "RemoteCommand", "RemoteForward",
+		"RequestTTY", "RequiredRSASize", "RevokedHostKeys", "SecurityKeyProvider",
+		"SendEnv", "ServerAliveCountMax", "ServerAliveInterval", "SessionType", "SetEnv",
+		"StdinNull", "StreamLocalBindMask", "StreamLocalBindUnlink", "StrictHostKeyChecking",
+		"SyslogFacility", "Tag", "TCPKeepAlive", "Tunnel", "TunnelDevice",
+		"UpdateHostKeys", "User", "UserKnownHostsFile", "VerifyHostKeyDNS",
+		"VisualHostKey", "XAuthLocation",
+		// Deprecated but still accepted.
+		"ChallengeResponseAuthentication", "PubkeyAcceptedKeyTypes", "HostbasedKeyTypes",
+		// Apple's OpenSSH (macOS).
+		"UseKeychain",
+	} {
+		sshOptions[strings.ToLower(k)] = true
+	}
+}
+
+// IsSSHOption reports whether key is an ssh_config keyword ssh accepts with
+// -o. Keywords are case-insensitive.
+func IsSSHOption(key string) bool {
+	return sshOptions[strings.ToLower(key)]
+}
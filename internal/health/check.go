@@ -13,6 +13,9 @@ const (
 	StatusChecking
 	StatusReachable
 	StatusUnreachable
+	// StatusPortOpen means the port accepted the connection but no SSH
+	// server answered on it.
+	StatusPortOpen
 )
 
 func CheckTCP(host string, port int) Status {
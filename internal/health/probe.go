@@ -0,0 +1,272 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+const (
+	// DefaultTimeout bounds the TCP connect and the wait for the SSH banner,
+	// each.
+	DefaultTimeout = 2 * time.Second
+	// DefaultParallel is how many hosts CheckAll checks at once.
+	DefaultParallel = 20
+	// HistorySize is how many results a History keeps per host.
+	HistorySize = 20
+)
+
+// maxBannerLine is the longest identification line RFC 4253 allows,
+// including CR LF. Servers may send other lines before it.
+const maxBannerLine = 255
+
+func (s Status) String() string {
+	switch s {
+	case StatusChecking:
+		return "checking"
+	case StatusReachable:
+		return "reachable"
+	case StatusUnreachable:
+		return "unreachable"
+	case StatusPortOpen:
+		return "port_open"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is the outcome of checking one host.
+type Result struct {
+	Status Status
+	// RTT is how long the TCP connect took. Through a jump host it is the
+	// time until the target's first bytes arrived through ssh, which
+	// includes logging in to the jump host unless a master was shared.
+	RTT time.Duration
+	// Banner is the SSH server's identification line, e.g.
+	// "SSH-2.0-OpenSSH_9.6".
+	Banner string
+	// Via is the proxy_jump chain the check went through, if any.
+	Via     string
+	Err     error
+	Checked time.Time
+}
+
+// DialFunc opens a TCP connection to a connection's SSH port.
+type DialFunc func(ctx context.Context, conn *config.Connection) (net.Conn, error)
+
+// Check connects to conn's SSH port with dial and waits for the server's
+// SSH banner, giving each step timeout. Behind a proxy_jump the connect
+// gets timeout again for the jump host login. A port that accepts
+// connections but doesn't answer with a banner is reported as
+// StatusPortOpen; through a jump host such a port can't be told apart
+// from an unreachable one.
+func Check(ctx context.Context, conn *config.Connection, dial DialFunc, timeout time.Duration) Result {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	r := Result{Checked: time.Now()}
+	dialTimeout := timeout
+	if conn.ProxyJump != "" && !strings.EqualFold(conn.ProxyJump, "none") {
+		r.Via = conn.ProxyJump
+		dialTimeout += timeout
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	start := time.Now()
+	nc, err := dial(dialCtx, conn)
+	if err != nil {
+		r.Status, r.Err = StatusUnreachable, err
+		return r
+	}
+	defer nc.Close()
+	r.RTT = time.Since(start)
+
+	r.Banner, err = readBanner(nc, timeout)
+	if err != nil {
+		r.Status, r.Err = StatusPortOpen, err
+		return r
+	}
+	r.Status = StatusReachable
+	return r
+}
+
+// readBanner returns the SSH identification line the server sends first,
+// skipping any other lines before it.
+func readBanner(nc net.Conn, timeout time.Duration) (string, error) {
+	nc.SetReadDeadline(time.Now().Add(timeout))
+	br := bufio.NewReaderSize(nc, maxBannerLine)
+	for i := 0; i < 10; i++ {
+		line, err := br.ReadSlice('\n')
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return "", errors.New("no SSH banner")
+			}
+			if errors.Is(err, bufio.ErrBufferFull) {
+				return "", errors.New("not an SSH server")
+			}
+			return "", fmt.Errorf("reading SSH banner: %w", err)
+		}
+		if s := strings.TrimRight(string(line), "\r\n"); strings.HasPrefix(s, "SSH-") {
+			return s, nil
+		}
+	}
+	return "", errors.New("not an SSH server")
+}
+
+// CheckAll checks connections concurrently, at most parallel at a time,
+// and returns their results in the same order. Each host's timeouts start
+// when its check does, not while it waits for a slot. Hosts behind a
+// proxy_jump are reached through it with the ssh binary (see
+// ssh.TCPDialer).
+func CheckAll(ctx context.Context, connections []config.Connection, timeout time.Duration, parallel int) []Result {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+
+	// ssh processes left by an abandoned check end with the round.
+	dialCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dialer := ssh.NewTCPDialer(dialCtx)
+
+	results := make([]Result, len(connections))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range connections {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = Check(ctx, &connections[i], dialer.Dial, timeout)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// Record is the JSON form of a Result, for hop status and the MCP server.
+type Record struct {
+	ID      string    `json:"id"`
+	Host    string    `json:"host"`
+	Port    int       `json:"port"`
+	Status  string    `json:"status"`
+	RTTMS   float64   `json:"rtt_ms,omitempty"`
+	Banner  string    `json:"banner,omitempty"`
+	Via     string    `json:"via,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// NewRecord converts conn's check result to a Record.
+func NewRecord(conn *config.Connection, r Result) Record {
+	port := conn.Port
+	if port == 0 {
+		port = 22
+	}
+	rec := Record{
+		ID:      conn.ID,
+		Host:    conn.Host,
+		Port:    port,
+		Status:  r.Status.String(),
+		Banner:  r.Banner,
+		Via:     r.Via,
+		Checked: r.Checked,
+	}
+	if r.RTT > 0 {
+		rec.RTTMS = float64(r.RTT.Microseconds()) / 1000
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	return rec
+}
+
+// Summary counts check results by status.
+type Summary struct {
+	Checked     int `json:"checked"`
+	Reachable   int `json:"reachable"`
+	PortOpen    int `json:"port_open"`
+	Unreachable int `json:"unreachable"`
+}
+
+// Summarize counts records by status.
+func Summarize(records []Record) Summary {
+	s := Summary{Checked: len(records)}
+	for _, r := range records {
+		switch r.Status {
+		case StatusReachable.String():
+			s.Reachable++
+		case StatusPortOpen.String():
+			s.PortOpen++
+		case StatusUnreachable.String():
+			s.Unreachable++
+		}
+	}
+	return s
+}
+
+// Down returns how many hosts did not answer as SSH servers.
+func (s Summary) Down() int {
+	return s.Checked - s.Reachable
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d checked: %d reachable, %d port open, %d unreachable", s.Checked, s.Reachable, s.PortOpen, s.Unreachable)
+}
+
+// History keeps the most recent results of each host, oldest first.
+type History struct {
+	size    int
+	results map[string][]Result
+}
+
+// NewHistory returns a History keeping size results per host.
+func NewHistory(size int) *History {
+	return &History{size: size, results: make(map[string][]Result)}
+}
+
+// Add records r for the host with the given ID, dropping its oldest result
+// when full.
+func (h *History) Add(id string, r Result) {
+	rs := append(h.results[id], r)
+	if len(rs) > h.size {
+		rs = rs[len(rs)-h.size:]
+	}
+	h.results[id] = rs
+}
+
+// Results returns the host's results, oldest first.
+func (h *History) Results(id string) []Result {
+	return h.results[id]
+}
+
+// Latest returns the host's most recent result.
+func (h *History) Latest(id string) (Result, bool) {
+	rs := h.results[id]
+	if len(rs) == 0 {
+		return Result{}, false
+	}
+	return rs[len(rs)-1], true
+}
+
+// Forget drops the results of hosts not in keep.
+func (h *History) Forget(keep map[string]bool) {
+	for id := range h.results {
+		if !keep[id] {
+			delete(h.results, id)
+		}
+	}
+}
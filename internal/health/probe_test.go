@@ -0,0 +1,166 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// listen starts a listener that calls serve for each connection and returns
+// a connection pointing at it.
+func listen(t *testing.T, serve func(net.Conn)) config.Connection {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				serve(nc)
+			}()
+		}
+	}()
+	return config.Connection{ID: "test", Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+}
+
+func TestCheckAll(t *testing.T) {
+	sshd := listen(t, func(nc net.Conn) {
+		nc.Write([]byte("a pre-banner line\r\nSSH-2.0-OpenSSH_9.6 test\r\n"))
+		time.Sleep(time.Second)
+	})
+	silent := listen(t, func(nc net.Conn) { time.Sleep(time.Second) })
+	web := listen(t, func(nc net.Conn) { nc.Write([]byte(strings.Repeat("x", 300))) })
+	closed := listen(t, func(net.Conn) {})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := config.Connection{ID: "down", Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+	ln.Close()
+
+	conns := []config.Connection{sshd, silent, web, closed, down}
+	results := CheckAll(context.Background(), conns, 200*time.Millisecond, 0)
+
+	want := []Status{StatusReachable, StatusPortOpen, StatusPortOpen, StatusPortOpen, StatusUnreachable}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("result %d: status = %s (%v), want %s", i, r.Status, r.Err, want[i])
+		}
+	}
+	if results[0].Banner != "SSH-2.0-OpenSSH_9.6 test" {
+		t.Errorf("banner = %q", results[0].Banner)
+	}
+	if results[0].RTT <= 0 || results[4].RTT != 0 {
+		t.Errorf("RTT = %v, %v", results[0].RTT, results[4].RTT)
+	}
+	if results[1].Err == nil || results[4].Err == nil {
+		t.Error("expected errors for the silent and down hosts")
+	}
+}
+
+func TestCheckAllQueuedHostsGetFullTimeout(t *testing.T) {
+	silent := listen(t, func(nc net.Conn) { time.Sleep(2 * time.Second) })
+	sshd := listen(t, func(nc net.Conn) {
+		nc.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		time.Sleep(time.Second)
+	})
+
+	// Hosts that never send a banner fill every slot for several rounds
+	// before the healthy ones get a turn.
+	const parallel = 4
+	var conns []config.Connection
+	for i := 0; i < 4*parallel; i++ {
+		conns = append(conns, silent)
+	}
+	for i := 0; i < 5; i++ {
+		conns = append(conns, sshd)
+	}
+	results := CheckAll(context.Background(), conns, 200*time.Millisecond, parallel)
+
+	for i, r := range results {
+		want := StatusPortOpen
+		if i >= 4*parallel {
+			want = StatusReachable
+		}
+		if r.Status != want {
+			t.Errorf("result %d: status = %s (%v), want %s", i, r.Status, r.Err, want)
+		}
+	}
+}
+
+func TestCheck_Via(t *testing.T) {
+	dial := func(context.Context, *config.Connection) (net.Conn, error) {
+		return nil, errors.New("jump failed")
+	}
+	conn := &config.Connection{ID: "db", Host: "10.0.0.5", ProxyJump: "bastion"}
+	r := Check(context.Background(), conn, dial, 0)
+	if r.Status != StatusUnreachable || r.Via != "bastion" || r.Err == nil {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	conn := &config.Connection{ID: "web", Host: "web.example.com"}
+	rec := NewRecord(conn, Result{Status: StatusReachable, RTT: 1500 * time.Microsecond, Banner: "SSH-2.0-x"})
+	if rec.Port != 22 || rec.Status != "reachable" || rec.RTTMS != 1.5 || rec.Error != "" {
+		t.Errorf("got %+v", rec)
+	}
+
+	rec = NewRecord(conn, Result{Status: StatusUnreachable, Err: errors.New("refused")})
+	if rec.Status != "unreachable" || rec.Error != "refused" || rec.RTTMS != 0 {
+		t.Errorf("got %+v", rec)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(3)
+	if _, ok := h.Latest("web"); ok {
+		t.Error("expected no result before any Add")
+	}
+	for i := 1; i <= 5; i++ {
+		h.Add("web", Result{RTT: time.Duration(i)})
+	}
+	h.Add("db", Result{})
+
+	rs := h.Results("web")
+	if len(rs) != 3 || rs[0].RTT != 3 || rs[2].RTT != 5 {
+		t.Errorf("results = %+v, want the last 3", rs)
+	}
+	if last, _ := h.Latest("web"); last.RTT != 5 {
+		t.Errorf("latest RTT = %v, want 5", last.RTT)
+	}
+
+	h.Forget(map[string]bool{"db": true})
+	if len(h.Results("web")) != 0 || len(h.Results("db")) != 1 {
+		t.Error("Forget should drop only hosts not kept")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	records := []Record{
+		{Status: "reachable"}, {Status: "reachable"}, {Status: "port_open"}, {Status: "unreachable"},
+	}
+	sum := Summarize(records)
+	if sum != (Summary{Checked: 4, Reachable: 2, PortOpen: 1, Unreachable: 1}) {
+		t.Errorf("summary = %+v", sum)
+	}
+	if sum.Down() != 2 {
+		t.Errorf("down = %d, want 2", sum.Down())
+	}
+	if got := sum.String(); got != "4 checked: 2 reachable, 1 port open, 1 unreachable" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -0,0 +1,526 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ansibleImporter reads Ansible inventories in INI or YAML form. Groups
+// become hop groups holding every host in them or their child groups, and
+// ansible_host, ansible_user, ansible_port and
+// ansible_ssh_private_key_file map to connection fields. Variables from
+// host_vars and group_vars directories are not read.
+type ansibleImporter struct{}
+
+func (ansibleImporter) Name() string { return "ansible" }
+
+func (ansibleImporter) Description() string {
+	return "Ansible inventory (INI or YAML)"
+}
+
+func (ansibleImporter) DefaultPath() string { return "/etc/ansible/hosts" }
+
+func (imp ansibleImporter) Import(path string, _ Options) (*Result, error) {
+	path, err := requirePath(imp, path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv *inventory
+	if isYAMLInventory(path, data) {
+		inv, err = parseYAMLInventory(data)
+	} else {
+		inv, err = parseINIInventory(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return inv.result(), nil
+}
+
+// inventory is an Ansible inventory, whichever form it was read from.
+type inventory struct {
+	hosts    []string // in the order first seen
+	hostVars map[string]map[string]string
+	groups   map[string]*inventoryGroup
+}
+
+type inventoryGroup struct {
+	hosts    []string
+	vars     map[string]string
+	children []string
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		hostVars: make(map[string]map[string]string),
+		groups:   make(map[string]*inventoryGroup),
+	}
+}
+
+func (inv *inventory) group(name string) *inventoryGroup {
+	g := inv.groups[name]
+	if g == nil {
+		g = &inventoryGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+// addHost records a host in group, with vars set on the host itself.
+func (inv *inventory) addHost(group, host string, vars map[string]string) {
+	hv, seen := inv.hostVars[host]
+	if !seen {
+		inv.hosts = append(inv.hosts, host)
+		hv = make(map[string]string)
+		inv.hostVars[host] = hv
+	}
+	for k, v := range vars {
+		hv[k] = v
+	}
+	g := inv.group(group)
+	if !containsString(g.hosts, host) {
+		g.hosts = append(g.hosts, host)
+	}
+}
+
+// members returns the hosts in a group and its descendants.
+func (inv *inventory) members(name string, visiting map[string]bool) []string {
+	g := inv.groups[name]
+	if g == nil || visiting[name] {
+		return nil
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	hosts := append([]string(nil), g.hosts...)
+	for _, child := range g.children {
+		for _, h := range inv.members(child, visiting) {
+			if !containsString(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return hosts
+}
+
+// depth is how far below the top a group is nested; Ansible lets a child
+// group's variables override its parents'.
+func (inv *inventory) depth(name string, visiting map[string]bool) int {
+	if visiting[name] {
+		return 0
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	d := 0
+	for parent, g := range inv.groups {
+		if containsString(g.children, name) {
+			if pd := inv.depth(parent, visiting) + 1; pd > d {
+				d = pd
+			}
+		}
+	}
+	return d
+}
+
+// result resolves each host's variables, from "all" through nested groups
+// to the host's own, and turns the hosts into connections.
+func (inv *inventory) result() *Result {
+	res := &Result{}
+
+	names := make([]string, 0, len(inv.groups))
+	depths := make(map[string]int)
+	memberOf := make(map[string]map[string]bool)
+	for name := range inv.groups {
+		names = append(names, name)
+		depths[name] = inv.depth(name, map[string]bool{})
+		memberOf[name] = make(map[string]bool)
+		for _, h := range inv.members(name, map[string]bool{}) {
+			memberOf[name][h] = true
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if depths[names[i]] != depths[names[j]] {
+			return depths[names[i]] < depths[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	imported := make(map[string]bool)
+	for _, host := range inv.hosts {
+		vars := make(map[string]string)
+		if all := inv.groups["all"]; all != nil {
+			for k, v := range all.vars {
+				vars[k] = v
+			}
+		}
+		for _, name := range names {
+			if name != "all" && memberOf[name][host] {
+				for k, v := range inv.groups[name].vars {
+					vars[k] = v
+				}
+			}
+		}
+		for k, v := range inv.hostVars[host] {
+			vars[k] = v
+		}
+
+		conn, err := ansibleConnection(host, vars)
+		if err != nil {
+			res.skip("%s: %v", host, err)
+			continue
+		}
+		res.Connections = append(res.Connections, conn)
+		imported[host] = true
+	}
+
+	for _, name := range names {
+		if name == "all" || name == "ungrouped" {
+			continue
+		}
+		for _, h := range inv.members(name, map[string]bool{}) {
+			if imported[h] {
+				res.addToGroup(name, h)
+			}
+		}
+	}
+	return res
+}
+
+func ansibleConnection(host string, vars map[string]string) (config.Connection, error) {
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if v := vars[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	switch c := get("ansible_connection"); c {
+	case "", "ssh", "paramiko", "smart":
+	default:
+		return config.Connection{}, fmt.Errorf("ansible_connection is %s", c)
+	}
+
+	conn := config.Connection{
+		ID:           host,
+		Host:         get("ansible_host", "ansible_ssh_host"),
+		User:         get("ansible_user", "ansible_ssh_user"),
+		IdentityFile: get("ansible_ssh_private_key_file", "ansible_private_key_file"),
+	}
+	if conn.Host == "" {
+		conn.Host = host
+	}
+	if p := get("ansible_port", "ansible_ssh_port"); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return config.Connection{}, fmt.Errorf("invalid ansible_port %q", p)
+		}
+		conn.Port = port
+	}
+	return conn, nil
+}
+
+// isYAMLInventory tells YAML inventories from INI ones by extension, or
+// else by whether the first entry ends in a colon ("all:").
+func isYAMLInventory(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return true
+	case ".ini", ".cfg":
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' || line == "---" {
+			continue
+		}
+		return strings.HasSuffix(line, ":")
+	}
+	return false
+}
+
+// parseINIInventory reads the INI form: host lines with key=value
+// variables under [group] headers, [group:vars] and [group:children].
+func parseINIInventory(data []byte) (*inventory, error) {
+	inv := newInventory()
+	group, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section %q", lineNum, line)
+			}
+			group, kind = line[1:len(line)-1], "hosts"
+			if name, suffix, ok := strings.Cut(group, ":"); ok {
+				group, kind = name, suffix
+			}
+			inv.group(group)
+			continue
+		}
+
+		switch kind {
+		case "hosts":
+			fields, err := splitINIFields(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			vars := make(map[string]string)
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: expected key=value, got %q", lineNum, f)
+				}
+				vars[k] = v
+			}
+			name := fields[0]
+			if h, p, ok := strings.Cut(name, ":"); ok && !strings.Contains(p, ":") {
+				if _, err := strconv.Atoi(p); err == nil {
+					name = h
+					if _, set := vars["ansible_port"]; !set {
+						vars["ansible_port"] = p
+					}
+				}
+			}
+			hosts, err := expandHostPattern(name)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			for _, h := range hosts {
+				inv.addHost(group, h, vars)
+			}
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key=value, got %q", lineNum, line)
+			}
+			inv.group(group).vars[strings.TrimSpace(k)] = unquote(strings.TrimSpace(v))
+		case "children":
+			g := inv.group(group)
+			if !containsString(g.children, line) {
+				g.children = append(g.children, line)
+			}
+			inv.group(line)
+		default:
+			return nil, fmt.Errorf("line %d: unknown section type %q", lineNum, kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// splitINIFields splits a host line on whitespace, keeping quoted values
+// together and dropping a trailing comment.
+func splitINIFields(line string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	var quote rune
+	inField := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		case r == '#' && !inField:
+			return fields, nil
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// expandHostPattern expands Ansible host ranges: "web[01:03]" is web01,
+// web02 and web03, "db-[a:c]" is db-a to db-c, and "[1:9:2]" steps by 2.
+func expandHostPattern(pattern string) ([]string, error) {
+	open := strings.IndexByte(pattern, '[')
+	if open < 0 {
+		return []string{pattern}, nil
+	}
+	end := strings.IndexByte(pattern[open:], ']')
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated range in %q", pattern)
+	}
+	end += open
+	prefix, spec, suffix := pattern[:open], pattern[open+1:end], pattern[end+1:]
+
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid range [%s] in %q", spec, pattern)
+	}
+	step := 1
+	if len(parts) == 3 {
+		s, err := strconv.Atoi(parts[2])
+		if err != nil || s <= 0 {
+			return nil, fmt.Errorf("invalid step in [%s]", spec)
+		}
+		step = s
+	}
+
+	var values []string
+	start, errStart := strconv.Atoi(parts[0])
+	stop, errStop := strconv.Atoi(parts[1])
+	switch {
+	case errStart == nil && errStop == nil:
+		width := len(parts[0])
+		for i := start; i <= stop; i += step {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+	case len(parts[0]) == 1 && len(parts[1]) == 1:
+		for c := int(parts[0][0]); c <= int(parts[1][0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+	default:
+		return nil, fmt.Errorf("invalid range [%s] in %q", spec, pattern)
+	}
+
+	rest, err := expandHostPattern(suffix)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, v := range values {
+		for _, r := range rest {
+			hosts = append(hosts, prefix+v+r)
+		}
+	}
+	return hosts, nil
+}
+
+// parseYAMLInventory reads the YAML form: nested groups with hosts, vars
+// and children keys. The YAML is walked as nodes to keep hosts in file
+// order.
+func parseYAMLInventory(data []byte) (*inventory, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	inv := newInventory()
+	if len(doc.Content) == 0 {
+		return inv, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of groups", root.Line)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if err := inv.readYAMLGroup(root.Content[i].Value, root.Content[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+func (inv *inventory) readYAMLGroup(name string, node *yaml.Node) error {
+	g := inv.group(name)
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: group %s: expected a mapping", node.Line, name)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		switch key {
+		case "hosts":
+			if value.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				vars := yamlVars(value.Content[j+1])
+				hosts, err := expandHostPattern(value.Content[j].Value)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", value.Content[j].Line, err)
+				}
+				for _, h := range hosts {
+					inv.addHost(name, h, vars)
+				}
+			}
+		case "vars":
+			for k, v := range yamlVars(value) {
+				g.vars[k] = v
+			}
+		case "children":
+			if value.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				child := value.Content[j].Value
+				if !containsString(g.children, child) {
+					g.children = append(g.children, child)
+				}
+				if err := inv.readYAMLGroup(child, value.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// yamlVars reads a mapping of variables; values that aren't scalars, such
+// as lists, are left out.
+func yamlVars(node *yaml.Node) map[string]string {
+	vars := make(map[string]string)
+	if node.Kind != yaml.MappingNode {
+		return vars
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if v := node.Content[i+1]; v.Kind == yaml.ScalarNode && v.Tag != "!!null" {
+			vars[node.Content[i].Value] = v.Value
+		}
+	}
+	return vars
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnsibleImport_INI(t *testing.T) {
+	path := writeFile(t, "hosts", `# inventory
+bastion.example.com ansible_user=jump
+
+[web]
+web[01:02].example.com ansible_user=deploy
+api.example.com:2222 ansible_host=10.0.0.5 # comment
+
+[db]
+db1 ansible_host=10.0.1.1 ansible_port=5022
+win1 ansible_connection=winrm
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=admin
+ansible_ssh_private_key_file="~/.ssh/prod key"
+
+[all:vars]
+ansible_port=22
+`)
+	res, err := (ansibleImporter{}).Import(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantIDs := []string{"bastion.example.com", "web01.example.com", "web02.example.com", "api.example.com", "db1"}
+	if got := connIDs(res.Connections); !reflect.DeepEqual(got, wantIDs) {
+		t.Fatalf("IDs = %v, want %v", got, wantIDs)
+	}
+	byID := make(map[string]int)
+	for i, c := range res.Connections {
+		byID[c.ID] = i
+	}
+
+	bastion := res.Connections[byID["bastion.example.com"]]
+	if bastion.User != "jump" || bastion.Port != 22 || bastion.IdentityFile != "" {
+		t.Errorf("bastion = %+v", bastion)
+	}
+	// Host vars win over the prod group's.
+	web := res.Connections[byID["web01.example.com"]]
+	if web.Host != "web01.example.com" || web.User != "deploy" || web.IdentityFile != "~/.ssh/prod key" {
+		t.Errorf("web01 = %+v", web)
+	}
+	api := res.Connections[byID["api.example.com"]]
+	if api.Host != "10.0.0.5" || api.Port != 2222 || api.User != "admin" {
+		t.Errorf("api = %+v", api)
+	}
+	db := res.Connections[byID["db1"]]
+	if db.Host != "10.0.1.1" || db.Port != 5022 {
+		t.Errorf("db1 = %+v", db)
+	}
+
+	wantGroups := map[string][]string{
+		"web":  {"web01.example.com", "web02.example.com", "api.example.com"},
+		"db":   {"db1"},
+		"prod": {"web01.example.com", "web02.example.com", "api.example.com", "db1"},
+	}
+	if !reflect.DeepEqual(res.Groups, wantGroups) {
+		t.Errorf("groups = %v, want %v", res.Groups, wantGroups)
+	}
+	if len(res.Skipped) != 1 {
+		t.Errorf("skipped = %v, want win1", res.Skipped)
+	}
+}
+
+func TestAnsibleImport_YAML(t *testing.T) {
+	path := writeFile(t, "inventory.yml", `all:
+  vars:
+    ansible_user: admin
+  hosts:
+    bastion:
+      ansible_host: 203.0.113.10
+  children:
+    webservers:
+      hosts:
+        web1:
+          ansible_host: 10.0.0.1
+        web2:
+      vars:
+        ansible_port: 2222
+    prod:
+      children:
+        webservers:
+`)
+	res, err := (ansibleImporter{}).Import(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := connIDs(res.Connections), []string{"bastion", "web1", "web2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("IDs = %v, want %v", got, want)
+	}
+	web1 := res.Connections[1]
+	if web1.Host != "10.0.0.1" || web1.User != "admin" || web1.Port != 2222 {
+		t.Errorf("web1 = %+v", web1)
+	}
+	if res.Connections[0].Port != 0 {
+		t.Errorf("bastion port = %d, want unset", res.Connections[0].Port)
+	}
+	wantGroups := map[string][]string{"webservers": {"web1", "web2"}, "prod": {"web1", "web2"}}
+	if !reflect.DeepEqual(res.Groups, wantGroups) {
+		t.Errorf("groups = %v, want %v", res.Groups, wantGroups)
+	}
+}
+
+func TestExpandHostPattern(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"web1", []string{"web1"}},
+		{"web[1:3]", []string{"web1", "web2", "web3"}},
+		{"web[08:10].x", []string{"web08.x", "web09.x", "web10.x"}},
+		{"db-[a:c]", []string{"db-a", "db-b", "db-c"}},
+		{"n[0:4:2]", []string{"n0", "n2", "n4"}},
+		{"r[1:2]-[a:b]", []string{"r1-a", "r1-b", "r2-a", "r2-b"}},
+	}
+	for _, tt := range tests {
+		got, err := expandHostPattern(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandHostPattern(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := expandHostPattern("web[1:"); err == nil {
+		t.Error("expected an error for an unterminated range")
+	}
+}
@@ -0,0 +1,203 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// csvImporter reads a spreadsheet export with a header row. Columns are
+// recognised by common header names (see csvHeaders); Options.Columns maps
+// fields to other headers. The delimiter (comma, semicolon or tab) is
+// detected from the header.
+type csvImporter struct{}
+
+func (csvImporter) Name() string { return "csv" }
+
+func (csvImporter) Description() string {
+	return "CSV with a header row (host, user, port, ...)"
+}
+
+func (csvImporter) DefaultPath() string { return "" }
+
+// csvHeaders lists the headers each field is recognised by, lower-cased
+// with spaces, dashes and underscores removed.
+var csvHeaders = map[string][]string{
+	"id":            {"id", "name", "alias", "label", "title"},
+	"host":          {"host", "hostname", "address", "ip", "ipaddress", "server"},
+	"user":          {"user", "username", "login"},
+	"port":          {"port"},
+	"identity_file": {"identityfile", "key", "keyfile", "privatekey"},
+	"proxy_jump":    {"proxyjump", "jump", "jumphost", "bastion"},
+	"project":       {"project"},
+	"env":           {"env", "environment"},
+	"remote_dir":    {"remotedir", "dir", "directory"},
+	"tags":          {"tags", "labels"},
+	"groups":        {"group", "groups"},
+}
+
+// CSVFields returns the fields a CSV column can be mapped to.
+func CSVFields() []string {
+	fields := make([]string, 0, len(csvHeaders))
+	for f := range csvHeaders {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (imp csvImporter) Import(path string, opts Options) (*Result, error) {
+	path, err := requirePath(imp, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	r := csv.NewReader(br)
+	r.Comma = sniffDelimiter(br)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return &Result{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	columns, err := csvColumns(header, opts.Columns)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, ok := columns["host"]; !ok {
+		return nil, fmt.Errorf("%s: no host column (use --columns host=<header>)", path)
+	}
+
+	res := &Result{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		conn := config.Connection{
+			ID:           value("id"),
+			Host:         value("host"),
+			User:         value("user"),
+			IdentityFile: value("identity_file"),
+			ProxyJump:    value("proxy_jump"),
+			Project:      value("project"),
+			Env:          value("env"),
+			RemoteDir:    value("remote_dir"),
+			Tags:         splitList(value("tags")),
+		}
+		if conn.Host == "" {
+			if strings.Join(record, "") != "" {
+				res.skip("line %d: no host", line)
+			}
+			continue
+		}
+		if conn.ID == "" {
+			conn.ID = conn.Host
+		}
+		if p := value("port"); p != "" {
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				res.skip("line %d: invalid port %q", line, p)
+				continue
+			}
+			conn.Port = port
+		}
+		res.Connections = append(res.Connections, conn)
+		for _, g := range splitList(value("groups")) {
+			res.addToGroup(g, conn.ID)
+		}
+	}
+	return res, nil
+}
+
+// csvColumns maps fields to column indexes, from mapping (field -> header)
+// first and recognised headers otherwise.
+func csvColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := make(map[string]int)
+	for field, name := range mapping {
+		if _, ok := csvHeaders[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q in column mapping (fields: %s)", field, strings.Join(CSVFields(), ", "))
+		}
+		i := indexFold(header, name)
+		if i < 0 {
+			return nil, fmt.Errorf("no column %q", name)
+		}
+		columns[field] = i
+	}
+	for i, h := range header {
+		key := normalizeHeader(h)
+		for field, names := range csvHeaders {
+			if _, mapped := columns[field]; !mapped && containsString(names, key) {
+				columns[field] = i
+			}
+		}
+	}
+	return columns, nil
+}
+
+// sniffDelimiter picks the most common of comma, semicolon and tab in the
+// first line.
+func sniffDelimiter(br *bufio.Reader) rune {
+	line, _ := br.Peek(4096)
+	if i := strings.IndexByte(string(line), '\n'); i >= 0 {
+		line = line[:i]
+	}
+	best, count := ',', strings.Count(string(line), ",")
+	for _, d := range []rune{';', '\t'} {
+		if n := strings.Count(string(line), string(d)); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+func normalizeHeader(h string) string {
+	h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(h)
+}
+
+func indexFold(list []string, s string) int {
+	for i, v := range list {
+		if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(v, "\ufeff")), s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitList splits a cell holding several values, separated by commas,
+// semicolons, pipes or spaces.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|' || r == ' '
+	})
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVImport(t *testing.T) {
+	path := writeFile(t, "hosts.csv", `Name,IP Address,Username,Port,Tags,Group
+web1,10.0.0.1,deploy,22,"web,prod",web
+db1,10.0.0.2,,5432,db,data
+,10.0.0.3,,,,
+bad,10.0.0.4,,x,,
+nohost,,,,,
+`)
+	res, err := (csvImporter{}).Import(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := connIDs(res.Connections), []string{"web1", "db1", "10.0.0.3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("IDs = %v, want %v", got, want)
+	}
+	web := res.Connections[0]
+	if web.Host != "10.0.0.1" || web.User != "deploy" || web.Port != 22 || !reflect.DeepEqual(web.Tags, []string{"web", "prod"}) {
+		t.Errorf("web1 = %+v", web)
+	}
+	if res.Connections[1].Port != 5432 {
+		t.Errorf("db1 port = %d", res.Connections[1].Port)
+	}
+	if want := map[string][]string{"web": {"web1"}, "data": {"db1"}}; !reflect.DeepEqual(res.Groups, want) {
+		t.Errorf("groups = %v, want %v", res.Groups, want)
+	}
+	if len(res.Skipped) != 2 {
+		t.Errorf("skipped = %v, want bad port and missing host", res.Skipped)
+	}
+}
+
+func TestCSVImport_ColumnMapping(t *testing.T) {
+	path := writeFile(t, "hosts.csv", "Server Name;Endpoint;Account\nweb1;10.0.0.1;deploy\n")
+
+	if _, err := (csvImporter{}).Import(path, Options{}); err == nil || !strings.Contains(err.Error(), "no host column") {
+		t.Errorf("err = %v, want a missing host column", err)
+	}
+
+	opts := Options{Columns: map[string]string{"id": "server name", "host": "Endpoint", "user": "Account"}}
+	res, err := (csvImporter{}).Import(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Connections) != 1 {
+		t.Fatalf("connections = %+v", res.Connections)
+	}
+	if c := res.Connections[0]; c.ID != "web1" || c.Host != "10.0.0.1" || c.User != "deploy" {
+		t.Errorf("connection = %+v", c)
+	}
+
+	opts.Columns = map[string]string{"hostname": "Endpoint"}
+	if _, err := (csvImporter{}).Import(path, opts); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+	opts.Columns = map[string]string{"host": "Missing"}
+	if _, err := (csvImporter{}).Import(path, opts); err == nil {
+		t.Error("expected an error for a missing column")
+	}
+}
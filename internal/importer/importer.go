@@ -0,0 +1,139 @@
+// Package importer reads connections from inventories kept by other tools:
+// OpenSSH config, Ansible inventories, known_hosts, CSV and PuTTY sessions.
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// Importer reads connections from one inventory format.
+type Importer interface {
+	// Name is the format's --from value, e.g. "ansible".
+	Name() string
+	// Description is a one-line summary for help text and the dashboard.
+	Description() string
+	// DefaultPath is the file read when no path is given, or "" if the
+	// format needs one.
+	DefaultPath() string
+	// Import reads connections from the file at path.
+	Import(path string, opts Options) (*Result, error)
+}
+
+// Options tunes an import.
+type Options struct {
+	// Columns maps connection fields (id, host, user, ...) to the CSV
+	// column holding them, for CSV files whose headers hop doesn't
+	// recognise.
+	Columns map[string]string
+}
+
+// Result is what an importer found.
+type Result struct {
+	Connections []config.Connection
+	// Groups maps group names to the IDs of connections in Connections.
+	Groups map[string][]string
+	// Skipped describes entries that could not be imported.
+	Skipped []string
+}
+
+// DefaultFormat is the format hop import reads without --from.
+const DefaultFormat = "ssh-config"
+
+var importers = []Importer{
+	sshConfigImporter{},
+	ansibleImporter{},
+	knownHostsImporter{},
+	csvImporter{},
+	puttyImporter{},
+}
+
+// All returns the available importers, the default first.
+func All() []Importer {
+	return importers
+}
+
+// Names returns the --from values of the available importers.
+func Names() []string {
+	names := make([]string, len(importers))
+	for i, imp := range importers {
+		names[i] = imp.Name()
+	}
+	return names
+}
+
+// Lookup returns the importer for a --from value.
+func Lookup(name string) (Importer, error) {
+	for _, imp := range importers {
+		if imp.Name() == name {
+			return imp, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown import format %q (available: %s)", name, strings.Join(Names(), ", "))
+}
+
+// AddGroups adds members to c's groups, creating groups that don't exist
+// and skipping members a group already has.
+func AddGroups(c *config.Config, groups map[string][]string) {
+	for name, members := range groups {
+		if len(members) == 0 {
+			continue
+		}
+		if c.Groups == nil {
+			c.Groups = make(map[string][]string)
+		}
+		existing := c.Groups[name]
+		for _, id := range members {
+			if !containsString(existing, id) {
+				existing = append(existing, id)
+			}
+		}
+		c.Groups[name] = existing
+	}
+}
+
+// addToGroup appends id to the group unless it is already a member.
+func (r *Result) addToGroup(name, id string) {
+	if r.Groups == nil {
+		r.Groups = make(map[string][]string)
+	}
+	if !containsString(r.Groups[name], id) {
+		r.Groups[name] = append(r.Groups[name], id)
+	}
+}
+
+func (r *Result) skip(format string, args ...any) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, args...))
+}
+
+// requirePath returns path, or the importer's default path if it is empty.
+func requirePath(imp Importer, path string) (string, error) {
+	if path == "" {
+		path = imp.DefaultPath()
+	}
+	if path == "" {
+		return "", fmt.Errorf("no file given")
+	}
+	return config.ExpandHome(path), nil
+}
+
+func homePath(elem ...string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(append([]string{home}, elem...)...)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func connIDs(conns []config.Connection) []string {
+	var ids []string
+	for _, c := range conns {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range Names() {
+		imp, err := Lookup(name)
+		if err != nil || imp.Name() != name {
+			t.Errorf("Lookup(%q) = %v, %v", name, imp, err)
+		}
+	}
+	if _, err := Lookup("termius"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if All()[0].Name() != DefaultFormat {
+		t.Errorf("first importer = %s, want %s", All()[0].Name(), DefaultFormat)
+	}
+}
+
+func TestRequirePath(t *testing.T) {
+	if _, err := (csvImporter{}).Import("", Options{}); err == nil {
+		t.Error("expected csv import without a file to fail")
+	}
+}
+
+func TestAddGroups(t *testing.T) {
+	cfg := &config.Config{Groups: map[string][]string{"web": {"web1"}}}
+	AddGroups(cfg, map[string][]string{
+		"web": {"web1", "web2"},
+		"db":  {"db1"},
+		"nil": nil,
+	})
+	want := map[string][]string{"web": {"web1", "web2"}, "db": {"db1"}}
+	if !reflect.DeepEqual(cfg.Groups, want) {
+		t.Errorf("groups = %v, want %v", cfg.Groups, want)
+	}
+}
+
+func TestSSHConfigImport(t *testing.T) {
+	path := writeFile(t, "config", "Host web\n    HostName 10.0.0.1\n    User deploy\n")
+	res, err := (sshConfigImporter{}).Import(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Connections) != 1 {
+		t.Fatalf("connections = %+v", res.Connections)
+	}
+	c := res.Connections[0]
+	if c.ID != "web" || c.Host != "10.0.0.1" || c.User != "deploy" || c.SSHConfigHost != "web" {
+		t.Errorf("connection = %+v", c)
+	}
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// knownHostsImporter reads the hosts ssh has connected to from a
+// known_hosts file. Each line becomes one connection, named after its first
+// host name (an IP only when the line has no name). Hashed entries
+// (HashKnownHosts) and @cert-authority/@revoked lines are skipped.
+type knownHostsImporter struct{}
+
+func (knownHostsImporter) Name() string { return "known-hosts" }
+
+func (knownHostsImporter) Description() string {
+	return "hosts ssh has connected to (known_hosts)"
+}
+
+func (knownHostsImporter) DefaultPath() string { return homePath(".ssh", "known_hosts") }
+
+func (imp knownHostsImporter) Import(path string, _ Options) (*Result, error) {
+	path, err := requirePath(imp, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &Result{}
+	seen := make(map[string]bool)
+	hashed := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '@' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "|") {
+			hashed++
+			continue
+		}
+
+		host, port, ok := pickKnownHost(strings.Split(fields[0], ","))
+		if !ok {
+			continue
+		}
+		key := net.JoinHostPort(host, strconv.Itoa(port))
+		if seen[key] {
+			// Another key type for the same host.
+			continue
+		}
+		seen[key] = true
+
+		conn := config.Connection{ID: host, Host: host}
+		if port != 22 {
+			conn.ID = host + "-" + strconv.Itoa(port)
+			conn.Port = port
+		}
+		res.Connections = append(res.Connections, conn)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if hashed > 0 {
+		res.skip("%d hashed entries (HashKnownHosts hides their host names)", hashed)
+	}
+	return res, nil
+}
+
+// pickKnownHost chooses the host a known_hosts line is for from its
+// comma-separated names: the first that isn't an IP address, else the
+// first IP. Wildcard patterns are ignored.
+func pickKnownHost(names []string) (string, int, bool) {
+	var ip string
+	ipPort := 0
+	for _, name := range names {
+		if strings.ContainsAny(name, "*?!") || name == "" {
+			continue
+		}
+		host, port := name, 22
+		// Non-default ports are written as [host]:port.
+		if strings.HasPrefix(name, "[") {
+			h, p, err := net.SplitHostPort(name)
+			if err != nil {
+				continue
+			}
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				continue
+			}
+			host, port = h, n
+		}
+		if net.ParseIP(host) == nil {
+			return host, port, true
+		}
+		if ip == "" {
+			ip, ipPort = host, port
+		}
+	}
+	return ip, ipPort, ip != ""
+}
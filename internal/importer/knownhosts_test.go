@@ -0,0 +1,42 @@
+package importer
+
+import (
+	"testing"
+)
+
+func TestKnownHostsImport(t *testing.T) {
+	path := writeFile(t, "known_hosts", `github.com,140.82.121.4 ssh-ed25519 AAAAC3Nz
+github.com ecdsa-sha2-nistp256 AAAAE2Vj
+10.0.0.7 ssh-rsa AAAAB3Nz
+[git.example.com]:2222 ssh-ed25519 AAAAC3Nz
+|1|JfKTdBh7rNbXkVAQCRp4OQoPfmI=|USECr3SWf1JUPsms5AqfD5QfxkM= ssh-rsa AAAAB3Nz
+|1|mHR/Ce3BDFQWSzUKPIUFcj/VUmg=|kzXo6yGqsLl7zeWg/ZEbhTGTC8U= ssh-rsa AAAAB3Nz
+@cert-authority *.example.com ssh-rsa AAAAB3Nz
+*.corp ssh-rsa AAAAB3Nz
+# comment
+`)
+	res, err := (knownHostsImporter{}).Import(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Connections) != 3 {
+		t.Fatalf("connections = %+v, want 3", res.Connections)
+	}
+	want := []struct {
+		id, host string
+		port     int
+	}{
+		{"github.com", "github.com", 0},
+		{"10.0.0.7", "10.0.0.7", 0},
+		{"git.example.com-2222", "git.example.com", 2222},
+	}
+	for i, w := range want {
+		c := res.Connections[i]
+		if c.ID != w.id || c.Host != w.host || c.Port != w.port {
+			t.Errorf("connection %d = %+v, want %+v", i, c, w)
+		}
+	}
+	if len(res.Skipped) != 1 {
+		t.Errorf("skipped = %v, want one note about hashed entries", res.Skipped)
+	}
+}
@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// puttyImporter reads PuTTY sessions from a registry export, made with
+//
+//	reg export HKCU\Software\SimonTatham\PuTTY\Sessions putty.reg
+//
+// Sessions using other protocols than SSH, and PuTTY's Default Settings,
+// are skipped. PuTTY keys (.ppk) need converting with puttygen before
+// OpenSSH can use them, so they aren't imported.
+type puttyImporter struct{}
+
+func (puttyImporter) Name() string { return "putty" }
+
+func (puttyImporter) Description() string {
+	return "PuTTY sessions exported from the registry (.reg)"
+}
+
+func (puttyImporter) DefaultPath() string { return "" }
+
+const puttySessionsKey = `\Software\SimonTatham\PuTTY\Sessions\`
+
+// puttySession is one session's registry values.
+type puttySession struct {
+	name   string
+	values map[string]string
+}
+
+func (imp puttyImporter) Import(path string, _ Options) (*Result, error) {
+	path, err := requirePath(imp, path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	for _, s := range parseRegSessions(decodeRegFile(data)) {
+		if s.name == "Default Settings" {
+			continue
+		}
+		if p := s.values["Protocol"]; p != "" && p != "ssh" {
+			res.skip("%s: protocol %s", s.name, p)
+			continue
+		}
+
+		conn := config.Connection{
+			ID:   strings.Join(strings.Fields(s.name), "-"),
+			Host: s.values["HostName"],
+			User: s.values["UserName"],
+		}
+		if user, host, ok := strings.Cut(conn.Host, "@"); ok {
+			conn.Host = host
+			if conn.User == "" {
+				conn.User = user
+			}
+		}
+		if conn.Host == "" {
+			res.skip("%s: no host name", s.name)
+			continue
+		}
+		if p, err := strconv.Atoi(s.values["PortNumber"]); err == nil && p != 22 {
+			conn.Port = p
+		}
+		if s.values["AgentFwd"] == "1" {
+			conn.ForwardAgent = true
+		}
+		res.Connections = append(res.Connections, conn)
+	}
+	return res, nil
+}
+
+// decodeRegFile returns the text of a .reg file, which regedit writes as
+// UTF-16 with a byte order mark.
+func decodeRegFile(data []byte) string {
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		data = data[2:]
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(u))
+	}
+	return string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")))
+}
+
+// parseRegSessions collects the string and dword values of each key under
+// PuTTY's Sessions key. dword values are returned in decimal.
+func parseRegSessions(text string) []puttySession {
+	var sessions []puttySession
+	var cur *puttySession
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			cur = nil
+			key := line[1 : len(line)-1]
+			i := strings.Index(key, puttySessionsKey)
+			if i < 0 {
+				continue
+			}
+			name := key[i+len(puttySessionsKey):]
+			if name == "" || strings.Contains(name, `\`) {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				name = unescaped
+			}
+			sessions = append(sessions, puttySession{name: name, values: make(map[string]string)})
+			cur = &sessions[len(sessions)-1]
+			continue
+		}
+		if cur == nil || !strings.HasPrefix(line, `"`) {
+			continue
+		}
+
+		name, value, ok := cutRegValue(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(value, `"`):
+			cur.values[name] = unescapeRegString(value)
+		case strings.HasPrefix(value, "dword:"):
+			if n, err := strconv.ParseUint(strings.TrimPrefix(value, "dword:"), 16, 32); err == nil {
+				cur.values[name] = strconv.FormatUint(n, 10)
+			}
+		}
+	}
+	return sessions
+}
+
+// cutRegValue splits `"Name"=value` into its name and raw value.
+func cutRegValue(line string) (string, string, bool) {
+	end := strings.Index(line[1:], `"=`)
+	if end < 0 {
+		return "", "", false
+	}
+	return line[1 : end+1], line[end+3:], true
+}
+
+// unescapeRegString decodes a quoted .reg string value, which escapes
+// backslashes and quotes with a backslash.
+func unescapeRegString(s string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+const puttyReg = `Windows Registry Editor Version 5.00
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\Default%20Settings]
+"HostName"=""
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\prod%20web]
+"HostName"="deploy@10.0.0.1"
+"PortNumber"=dword:000008ae
+"Protocol"="ssh"
+"AgentFwd"=dword:00000001
+"PublicKeyFile"="C:\\Users\\me\\key.ppk"
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\db]
+"HostName"="db.example.com"
+"UserName"="admin"
+"PortNumber"=dword:00000016
+"Protocol"="ssh"
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\router]
+"HostName"="192.168.1.1"
+"Protocol"="telnet"
+`
+
+func TestPuTTYImport(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"utf8":  []byte(puttyReg),
+		"utf16": utf16LE(puttyReg),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, "putty.reg", string(data))
+			res, err := (puttyImporter{}).Import(path, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Connections) != 2 {
+				t.Fatalf("connections = %+v, want prod-web and db", res.Connections)
+			}
+			web := res.Connections[0]
+			if web.ID != "prod-web" || web.Host != "10.0.0.1" || web.User != "deploy" || web.Port != 2222 || !web.ForwardAgent || web.IdentityFile != "" {
+				t.Errorf("prod-web = %+v", web)
+			}
+			db := res.Connections[1]
+			if db.ID != "db" || db.Host != "db.example.com" || db.User != "admin" || db.Port != 0 {
+				t.Errorf("db = %+v", db)
+			}
+			if len(res.Skipped) != 1 {
+				t.Errorf("skipped = %v, want the telnet session", res.Skipped)
+			}
+		})
+	}
+}
+
+// utf16LE encodes s the way regedit writes .reg files.
+func utf16LE(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2+2*len(u))
+	b[0], b[1] = 0xFF, 0xFE
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2+2*i:], c)
+	}
+	return b
+}
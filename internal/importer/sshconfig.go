@@ -0,0 +1,34 @@
+package importer
+
+import (
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+)
+
+// sshConfigImporter reads OpenSSH config; see sshconfig.Parse.
+type sshConfigImporter struct{}
+
+func (sshConfigImporter) Name() string { return DefaultFormat }
+
+func (sshConfigImporter) Description() string {
+	return "OpenSSH client config (Host blocks)"
+}
+
+func (sshConfigImporter) DefaultPath() string { return sshconfig.DefaultPath() }
+
+func (imp sshConfigImporter) Import(path string, _ Options) (*Result, error) {
+	path, err := requirePath(imp, path)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := sshconfig.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	for i := range hosts {
+		conn := hosts[i].ToConnection()
+		conn.SSHConfigHost = hosts[i].Alias
+		res.Connections = append(res.Connections, conn)
+	}
+	return res, nil
+}
@@ -51,11 +51,16 @@ func NewHopServer(version, cfgPath string, allowExec bool) *mcp.Server {
 		Description: "Build the full SSH command string for a connection, useful for debugging or manual use.",
 	}, loader.handleBuildSSHCommand)
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "check_status",
+		Description: "Check whether connections are reachable: connects to each SSH port and reads the server's banner, without logging in to the host or running anything on it. Hosts with a proxy_jump are reached with ssh -W through the jump host, which does log in to the jump host (or reuses its shared master). Reports reachable, port_open (port answers but no SSH banner) or unreachable per host, with latency and a summary.",
+	}, loader.handleCheckStatus)
+
 	// Exec tool (gated by --allow-exec)
 	if allowExec {
 		mcp.AddTool(server, &mcp.Tool{
 			Name:        "exec_command",
-			Description: "Execute a shell command on one or more remote servers matched by a target pattern. Requires --allow-exec flag.",
+			Description: "Execute a shell command on one or more remote servers matched by a target pattern. Set group_output or diff to get each distinct output once with its hosts, so outliers stand out. Requires --allow-exec flag.",
 		}, loader.handleExecCommand)
 	}
 
@@ -93,4 +98,18 @@ func registerResources(server *mcp.Server, loader *configLoader) {
 		Description: "All named connection groups and their members.",
 		MIMEType:    "application/json",
 	}, loader.handleGroupsResource)
+
+	server.AddResource(&mcp.Resource{
+		Name:        "runs",
+		URI:         "hop://runs",
+		Description: "Stored hop exec and exec_command runs, newest first: target, command, hosts and how many failed.",
+		MIMEType:    "application/json",
+	}, loader.handleRunsResource)
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "run",
+		URITemplate: "hop://runs/{id}",
+		Description: "A stored run by ID, with every host's stdout, stderr, exit code and duration.",
+		MIMEType:    "application/json",
+	}, loader.handleRunResource)
 }
@@ -86,7 +86,7 @@ func TestIntegration_InitializeAndListTools(t *testing.T) {
 		}
 
 		// Should have read-only tools
-		expectedTools := []string{"list_connections", "search_connections", "get_connection", "resolve_target", "list_groups", "get_history", "build_ssh_command"}
+		expectedTools := []string{"list_connections", "search_connections", "get_connection", "resolve_target", "list_groups", "get_history", "build_ssh_command", "check_status"}
 		for _, name := range expectedTools {
 			if !toolNames[name] {
 				t.Errorf("missing tool: %s", name)
@@ -10,7 +10,9 @@ import (
 
 	"github.com/danmartuszewski/hop/internal/config"
 	"github.com/danmartuszewski/hop/internal/fuzzy"
+	"github.com/danmartuszewski/hop/internal/health"
 	"github.com/danmartuszewski/hop/internal/resolve"
+	"github.com/danmartuszewski/hop/internal/runs"
 	"github.com/danmartuszewski/hop/internal/ssh"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -37,6 +39,7 @@ func toConnectionInfo(c config.Connection) ConnectionInfo {
 		ForwardAgent: c.ForwardAgent,
 		Tags:         c.Tags,
 		Options:      c.Options,
+		Inventory:    c.Inventory(),
 	}
 }
 
@@ -252,6 +255,54 @@ func (cl *configLoader) handleBuildSSHCommand(_ context.Context, _ *mcp.CallTool
 	return textResult(cmdStr)
 }
 
+func (cl *configLoader) handleCheckStatus(ctx context.Context, _ *mcp.CallToolRequest, input CheckStatusInput) (*mcp.CallToolResult, any, error) {
+	cfg, err := cl.load()
+	if err != nil {
+		return errorResult(fmt.Sprintf("failed to load config: %v", err))
+	}
+
+	connections := cfg.Connections
+	if input.Target != "" {
+		result, err := resolve.ResolveTarget(input.Target, cfg)
+		if err != nil {
+			return errorResult(fmt.Sprintf("resolve error: %v", err))
+		}
+		connections = result.Connections
+	}
+	if input.Tag != "" {
+		connections = fuzzy.MatchByTag(input.Tag, connections)
+	}
+
+	if len(connections) == 0 {
+		if input.Target == "" {
+			return errorResult("No connections to check.")
+		}
+		return errorResult(fmt.Sprintf("No connections matching '%s'.", input.Target))
+	}
+
+	timeout := health.DefaultTimeout
+	if input.Timeout != "" {
+		timeout, err = time.ParseDuration(input.Timeout)
+		if err != nil {
+			return errorResult(fmt.Sprintf("invalid timeout '%s': %v", input.Timeout, err))
+		}
+	}
+
+	log.Printf("[status] target=%s hosts=%d", input.Target, len(connections))
+
+	results := health.CheckAll(ctx, connections, timeout, input.Parallel)
+	records := make([]health.Record, len(connections))
+	for i := range connections {
+		records[i] = health.NewRecord(&connections[i], results[i])
+	}
+
+	type statusOutput struct {
+		Summary health.Summary  `json:"summary"`
+		Hosts   []health.Record `json:"hosts"`
+	}
+	return jsonTextResult(statusOutput{Summary: health.Summarize(records), Hosts: records})
+}
+
 func (cl *configLoader) handleExecCommand(ctx context.Context, _ *mcp.CallToolRequest, input ExecCommandInput) (*mcp.CallToolResult, any, error) {
 	if input.Command == "" {
 		return errorResult("command is required")
@@ -300,16 +351,32 @@ func (cl *configLoader) handleExecCommand(ctx context.Context, _ *mcp.CallToolRe
 		parallel = 10
 	}
 
+	transport, err := ssh.ParseTransport(input.Transport)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+
 	log.Printf("[exec] target=%s command=%q hosts=%d", input.Target, input.Command, len(connections))
 
 	execOpts := &ssh.ExecOptions{
-		Command:  input.Command,
-		Parallel: parallel,
-		Timeout:  timeout,
-		Stream:   false,
+		Command:   input.Command,
+		Parallel:  parallel,
+		Timeout:   timeout,
+		Stream:    false,
+		Transport: transport,
 	}
 
+	run := runs.New(runs.SourceMCP, input.Target, input.Command, connections)
+	run.Tag = input.Tag
+	run.Transport = string(transport)
 	results := ssh.ExecuteContext(ctx, connections, execOpts)
+	if _, err := config.RecordUsages(ssh.ExecUsages(results)...); err != nil {
+		log.Printf("[exec] failed to record history: %v", err)
+	}
+	run.Finish(results)
+	if err := runs.Save(run); err != nil {
+		log.Printf("[exec] failed to save run: %v", err)
+	}
 
 	// Build structured response
 	type hostResult struct {
@@ -317,28 +384,19 @@ func (cl *configLoader) handleExecCommand(ctx context.Context, _ *mcp.CallToolRe
 		Stdout   string `json:"stdout,omitempty"`
 		Stderr   string `json:"stderr,omitempty"`
 		ExitCode int    `json:"exit_code"`
+		Signal   string `json:"signal,omitempty"`
 		Duration string `json:"duration"`
 		Error    string `json:"error,omitempty"`
 	}
 
 	hostResults := make([]hostResult, len(results))
 	for i, r := range results {
-		stdout := r.Stdout
-		stderr := r.Stderr
-
-		// Enforce output cap
-		if len(stdout) > MaxBytesPerHost {
-			stdout = stdout[:MaxBytesPerHost] + "\n[truncated]"
-		}
-		if len(stderr) > MaxBytesPerHost {
-			stderr = stderr[:MaxBytesPerHost] + "\n[truncated]"
-		}
-
 		hr := hostResult{
 			ID:       r.Connection.ID,
-			Stdout:   stdout,
-			Stderr:   stderr,
+			Stdout:   truncateOutput(r.Stdout),
+			Stderr:   truncateOutput(r.Stderr),
 			ExitCode: r.ExitCode,
+			Signal:   r.Signal,
 			Duration: r.Duration.Round(time.Millisecond).String(),
 		}
 		if r.Error != nil {
@@ -348,16 +406,73 @@ func (cl *configLoader) handleExecCommand(ctx context.Context, _ *mcp.CallToolRe
 	}
 
 	type execResponse struct {
-		Results        []hostResult `json:"results"`
-		TotalHosts     int          `json:"total_hosts"`
-		TruncatedHosts bool         `json:"truncated_hosts,omitempty"`
+		RunID          string        `json:"run_id"`
+		Results        []hostResult  `json:"results,omitempty"`
+		Groups         []outputGroup `json:"groups,omitempty"`
+		TotalHosts     int           `json:"total_hosts"`
+		TruncatedHosts bool          `json:"truncated_hosts,omitempty"`
 	}
 
-	return jsonTextResult(execResponse{
-		Results:        hostResults,
+	resp := execResponse{
+		RunID:          run.ID,
 		TotalHosts:     len(hostResults),
 		TruncatedHosts: truncatedHosts,
-	})
+	}
+	if input.GroupOutput || input.Diff {
+		resp.Groups = groupOutputs(results, input.Diff)
+	} else {
+		resp.Results = hostResults
+	}
+	return jsonTextResult(resp)
+}
+
+// outputGroup is a set of hosts with identical stdout and exit code, as
+// returned by exec_command with group_output or diff.
+type outputGroup struct {
+	Hosts    []string `json:"hosts"`
+	Count    int      `json:"count"`
+	ExitCode int      `json:"exit_code"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Diff     string   `json:"diff,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// groupOutputs buckets results by output, the diff base first and hosts
+// that never ran last (see ssh.GroupResults). With diff, the other groups
+// that ran carry a unified diff against the base instead of their stdout.
+// Stderr and error are the group's first host's.
+func groupOutputs(results []ssh.ExecResult, diff bool) []outputGroup {
+	groups := ssh.GroupResults(results)
+	out := make([]outputGroup, len(groups))
+	for i := range groups {
+		g := &groups[i]
+		first := g.Results[0]
+		og := outputGroup{
+			Hosts:    g.IDs(),
+			Count:    len(g.Results),
+			ExitCode: g.ExitCode,
+			Stdout:   truncateOutput(g.Stdout),
+			Stderr:   truncateOutput(first.Stderr),
+		}
+		if first.Error != nil {
+			og.Error = first.Error.Error()
+		}
+		if diff && i > 0 && g.Error == "" {
+			og.Diff = truncateOutput(ssh.DiffGroup(&groups[0], g))
+			og.Stdout = ""
+		}
+		out[i] = og
+	}
+	return out
+}
+
+// truncateOutput enforces MaxBytesPerHost on s.
+func truncateOutput(s string) string {
+	if len(s) > MaxBytesPerHost {
+		return s[:MaxBytesPerHost] + "\n[truncated]"
+	}
+	return s
 }
 
 // --- Resource handlers ---
@@ -490,3 +605,73 @@ func (cl *configLoader) handleGroupsResource(_ context.Context, req *mcp.ReadRes
 		}},
 	}, nil
 }
+
+// runSummary is a stored run without its per-host output, as listed by the
+// hop://runs resource.
+type runSummary struct {
+	ID       string    `json:"id"`
+	Target   string    `json:"target"`
+	Command  string    `json:"command"`
+	Hosts    []string  `json:"hosts"`
+	Failed   int       `json:"failed"`
+	User     string    `json:"user"`
+	Source   string    `json:"source"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+}
+
+func (cl *configLoader) handleRunsResource(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	list, err := runs.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	summaries := make([]runSummary, len(list))
+	for i, r := range list {
+		summaries[i] = runSummary{
+			ID:       r.ID,
+			Target:   r.Target,
+			Command:  r.Label(),
+			Hosts:    r.Hosts,
+			Failed:   r.Failed,
+			User:     r.User,
+			Source:   string(r.Source),
+			Started:  r.Started,
+			Duration: (time.Duration(r.DurationMS) * time.Millisecond).String(),
+		}
+	}
+
+	data, _ := json.MarshalIndent(summaries, "", "  ")
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{
+			URI:      req.Params.URI,
+			MIMEType: "application/json",
+			Text:     string(data),
+		}},
+	}, nil
+}
+
+func (cl *configLoader) handleRunResource(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	// Extract ID from URI: hop://runs/{id}
+	uri := req.Params.URI
+	id := strings.TrimPrefix(uri, "hop://runs/")
+	if id == "" || id == uri {
+		return nil, fmt.Errorf("invalid run URI: %s", uri)
+	}
+
+	run, err := runs.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := json.MarshalIndent(run, "", "  ")
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{
+			URI:      req.Params.URI,
+			MIMEType: "application/json",
+			Text:     string(data),
+		}},
+	}, nil
+}
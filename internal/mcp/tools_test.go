@@ -2,15 +2,21 @@ package hopmcp
 
 import (
 	"context"
+	"errors"
 	"encoding/json"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"gopkg.in/yaml.v3"
 
 	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/health"
+	"github.com/danmartuszewski/hop/internal/runs"
+	"github.com/danmartuszewski/hop/internal/ssh"
 )
 
 // writeTestConfig creates a temporary config file and returns the path.
@@ -249,6 +255,34 @@ func TestGetConnection_Found(t *testing.T) {
 	}
 }
 
+func TestGetConnection_FromInventory(t *testing.T) {
+	cfg := fullTestConfig()
+	cfg.Inventories = []config.Inventory{{Name: "cloud", Command: "./cloud.sh"}}
+	path := writeTestConfig(t, cfg)
+	script := filepath.Join(filepath.Dir(path), "cloud.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '[{\"id\": \"cloud-web\", \"host\": \"10.0.0.1\"}]'\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	loader := &configLoader{cfgPath: path}
+
+	result, _, err := loader.handleGetConnection(context.Background(), nil, GetConnectionInput{ID: "cloud-web"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].(*mcp.TextContent).Text)
+	}
+
+	var conn ConnectionInfo
+	text := result.Content[0].(*mcp.TextContent).Text
+	if err := json.Unmarshal([]byte(text), &conn); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if conn.Host != "10.0.0.1" || conn.User != "deploy" || conn.Inventory != "cloud" {
+		t.Errorf("got %+v, want cloud-web from inventory cloud with defaults applied", conn)
+	}
+}
+
 func TestGetConnection_NotFound(t *testing.T) {
 	cfg := fullTestConfig()
 	path := writeTestConfig(t, cfg)
@@ -431,6 +465,24 @@ func TestExecCommand_InvalidTimeout(t *testing.T) {
 	}
 }
 
+func TestExecCommand_InvalidTransport(t *testing.T) {
+	cfg := fullTestConfig()
+	path := writeTestConfig(t, cfg)
+	loader := &configLoader{cfgPath: path}
+
+	result, _, err := loader.handleExecCommand(context.Background(), nil, ExecCommandInput{
+		Target:    "production",
+		Command:   "uptime",
+		Transport: "telnet",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsError {
+		t.Error("expected IsError for invalid transport")
+	}
+}
+
 func TestIdentityFileNeverExposed(t *testing.T) {
 	cfg := fullTestConfig()
 	path := writeTestConfig(t, cfg)
@@ -663,3 +715,155 @@ func containsStr(s, substr string) bool {
 	}
 	return false
 }
+
+func TestGroupOutputs(t *testing.T) {
+	results := []ssh.ExecResult{
+		{Connection: &config.Connection{ID: "web1"}, Stdout: "6.1.0\n"},
+		{Connection: &config.Connection{ID: "web2"}, Stdout: "6.8.0\n"},
+		{Connection: &config.Connection{ID: "web3"}, Stdout: "6.1.0\n"},
+	}
+
+	groups := groupOutputs(results, false)
+	if len(groups) != 2 || groups[0].Count != 2 || strings.Join(groups[0].Hosts, ",") != "web1,web3" {
+		t.Fatalf("groups = %+v", groups)
+	}
+	if groups[1].Stdout != "6.8.0\n" || groups[1].Diff != "" {
+		t.Errorf("minority group without diff = %+v", groups[1])
+	}
+
+	groups = groupOutputs(results, true)
+	if groups[0].Stdout != "6.1.0\n" {
+		t.Errorf("majority group should keep its stdout: %+v", groups[0])
+	}
+	if groups[1].Stdout != "" || !strings.Contains(groups[1].Diff, "-6.1.0\n+6.8.0\n") {
+		t.Errorf("minority group should carry a diff: %+v", groups[1])
+	}
+
+	// Unreachable hosts are neither the base nor diffed against it.
+	for _, id := range []string{"db1", "db2", "db3"} {
+		results = append(results, ssh.ExecResult{Connection: &config.Connection{ID: id}, ExitCode: -1, Error: errors.New("connection refused")})
+	}
+	groups = groupOutputs(results, true)
+	if len(groups) != 3 || groups[0].Stdout != "6.1.0\n" {
+		t.Fatalf("groups = %+v, want the succeeding majority as the base", groups)
+	}
+	if last := groups[2]; last.Count != 3 || last.Error != "connection refused" || last.Diff != "" {
+		t.Errorf("unreachable group = %+v", last)
+	}
+}
+
+func TestRunResources(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	conns := []config.Connection{{ID: "web1"}, {ID: "web2"}}
+	run := runs.New(runs.SourceMCP, "web", "uptime", conns)
+	run.Finish([]ssh.ExecResult{
+		{Connection: &conns[0], Stdout: "up\n"},
+		{Connection: &conns[1], ExitCode: 1, Error: errors.New("exit status 1")},
+	})
+	if err := runs.Save(run); err != nil {
+		t.Fatal(err)
+	}
+	loader := &configLoader{}
+
+	result, err := loader.handleRunsResource(context.Background(), &mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: "hop://runs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summaries []runSummary
+	if err := json.Unmarshal([]byte(result.Contents[0].Text), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].ID != run.ID || summaries[0].Failed != 1 {
+		t.Errorf("summaries = %+v", summaries)
+	}
+
+	result, err = loader.handleRunResource(context.Background(), &mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: "hop://runs/" + run.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runs.Run
+	if err := json.Unmarshal([]byte(result.Contents[0].Text), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != 2 || got.Results[0].Stdout != "up\n" {
+		t.Errorf("run = %+v", got)
+	}
+
+	if _, err := loader.handleRunResource(context.Background(), &mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: "hop://runs/missing"}}); err == nil {
+		t.Error("expected an error for an unknown run")
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			nc.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			nc.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	cfg := &config.Config{
+		Version: 1,
+		Connections: []config.Connection{
+			{ID: "web-up", Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, Tags: []string{"web"}},
+			{ID: "web-down", Host: "127.0.0.1", Port: closed.Addr().(*net.TCPAddr).Port, Tags: []string{"web"}},
+			{ID: "db", Host: "127.0.0.1", Port: 1},
+		},
+	}
+	loader := &configLoader{cfgPath: writeTestConfig(t, cfg)}
+
+	result, _, err := loader.handleCheckStatus(context.Background(), nil, CheckStatusInput{Target: "web*", Timeout: "1s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Content[0].(*mcp.TextContent).Text)
+	}
+
+	var output struct {
+		Summary health.Summary  `json:"summary"`
+		Hosts   []health.Record `json:"hosts"`
+	}
+	text := result.Content[0].(*mcp.TextContent).Text
+	if err := json.Unmarshal([]byte(text), &output); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if output.Summary.Checked != 2 || output.Summary.Reachable != 1 || output.Summary.Unreachable != 1 {
+		t.Errorf("summary = %+v", output.Summary)
+	}
+	if len(output.Hosts) != 2 || output.Hosts[0].Banner != "SSH-2.0-OpenSSH_9.6" || output.Hosts[1].Status != "unreachable" {
+		t.Errorf("hosts = %+v", output.Hosts)
+	}
+}
+
+func TestCheckStatus_Errors(t *testing.T) {
+	path := writeTestConfig(t, fullTestConfig())
+	loader := &configLoader{cfgPath: path}
+
+	for _, input := range []CheckStatusInput{
+		{Target: "production", Timeout: "soon"},
+		{Target: "production", Tag: "nonexistent"},
+	} {
+		result, _, err := loader.handleCheckStatus(context.Background(), nil, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.IsError {
+			t.Errorf("%+v: expected tool error", input)
+		}
+	}
+}
@@ -25,11 +25,22 @@ type GetConnectionInput struct {
 
 // ExecCommandInput executes a command on matched connections.
 type ExecCommandInput struct {
-	Target   string `json:"target" jsonschema:"Target pattern (group name, project-env, glob, or fuzzy match)"`
-	Command  string `json:"command" jsonschema:"Shell command to execute on remote hosts"`
+	Target      string `json:"target" jsonschema:"Target pattern (group name, project-env, glob, or fuzzy match)"`
+	Command     string `json:"command" jsonschema:"Shell command to execute on remote hosts"`
+	Tag         string `json:"tag,omitempty" jsonschema:"Filter matched connections by tag"`
+	Parallel    int    `json:"parallel,omitempty" jsonschema:"Max concurrent connections (default: 10)"`
+	Timeout     string `json:"timeout,omitempty" jsonschema:"Command timeout (e.g. 30s, 5m)"`
+	Transport   string `json:"transport,omitempty" jsonschema:"How to connect: ssh (run the ssh binary, default) or native (built-in client, no process per host)"`
+	GroupOutput bool   `json:"group_output,omitempty" jsonschema:"Return one entry per distinct stdout and exit code, listing the hosts that produced it, instead of one result per host"`
+	Diff        bool   `json:"diff,omitempty" jsonschema:"Group output and return each minority group as a unified diff against the majority output"`
+}
+
+// CheckStatusInput checks whether matched connections are reachable.
+type CheckStatusInput struct {
+	Target   string `json:"target,omitempty" jsonschema:"Target pattern (group name, project-env, glob, or fuzzy match); all connections when empty"`
 	Tag      string `json:"tag,omitempty" jsonschema:"Filter matched connections by tag"`
-	Parallel int    `json:"parallel,omitempty" jsonschema:"Max concurrent connections (default: 10)"`
-	Timeout  string `json:"timeout,omitempty" jsonschema:"Command timeout (e.g. 30s, 5m)"`
+	Timeout  string `json:"timeout,omitempty" jsonschema:"How long to wait for each connect and SSH banner (default: 2s)"`
+	Parallel int    `json:"parallel,omitempty" jsonschema:"Max hosts checked at once (default: 20)"`
 }
 
 // ResolveTargetInput resolves a target to connections.
@@ -67,4 +78,6 @@ type ConnectionInfo struct {
 	ForwardAgent bool              `json:"forward_agent,omitempty"`
 	Tags         []string          `json:"tags,omitempty"`
 	Options      map[string]string `json:"options,omitempty"`
+	// Inventory names the inventory a read-only connection came from.
+	Inventory string `json:"inventory,omitempty"`
 }
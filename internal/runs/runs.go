@@ -0,0 +1,292 @@
+// Package runs stores the results of hop exec runs so they can be listed,
+// inspected and re-run later. Each run is a JSON file under
+// ~/.config/hop/runs, named after its ID.
+package runs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+const (
+	// MaxRuns is the number of runs kept. Older runs are pruned whenever a
+	// new one is saved.
+	MaxRuns = 200
+	// MaxOutputBytes caps the stdout and stderr stored for each host.
+	MaxOutputBytes = 256 * 1024
+)
+
+// Source says what started a run.
+type Source string
+
+const (
+	SourceCLI Source = "cli"
+	SourceMCP Source = "mcp"
+	SourceTUI Source = "tui"
+)
+
+// Run is one stored execution of a command across a set of hosts.
+type Run struct {
+	ID      string `json:"id"`
+	Target  string `json:"target"`
+	Tag     string `json:"tag,omitempty"`
+	Command string `json:"command"`
+	// Script is the local script and arguments of a --script run, whose
+	// Command embeds the script.
+	Script string `json:"script,omitempty"`
+	// Stdin is true when local input was sent to every host. The input
+	// itself is not stored.
+	Stdin     bool   `json:"stdin,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	// Hosts are the connection IDs the target resolved to, in run order.
+	Hosts []string `json:"hosts"`
+	// User is who ran it, as user@machine.
+	User    string `json:"user"`
+	Source  Source `json:"source"`
+	RerunOf string `json:"rerun_of,omitempty"`
+
+	Started    time.Time        `json:"started"`
+	Finished   time.Time        `json:"finished"`
+	DurationMS int64            `json:"duration_ms"`
+	Failed     int              `json:"failed"`
+	Results    []ssh.ExecRecord `json:"results"`
+}
+
+// Dir returns the directory holding stored runs.
+func Dir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "hop", "runs")
+}
+
+// New starts a run of command on connections, which target resolved to.
+func New(source Source, target, command string, connections []config.Connection) *Run {
+	now := time.Now()
+	r := &Run{
+		ID:      newID(now),
+		Target:  target,
+		Command: command,
+		Hosts:   make([]string, len(connections)),
+		User:    whoami(),
+		Source:  source,
+		Started: now,
+	}
+	for i, c := range connections {
+		r.Hosts[i] = c.ID
+	}
+	return r
+}
+
+// newID returns a run ID that sorts by start time, with a random suffix so
+// runs started in the same second don't collide.
+func newID(t time.Time) string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return t.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+func whoami() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		return name + "@" + host
+	}
+	return name
+}
+
+// Label describes what the run executed: the script for --script runs,
+// otherwise the command.
+func (r *Run) Label() string {
+	if r.Script != "" {
+		return "script " + r.Script
+	}
+	return r.Command
+}
+
+// Finish records results and the run's end time.
+func (r *Run) Finish(results []ssh.ExecResult) {
+	r.Finished = time.Now()
+	r.DurationMS = r.Finished.Sub(r.Started).Milliseconds()
+	r.Failed = ssh.CountErrors(results)
+	r.Results = make([]ssh.ExecRecord, len(results))
+	for i, res := range results {
+		rec := ssh.NewExecRecord(res)
+		rec.Stdout = truncate(rec.Stdout)
+		rec.Stderr = truncate(rec.Stderr)
+		r.Results[i] = rec
+	}
+}
+
+func truncate(s string) string {
+	if len(s) > MaxOutputBytes {
+		return s[:MaxOutputBytes] + "\n[truncated]"
+	}
+	return s
+}
+
+// ExecResults converts the stored records back to results, for printing
+// with the hop exec output formats.
+func (r *Run) ExecResults() []ssh.ExecResult {
+	results := make([]ssh.ExecResult, len(r.Results))
+	for i, rec := range r.Results {
+		res := ssh.ExecResult{
+			Connection: &config.Connection{ID: rec.ID, Host: rec.Host, User: rec.User},
+			Stdout:     rec.Stdout,
+			Stderr:     rec.Stderr,
+			ExitCode:   rec.ExitCode,
+			Signal:     rec.Signal,
+			Duration:   time.Duration(rec.DurationMS) * time.Millisecond,
+			Skipped:    rec.Skipped,
+		}
+		if rec.Error != "" {
+			res.Error = errors.New(rec.Error)
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// FailedHosts returns the IDs of hosts that failed or were skipped.
+func (r *Run) FailedHosts() []string {
+	var ids []string
+	for _, rec := range r.Results {
+		if rec.Error != "" {
+			ids = append(ids, rec.ID)
+		}
+	}
+	return ids
+}
+
+// Save writes r to the run store and prunes it to MaxRuns.
+func Save(r *Run) error {
+	dir := Dir()
+	if dir == "" {
+		return errors.New("run directory is not set")
+	}
+	// 0700/0600: runs hold command output, which can be sensitive.
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, r.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	prune(dir)
+	return nil
+}
+
+// prune removes the oldest runs beyond MaxRuns.
+func prune(dir string) {
+	ids, _ := storedIDs(dir)
+	for len(ids) > MaxRuns {
+		os.Remove(filepath.Join(dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+}
+
+// storedIDs returns the IDs in dir, oldest first. A missing directory
+// holds no runs.
+func storedIDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Load reads the run with the given ID, or the only run whose ID starts
+// with it.
+func Load(id string) (*Run, error) {
+	if id == "" {
+		return nil, errors.New("run ID is required")
+	}
+	dir := Dir()
+	ids, err := storedIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, stored := range ids {
+		if stored == id {
+			matches = []string{stored}
+			break
+		}
+		if strings.HasPrefix(stored, id) {
+			matches = append(matches, stored)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("run '%s' not found", id)
+	case 1:
+		return read(filepath.Join(dir, matches[0]+".json"))
+	}
+	return nil, fmt.Errorf("run ID '%s' is ambiguous (%d runs match)", id, len(matches))
+}
+
+func read(path string) (*Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Run
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &r, nil
+}
+
+// List returns the stored runs, newest first. Unreadable files are skipped.
+func List() ([]*Run, error) {
+	dir := Dir()
+	ids, err := storedIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Run, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		if r, err := read(filepath.Join(dir, ids[i]+".json")); err == nil {
+			list = append(list, r)
+		}
+	}
+	// IDs only order runs to the second.
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Started.After(list[j].Started)
+	})
+	return list, nil
+}
@@ -0,0 +1,136 @@
+package runs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+func testRun(t *testing.T) *Run {
+	t.Helper()
+	conns := []config.Connection{
+		{ID: "web1", Host: "10.0.0.1", User: "deploy"},
+		{ID: "web2", Host: "10.0.0.2"},
+		{ID: "web3", Host: "10.0.0.3"},
+	}
+	r := New(SourceCLI, "web", "uptime", conns)
+	r.Finish([]ssh.ExecResult{
+		{Connection: &conns[0], Stdout: "up 3 days\n", Duration: 120 * time.Millisecond},
+		{Connection: &conns[1], Stderr: "boom\n", ExitCode: 2, Error: errors.New("exit status 2")},
+		{Connection: &conns[2], ExitCode: -1, Error: errors.New("skipped due to fail-fast"), Skipped: true},
+	})
+	return r
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	r := testRun(t)
+	if err := Save(r); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(Dir(), r.ID+".json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("run file not private: %v %v", info, err)
+	}
+
+	got, err := Load(r.ID[:len("20060102-150405")])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != r.ID || got.Command != "uptime" || !reflect.DeepEqual(got.Hosts, []string{"web1", "web2", "web3"}) {
+		t.Errorf("loaded %+v", got)
+	}
+	if got.Failed != 2 || got.User == "" || got.Source != SourceCLI {
+		t.Errorf("failed=%d user=%q source=%q", got.Failed, got.User, got.Source)
+	}
+	if !reflect.DeepEqual(got.FailedHosts(), []string{"web2", "web3"}) {
+		t.Errorf("FailedHosts = %v", got.FailedHosts())
+	}
+
+	results := got.ExecResults()
+	if results[0].Connection.ID != "web1" || results[0].Connection.EffectiveUser() != "deploy" || results[0].Duration != 120*time.Millisecond {
+		t.Errorf("result 0 = %+v", results[0])
+	}
+	if results[1].Error == nil || results[1].ExitCode != 2 || results[1].Stderr != "boom\n" {
+		t.Errorf("result 1 = %+v", results[1])
+	}
+	if !results[2].Skipped {
+		t.Errorf("result 2 should be skipped: %+v", results[2])
+	}
+
+	if _, err := Load("nope"); err == nil {
+		t.Error("expected an error for an unknown run")
+	}
+}
+
+func TestLoad_Ambiguous(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, id := range []string{"20260102-150405-aaaa", "20260102-150405-bbbb"} {
+		r := testRun(t)
+		r.ID = id
+		if err := Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Load("20260102"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Load(prefix) error = %v, want ambiguous", err)
+	}
+	if r, err := Load("20260102-150405-b"); err != nil || r.ID != "20260102-150405-bbbb" {
+		t.Errorf("Load(unique prefix) = %v, %v", r, err)
+	}
+}
+
+func TestList_NewestFirstAndPruned(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if list, err := List(); err != nil || len(list) != 0 {
+		t.Fatalf("List without a run dir = %v, %v", list, err)
+	}
+
+	base := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxRuns+3; i++ {
+		r := testRun(t)
+		r.ID = newID(base.Add(time.Duration(i) * time.Second))
+		if err := Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != MaxRuns {
+		t.Fatalf("kept %d runs, want %d", len(list), MaxRuns)
+	}
+	newest := base.Add(time.Duration(MaxRuns+2) * time.Second).Format("20060102-150405")
+	oldest := base.Add(3 * time.Second).Format("20060102-150405")
+	if !strings.HasPrefix(list[0].ID, newest) || !strings.HasPrefix(list[len(list)-1].ID, oldest) {
+		t.Errorf("list runs from %s to %s, want %s to %s", list[0].ID, list[len(list)-1].ID, newest, oldest)
+	}
+}
+
+func TestFinish_TruncatesOutput(t *testing.T) {
+	r := New(SourceMCP, "web", "cat big", nil)
+	big := strings.Repeat("x", MaxOutputBytes+10)
+	r.Finish([]ssh.ExecResult{{Connection: &config.Connection{ID: "web1"}, Stdout: big}})
+	if got := r.Results[0].Stdout; got != fmt.Sprintf("%s\n[truncated]", big[:MaxOutputBytes]) {
+		t.Errorf("stdout not truncated: %d bytes", len(got))
+	}
+}
+
+func TestLabel(t *testing.T) {
+	r := &Run{Command: "uptime"}
+	if r.Label() != "uptime" {
+		t.Errorf("Label = %q", r.Label())
+	}
+	r = &Run{Command: "t=$(mktemp) ...", Script: "./fix.sh --force"}
+	if r.Label() != "script ./fix.sh --force" {
+		t.Errorf("Label = %q", r.Label())
+	}
+}
@@ -0,0 +1,132 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+)
+
+// OutputGroup is a set of hosts that produced the same stdout and exit
+// code. Hosts that never ran the command (unreachable, skipped) are grouped
+// by their error instead, since they have no output to compare.
+type OutputGroup struct {
+	Stdout   string
+	ExitCode int
+	// Error is the error shared by hosts that never ran the command.
+	Error string
+	// Results holds the group's hosts in their original order.
+	Results []ExecResult
+}
+
+// IDs returns the connection IDs of the group's hosts.
+func (g *OutputGroup) IDs() []string {
+	ids := make([]string, len(g.Results))
+	for i, r := range g.Results {
+		ids[i] = r.Connection.ID
+	}
+	return ids
+}
+
+// GroupResults buckets results by identical stdout and exit code. The
+// first group is the base that --diff compares against: the largest that
+// succeeded with output, or else the largest that ran the command. The
+// other groups of hosts that ran follow by size, then the hosts that never
+// ran, grouped by error. Groups of equal size keep the order their first
+// host had.
+func GroupResults(results []ExecResult) []OutputGroup {
+	type key struct {
+		stdout   string
+		exitCode int
+		err      string
+	}
+	var groups []OutputGroup
+	index := make(map[key]int)
+	for _, r := range results {
+		k := key{stdout: r.Stdout, exitCode: r.ExitCode}
+		if r.Skipped || (r.ExitCode < 0 && r.Error != nil) {
+			k = key{exitCode: r.ExitCode, err: r.Error.Error()}
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, OutputGroup{Stdout: k.stdout, ExitCode: k.exitCode, Error: k.err})
+		}
+		groups[i].Results = append(groups[i].Results, r)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if ei, ej := groups[i].Error != "", groups[j].Error != ""; ei != ej {
+			return ej
+		}
+		return len(groups[i].Results) > len(groups[j].Results)
+	})
+	for i, g := range groups {
+		if g.Error == "" && g.ExitCode == 0 && g.Stdout != "" {
+			base := groups[i]
+			copy(groups[1:i+1], groups[:i])
+			groups[0] = base
+			break
+		}
+	}
+	return groups
+}
+
+// DiffGroup returns a unified diff from the base group's stdout to g's.
+func DiffGroup(majority, g *OutputGroup) string {
+	return udiff.Unified(groupLabel(majority), groupLabel(g), majority.Stdout, g.Stdout)
+}
+
+// groupLabel names a group in diff headers: its first host, and how many
+// others share its output.
+func groupLabel(g *OutputGroup) string {
+	label := g.Results[0].Connection.ID
+	if n := len(g.Results) - 1; n > 0 {
+		label += fmt.Sprintf(" (+%d)", n)
+	}
+	return label
+}
+
+// FormatClusteredOutput prints each distinct output once under a banner
+// listing the hosts that produced it, in GroupResults order. With diff,
+// every other group that ran is shown as a unified diff against the first.
+// Stderr is shown as the group's first host printed it.
+func FormatClusteredOutput(results []ExecResult, diff bool) string {
+	var buf bytes.Buffer
+	groups := GroupResults(results)
+
+	for i := range groups {
+		g := &groups[i]
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		status := ""
+		if g.Error == "" && g.ExitCode != 0 {
+			status = fmt.Sprintf(" (exit %d)", g.ExitCode)
+		}
+		fmt.Fprintf(&buf, "═══ %d host(s)%s: %s ═══\n", len(g.Results), status, strings.Join(g.IDs(), ", "))
+
+		first := g.Results[0]
+		switch {
+		case g.Error != "":
+			fmt.Fprintf(&buf, "Error: %s\n", g.Error)
+			continue
+		case i > 0 && diff:
+			if d := DiffGroup(&groups[0], g); d != "" {
+				buf.WriteString(d)
+			} else {
+				buf.WriteString("(same output, different exit code)\n")
+			}
+		default:
+			buf.WriteString(first.Stdout)
+		}
+		buf.WriteString(first.Stderr)
+		if first.Error != nil {
+			fmt.Fprintf(&buf, "Error: %v (exit code: %d)\n", first.Error, first.ExitCode)
+		}
+	}
+
+	return buf.String()
+}
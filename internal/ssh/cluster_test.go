@@ -0,0 +1,119 @@
+package ssh
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func clusterResults() []ExecResult {
+	res := func(id, stdout string, code int) ExecResult {
+		r := ExecResult{Connection: &config.Connection{ID: id}, Stdout: stdout, ExitCode: code}
+		if code != 0 {
+			r.Error = errors.New("exit status 1")
+		}
+		return r
+	}
+	down := ExecResult{Connection: &config.Connection{ID: "web6"}, ExitCode: -1, Error: errors.New("connection refused")}
+	return []ExecResult{
+		res("web1", "a\nb\nc\n", 0),
+		res("web2", "a\nB\nc\n", 0),
+		res("web3", "a\nb\nc\n", 0),
+		res("web4", "a\nb\nc\n", 1),
+		res("web5", "a\nb\nc\n", 0),
+		down,
+	}
+}
+
+func TestGroupResults(t *testing.T) {
+	groups := GroupResults(clusterResults())
+
+	var got [][]string
+	for _, g := range groups {
+		got = append(got, g.IDs())
+	}
+	want := [][]string{{"web1", "web3", "web5"}, {"web2"}, {"web4"}, {"web6"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("groups = %v, want %v", got, want)
+	}
+	if groups[2].ExitCode != 1 || groups[2].Stdout != groups[0].Stdout {
+		t.Errorf("same stdout with another exit code should be its own group: %+v", groups[2])
+	}
+	if groups[3].Error != "connection refused" {
+		t.Errorf("unreachable host group error = %q", groups[3].Error)
+	}
+}
+
+func TestFormatClusteredOutput(t *testing.T) {
+	out := FormatClusteredOutput(clusterResults(), false)
+	for _, want := range []string{
+		"═══ 3 host(s): web1, web3, web5 ═══\na\nb\nc\n",
+		"═══ 1 host(s): web2 ═══\na\nB\nc\n",
+		"═══ 1 host(s) (exit 1): web4 ═══\na\nb\nc\nError: exit status 1 (exit code: 1)\n",
+		"═══ 1 host(s): web6 ═══\nError: connection refused\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "a\nb\nc\n") != 2 {
+		t.Errorf("majority output should be printed once per group:\n%s", out)
+	}
+}
+
+func TestFormatClusteredOutput_Diff(t *testing.T) {
+	out := FormatClusteredOutput(clusterResults(), true)
+	for _, want := range []string{
+		"═══ 3 host(s): web1, web3, web5 ═══\na\nb\nc\n",
+		"--- web1 (+2)\n+++ web2\n",
+		"-b\n+B\n",
+		"═══ 1 host(s) (exit 1): web4 ═══\n(same output, different exit code)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGroupResults_BaseSucceededWithOutput(t *testing.T) {
+	res := func(id, stdout string, code int, err error) ExecResult {
+		return ExecResult{Connection: &config.Connection{ID: id}, Stdout: stdout, ExitCode: code, Error: err}
+	}
+	refused := errors.New("connection refused")
+	results := []ExecResult{
+		res("down1", "", -1, refused),
+		res("empty1", "", 0, nil),
+		res("web1", "v1\n", 0, nil),
+		res("down2", "", -1, refused),
+		res("empty2", "", 0, nil),
+		res("ssh1", "", 255, errors.New("exit status 255")),
+		res("ssh2", "", 255, errors.New("exit status 255")),
+		res("web2", "v2\n", 0, nil),
+		res("down3", "", -1, refused),
+		res("ssh3", "", 255, errors.New("exit status 255")),
+	}
+
+	var got [][]string
+	for _, g := range GroupResults(results) {
+		got = append(got, g.IDs())
+	}
+	want := [][]string{{"web1"}, {"ssh1", "ssh2", "ssh3"}, {"empty1", "empty2"}, {"web2"}, {"down1", "down2", "down3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("groups = %v, want %v", got, want)
+	}
+
+	out := FormatClusteredOutput(results, true)
+	for _, want := range []string{
+		"═══ 1 host(s): web1 ═══\nv1\n",
+		"--- web1\n+++ web2\n",
+		"-v1\n+v2\n",
+		"═══ 3 host(s): down1, down2, down3 ═══\nError: connection refused\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -27,8 +27,34 @@ func BuildCommand(conn *config.Connection, opts *ConnectOptions) []string {
 		args = append(args, "-t")
 	}
 
+	args = append(args, connectionArgs(conn, "-p")...)
+
+	if opts != nil {
+		args = append(args, opts.ExtraArgs...)
+	}
+
+	destination := destinationHost(conn)
+
+	// "--" ends option parsing so a destination beginning with "-" can never be
+	// interpreted as an ssh flag (e.g. "-oProxyCommand=..."), which would run an
+	// arbitrary command on the local machine (CWE-88 argument injection).
+	args = append(args, "--", destination)
+
+	if remoteCmd != "" {
+		args = append(args, remoteCmd)
+	}
+
+	return args
+}
+
+// connectionArgs returns the ssh flags for conn's port, identity file, jump
+// host, agent forwarding, shared master and extra options. scp takes the
+// same flags except that the port is portFlag "-P" instead of "-p".
+func connectionArgs(conn *config.Connection, portFlag string) []string {
+	var args []string
+
 	if conn.Port != 0 && conn.Port != 22 {
-		args = append(args, "-p", fmt.Sprintf("%d", conn.Port))
+		args = append(args, portFlag, fmt.Sprintf("%d", conn.Port))
 	}
 
 	if conn.IdentityFile != "" {
@@ -44,30 +70,21 @@ func BuildCommand(conn *config.Connection, opts *ConnectOptions) []string {
 		args = append(args, "-A")
 	}
 
+	args = append(args, muxArgs(conn)...)
+
 	for key, value := range conn.Options {
 		args = append(args, "-o", fmt.Sprintf("%s=%s", key, value))
 	}
 
-	if opts != nil {
-		args = append(args, opts.ExtraArgs...)
-	}
-
-	user := conn.EffectiveUser()
-	destination := conn.Host
-	if user != "" {
-		destination = user + "@" + conn.Host
-	}
-
-	// "--" ends option parsing so a destination beginning with "-" can never be
-	// interpreted as an ssh flag (e.g. "-oProxyCommand=..."), which would run an
-	// arbitrary command on the local machine (CWE-88 argument injection).
-	args = append(args, "--", destination)
+	return args
+}
 
-	if remoteCmd != "" {
-		args = append(args, remoteCmd)
+// destinationHost returns "user@host", or just the host when no user is set.
+func destinationHost(conn *config.Connection) string {
+	if user := conn.EffectiveUser(); user != "" {
+		return user + "@" + conn.Host
 	}
-
-	return args
+	return conn.Host
 }
 
 // BuildMoshCommand builds the mosh command arguments for a connection.
@@ -0,0 +1,185 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// TCPDialer opens plain TCP connections to hosts' SSH ports. Hosts behind a
+// proxy_jump are reached with "ssh -W" through the jump hosts, so they get
+// everything in ~/.ssh/config (jump hosts may be aliases there) and reuse a
+// shared master connection when there is one instead of logging in again.
+type TCPDialer struct {
+	ctx context.Context
+}
+
+// NewTCPDialer returns a dialer whose ssh processes are killed when ctx is
+// done, if their connections haven't been closed before.
+func NewTCPDialer(ctx context.Context) *TCPDialer {
+	return &TCPDialer{ctx: ctx}
+}
+
+// Dial connects to conn's host and SSH port without an SSH handshake.
+// Through a jump host the connection counts as open once the target's
+// first bytes arrive, since ssh doesn't report when the forward is set up;
+// SSH servers speak first, so they always send some.
+func (t *TCPDialer) Dial(ctx context.Context, conn *config.Connection) (net.Conn, error) {
+	if err := conn.CheckSafety(); err != nil {
+		return nil, err
+	}
+	port := conn.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(conn.Host, strconv.Itoa(port))
+	if conn.ProxyJump == "" || strings.EqualFold(conn.ProxyJump, "none") {
+		var nd net.Dialer
+		return nd.DialContext(ctx, "tcp", addr)
+	}
+	return t.dialJump(ctx, conn, addr)
+}
+
+func (t *TCPDialer) dialJump(ctx context.Context, conn *config.Connection, addr string) (net.Conn, error) {
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(t.ctx, "ssh", jumpDialArgs(conn, addr)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdinR, stdoutW, &stderr
+	err = cmd.Start()
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, err
+	}
+	c := &stdioConn{r: stdoutR, w: stdinW, cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(c.exited)
+	}()
+
+	first := make([]byte, 1)
+	stop := context.AfterFunc(ctx, func() { stdoutR.SetReadDeadline(time.Now()) })
+	n, _ := stdoutR.Read(first)
+	stop()
+	stdoutR.SetReadDeadline(time.Time{})
+	if n == 0 {
+		c.Close()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		if msg == "" {
+			msg = "ssh exited"
+		}
+		return nil, fmt.Errorf("via %s: %s", conn.ProxyJump, msg)
+	}
+	c.buf = first[:n]
+	return c, nil
+}
+
+// jumpDialArgs returns the ssh arguments that forward stdio to addr through
+// conn's jump hosts: the last one is the destination and the ones before it
+// are passed on with -J. The last hop is multiplexed like conn.
+func jumpDialArgs(conn *config.Connection, addr string) []string {
+	hops := strings.Split(conn.ProxyJump, ",")
+	user, host, port := splitJumpHop(strings.TrimSpace(hops[len(hops)-1]))
+
+	args := []string{"-W", addr, "-o", "BatchMode=yes"}
+	if len(hops) > 1 {
+		args = append(args, "-J", strings.Join(hops[:len(hops)-1], ","))
+	}
+	if port != 0 {
+		args = append(args, "-p", strconv.Itoa(port))
+	}
+	jump := &config.Connection{Host: host, User: user, Port: port, Multiplex: conn.Multiplex}
+	args = append(args, muxArgs(jump)...)
+	return append(args, "--", destinationHost(jump))
+}
+
+// splitJumpHop splits one ProxyJump hop ("user@host:port") into its parts;
+// user is "" and port 0 when the hop doesn't set them, leaving them to the
+// ssh config.
+func splitJumpHop(hop string) (user, host string, port int) {
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		user, hop = hop[:i], hop[i+1:]
+	}
+	if h, p, err := net.SplitHostPort(hop); err == nil {
+		if n, err := strconv.Atoi(p); err == nil {
+			return user, h, n
+		}
+	}
+	return user, strings.Trim(hop, "[]"), 0
+}
+
+// stdioConn is a connection forwarded by an ssh process over its stdin and
+// stdout. Closing it ends the process.
+type stdioConn struct {
+	r, w   *os.File
+	buf    []byte // read ahead by Dial
+	cmd    *exec.Cmd
+	exited chan struct{}
+	once   sync.Once
+}
+
+func (c *stdioConn) Read(p []byte) (int, error) {
+	if len(c.buf) > 0 {
+		n := copy(p, c.buf)
+		c.buf = c.buf[n:]
+		return n, nil
+	}
+	return c.r.Read(p)
+}
+
+func (c *stdioConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c *stdioConn) Close() error {
+	c.once.Do(func() {
+		c.w.Close()
+		c.r.Close()
+		c.cmd.Process.Kill()
+		<-c.exited
+	})
+	return nil
+}
+
+func (c *stdioConn) LocalAddr() net.Addr  { return stdioAddr("local") }
+func (c *stdioConn) RemoteAddr() net.Addr { return stdioAddr(strings.Join(c.cmd.Args, " ")) }
+
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	if err := c.r.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.w.SetWriteDeadline(t)
+}
+
+func (c *stdioConn) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *stdioConn) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
+
+// stdioAddr names the ends of a stdioConn.
+type stdioAddr string
+
+func (a stdioAddr) Network() string { return "ssh" }
+func (a stdioAddr) String() string  { return string(a) }
@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestJumpDialArgs(t *testing.T) {
+	tests := []struct {
+		jump string
+		want string
+	}{
+		{"bastion", "-W db:22 -o BatchMode=yes -- bastion"},
+		{"ops@bastion:2222", "-W db:22 -o BatchMode=yes -p 2222 -- ops@bastion"},
+		{"edge, ops@[::1]:2200", "-W db:22 -o BatchMode=yes -J edge -p 2200 -- ops@::1"},
+	}
+	for _, tt := range tests {
+		conn := &config.Connection{ID: "db", Host: "db", ProxyJump: tt.jump}
+		if got := strings.Join(jumpDialArgs(conn, "db:22"), " "); got != tt.want {
+			t.Errorf("jumpDialArgs(%q) = %q, want %q", tt.jump, got, tt.want)
+		}
+	}
+}
+
+func TestTCPDialerJumpFailure(t *testing.T) {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		t.Skip("ssh not installed")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	conn := &config.Connection{ID: "db", Host: "10.0.0.5", ProxyJump: "127.0.0.1:" + strconv.Itoa(port)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	nc, err := NewTCPDialer(ctx).Dial(ctx, conn)
+	if err == nil {
+		nc.Close()
+		t.Fatal("Dial() through a closed jump host succeeded")
+	}
+	if !strings.HasPrefix(err.Error(), "via 127.0.0.1:") {
+		t.Errorf("Dial() error = %v, want it to name the jump host", err)
+	}
+}
+
+func TestTCPDialerJump(t *testing.T) {
+	// A stand-in ssh that records its arguments and answers like a
+	// forwarded SSH server.
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\nprintf 'SSH-2.0-OpenSSH_9.6\\r\\n'\nexec sleep 5\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	conn := &config.Connection{ID: "db", Host: "10.0.0.5", Port: 2222, ProxyJump: "bastion"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	nc, err := NewTCPDialer(ctx).Dial(ctx, conn)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(nc).ReadString('\n')
+	if err != nil || line != "SSH-2.0-OpenSSH_9.6\r\n" {
+		t.Errorf("read %q, %v", line, err)
+	}
+	start := time.Now()
+	nc.Close()
+	if time.Since(start) > time.Second {
+		t.Error("Close() didn't end the ssh process")
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "-W 10.0.0.5:2222 -o BatchMode=yes -- bastion" {
+		t.Errorf("ssh args = %q", got)
+	}
+}
@@ -3,20 +3,25 @@ package ssh
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/danmartuszewski/hop/internal/config"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 // ExecOptions configures the behavior of parallel execution.
 type ExecOptions struct {
 	// Command is the command to execute on remote hosts.
 	Command string
+	// Stdin, if set, is sent to the command's standard input on every host.
+	Stdin []byte
 	// Parallel is the maximum number of concurrent connections (default: 10).
 	Parallel int
 	// Timeout is the maximum duration for each command (0 means no timeout).
@@ -27,6 +32,39 @@ type ExecOptions struct {
 	Stream bool
 	// DryRun prints commands without executing if true.
 	DryRun bool
+	// Transport selects the ssh binary (default) or the in-process client.
+	Transport Transport
+	// OnResult, if set, is called with each host's result as soon as the
+	// host finishes or is skipped. Calls are never concurrent.
+	OnResult func(ExecResult)
+	// OnStart, if set, is called when a host gets a slot and starts
+	// running. Calls may be concurrent.
+	OnStart func(conn *config.Connection)
+	// Output, if set, returns writers that receive a host's stdout and
+	// stderr as it arrives, in addition to the result's copies. They may be
+	// written to concurrently.
+	Output func(conn *config.Connection) (stdout, stderr io.Writer)
+	// HostContext, if set, returns a context whose cancellation stops just
+	// that host: it is killed if running and skipped if not started yet.
+	HostContext func(conn *config.Connection) context.Context
+
+	// Canary runs this many hosts first, as a batch of their own.
+	Canary int
+	// Batch runs the (remaining) hosts in batches of this size, one batch
+	// at a time. Zero runs them all in one batch.
+	Batch int
+	// Pause is how long to wait between batches.
+	Pause time.Duration
+	// MaxFail stops the run once more hosts than it allows have failed:
+	// hosts already running finish, the rest are skipped. Nil means no
+	// limit.
+	MaxFail *FailureThreshold
+	// Gate, if set, is called after each batch but the last with that
+	// batch's connections; an error stops the run.
+	Gate func(ctx context.Context, batch []config.Connection) error
+	// OnBatch, if set, is called as batches start and finish, for progress
+	// output.
+	OnBatch func(BatchEvent)
 }
 
 // ExecResult holds the result of executing a command on a single host.
@@ -37,6 +75,12 @@ type ExecResult struct {
 	ExitCode   int
 	Error      error
 	Duration   time.Duration
+	// Skipped is true when the host was never contacted because the run was
+	// cancelled or stopped by fail-fast before its turn.
+	Skipped bool
+	// Signal is the name of the signal that killed the remote command
+	// (e.g. "KILL"). Only the native transport reports it.
+	Signal string
 }
 
 // Execute runs a command on multiple connections in parallel.
@@ -45,12 +89,102 @@ func Execute(connections []config.Connection, opts *ExecOptions) []ExecResult {
 }
 
 // ExecuteContext runs a command on multiple connections in parallel,
-// using the provided context for cancellation.
+// using the provided context for cancellation. With opts.Batch or
+// opts.Canary set, hosts are run in batches (see runBatches).
 func ExecuteContext(parentCtx context.Context, connections []config.Connection, opts *ExecOptions) []ExecResult {
 	if opts == nil {
 		opts = &ExecOptions{}
 	}
 
+	run := executeOnHost
+	if opts.Transport == TransportNative {
+		dialer := newNativeDialer(parentCtx)
+		defer dialer.Close()
+		run = dialer.execute
+	}
+	st := newRunState(len(connections))
+	if opts.Batch > 0 || opts.Canary > 0 {
+		return runBatches(parentCtx, connections, opts, run, st)
+	}
+	return runParallel(parentCtx, connections, opts, run, st)
+}
+
+// hostFunc does one host's share of a parallel run.
+type hostFunc func(ctx context.Context, conn *config.Connection, opts *ExecOptions) ExecResult
+
+// errFailFast is the error of hosts skipped after a failure with FailFast.
+var errFailFast = errors.New("skipped due to fail-fast")
+
+// runState tracks failures across a whole run, which may span several
+// runParallel calls (batches), and records why the run was stopped.
+type runState struct {
+	total int
+
+	mu       sync.Mutex
+	failures int
+	stopErr  error
+}
+
+func newRunState(total int) *runState {
+	return &runState{total: total}
+}
+
+// stopped returns why the run was stopped, or nil.
+func (st *runState) stopped() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.stopErr
+}
+
+// stop stops the run unless it is already stopped.
+func (st *runState) stop(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.stopErr == nil {
+		st.stopErr = err
+	}
+}
+
+// record counts a finished host and stops the run if it failed and
+// opts.FailFast is set (reporting true, so running hosts are cancelled
+// too) or opts.MaxFail is exceeded (letting running hosts finish).
+func (st *runState) record(r ExecResult, opts *ExecOptions) (cancel bool) {
+	if r.Error == nil || r.Skipped {
+		return false
+	}
+	st.mu.Lock()
+	st.failures++
+	failures := st.failures
+	st.mu.Unlock()
+
+	if opts.FailFast {
+		st.stop(errFailFast)
+		return true
+	}
+	if opts.MaxFail != nil && opts.MaxFail.Exceeded(failures, st.total) {
+		st.stop(fmt.Errorf("%d of %d hosts failed (max %s)", failures, st.total, opts.MaxFail))
+	}
+	return false
+}
+
+// skipped is the result of a host that was never contacted.
+func skipped(conn *config.Connection, err error) ExecResult {
+	return ExecResult{Connection: conn, Error: err, ExitCode: -1, Skipped: true}
+}
+
+// Turn states of a host in runParallel. Hosts get slots in order; one
+// cancelled while waiting forfeits its turn so the next host gets the slot.
+const (
+	turnWaiting int32 = iota
+	turnGiven
+	turnForfeited
+)
+
+// runParallel calls run for every connection, at most opts.Parallel at a
+// time, honouring cancellation of parentCtx and the stop conditions of st.
+// Hosts start in the order of connections, so a stopped run skips the last
+// ones. Results are in the order of connections.
+func runParallel(parentCtx context.Context, connections []config.Connection, opts *ExecOptions, run hostFunc, st *runState) []ExecResult {
 	// Set defaults
 	parallel := opts.Parallel
 	if parallel <= 0 {
@@ -58,87 +192,101 @@ func ExecuteContext(parentCtx context.Context, connections []config.Connection,
 	}
 
 	results := make([]ExecResult, len(connections))
-	resultChan := make(chan struct {
+	type indexedResult struct {
 		index  int
 		result ExecResult
-	}, len(connections))
+	}
+	resultChan := make(chan indexedResult, len(connections))
 
 	// Create context for timeout and cancellation
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
 
-	// Semaphore for limiting parallelism
+	// Semaphore for limiting parallelism, handed to hosts in order: turns[i]
+	// is closed once host i holds a slot.
 	sem := make(chan struct{}, parallel)
+	turns := make([]chan struct{}, len(connections))
+	states := make([]atomic.Int32, len(connections))
+	for i := range turns {
+		turns[i] = make(chan struct{})
+	}
+	go func() {
+		for i := range connections {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			if states[i].CompareAndSwap(turnWaiting, turnGiven) {
+				close(turns[i])
+			} else {
+				<-sem
+			}
+		}
+	}()
 
 	// WaitGroup for tracking completion
 	var wg sync.WaitGroup
 
-	// Track if we should stop due to fail-fast
-	var failFastTriggered bool
-	var failFastMu sync.Mutex
-
 	for i := range connections {
 		wg.Add(1)
 		go func(index int, conn config.Connection) {
 			defer wg.Done()
 
-			// Check fail-fast before acquiring semaphore
-			if opts.FailFast {
-				failFastMu.Lock()
-				triggered := failFastTriggered
-				failFastMu.Unlock()
-				if triggered {
-					resultChan <- struct {
-						index  int
-						result ExecResult
-					}{
-						index: index,
-						result: ExecResult{
-							Connection: &conn,
-							Error:      fmt.Errorf("skipped due to fail-fast"),
-							ExitCode:   -1,
-						},
-					}
-					return
+			ctx, hostCancel := context.WithCancel(ctx)
+			defer hostCancel()
+			if opts.HostContext != nil {
+				hostCtx := opts.HostContext(&conn)
+				// AfterFunc calls hostCancel from its own goroutine, so
+				// catch a context that is already done here.
+				if hostCtx.Err() != nil {
+					hostCancel()
+				}
+				stop := context.AfterFunc(hostCtx, hostCancel)
+				defer stop()
+			}
+
+			// skip reports the host as never contacted, for why the run
+			// stopped or else for the cancelled context.
+			skip := func() {
+				err := st.stopped()
+				if err == nil {
+					err = ctx.Err()
 				}
+				resultChan <- indexedResult{index, skipped(&conn, err)}
 			}
 
-			// Acquire semaphore
+			// Give up the turn if the run is already stopped, otherwise
+			// wait for it unless the host is cancelled first. A turn given
+			// meanwhile still holds a slot, released below.
+			if st.stopped() != nil && states[index].CompareAndSwap(turnWaiting, turnForfeited) {
+				skip()
+				return
+			}
 			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
+			case <-turns[index]:
 			case <-ctx.Done():
-				resultChan <- struct {
-					index  int
-					result ExecResult
-				}{
-					index: index,
-					result: ExecResult{
-						Connection: &conn,
-						Error:      ctx.Err(),
-						ExitCode:   -1,
-					},
+				if states[index].CompareAndSwap(turnWaiting, turnForfeited) {
+					skip()
+					return
 				}
-				return
+				<-turns[index]
 			}
+			defer func() { <-sem }()
 
-			result := executeOnHost(ctx, &conn, opts)
-
-			// Check if we should trigger fail-fast
-			if opts.FailFast && result.Error != nil {
-				failFastMu.Lock()
-				failFastTriggered = true
-				failFastMu.Unlock()
-				cancel()
+			if st.stopped() != nil || ctx.Err() != nil {
+				skip()
+				return
 			}
 
-			resultChan <- struct {
-				index  int
-				result ExecResult
-			}{
-				index:  index,
-				result: result,
+			if opts.OnStart != nil {
+				opts.OnStart(&conn)
 			}
+			result := run(ctx, &conn, opts)
+			if st.record(result, opts) {
+				cancel()
+			}
+			resultChan <- indexedResult{index, result}
 		}(i, connections[i])
 	}
 
@@ -151,6 +299,9 @@ func ExecuteContext(parentCtx context.Context, connections []config.Connection,
 	// Collect results
 	for r := range resultChan {
 		results[r.index] = r.result
+		if opts.OnResult != nil {
+			opts.OnResult(r.result)
+		}
 	}
 
 	return results
@@ -179,6 +330,20 @@ func executeOnHost(ctx context.Context, conn *config.Connection, opts *ExecOptio
 		Command: opts.Command,
 	})
 
+	result = runLocal(ctx, conn, opts, "ssh", args)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// runLocal runs a local command (ssh, scp, rsync) on behalf of conn and
+// collects its output and exit status.
+func runLocal(ctx context.Context, conn *config.Connection, opts *ExecOptions, binary string, args []string) ExecResult {
+	start := time.Now()
+
+	result := ExecResult{
+		Connection: conn,
+	}
+
 	// Create command with context
 	var execCtx context.Context
 	var execCancel context.CancelFunc
@@ -189,19 +354,21 @@ func executeOnHost(ctx context.Context, conn *config.Connection, opts *ExecOptio
 	}
 	defer execCancel()
 
-	cmd := exec.CommandContext(execCtx, "ssh", args...)
-
-	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(execCtx, binary, args...)
+	if conn.Multiplexed() {
+		// The first ssh to a host forks the persistent master. It detaches
+		// from our pipes, but don't let a stray inherited descriptor hold
+		// the result hostage.
+		cmd.WaitDelay = 2 * time.Second
+	}
 
-	if opts.Stream {
-		// In stream mode, we write to stdout/stderr with prefixes
-		cmd.Stdout = &prefixWriter{prefix: fmt.Sprintf("[%s] ", conn.ID), writer: os.Stdout}
-		cmd.Stderr = &prefixWriter{prefix: fmt.Sprintf("[%s] ", conn.ID), writer: os.Stderr}
-	} else {
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
+	if opts.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(opts.Stdin)
 	}
 
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = outputWriters(conn, opts, &stdout, &stderr)
+
 	err := cmd.Run()
 	result.Duration = time.Since(start)
 
@@ -211,17 +378,50 @@ func executeOnHost(ctx context.Context, conn *config.Connection, opts *ExecOptio
 	}
 
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.ExitCode = -1
-		}
+		result.ExitCode = ExitCode(err)
 		result.Error = err
 	}
 
 	return result
 }
 
+// outputWriters returns where a host's stdout and stderr go: prefixed to
+// the terminal with opts.Stream, otherwise into the given buffers, and also
+// to opts.Output's writers when it is set.
+func outputWriters(conn *config.Connection, opts *ExecOptions, stdout, stderr *bytes.Buffer) (io.Writer, io.Writer) {
+	var outW, errW io.Writer = stdout, stderr
+	if opts.Stream {
+		// In stream mode, we write to stdout/stderr with prefixes
+		outW = newPrefixWriter(fmt.Sprintf("[%s] ", conn.ID), os.Stdout)
+		errW = newPrefixWriter(fmt.Sprintf("[%s] ", conn.ID), os.Stderr)
+	}
+	if opts.Output != nil {
+		extraOut, extraErr := opts.Output(conn)
+		outW = io.MultiWriter(outW, extraOut)
+		errW = io.MultiWriter(errW, extraErr)
+	}
+	return outW, errW
+}
+
+// ExitCode maps the error returned by running ssh/mosh to a process exit
+// status: 0 for nil, the remote exit code for an *exec.ExitError (possibly
+// wrapped, e.g. in an SSHError) or an in-process *ssh.ExitError, and -1 when
+// the command never ran.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	var remoteErr *gossh.ExitError
+	if errors.As(err, &remoteErr) {
+		return remoteErr.ExitStatus()
+	}
+	return -1
+}
+
 // prefixWriter adds a prefix to each line written.
 type prefixWriter struct {
 	prefix      string
@@ -304,6 +504,32 @@ func FormatGroupedOutput(results []ExecResult) string {
 	return buf.String()
 }
 
+// ExecUsages converts results into history records. Hosts that were never
+// contacted are left out.
+func ExecUsages(results []ExecResult) []config.Usage {
+	return resultUsages(results, config.UsageExec)
+}
+
+// TransferUsages is ExecUsages for hop cp and hop sync.
+func TransferUsages(results []ExecResult) []config.Usage {
+	return resultUsages(results, config.UsageTransfer)
+}
+
+func resultUsages(results []ExecResult, kind config.UsageKind) []config.Usage {
+	usages := make([]config.Usage, 0, len(results))
+	for _, r := range results {
+		if r.Connection == nil || r.Skipped {
+			continue
+		}
+		usages = append(usages, config.Usage{
+			ID:       r.Connection.ID,
+			Kind:     kind,
+			ExitCode: config.ExitStatus(r.ExitCode),
+		})
+	}
+	return usages
+}
+
 // HasErrors returns true if any result has an error.
 func HasErrors(results []ExecResult) bool {
 	for _, r := range results {
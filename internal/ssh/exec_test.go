@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"bytes"
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
@@ -213,6 +214,44 @@ func TestExecResultDuration(t *testing.T) {
 	}
 }
 
+func TestExitCode(t *testing.T) {
+	if got := ExitCode(nil); got != 0 {
+		t.Errorf("ExitCode(nil) = %d, want 0", got)
+	}
+	if got := ExitCode(&mockError{msg: "exec: not found"}); got != -1 {
+		t.Errorf("ExitCode(non-exit error) = %d, want -1", got)
+	}
+
+	err := exec.Command("sh", "-c", "exit 7").Run()
+	if got := ExitCode(err); got != 7 {
+		t.Errorf("ExitCode(exit 7) = %d, want 7", got)
+	}
+	// Connect wraps known failures in an SSHError; the status must survive.
+	wrapped := &SSHError{Original: err, Suggestion: "try again"}
+	if got := ExitCode(wrapped); got != 7 {
+		t.Errorf("ExitCode(wrapped) = %d, want 7", got)
+	}
+}
+
+func TestExecUsages(t *testing.T) {
+	results := []ExecResult{
+		{Connection: &config.Connection{ID: "ok"}, ExitCode: 0},
+		{Connection: &config.Connection{ID: "failed"}, Error: &mockError{msg: "failed"}, ExitCode: 2},
+		{Connection: &config.Connection{ID: "skipped"}, Error: &mockError{msg: "skipped"}, ExitCode: -1, Skipped: true},
+	}
+
+	usages := ExecUsages(results)
+	if len(usages) != 2 {
+		t.Fatalf("expected 2 usages (skipped host excluded), got %d", len(usages))
+	}
+	if usages[1].ID != "failed" || usages[1].Kind != config.UsageExec {
+		t.Errorf("unexpected usage: %+v", usages[1])
+	}
+	if usages[1].ExitCode == nil || *usages[1].ExitCode != 2 {
+		t.Errorf("exit code = %v, want 2", usages[1].ExitCode)
+	}
+}
+
 // mockError is a simple error implementation for testing
 type mockError struct {
 	msg string
@@ -0,0 +1,72 @@
+package ssh
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// ForwardSpec returns the ssh flag and its argument for f, e.g.
+// "-L", "127.0.0.1:5432:db.internal:5432".
+func ForwardSpec(f *config.Forward) (string, string) {
+	listen := strconv.Itoa(f.ListenPort)
+	if f.BindAddress != "" {
+		listen = bracketHost(f.BindAddress) + ":" + listen
+	}
+	switch f.EffectiveType() {
+	case config.ForwardRemote:
+		return "-R", listen + ":" + forwardTarget(f.Target)
+	case config.ForwardDynamic:
+		return "-D", listen
+	default:
+		return "-L", listen + ":" + forwardTarget(f.Target)
+	}
+}
+
+// forwardTarget rewrites a "host:port" target in ssh's -L/-R syntax, which
+// needs IPv6 hosts bracketed.
+func forwardTarget(target string) string {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+	return bracketHost(host) + ":" + port
+}
+
+func bracketHost(host string) string {
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// BuildForwardCommand returns the ssh argv that holds f open over conn
+// without running a remote command. The session never prompts, exits if the
+// forward can't be set up, and detects a dead server through keepalives,
+// so a supervisor can restart it. It always uses its own connection rather
+// than a shared master: a forward would otherwise live on in the master
+// after the tunnel is stopped.
+func BuildForwardCommand(conn *config.Connection, f *config.Forward) []string {
+	// ssh uses the first value it sees for an option, so these win over
+	// the connection's own options and multiplex settings.
+	args := []string{
+		"-N",
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ControlMaster=no",
+		"-o", "ControlPath=none",
+	}
+	args = append(args, connectionArgs(conn, "-p")...)
+	// Defaults the connection's options may override.
+	for _, opt := range [][2]string{
+		{"ServerAliveInterval", "15"},
+		{"ServerAliveCountMax", "3"},
+	} {
+		if optionValue(conn.Options, opt[0]) == "" {
+			args = append(args, "-o", opt[0]+"="+opt[1])
+		}
+	}
+	flag, spec := ForwardSpec(f)
+	return append(args, flag, spec, "--", destinationHost(conn))
+}
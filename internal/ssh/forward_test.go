@@ -0,0 +1,60 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestForwardSpec(t *testing.T) {
+	tests := []struct {
+		fwd      config.Forward
+		wantFlag string
+		wantSpec string
+	}{
+		{config.Forward{ListenPort: 5432, Target: "localhost:5432"}, "-L", "5432:localhost:5432"},
+		{config.Forward{Type: config.ForwardLocal, BindAddress: "0.0.0.0", ListenPort: 8080, Target: "app.internal:80"}, "-L", "0.0.0.0:8080:app.internal:80"},
+		{config.Forward{Type: config.ForwardRemote, ListenPort: 9000, Target: "localhost:3000"}, "-R", "9000:localhost:3000"},
+		{config.Forward{Type: config.ForwardDynamic, ListenPort: 1080}, "-D", "1080"},
+		{config.Forward{Type: config.ForwardDynamic, BindAddress: "::1", ListenPort: 1080}, "-D", "[::1]:1080"},
+		{config.Forward{ListenPort: 5432, Target: "[fd00::5]:5432"}, "-L", "5432:[fd00::5]:5432"},
+	}
+	for _, tt := range tests {
+		flag, spec := ForwardSpec(&tt.fwd)
+		if flag != tt.wantFlag || spec != tt.wantSpec {
+			t.Errorf("ForwardSpec(%+v) = %s %s, want %s %s", tt.fwd, flag, spec, tt.wantFlag, tt.wantSpec)
+		}
+	}
+}
+
+func TestBuildForwardCommand(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	on := true
+	conn := &config.Connection{
+		ID:        "db1",
+		Host:      "db1.example.com",
+		User:      "deploy",
+		Port:      2222,
+		Multiplex: &on,
+		Options:   map[string]string{"ServerAliveInterval": "60"},
+	}
+	fwd := &config.Forward{Name: "pg", ListenPort: 5432, Target: "localhost:5432"}
+
+	args := BuildForwardCommand(conn, fwd)
+	got := strings.Join(args, " ")
+	if !strings.HasPrefix(got, "-N -o BatchMode=yes -o ExitOnForwardFailure=yes -o ControlMaster=no -o ControlPath=none ") {
+		t.Errorf("forced options must come first: %q", got)
+	}
+	if !strings.HasSuffix(got, "-L 5432:localhost:5432 -- deploy@db1.example.com") {
+		t.Errorf("args = %q", got)
+	}
+	for _, want := range []string{"-p 2222", "-o ServerAliveInterval=60", "-o ServerAliveCountMax=3"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("args %q missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, "ServerAliveInterval=15") {
+		t.Errorf("connection's ServerAliveInterval should win: %q", got)
+	}
+}
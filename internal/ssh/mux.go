@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// DefaultControlPersist is how long an idle master connection stays open
+// after its last session ends.
+const DefaultControlPersist = "10m"
+
+// RuntimeDir returns the directory holding hop's ControlMaster sockets:
+// $XDG_RUNTIME_DIR/hop, or a per-user directory under the system temp dir.
+func RuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "hop")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("hop-%d", os.Getuid()))
+}
+
+// ControlPath returns the master socket for conn. Connections that reach the
+// same user, host, port and jump host share a master. The name is a short
+// hash because unix socket paths are limited to ~100 bytes.
+func ControlPath(conn *config.Connection) string {
+	key := fmt.Sprintf("%s@%s:%d %s", conn.EffectiveUser(), conn.Host, conn.Port, conn.ProxyJump)
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(RuntimeDir(), hex.EncodeToString(sum[:8]))
+}
+
+// muxArgs returns the ssh options that attach conn to its hop-managed
+// master, or nil when conn is not multiplexed. Options the connection sets
+// itself win. The runtime directory is created here so every caller of
+// BuildCommand (including terminal tabs) gets a usable socket path; if it
+// can't be created safely, ssh runs without a master.
+func muxArgs(conn *config.Connection) []string {
+	if !conn.Multiplexed() || !ensureRuntimeDir() {
+		return nil
+	}
+	var args []string
+	for _, opt := range [][2]string{
+		{"ControlMaster", "auto"},
+		{"ControlPath", ControlPath(conn)},
+		{"ControlPersist", DefaultControlPersist},
+	} {
+		if optionValue(conn.Options, opt[0]) == "" {
+			args = append(args, "-o", opt[0]+"="+opt[1])
+		}
+	}
+	return args
+}
+
+// ensureRuntimeDir creates RuntimeDir and reports whether it is private to
+// the current user. Under the shared temp dir another user could have
+// created it first, so its owner is checked as well as its mode.
+func ensureRuntimeDir() bool {
+	dir := RuntimeDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false
+	}
+	info, err := os.Lstat(dir)
+	return err == nil && info.IsDir() && info.Mode().Perm()&0077 == 0 && ownedByCurrentUser(info)
+}
+
+// MuxMaster describes the master connection for a connection.
+type MuxMaster struct {
+	Connection *config.Connection
+	Path       string
+	Running    bool
+	PID        int
+}
+
+var masterPIDRe = regexp.MustCompile(`pid=(\d+)`)
+
+// CheckMaster asks ssh whether conn's master is running. A socket left
+// behind by a dead master is removed.
+func CheckMaster(conn *config.Connection) MuxMaster {
+	m := MuxMaster{Connection: conn, Path: ControlPath(conn)}
+	if _, err := os.Stat(m.Path); err != nil {
+		return m
+	}
+	out, err := controlCommand(conn, m.Path, "check")
+	if err != nil {
+		os.Remove(m.Path)
+		return m
+	}
+	m.Running = true
+	if match := masterPIDRe.FindStringSubmatch(out); match != nil {
+		m.PID, _ = strconv.Atoi(match[1])
+	}
+	return m
+}
+
+// StopMaster closes conn's master connection. Sessions using it are closed
+// too. It returns false when no master was running.
+func StopMaster(conn *config.Connection) (bool, error) {
+	path := ControlPath(conn)
+	if _, err := os.Stat(path); err != nil {
+		return false, nil
+	}
+	if _, err := controlCommand(conn, path, "exit"); err != nil {
+		if !CheckMaster(conn).Running {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// controlCommand runs "ssh -O <op>" against the master at path.
+func controlCommand(conn *config.Connection, path, op string) (string, error) {
+	if err := conn.CheckSafety(); err != nil {
+		return "", err
+	}
+	dest := conn.Host
+	if user := conn.EffectiveUser(); user != "" {
+		dest = user + "@" + conn.Host
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("ssh", "-O", op, "-o", "ControlPath="+path, "--", dest)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	msg := strings.TrimSpace(out.String())
+	if err != nil && msg != "" {
+		err = errors.New(msg)
+	}
+	return msg, err
+}
@@ -0,0 +1,127 @@
+package ssh
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestControlPath(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	a := &config.Connection{ID: "a", Host: "web.example.com", User: "deploy", Port: 22}
+	b := &config.Connection{ID: "b", Host: "web.example.com", User: "deploy", Port: 22}
+	c := &config.Connection{ID: "c", Host: "web.example.com", User: "root", Port: 22}
+
+	if got := ControlPath(a); filepath.Dir(got) != "/run/user/1000/hop" {
+		t.Errorf("ControlPath = %q, want it under the runtime dir", got)
+	}
+	if ControlPath(a) != ControlPath(b) {
+		t.Error("connections to the same endpoint should share a master")
+	}
+	if ControlPath(a) == ControlPath(c) {
+		t.Error("different users should not share a master")
+	}
+}
+
+func TestBuildCommand_Multiplex(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	on := true
+	conn := &config.Connection{ID: "web", Host: "web.example.com", User: "deploy", Multiplex: &on}
+
+	args := strings.Join(BuildCommand(conn, nil), " ")
+	for _, want := range []string{"-o ControlMaster=auto", "-o ControlPath=" + ControlPath(conn), "-o ControlPersist=" + DefaultControlPersist} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+	if info, err := os.Stat(RuntimeDir()); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("runtime dir not created private: %v %v", info, err)
+	}
+
+	conn.Options = map[string]string{"controlpersist": "1h"}
+	args = strings.Join(BuildCommand(conn, nil), " ")
+	if strings.Contains(args, "ControlPersist="+DefaultControlPersist) {
+		t.Errorf("connection's own ControlPersist should win: %q", args)
+	}
+
+	conn.Multiplex = nil
+	if args := strings.Join(BuildCommand(conn, nil), " "); strings.Contains(args, "ControlMaster") {
+		t.Errorf("unexpected mux args without multiplex: %q", args)
+	}
+}
+
+func TestMuxMaster(t *testing.T) {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		t.Skip("ssh not installed")
+	}
+	_, conn, _ := nativeTestEnv(t)
+	// t.TempDir paths can exceed the unix socket path limit.
+	dir, err := os.MkdirTemp("", "hopmux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+
+	on := true
+	conn.Multiplex = &on
+	conn.IdentityFile = filepath.Join(os.Getenv("HOME"), ".ssh", "id_ed25519")
+	conn.Options = map[string]string{
+		"BatchMode":             "yes",
+		"IdentitiesOnly":        "yes",
+		"StrictHostKeyChecking": "no",
+		"UserKnownHostsFile":    "/dev/null",
+		"LogLevel":              "ERROR",
+	}
+
+	if m := CheckMaster(&conn); m.Running {
+		t.Fatalf("master running before first use: %+v", m)
+	}
+	for i := 0; i < 2; i++ {
+		r := Execute([]config.Connection{conn}, &ExecOptions{Command: "echo hi"})[0]
+		if r.Error != nil || r.Stdout != "hi\n" {
+			t.Fatalf("run %d: stdout %q stderr %q err %v", i, r.Stdout, r.Stderr, r.Error)
+		}
+	}
+	m := CheckMaster(&conn)
+	if !m.Running || m.PID == 0 {
+		t.Fatalf("master not running after exec: %+v", m)
+	}
+	if stopped, err := StopMaster(&conn); !stopped || err != nil {
+		t.Fatalf("StopMaster = %v, %v", stopped, err)
+	}
+	if m := CheckMaster(&conn); m.Running {
+		t.Errorf("master still running after stop: %+v", m)
+	}
+	if stopped, err := StopMaster(&conn); stopped || err != nil {
+		t.Errorf("second StopMaster = %v, %v, want false, nil", stopped, err)
+	}
+}
+
+func TestEnsureRuntimeDir_RefusesOtherOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root to create a directory owned by another user")
+	}
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if err := os.Mkdir(RuntimeDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if !ensureRuntimeDir() {
+		t.Fatal("own private runtime dir refused")
+	}
+	if err := os.Chown(RuntimeDir(), 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if ensureRuntimeDir() {
+		t.Error("runtime dir owned by another user accepted")
+	}
+	on := true
+	conn := &config.Connection{ID: "web", Host: "web.example.com", Multiplex: &on}
+	if args := strings.Join(BuildCommand(conn, nil), " "); strings.Contains(args, "ControlPath") {
+		t.Errorf("multiplexed through another user's dir: %q", args)
+	}
+}
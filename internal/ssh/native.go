@@ -0,0 +1,471 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Transport selects how exec reaches remote hosts.
+type Transport string
+
+const (
+	// TransportSSH runs the local ssh binary once per host, so everything in
+	// ~/.ssh/config applies.
+	TransportSSH Transport = "ssh"
+	// TransportNative uses an in-process SSH client: no process per host,
+	// jump host connections are shared across hosts, and the remote exit
+	// status and signal are reported exactly. Only the settings in the hop
+	// connection are used; ~/.ssh/config is not read.
+	TransportNative Transport = "native"
+)
+
+// ParseTransport parses a --transport value. The empty string means ssh.
+func ParseTransport(s string) (Transport, error) {
+	switch Transport(strings.ToLower(s)) {
+	case "", TransportSSH:
+		return TransportSSH, nil
+	case TransportNative:
+		return TransportNative, nil
+	}
+	return "", fmt.Errorf("unknown transport %q (use ssh or native)", s)
+}
+
+// defaultIdentityFiles are tried, like ssh does, when a connection has no
+// identity_file.
+var defaultIdentityFiles = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// nativeDialer opens in-process SSH connections for one ExecuteContext run.
+// Jump host clients are opened once and shared by every host behind them.
+type nativeDialer struct {
+	ctx       context.Context
+	agent     agent.ExtendedAgent
+	agentConn net.Conn
+
+	mu       sync.Mutex
+	jumps    map[string]*jumpClient
+	accepted map[string]bool
+}
+
+type jumpClient struct {
+	once   sync.Once
+	client *gossh.Client
+	err    error
+}
+
+func newNativeDialer(ctx context.Context) *nativeDialer {
+	d := &nativeDialer{
+		ctx:      ctx,
+		jumps:    make(map[string]*jumpClient),
+		accepted: make(map[string]bool),
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			d.agent = agent.NewClient(conn)
+			d.agentConn = conn
+		}
+	}
+	return d
+}
+
+// Close closes the shared jump host connections and the agent.
+func (d *nativeDialer) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, j := range d.jumps {
+		if j.client != nil {
+			j.client.Close()
+		}
+	}
+	if d.agentConn != nil {
+		d.agentConn.Close()
+	}
+}
+
+// execute runs the command on a single host over an in-process connection.
+func (d *nativeDialer) execute(ctx context.Context, conn *config.Connection, opts *ExecOptions) ExecResult {
+	start := time.Now()
+	result := ExecResult{Connection: conn}
+	fail := func(err error) ExecResult {
+		result.Error = err
+		result.ExitCode = -1
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// No argv is built here, but a host or jump host starting with "-" is
+	// rejected the same way as for the ssh transport.
+	if err := conn.CheckSafety(); err != nil {
+		return fail(err)
+	}
+
+	var execCtx context.Context
+	var execCancel context.CancelFunc
+	if opts.Timeout > 0 {
+		execCtx, execCancel = context.WithTimeout(ctx, opts.Timeout)
+	} else {
+		execCtx, execCancel = context.WithCancel(ctx)
+	}
+	defer execCancel()
+
+	client, err := d.dial(execCtx, conn)
+	if err != nil {
+		return fail(err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fail(fmt.Errorf("open session: %w", err))
+	}
+	defer session.Close()
+
+	if conn.ForwardAgent {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if err := agent.ForwardToRemote(client, sock); err == nil {
+				_ = agent.RequestAgentForwarding(session)
+			}
+		}
+	}
+
+	if opts.Stdin != nil {
+		session.Stdin = bytes.NewReader(opts.Stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout, session.Stderr = outputWriters(conn, opts, &stdout, &stderr)
+
+	command, _ := resolveRemoteCommand(conn, &ConnectOptions{Command: opts.Command})
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+
+	select {
+	case err = <-done:
+	case <-execCtx.Done():
+		_ = session.Signal(gossh.SIGTERM)
+		client.Close()
+		<-done
+		err = execCtx.Err()
+	}
+	result.Duration = time.Since(start)
+
+	if !opts.Stream {
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+	}
+
+	if err != nil {
+		result.ExitCode = ExitCode(err)
+		result.Error = err
+		var exitErr *gossh.ExitError
+		if errors.As(err, &exitErr) {
+			result.Signal = exitErr.Signal()
+		}
+	}
+
+	return result
+}
+
+// dial connects to conn, through its proxy_jump chain if it has one.
+func (d *nativeDialer) dial(ctx context.Context, conn *config.Connection) (*gossh.Client, error) {
+	var via *gossh.Client
+	if conn.ProxyJump != "" && !strings.EqualFold(conn.ProxyJump, "none") {
+		var err error
+		if via, err = d.jump(conn.ProxyJump, conn.Options); err != nil {
+			return nil, err
+		}
+	}
+
+	user := conn.EffectiveUser()
+	if user == "" {
+		user = localUser()
+	}
+	port := conn.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(conn.Host, strconv.Itoa(port))
+	cfg, err := d.clientConfig(user, conn.IdentityFile, addr, conn.Options)
+	if err != nil {
+		return nil, err
+	}
+	return d.connect(ctx, via, addr, cfg, conn.Options)
+}
+
+// jump returns a client for the last host of a ProxyJump chain
+// ("user@host:port,host2"), opening each hop once per run.
+func (d *nativeDialer) jump(spec string, options map[string]string) (*gossh.Client, error) {
+	var via *gossh.Client
+	hops := strings.Split(spec, ",")
+	for i := range hops {
+		key := strings.Join(hops[:i+1], ",")
+		d.mu.Lock()
+		j, ok := d.jumps[key]
+		if !ok {
+			j = &jumpClient{}
+			d.jumps[key] = j
+		}
+		d.mu.Unlock()
+
+		prev := via
+		j.once.Do(func() {
+			user, addr := parseJumpHost(strings.TrimSpace(hops[i]))
+			cfg, err := d.clientConfig(user, "", addr, options)
+			if err != nil {
+				j.err = err
+				return
+			}
+			j.client, j.err = d.connect(d.ctx, prev, addr, cfg, options)
+		})
+		if j.err != nil {
+			return nil, fmt.Errorf("jump host %s: %w", strings.TrimSpace(hops[i]), j.err)
+		}
+		via = j.client
+	}
+	return via, nil
+}
+
+// parseJumpHost splits one ProxyJump hop into a user and a host:port
+// address, filling in the local user and port 22.
+func parseJumpHost(hop string) (user, addr string) {
+	user = localUser()
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		user, hop = hop[:i], hop[i+1:]
+	}
+	if host, port, err := net.SplitHostPort(hop); err == nil {
+		return user, net.JoinHostPort(host, port)
+	}
+	return user, net.JoinHostPort(strings.Trim(hop, "[]"), "22")
+}
+
+// connect opens a TCP connection to addr, directly or through via, and runs
+// the SSH handshake. Cancelling ctx aborts the handshake.
+func (d *nativeDialer) connect(ctx context.Context, via *gossh.Client, addr string, cfg *gossh.ClientConfig, options map[string]string) (*gossh.Client, error) {
+	if v := optionValue(options, "ConnectTimeout"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(secs)*time.Second)
+			defer cancel()
+		}
+	}
+
+	var nc net.Conn
+	var err error
+	if via != nil {
+		nc, err = via.DialContext(ctx, "tcp", addr)
+	} else {
+		var nd net.Dialer
+		nc, err = nd.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { nc.Close() })
+	c, chans, reqs, err := gossh.NewClientConn(nc, addr, cfg)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return gossh.NewClient(c, chans, reqs), nil
+}
+
+// clientConfig builds the auth and host key settings for user at addr. Keys are
+// offered in ssh's order: the identity file (or the default keys when there
+// is none), then the agent unless IdentitiesOnly is set.
+func (d *nativeDialer) clientConfig(user, identityFile, addr string, options map[string]string) (*gossh.ClientConfig, error) {
+	var signers []gossh.Signer
+	if identityFile != "" {
+		signer, err := loadSigner(expandPath(identityFile))
+		var missing *gossh.PassphraseMissingError
+		switch {
+		case errors.As(err, &missing) && d.agent != nil:
+			// Encrypted keys can't be prompted for here; the agent may hold it.
+		case err != nil:
+			return nil, fmt.Errorf("identity file %s: %w", identityFile, err)
+		default:
+			signers = append(signers, signer)
+		}
+	} else {
+		for _, path := range defaultIdentityFiles {
+			if signer, err := loadSigner(expandPath(path)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+
+	useAgent := d.agent != nil && !(identityFile != "" && isYes(optionValue(options, "IdentitiesOnly")))
+	keys := func() ([]gossh.Signer, error) {
+		if !useAgent {
+			return signers, nil
+		}
+		agentSigners, err := d.agent.Signers()
+		if err != nil {
+			return signers, nil
+		}
+		return append(append([]gossh.Signer(nil), signers...), agentSigners...), nil
+	}
+	if len(signers) == 0 && !useAgent {
+		return nil, fmt.Errorf("no identity file or ssh-agent keys to authenticate with")
+	}
+
+	callback, known, err := d.hostKeyCallback(options)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &gossh.ClientConfig{
+		User:            user,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeysCallback(keys)},
+		HostKeyCallback: callback,
+	}
+	if known != nil {
+		cfg.HostKeyAlgorithms = known(addr)
+	}
+	return cfg, nil
+}
+
+func loadSigner(path string) (gossh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gossh.ParsePrivateKey(data)
+}
+
+// probeKey never matches a known_hosts entry; checking it returns the keys
+// that are recorded for an address.
+var probeKey, _ = gossh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+
+// hostKeyCallback verifies host keys against known_hosts, following the
+// StrictHostKeyChecking and UserKnownHostsFile options. There is no one to
+// ask, so unknown hosts are rejected unless StrictHostKeyChecking is
+// accept-new (record the key) or no (skip the check).
+func (d *nativeDialer) hostKeyCallback(options map[string]string) (gossh.HostKeyCallback, func(string) []string, error) {
+	strict := strings.ToLower(optionValue(options, "StrictHostKeyChecking"))
+	if strict == "no" || strict == "off" {
+		return gossh.InsecureIgnoreHostKey(), nil, nil
+	}
+
+	userFiles := []string{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"}
+	if v := optionValue(options, "UserKnownHostsFile"); v != "" {
+		userFiles = strings.Fields(v)
+	}
+	var files []string
+	for _, f := range append(userFiles, "/etc/ssh/ssh_known_hosts") {
+		f = expandPath(f)
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+	check, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read known_hosts: %w", err)
+	}
+
+	// algorithms lists the key types known_hosts has for addr, so the server
+	// is asked for a key we can verify rather than its preferred one.
+	algorithms := func(addr string) []string {
+		var keyErr *knownhosts.KeyError
+		if err := check(addr, &net.TCPAddr{}, probeKey); !errors.As(err, &keyErr) {
+			return nil
+		}
+		var algos []string
+		for _, k := range keyErr.Want {
+			if k.Key.Type() == gossh.KeyAlgoRSA {
+				algos = append(algos, gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256)
+			}
+			algos = append(algos, k.Key.Type())
+		}
+		return algos
+	}
+
+	writeTo := expandPath(userFiles[0])
+	callback := func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key for %s does not match known_hosts (%s:%d); it may have been replaced or you may be under attack",
+				hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line)
+		}
+		if strict != "accept-new" {
+			return fmt.Errorf("%s is not in known_hosts; connect once with ssh to verify its host key, or set StrictHostKeyChecking: accept-new", hostname)
+		}
+		return d.acceptHostKey(writeTo, hostname, key)
+	}
+	return callback, algorithms, nil
+}
+
+// acceptHostKey appends key for hostname to the known_hosts file at path.
+func (d *nativeDialer) acceptHostKey(path, hostname string, key gossh.PublicKey) error {
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.accepted[line] {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return err
+	}
+	d.accepted[line] = true
+	return nil
+}
+
+// optionValue looks up an ssh option case-insensitively, as ssh does.
+func optionValue(options map[string]string, key string) string {
+	for k, v := range options {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isYes(v string) bool {
+	switch strings.ToLower(v) {
+	case "yes", "true", "on":
+		return true
+	}
+	return false
+}
+
+func localUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
@@ -0,0 +1,362 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is a minimal in-process sshd. Its "commands" are:
+// "echo <text>", "exit <n>", "kill" (dies from SIGKILL), "cat" (echoes
+// stdin) and "sleep" (blocks until the client disconnects). It also forwards direct-tcpip channels so it
+// can act as its own jump host.
+type testSSHServer struct {
+	addr    string
+	host    string
+	port    int
+	hostKey gossh.PublicKey
+}
+
+func startTestSSHServer(t *testing.T, authorized gossh.PublicKey) *testSSHServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &gossh.ServerConfig{
+		PublicKeyCallback: func(_ gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(nc, cfg)
+		}
+	}()
+
+	tcp := ln.Addr().(*net.TCPAddr)
+	return &testSSHServer{addr: tcp.String(), host: "127.0.0.1", port: tcp.Port, hostKey: signer.PublicKey()}
+}
+
+func serveTestConn(nc net.Conn, cfg *gossh.ServerConfig) {
+	_, chans, reqs, err := gossh.NewServerConn(nc, cfg)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	for nch := range chans {
+		switch nch.ChannelType() {
+		case "session":
+			ch, reqs, err := nch.Accept()
+			if err != nil {
+				continue
+			}
+			go serveTestSession(ch, reqs)
+		case "direct-tcpip":
+			var target struct {
+				Host     string
+				Port     uint32
+				OrigHost string
+				OrigPort uint32
+			}
+			if err := gossh.Unmarshal(nch.ExtraData(), &target); err != nil {
+				nch.Reject(gossh.ConnectionFailed, err.Error())
+				continue
+			}
+			out, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+			if err != nil {
+				nch.Reject(gossh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, reqs, err := nch.Accept()
+			if err != nil {
+				out.Close()
+				continue
+			}
+			go gossh.DiscardRequests(reqs)
+			go func() {
+				defer ch.Close()
+				defer out.Close()
+				go io.Copy(out, ch)
+				io.Copy(ch, out)
+			}()
+		default:
+			nch.Reject(gossh.UnknownChannelType, "unsupported")
+		}
+	}
+}
+
+func serveTestSession(ch gossh.Channel, reqs <-chan *gossh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		gossh.Unmarshal(req.Payload, &payload)
+		req.Reply(true, nil)
+
+		cmd, arg, _ := strings.Cut(payload.Command, " ")
+		switch cmd {
+		case "echo":
+			io.WriteString(ch, arg+"\n")
+			ch.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{0}))
+		case "exit":
+			n, _ := strconv.Atoi(arg)
+			io.WriteString(ch.Stderr(), "failing\n")
+			ch.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{uint32(n)}))
+		case "kill":
+			ch.SendRequest("exit-signal", false, gossh.Marshal(struct {
+				Signal     string
+				CoreDumped bool
+				Error      string
+				Lang       string
+			}{Signal: "KILL"}))
+		case "cat":
+			io.Copy(ch, ch)
+			ch.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{0}))
+		case "sleep":
+			for range reqs {
+			}
+		}
+		return
+	}
+}
+
+// nativeTestEnv points HOME at a temp dir holding a client key, and returns
+// a connection to srv authenticated with it.
+func nativeTestEnv(t *testing.T) (*testSSHServer, config.Connection, string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sshDir, "id_ed25519"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := startTestSSHServer(t, sshPub)
+	conn := config.Connection{
+		ID:           "test",
+		Host:         srv.host,
+		Port:         srv.port,
+		User:         "tester",
+		IdentityFile: "~/.ssh/id_ed25519",
+	}
+	return srv, conn, filepath.Join(sshDir, "known_hosts")
+}
+
+func trustHost(t *testing.T, knownHosts string, srv *testSSHServer) {
+	t.Helper()
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, srv.hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecuteNative(t *testing.T) {
+	srv, conn, knownHosts := nativeTestEnv(t)
+	trustHost(t, knownHosts, srv)
+
+	tests := []struct {
+		command    string
+		wantStdout string
+		wantStderr string
+		wantCode   int
+		wantSignal string
+	}{
+		{command: "echo hello", wantStdout: "hello\n"},
+		{command: "exit 3", wantStderr: "failing\n", wantCode: 3},
+		{command: "kill", wantCode: 128 + 9, wantSignal: "KILL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			results := Execute([]config.Connection{conn}, &ExecOptions{Command: tt.command, Transport: TransportNative})
+			r := results[0]
+			if r.Stdout != tt.wantStdout || r.Stderr != tt.wantStderr {
+				t.Errorf("output = %q/%q, want %q/%q", r.Stdout, r.Stderr, tt.wantStdout, tt.wantStderr)
+			}
+			if r.ExitCode != tt.wantCode || r.Signal != tt.wantSignal {
+				t.Errorf("exit = %d/%q, want %d/%q (err %v)", r.ExitCode, r.Signal, tt.wantCode, tt.wantSignal, r.Error)
+			}
+			if (r.Error != nil) != (tt.wantCode != 0) {
+				t.Errorf("error = %v", r.Error)
+			}
+		})
+	}
+}
+
+func TestExecuteNative_Stdin(t *testing.T) {
+	srv, conn, knownHosts := nativeTestEnv(t)
+	trustHost(t, knownHosts, srv)
+
+	second := conn
+	second.ID = "test2"
+	opts := &ExecOptions{Command: "cat", Stdin: []byte("line 1\nline 2\n"), Transport: TransportNative}
+	for _, r := range Execute([]config.Connection{conn, second}, opts) {
+		if r.Error != nil || r.Stdout != "line 1\nline 2\n" {
+			t.Errorf("%s: stdout = %q, err = %v", r.Connection.ID, r.Stdout, r.Error)
+		}
+	}
+}
+
+func TestExecuteNative_ProxyJump(t *testing.T) {
+	srv, conn, knownHosts := nativeTestEnv(t)
+	trustHost(t, knownHosts, srv)
+
+	// The server forwards to itself, so it is both the jump host and target.
+	conn.ProxyJump = "tester@" + srv.addr
+	second := conn
+	second.ID = "test2"
+
+	results := Execute([]config.Connection{conn, second}, &ExecOptions{Command: "echo via jump", Transport: TransportNative})
+	for _, r := range results {
+		if r.Error != nil || r.Stdout != "via jump\n" {
+			t.Errorf("%s: stdout %q, err %v", r.Connection.ID, r.Stdout, r.Error)
+		}
+	}
+}
+
+func TestExecuteNative_HostKeys(t *testing.T) {
+	srv, conn, knownHosts := nativeTestEnv(t)
+
+	r := Execute([]config.Connection{conn}, &ExecOptions{Command: "echo hi", Transport: TransportNative})[0]
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "not in known_hosts") {
+		t.Fatalf("unknown host: err = %v, want not in known_hosts", r.Error)
+	}
+
+	conn.Options = map[string]string{"StrictHostKeyChecking": "accept-new"}
+	r = Execute([]config.Connection{conn}, &ExecOptions{Command: "echo hi", Transport: TransportNative})[0]
+	if r.Error != nil {
+		t.Fatalf("accept-new: %v", r.Error)
+	}
+	data, err := os.ReadFile(knownHosts)
+	if err != nil || !strings.Contains(string(data), "[127.0.0.1]:"+strconv.Itoa(srv.port)) {
+		t.Fatalf("accept-new did not record the key: %q, %v", data, err)
+	}
+
+	// A different key for the same host is refused even with accept-new.
+	other := startTestSSHServer(t, srv.hostKey)
+	line := knownhosts.Line([]string{knownhosts.Normalize(other.addr)}, srv.hostKey)
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conn.Port = other.port
+	r = Execute([]config.Connection{conn}, &ExecOptions{Command: "echo hi", Transport: TransportNative})[0]
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "does not match") {
+		t.Fatalf("changed key: err = %v, want does not match", r.Error)
+	}
+
+	conn.Options = map[string]string{"stricthostkeychecking": "no"}
+	r = Execute([]config.Connection{conn}, &ExecOptions{Command: "echo hi", Transport: TransportNative})[0]
+	if r.Error != nil && strings.Contains(r.Error.Error(), "known_hosts") {
+		t.Fatalf("StrictHostKeyChecking=no still checked the host key: %v", r.Error)
+	}
+}
+
+func TestExecuteNative_Timeout(t *testing.T) {
+	srv, conn, knownHosts := nativeTestEnv(t)
+	trustHost(t, knownHosts, srv)
+
+	start := time.Now()
+	r := ExecuteContext(context.Background(), []config.Connection{conn}, &ExecOptions{
+		Command:   "sleep",
+		Timeout:   200 * time.Millisecond,
+		Transport: TransportNative,
+	})[0]
+	if !errors.Is(r.Error, context.DeadlineExceeded) || r.ExitCode != -1 {
+		t.Errorf("timeout: exit %d, err %v", r.ExitCode, r.Error)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("timeout took %v", time.Since(start))
+	}
+}
+
+func TestParseTransport(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Transport
+		wantErr bool
+	}{
+		{"", TransportSSH, false},
+		{"ssh", TransportSSH, false},
+		{"Native", TransportNative, false},
+		{"paramiko", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTransport(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseTransport(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestParseJumpHost(t *testing.T) {
+	t.Setenv("USER", "me")
+	tests := []struct {
+		in, user, addr string
+	}{
+		{"bastion", "me", "bastion:22"},
+		{"admin@bastion", "admin", "bastion:22"},
+		{"admin@bastion:2222", "admin", "bastion:2222"},
+		{"[::1]:2222", "me", "[::1]:2222"},
+		{"[::1]", "me", "[::1]:22"},
+	}
+	for _, tt := range tests {
+		user, addr := parseJumpHost(tt.in)
+		if user != tt.user || addr != tt.addr {
+			t.Errorf("parseJumpHost(%q) = %q, %q, want %q, %q", tt.in, user, addr, tt.user, tt.addr)
+		}
+	}
+}
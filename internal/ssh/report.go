@@ -0,0 +1,259 @@
+package ssh
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// OutputFormat selects how hop exec reports results.
+type OutputFormat string
+
+const (
+	// OutputText prints each host's output under a "═══ id ═══" banner.
+	OutputText OutputFormat = "text"
+	// OutputJSON prints one JSON document with every host's record.
+	OutputJSON OutputFormat = "json"
+	// OutputNDJSON prints one JSON record per line as each host finishes.
+	OutputNDJSON OutputFormat = "ndjson"
+	// OutputJUnit prints a JUnit XML report with a testcase per host.
+	OutputJUnit OutputFormat = "junit"
+	// OutputTable prints one summary row per host.
+	OutputTable OutputFormat = "table"
+)
+
+// ParseOutputFormat parses an --output value. The empty string means text.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch f := OutputFormat(strings.ToLower(s)); f {
+	case "":
+		return OutputText, nil
+	case OutputText, OutputJSON, OutputNDJSON, OutputJUnit, OutputTable:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (use text, json, ndjson, junit or table)", s)
+}
+
+// ExecRecord is the machine-readable form of an ExecResult.
+type ExecRecord struct {
+	ID         string `json:"id"`
+	Host       string `json:"host"`
+	User       string `json:"user,omitempty"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	Signal     string `json:"signal,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"`
+}
+
+// NewExecRecord converts r to an ExecRecord.
+func NewExecRecord(r ExecResult) ExecRecord {
+	rec := ExecRecord{
+		Stdout:     r.Stdout,
+		Stderr:     r.Stderr,
+		ExitCode:   r.ExitCode,
+		Signal:     r.Signal,
+		DurationMS: r.Duration.Milliseconds(),
+		Skipped:    r.Skipped,
+	}
+	if r.Connection != nil {
+		rec.ID = r.Connection.ID
+		rec.Host = r.Connection.Host
+		rec.User = r.Connection.EffectiveUser()
+	}
+	if r.Error != nil {
+		rec.Error = r.Error.Error()
+	}
+	return rec
+}
+
+// ExecReport is the document printed by --output json.
+type ExecReport struct {
+	Command     string       `json:"command"`
+	Results     []ExecRecord `json:"results"`
+	TotalHosts  int          `json:"total_hosts"`
+	FailedHosts int          `json:"failed_hosts"`
+}
+
+// WriteJSON writes results as an indented ExecReport.
+func WriteJSON(w io.Writer, command string, results []ExecResult) error {
+	report := ExecReport{
+		Command:     command,
+		Results:     make([]ExecRecord, len(results)),
+		TotalHosts:  len(results),
+		FailedHosts: CountErrors(results),
+	}
+	for i, r := range results {
+		report.Results[i] = NewExecRecord(r)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// WriteNDJSON writes one result as a single line of JSON.
+func WriteNDJSON(w io.Writer, r ExecResult) error {
+	return json.NewEncoder(w).Encode(NewExecRecord(r))
+}
+
+// JUnit report structure. Each host is a testcase: a non-zero exit is a
+// failure, a host that could not be run (timeout, connection error) is an
+// error, and a host skipped by fail-fast or cancellation is skipped.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// sshExitError is the status the ssh binary exits with when ssh itself
+// fails, e.g. because the host can't be reached or authentication failed.
+const sshExitError = 255
+
+// WriteJUnit writes results as a JUnit XML report with one testsuite named
+// after the command, started at start. Hosts that couldn't be reached are
+// errors rather than failures; with the ssh transport that includes ssh
+// exiting 255.
+func WriteJUnit(w io.Writer, command string, start time.Time, transport Transport, results []ExecResult) error {
+	suite := junitTestSuite{
+		Name:      command,
+		Tests:     len(results),
+		Timestamp: start.UTC().Format("2006-01-02T15:04:05"),
+	}
+	var total time.Duration
+	for _, r := range results {
+		rec := NewExecRecord(r)
+		tc := junitTestCase{
+			Name:      rec.ID,
+			Classname: "hop.exec",
+			Time:      junitSeconds(r.Duration),
+			SystemOut: rec.Stdout,
+			SystemErr: rec.Stderr,
+		}
+		switch {
+		case r.Skipped:
+			tc.Skipped = &junitMessage{Message: rec.Error}
+			suite.Skipped++
+		case r.Error != nil && (r.ExitCode <= 0 || transport != TransportNative && r.ExitCode == sshExitError):
+			tc.Error = &junitMessage{Message: rec.Error, Type: "error", Text: rec.Stderr}
+			suite.Errors++
+		case r.Error != nil:
+			msg := "exit code " + strconv.Itoa(r.ExitCode)
+			if r.Signal != "" {
+				msg += " (signal " + r.Signal + ")"
+			}
+			tc.Failure = &junitMessage{Message: msg, Type: "exit", Text: rec.Stderr}
+			suite.Failures++
+		}
+		total += r.Duration
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = junitSeconds(total)
+
+	doc := junitTestSuites{
+		Name:     "hop exec",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// WriteTable writes one row per host: status, exit code, duration and the
+// first line of output (or the error for failed hosts).
+func WriteTable(w io.Writer, results []ExecResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tEXIT\tDURATION\tOUTPUT")
+	for _, r := range results {
+		status, output := "ok", firstLine(r.Stdout)
+		switch {
+		case r.Skipped:
+			status = "skipped"
+			if r.Error != nil {
+				output = r.Error.Error()
+			}
+		case r.Error != nil:
+			status = "failed"
+			if msg := firstLine(r.Stderr); msg != "" {
+				output = msg
+			} else {
+				output = r.Error.Error()
+			}
+		}
+		id := ""
+		if r.Connection != nil {
+			id = r.Connection.ID
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", id, status, r.ExitCode, r.Duration.Round(time.Millisecond), output)
+	}
+	return tw.Flush()
+}
+
+// firstLine returns the first non-empty line of s, shortened to fit a
+// table cell.
+func firstLine(s string) string {
+	const max = 80
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if runes := []rune(line); len(runes) > max {
+				line = string(runes[:max-1]) + "…"
+			}
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func reportResults() []ExecResult {
+	return []ExecResult{
+		{Connection: &config.Connection{ID: "web1", Host: "web1.example.com", User: "deploy"}, Stdout: "ok\n", Duration: 1200 * time.Millisecond},
+		{Connection: &config.Connection{ID: "web2", Host: "web2.example.com"}, Stdout: "partial\n", Stderr: "disk full\n", ExitCode: 2, Error: &mockError{msg: "exit status 2"}, Duration: 300 * time.Millisecond},
+		{Connection: &config.Connection{ID: "web3", Host: "web3.example.com"}, ExitCode: -1, Error: context.DeadlineExceeded, Duration: 5 * time.Second},
+		{Connection: &config.Connection{ID: "web4", Host: "web4.example.com"}, ExitCode: -1, Error: &mockError{msg: "skipped due to fail-fast"}, Skipped: true},
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for in, want := range map[string]OutputFormat{"": OutputText, "JSON": OutputJSON, "ndjson": OutputNDJSON, "junit": OutputJUnit, "table": OutputTable} {
+		if got, err := ParseOutputFormat(in); got != want || err != nil {
+			t.Errorf("ParseOutputFormat(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseOutputFormat("yaml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, "uptime", reportResults()); err != nil {
+		t.Fatal(err)
+	}
+	var report ExecReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if report.Command != "uptime" || report.TotalHosts != 4 || report.FailedHosts != 3 {
+		t.Errorf("report = %+v", report)
+	}
+	want := ExecRecord{ID: "web2", Host: "web2.example.com", Stdout: "partial\n", Stderr: "disk full\n", ExitCode: 2, DurationMS: 300, Error: "exit status 2"}
+	if report.Results[1] != want {
+		t.Errorf("record = %+v, want %+v", report.Results[1], want)
+	}
+	if report.Results[0].User != "deploy" || !report.Results[3].Skipped {
+		t.Errorf("records = %+v", report.Results)
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	for _, r := range reportResults() {
+		if err := WriteNDJSON(&buf, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want one per host:\n%s", len(lines), buf.String())
+	}
+	var rec ExecRecord
+	if err := json.Unmarshal([]byte(lines[2]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != "web3" || rec.Error != "context deadline exceeded" || rec.DurationMS != 5000 {
+		t.Errorf("record = %+v", rec)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := WriteJUnit(&buf, "uptime", start, TransportSSH, reportResults()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "<?xml") {
+		t.Errorf("missing XML header:\n%s", buf.String())
+	}
+
+	var doc junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if doc.Tests != 4 || doc.Failures != 1 || doc.Errors != 1 || doc.Skipped != 1 {
+		t.Errorf("totals = %d tests, %d failures, %d errors, %d skipped", doc.Tests, doc.Failures, doc.Errors, doc.Skipped)
+	}
+	suite := doc.Suites[0]
+	if suite.Name != "uptime" || suite.Timestamp != "2026-03-04T05:06:07" || suite.Time != "6.500" {
+		t.Errorf("suite = %+v", suite)
+	}
+	cases := suite.Cases
+	if cases[0].Name != "web1" || cases[0].Time != "1.200" || cases[0].Failure != nil || cases[0].SystemOut != "ok\n" {
+		t.Errorf("passing case = %+v", cases[0])
+	}
+	if f := cases[1].Failure; f == nil || f.Message != "exit code 2" || f.Text != "disk full\n" {
+		t.Errorf("failing case = %+v", cases[1])
+	}
+	if e := cases[2].Error; e == nil || e.Message != "context deadline exceeded" {
+		t.Errorf("error case = %+v", cases[2])
+	}
+	if cases[3].Skipped == nil {
+		t.Errorf("skipped case = %+v", cases[3])
+	}
+}
+
+func TestWriteJUnitSSHExit255(t *testing.T) {
+	results := []ExecResult{{
+		Connection: &config.Connection{ID: "down", Host: "down.example.com"},
+		Stderr:     "ssh: connect to host down.example.com port 22: Connection refused\n",
+		ExitCode:   255,
+		Error:      &mockError{msg: "exit status 255"},
+	}}
+	for transport, wantError := range map[Transport]bool{TransportSSH: true, TransportNative: false} {
+		var buf bytes.Buffer
+		if err := WriteJUnit(&buf, "uptime", time.Now(), transport, results); err != nil {
+			t.Fatal(err)
+		}
+		var doc junitTestSuites
+		if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+		}
+		tc := doc.Suites[0].Cases[0]
+		if gotError := tc.Error != nil; gotError != wantError || gotError == (tc.Failure != nil) {
+			t.Errorf("%s transport: error = %+v, failure = %+v", transport, tc.Error, tc.Failure)
+		}
+		if wantError && (doc.Errors != 1 || doc.Failures != 0 || !strings.Contains(tc.Error.Text, "Connection refused")) {
+			t.Errorf("%s transport: totals = %d errors, %d failures, text %q", transport, doc.Errors, doc.Failures, tc.Error.Text)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, reportResults()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := [][]string{
+		{"ID", "STATUS", "EXIT", "DURATION", "OUTPUT"},
+		{"web1", "ok", "0", "1.2s", "ok"},
+		{"web2", "failed", "2", "300ms", "disk", "full"},
+		{"web3", "failed", "-1", "5s", "context", "deadline", "exceeded"},
+		{"web4", "skipped", "-1", "0s", "skipped", "due", "to", "fail-fast"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestExecuteOnResult(t *testing.T) {
+	conns := []config.Connection{
+		{ID: "a", Host: "-oProxyCommand=x"},
+		{ID: "b", Host: "-oProxyCommand=y"},
+	}
+	var seen []string
+	results := Execute(conns, &ExecOptions{Command: "true", OnResult: func(r ExecResult) {
+		seen = append(seen, r.Connection.ID)
+	}})
+	if len(seen) != len(results) {
+		t.Errorf("OnResult called for %v, want every host", seen)
+	}
+}
@@ -0,0 +1,67 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// MaxScriptSize is the largest script ScriptCommand embeds. The script
+// travels inside the remote command line, which sshd passes to the login
+// shell as a single argument, and Linux limits one argument to 128KB.
+const MaxScriptSize = 100 * 1024
+
+// ScriptCommand returns a remote command that writes script to a temporary
+// file, runs it with args and removes it again, keeping the script's exit
+// status.
+//
+// The script is embedded in the command rather than sent on stdin so stdin
+// stays free for --stdin. With an empty interpreter, a script starting with
+// "#!" is run with the interpreter its first line names and any other
+// script with sh; the file is never executed itself, so a /tmp mounted
+// noexec doesn't matter. interpreter is used as written, so it may carry
+// its own flags (e.g. "bash -eu").
+func ScriptCommand(script []byte, interpreter string, args []string) (string, error) {
+	if len(script) > MaxScriptSize {
+		return "", fmt.Errorf("script is too large to send inline (%d bytes, max %d); copy it with hop cp instead", len(script), MaxScriptSize)
+	}
+	if bytes.IndexByte(script, 0) >= 0 {
+		return "", fmt.Errorf("script contains NUL bytes; only text scripts can be sent")
+	}
+
+	run := `sh "$t"`
+	if interpreter != "" {
+		run = interpreter + ` "$t"`
+	} else if path, arg := shebang(script); path != "" {
+		run = posixQuote(path)
+		if arg != "" {
+			run += " " + posixQuote(arg)
+		}
+		run += ` "$t"`
+	}
+	for _, arg := range args {
+		run += " " + posixQuote(arg)
+	}
+
+	write := `printf '%s' ` + posixQuote(string(script)) + ` > "$t"`
+	return strings.Join([]string{
+		`t=$(mktemp) || exit 125`,
+		`trap 'rm -f "$t"' EXIT`,
+		write + ` && ` + run,
+	}, "; "), nil
+}
+
+// shebang returns the interpreter named on a "#!" first line and its
+// optional argument. Like the kernel, everything after the interpreter is
+// one argument. path is "" when the script has no such line.
+func shebang(script []byte) (path, arg string) {
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		return "", ""
+	}
+	line, _, _ := bytes.Cut(script[2:], []byte("\n"))
+	line = bytes.TrimSpace(line)
+	if i := bytes.IndexAny(line, " \t"); i >= 0 {
+		return string(line[:i]), strings.TrimSpace(string(line[i+1:]))
+	}
+	return string(line), ""
+}
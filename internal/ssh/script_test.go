@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// runScript runs a ScriptCommand with the local sh, standing in for the
+// remote login shell.
+func runScript(t *testing.T, script, interpreter string, args ...string) (string, int) {
+	t.Helper()
+	command, err := ScriptCommand([]byte(script), interpreter, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("sh", "-c", command).Output()
+	return string(out), ExitCode(err)
+}
+
+func TestScriptCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		interpreter string
+		args        []string
+		want        string
+		wantCode    int
+	}{
+		{
+			name:   "sh by default",
+			script: "echo \"args: $1|$2\"\necho 'it''s' \"$(printf '%s' \\$HOME)\"\n",
+			args:   []string{"a b", "it's"},
+			want:   "args: a b|it's\nits $HOME\n",
+		},
+		{
+			name:   "shebang",
+			script: "#!/bin/sh\necho shebang $#\n",
+			args:   []string{"x", "y"},
+			want:   "shebang 2\n",
+		},
+		{
+			name:     "shebang argument",
+			script:   "#!/bin/sh -e\nfalse\necho not reached\n",
+			wantCode: 1,
+		},
+		{
+			// The file isn't executable, as if /tmp were mounted noexec:
+			// the shebang's interpreter runs it.
+			name:   "shebang via env without exec permission",
+			script: "#!/usr/bin/env sh\n[ -x \"$0\" ] && echo executable || echo read\n",
+			want:   "read\n",
+		},
+		{
+			name:        "interpreter with flags",
+			script:      "false\necho not reached\n",
+			interpreter: "sh -e",
+			wantCode:    1,
+		},
+		{
+			name:     "exit status kept",
+			script:   "echo before\nexit 7\n",
+			want:     "before\n",
+			wantCode: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, code := runScript(t, tt.script, tt.interpreter, tt.args...)
+			if out != tt.want || code != tt.wantCode {
+				t.Errorf("got %q (exit %d), want %q (exit %d)", out, code, tt.want, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := map[string][2]string{
+		"echo hi\n":                        {"", ""},
+		"#!/bin/bash\necho hi\n":           {"/bin/bash", ""},
+		"#! /usr/bin/env  python3 \r\nx\n": {"/usr/bin/env", "python3"},
+		"#!/usr/bin/env -S bash -eu\n":     {"/usr/bin/env", "-S bash -eu"},
+		"#!/bin/sh\t-x":                    {"/bin/sh", "-x"},
+	}
+	for script, want := range tests {
+		if path, arg := shebang([]byte(script)); path != want[0] || arg != want[1] {
+			t.Errorf("shebang(%q) = %q, %q, want %q, %q", script, path, arg, want[0], want[1])
+		}
+	}
+}
+
+func TestScriptCommand_RemovesTempFile(t *testing.T) {
+	out, code := runScript(t, `echo "$0"`, "")
+	path := strings.TrimSpace(out)
+	if code != 0 || path == "" {
+		t.Fatalf("script printed %q (exit %d)", out, code)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("temp script %s still exists (%v)", path, err)
+	}
+}
+
+func TestScriptCommand_Rejects(t *testing.T) {
+	if _, err := ScriptCommand(make([]byte, MaxScriptSize+1), "", nil); err == nil {
+		t.Error("expected an error for an oversized script")
+	}
+	if _, err := ScriptCommand([]byte("echo\x00"), "", nil); err == nil {
+		t.Error("expected an error for a binary script")
+	}
+}
+
+func TestRunLocal_Stdin(t *testing.T) {
+	conn := &config.Connection{ID: "local"}
+	r := runLocal(context.Background(), conn, &ExecOptions{Stdin: []byte("piped\n")}, "cat", nil)
+	if r.Error != nil || r.Stdout != "piped\n" {
+		t.Errorf("stdout = %q, err = %v", r.Stdout, r.Error)
+	}
+}
+
+func TestRunLocal_Output(t *testing.T) {
+	conn := &config.Connection{ID: "local"}
+	var out, errOut bytes.Buffer
+	opts := &ExecOptions{
+		Output: func(*config.Connection) (io.Writer, io.Writer) { return &out, &errOut },
+	}
+	r := runLocal(context.Background(), conn, opts, "sh", []string{"-c", "echo out; echo err >&2"})
+	if r.Stdout != "out\n" || r.Stderr != "err\n" {
+		t.Errorf("result stdout = %q, stderr = %q", r.Stdout, r.Stderr)
+	}
+	if out.String() != "out\n" || errOut.String() != "err\n" {
+		t.Errorf("output writers got %q and %q", out.String(), errOut.String())
+	}
+}
@@ -0,0 +1,183 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// FailureThreshold is how many failed hosts a run tolerates: a host count,
+// or a percentage of the hosts in the run.
+type FailureThreshold struct {
+	// Hosts is the number of failures tolerated, used when Percent is 0.
+	Hosts int
+	// Percent is the share of hosts, in percent, allowed to fail.
+	Percent float64
+}
+
+// ParseFailureThreshold parses a --max-fail value: "3" (hosts) or "10%".
+func ParseFailureThreshold(s string) (*FailureThreshold, error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("invalid max-fail %q (want a host count or a percentage like 10%%)", s)
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 || v > 100 {
+			return nil, invalid
+		}
+		return &FailureThreshold{Percent: v}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return nil, invalid
+	}
+	return &FailureThreshold{Hosts: n}, nil
+}
+
+// Exceeded reports whether failed hosts out of total is more than t allows.
+func (t *FailureThreshold) Exceeded(failed, total int) bool {
+	if t.Percent > 0 {
+		return float64(failed)*100 > t.Percent*float64(total)
+	}
+	return failed > t.Hosts
+}
+
+func (t *FailureThreshold) String() string {
+	if t.Percent > 0 {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(t.Hosts)
+}
+
+// BatchEventKind says what happened in a BatchEvent.
+type BatchEventKind int
+
+const (
+	// BatchStarted is sent before a batch's hosts are run.
+	BatchStarted BatchEventKind = iota
+	// BatchFinished is sent after all of a batch's hosts are done.
+	BatchFinished
+	// BatchPausing is sent before waiting opts.Pause for the next batch.
+	BatchPausing
+	// BatchGating is sent before running opts.Gate on a finished batch.
+	BatchGating
+	// BatchStopped is sent when the run stops before its last batch.
+	BatchStopped
+)
+
+// BatchEvent reports the progress of a batched run.
+type BatchEvent struct {
+	Kind BatchEventKind
+	// Batch is the 1-based batch number, of Batches.
+	Batch   int
+	Batches int
+	// Canary is true for the canary batch.
+	Canary bool
+	// Connections are the batch's hosts.
+	Connections []config.Connection
+	// Failed is the number of failed hosts in the batch (BatchFinished).
+	Failed   int
+	Duration time.Duration
+	// Err is why the run stopped (BatchStopped).
+	Err error
+}
+
+// planBatches splits n hosts into [start, end) ranges: canary hosts first,
+// then batches of size batch (the rest at once when batch is 0).
+func planBatches(n, canary, batch int) [][2]int {
+	var plan [][2]int
+	start := 0
+	if canary > 0 {
+		end := min(canary, n)
+		plan = append(plan, [2]int{0, end})
+		start = end
+	}
+	for start < n {
+		end := n
+		if batch > 0 {
+			end = min(start+batch, n)
+		}
+		plan = append(plan, [2]int{start, end})
+		start = end
+	}
+	return plan
+}
+
+// runBatches runs connections one batch at a time (see planBatches). Between
+// batches it waits opts.Pause and runs opts.Gate on the batch that just
+// finished. The run stops, skipping the remaining hosts, when the gate
+// fails, fail-fast or MaxFail trigger, or ctx is cancelled.
+func runBatches(ctx context.Context, connections []config.Connection, opts *ExecOptions, run hostFunc, st *runState) []ExecResult {
+	plan := planBatches(len(connections), opts.Canary, opts.Batch)
+	results := make([]ExecResult, 0, len(connections))
+	event := func(e BatchEvent) {
+		if opts.OnBatch != nil {
+			e.Batches = len(plan)
+			opts.OnBatch(e)
+		}
+	}
+
+	for i, b := range plan {
+		batch := connections[b[0]:b[1]]
+		e := BatchEvent{Batch: i + 1, Canary: opts.Canary > 0 && i == 0, Connections: batch}
+
+		if i > 0 && st.stopped() == nil && ctx.Err() == nil {
+			prev := connections[plan[i-1][0]:plan[i-1][1]]
+			if err := betweenBatches(ctx, opts, prev, e, event); err != nil {
+				st.stop(err)
+			}
+		}
+		if err := st.stopped(); err != nil || ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			e.Kind, e.Err = BatchStopped, err
+			event(e)
+			for j := range connections[b[0]:] {
+				r := skipped(&connections[b[0]+j], err)
+				results = append(results, r)
+				if opts.OnResult != nil {
+					opts.OnResult(r)
+				}
+			}
+			return results
+		}
+
+		e.Kind = BatchStarted
+		event(e)
+		start := time.Now()
+		batchResults := runParallel(ctx, batch, opts, run, st)
+		results = append(results, batchResults...)
+
+		e.Kind, e.Failed, e.Duration = BatchFinished, CountErrors(batchResults), time.Since(start)
+		event(e)
+	}
+	return results
+}
+
+// betweenBatches pauses and runs the gate before the batch described by
+// next, reporting both through event.
+func betweenBatches(ctx context.Context, opts *ExecOptions, prev []config.Connection, next BatchEvent, event func(BatchEvent)) error {
+	if opts.Pause > 0 {
+		e := next
+		e.Kind, e.Duration = BatchPausing, opts.Pause
+		event(e)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.Pause):
+		}
+	}
+	if opts.Gate != nil {
+		e := next
+		e.Kind, e.Connections = BatchGating, prev
+		event(e)
+		if err := opts.Gate(ctx, prev); err != nil {
+			return fmt.Errorf("health gate failed: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// fakeRun fails hosts whose Host is "bad" and records the order hosts ran in.
+type fakeRun struct {
+	mu  sync.Mutex
+	ran []string
+}
+
+func (f *fakeRun) run(ctx context.Context, conn *config.Connection, opts *ExecOptions) ExecResult {
+	f.mu.Lock()
+	f.ran = append(f.ran, conn.ID)
+	f.mu.Unlock()
+	if conn.Host == "bad" {
+		return ExecResult{Connection: conn, ExitCode: 1, Error: errors.New("exit status 1")}
+	}
+	return ExecResult{Connection: conn}
+}
+
+func hosts(ids ...string) []config.Connection {
+	conns := make([]config.Connection, len(ids))
+	for i, id := range ids {
+		host := "good"
+		if strings.HasPrefix(id, "bad") {
+			host = "bad"
+		}
+		conns[i] = config.Connection{ID: id, Host: host}
+	}
+	return conns
+}
+
+func TestPlanBatches(t *testing.T) {
+	tests := []struct {
+		n, canary, batch int
+		want             [][2]int
+	}{
+		{5, 0, 2, [][2]int{{0, 2}, {2, 4}, {4, 5}}},
+		{5, 1, 0, [][2]int{{0, 1}, {1, 5}}},
+		{5, 1, 2, [][2]int{{0, 1}, {1, 3}, {3, 5}}},
+		{2, 3, 2, [][2]int{{0, 2}}},
+		{0, 1, 2, [][2]int{{0, 0}}},
+	}
+	for _, tt := range tests {
+		if got := planBatches(tt.n, tt.canary, tt.batch); !reflect.DeepEqual(got, tt.want) && !(len(got) == 0 && tt.n == 0) {
+			t.Errorf("planBatches(%d, %d, %d) = %v, want %v", tt.n, tt.canary, tt.batch, got, tt.want)
+		}
+	}
+}
+
+func TestFailureThreshold(t *testing.T) {
+	tests := []struct {
+		in            string
+		failed, total int
+		exceeded      bool
+	}{
+		{"0", 1, 10, true},
+		{"2", 2, 10, false},
+		{"2", 3, 10, true},
+		{"10%", 1, 10, false},
+		{"10%", 2, 10, true},
+		{"25%", 1, 3, true},
+		{"0%", 1, 10, true},
+	}
+	for _, tt := range tests {
+		th, err := ParseFailureThreshold(tt.in)
+		if err != nil {
+			t.Fatalf("ParseFailureThreshold(%q) error = %v", tt.in, err)
+		}
+		if got := th.Exceeded(tt.failed, tt.total); got != tt.exceeded {
+			t.Errorf("%s: Exceeded(%d, %d) = %v", tt.in, tt.failed, tt.total, got)
+		}
+		if th.String() != tt.in && tt.in != "0%" {
+			t.Errorf("String() = %q, want %q", th.String(), tt.in)
+		}
+	}
+	for _, bad := range []string{"", "-1", "x%", "120%"} {
+		if _, err := ParseFailureThreshold(bad); err == nil {
+			t.Errorf("ParseFailureThreshold(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	conns := hosts("c1", "b1", "b2", "b3", "b4")
+	var f fakeRun
+	var events []string
+	var gated [][]string
+	opts := &ExecOptions{
+		Canary: 1,
+		Batch:  2,
+		Pause:  time.Millisecond,
+		Gate: func(ctx context.Context, batch []config.Connection) error {
+			var ids []string
+			for _, c := range batch {
+				ids = append(ids, c.ID)
+			}
+			gated = append(gated, ids)
+			return nil
+		},
+		OnBatch: func(e BatchEvent) {
+			events = append(events, fmt.Sprintf("%d:%d/%d canary=%v", e.Kind, e.Batch, e.Batches, e.Canary))
+		},
+	}
+
+	results := runBatches(context.Background(), conns, opts, f.run, newRunState(len(conns)))
+	if len(results) != 5 || HasErrors(results) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, r := range results {
+		if r.Connection.ID != conns[i].ID {
+			t.Errorf("result %d is %s, want %s", i, r.Connection.ID, conns[i].ID)
+		}
+	}
+	// Hosts of a later batch never run before an earlier batch is done.
+	if f.ran[0] != "c1" || !(contains(f.ran[1:3], "b1") && contains(f.ran[1:3], "b2")) {
+		t.Errorf("run order = %v", f.ran)
+	}
+	wantEvents := []string{
+		fmt.Sprintf("%d:1/3 canary=true", BatchStarted), fmt.Sprintf("%d:1/3 canary=true", BatchFinished),
+		fmt.Sprintf("%d:2/3 canary=false", BatchPausing), fmt.Sprintf("%d:2/3 canary=false", BatchGating),
+		fmt.Sprintf("%d:2/3 canary=false", BatchStarted), fmt.Sprintf("%d:2/3 canary=false", BatchFinished),
+		fmt.Sprintf("%d:3/3 canary=false", BatchPausing), fmt.Sprintf("%d:3/3 canary=false", BatchGating),
+		fmt.Sprintf("%d:3/3 canary=false", BatchStarted), fmt.Sprintf("%d:3/3 canary=false", BatchFinished),
+	}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("events = %v\nwant %v", events, wantEvents)
+	}
+	if !reflect.DeepEqual(gated, [][]string{{"c1"}, {"b1", "b2"}}) {
+		t.Errorf("gate saw %v", gated)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunBatches_GateStops(t *testing.T) {
+	conns := hosts("c1", "b1", "b2")
+	var f fakeRun
+	var stopped error
+	opts := &ExecOptions{
+		Canary: 1,
+		Gate: func(ctx context.Context, batch []config.Connection) error {
+			return errors.New("unreachable: c1")
+		},
+		OnBatch: func(e BatchEvent) {
+			if e.Kind == BatchStopped {
+				stopped = e.Err
+			}
+		},
+	}
+
+	results := runBatches(context.Background(), conns, opts, f.run, newRunState(len(conns)))
+	if !reflect.DeepEqual(f.ran, []string{"c1"}) {
+		t.Errorf("ran %v, want only the canary", f.ran)
+	}
+	if stopped == nil || !strings.Contains(stopped.Error(), "health gate failed: unreachable: c1") {
+		t.Errorf("stop reason = %v", stopped)
+	}
+	for _, r := range results[1:] {
+		if !r.Skipped || r.Error != stopped {
+			t.Errorf("%s: skipped=%v err=%v", r.Connection.ID, r.Skipped, r.Error)
+		}
+	}
+}
+
+func TestRunBatches_MaxFail(t *testing.T) {
+	// The first batch has 2 failures out of 6 hosts; 25% allows 1.
+	conns := hosts("bad1", "bad2", "ok1", "ok2", "ok3", "ok4")
+	var f fakeRun
+	th, _ := ParseFailureThreshold("25%")
+	results := runBatches(context.Background(), conns, &ExecOptions{Batch: 2, MaxFail: th}, f.run, newRunState(len(conns)))
+
+	if len(f.ran) != 2 {
+		t.Errorf("ran %v, want only the first batch", f.ran)
+	}
+	if n := CountErrors(results); n != 6 {
+		t.Errorf("CountErrors = %d, want 2 failed + 4 skipped", n)
+	}
+	if r := results[5]; !r.Skipped || r.Error.Error() != "2 of 6 hosts failed (max 25%)" {
+		t.Errorf("skipped host: %+v", r)
+	}
+}
+
+func TestRunParallel_MaxFailWithoutBatches(t *testing.T) {
+	// One host at a time, so the run stops right after the second failure.
+	conns := hosts("bad1", "ok1", "bad2", "ok2", "ok3")
+	var f fakeRun
+	opts := &ExecOptions{Parallel: 1, MaxFail: &FailureThreshold{Hosts: 1}}
+	results := runParallel(context.Background(), conns, opts, f.run, newRunState(len(conns)))
+
+	if got := strings.Join(f.ran, ","); got != "bad1,ok1,bad2" {
+		t.Errorf("ran %s; hosts should start in order and stop after bad2", got)
+	}
+	skippedCount := 0
+	for _, r := range results {
+		if r.Skipped {
+			skippedCount++
+		}
+	}
+	if skippedCount == 0 {
+		t.Error("expected skipped hosts")
+	}
+}
+
+func TestRunParallel_FailFastSkipsWithReason(t *testing.T) {
+	conns := hosts("bad1", "ok1", "ok2")
+	var f fakeRun
+	results := runParallel(context.Background(), conns, &ExecOptions{Parallel: 1, FailFast: true}, f.run, newRunState(len(conns)))
+	for _, r := range results[1:] {
+		if !r.Skipped || !errors.Is(r.Error, errFailFast) {
+			t.Errorf("%s: skipped=%v err=%v", r.Connection.ID, r.Skipped, r.Error)
+		}
+	}
+}
+
+func TestRunParallel_HostContext(t *testing.T) {
+	conns := hosts("ok1", "stop", "skip")
+	skipCtx, cancelSkip := context.WithCancel(context.Background())
+	cancelSkip()
+	stopCtx, cancelStop := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	var started []string
+	opts := &ExecOptions{
+		Parallel: 1,
+		HostContext: func(conn *config.Connection) context.Context {
+			switch conn.ID {
+			case "skip":
+				return skipCtx
+			case "stop":
+				return stopCtx
+			}
+			return context.Background()
+		},
+		OnStart: func(conn *config.Connection) {
+			mu.Lock()
+			started = append(started, conn.ID)
+			mu.Unlock()
+			if conn.ID == "stop" {
+				cancelStop()
+			}
+		},
+	}
+	run := func(ctx context.Context, conn *config.Connection, opts *ExecOptions) ExecResult {
+		if conn.ID == "stop" {
+			<-ctx.Done()
+			return ExecResult{Connection: conn, ExitCode: -1, Error: ctx.Err()}
+		}
+		return ExecResult{Connection: conn}
+	}
+
+	results := runParallel(context.Background(), conns, opts, run, newRunState(len(conns)))
+	if results[0].Error != nil {
+		t.Errorf("ok1: %v", results[0].Error)
+	}
+	if !errors.Is(results[1].Error, context.Canceled) || results[1].Skipped {
+		t.Errorf("stop: skipped=%v err=%v", results[1].Skipped, results[1].Error)
+	}
+	if !results[2].Skipped {
+		t.Errorf("skip: expected skipped, got err=%v", results[2].Error)
+	}
+	if strings.Join(started, ",") != "ok1,stop" {
+		t.Errorf("started = %v", started)
+	}
+}
+
+func TestRunParallel_CancelQueuedHost(t *testing.T) {
+	// A host cancelled while waiting for a slot is skipped right away, not
+	// when its turn comes.
+	conns := hosts("slow", "queued", "next")
+	queuedCtx, cancelQueued := context.WithCancel(context.Background())
+	queuedSkipped := make(chan struct{})
+
+	var mu sync.Mutex
+	var started []string
+	opts := &ExecOptions{
+		Parallel: 1,
+		HostContext: func(conn *config.Connection) context.Context {
+			if conn.ID == "queued" {
+				return queuedCtx
+			}
+			return context.Background()
+		},
+		OnStart: func(conn *config.Connection) {
+			mu.Lock()
+			started = append(started, conn.ID)
+			mu.Unlock()
+			if conn.ID == "slow" {
+				cancelQueued()
+			}
+		},
+		OnResult: func(r ExecResult) {
+			if r.Connection.ID == "queued" {
+				close(queuedSkipped)
+			}
+		},
+	}
+	run := func(ctx context.Context, conn *config.Connection, opts *ExecOptions) ExecResult {
+		if conn.ID == "slow" {
+			select {
+			case <-queuedSkipped:
+			case <-time.After(5 * time.Second):
+				return ExecResult{Connection: conn, ExitCode: -1, Error: errors.New("queued host not skipped while waiting")}
+			}
+		}
+		return ExecResult{Connection: conn}
+	}
+
+	results := runParallel(context.Background(), conns, opts, run, newRunState(len(conns)))
+	if results[0].Error != nil {
+		t.Errorf("slow: %v", results[0].Error)
+	}
+	if !results[1].Skipped || !errors.Is(results[1].Error, context.Canceled) {
+		t.Errorf("queued: skipped=%v err=%v", results[1].Skipped, results[1].Error)
+	}
+	if results[2].Error != nil || strings.Join(started, ",") != "slow,next" {
+		t.Errorf("next: err=%v, started = %v", results[2].Error, started)
+	}
+}
@@ -0,0 +1,193 @@
+package ssh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// TransferTool is the program that copies files.
+type TransferTool string
+
+const (
+	ToolSCP   TransferTool = "scp"
+	ToolRsync TransferTool = "rsync"
+)
+
+// Transfer describes a copy between the local machine and each of a set of
+// hosts.
+type Transfer struct {
+	Tool TransferTool
+	// Upload copies the local Sources to the remote Dest; otherwise the
+	// remote Sources are downloaded to the local Dest.
+	Upload  bool
+	Sources []string
+	Dest    string
+	// PerHost downloads each host's files into Dest/<id>/ so copies from
+	// several hosts don't overwrite each other.
+	PerHost bool
+	// Recursive copies directories (scp -r; rsync always recurses).
+	Recursive bool
+	// Delete removes destination files missing from the source (rsync only).
+	Delete bool
+	// Exclude holds rsync --exclude patterns.
+	Exclude []string
+	// ExtraArgs are passed to scp or rsync ahead of the paths.
+	ExtraArgs []string
+}
+
+// LocalDest returns where a download from conn is written.
+func (t *Transfer) LocalDest(conn *config.Connection) string {
+	if t.PerHost {
+		return filepath.Join(t.Dest, hostDirName(conn.ID)) + string(filepath.Separator)
+	}
+	return t.Dest
+}
+
+// hostDirName turns a connection ID into a single path element.
+func hostDirName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, id)
+	if name == "" || name == "." || name == ".." {
+		return "_" + name
+	}
+	return name
+}
+
+// BuildTransferCommand returns the binary and argv that copy t's files to or
+// from conn. The connection flags are the ones BuildCommand uses, and "--"
+// ends option parsing so no path can be read as a flag.
+func BuildTransferCommand(conn *config.Connection, t *Transfer) (string, []string) {
+	var args []string
+	binary := string(t.Tool)
+	switch t.Tool {
+	case ToolRsync:
+		args = append(args, "-az")
+		if t.Delete {
+			args = append(args, "--delete")
+		}
+		for _, pattern := range t.Exclude {
+			args = append(args, "--exclude="+pattern)
+		}
+		args = append(args, "-e", rsyncShell(conn))
+	default:
+		binary = string(ToolSCP)
+		if t.Recursive {
+			args = append(args, "-r")
+		}
+		args = append(args, connectionArgs(conn, "-P")...)
+	}
+	args = append(args, t.ExtraArgs...)
+	args = append(args, "--")
+
+	if t.Upload {
+		for _, src := range t.Sources {
+			args = append(args, localPath(src))
+		}
+		return binary, append(args, remotePath(conn, t.Dest))
+	}
+	for _, src := range t.Sources {
+		args = append(args, remotePath(conn, src))
+	}
+	return binary, append(args, localPath(t.LocalDest(conn)))
+}
+
+// BuildTransferCommandString is BuildTransferCommand as a shell-quoted
+// command line, for --dry-run.
+func BuildTransferCommandString(conn *config.Connection, t *Transfer) string {
+	binary, args := BuildTransferCommand(conn, t)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = posixQuote(arg)
+	}
+	return binary + " " + strings.Join(quoted, " ")
+}
+
+// rsyncShell is the -e command rsync uses to reach conn. rsync splits it on
+// spaces and honours quotes, so arguments are quoted the same way as for a
+// POSIX shell.
+func rsyncShell(conn *config.Connection) string {
+	parts := []string{"ssh"}
+	for _, arg := range connectionArgs(conn, "-p") {
+		parts = append(parts, posixQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// remotePath returns the "user@host:path" operand for conn. IPv6 addresses
+// are bracketed so their colons aren't taken as the path separator.
+func remotePath(conn *config.Connection, path string) string {
+	host := conn.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if user := conn.EffectiveUser(); user != "" {
+		host = user + "@" + host
+	}
+	return host + ":" + path
+}
+
+// localPath keeps a local path from being read as host:path by scp and
+// rsync, which treat any colon before the first slash as a host separator.
+func localPath(path string) string {
+	if IsRemotePath(path) {
+		return "." + string(filepath.Separator) + path
+	}
+	return path
+}
+
+// IsRemotePath reports whether scp would read path as host:path: it has a
+// colon before any slash.
+func IsRemotePath(path string) bool {
+	colon := strings.Index(path, ":")
+	if colon <= 0 {
+		return false
+	}
+	slash := strings.Index(path, "/")
+	return slash < 0 || colon < slash
+}
+
+// SplitRemotePath splits "target:path" at the first colon.
+func SplitRemotePath(arg string) (target, path string, ok bool) {
+	if !IsRemotePath(arg) {
+		return "", "", false
+	}
+	target, path, _ = strings.Cut(arg, ":")
+	return target, path, true
+}
+
+// TransferContext runs t against every connection in parallel, with the
+// same limits, fail-fast and cancellation as ExecuteContext.
+func TransferContext(ctx context.Context, connections []config.Connection, t *Transfer, opts *ExecOptions) []ExecResult {
+	if opts == nil {
+		opts = &ExecOptions{}
+	}
+	return runParallel(ctx, connections, opts, func(ctx context.Context, conn *config.Connection, opts *ExecOptions) ExecResult {
+		start := time.Now()
+		fail := func(err error) ExecResult {
+			return ExecResult{Connection: conn, Error: err, ExitCode: -1, Duration: time.Since(start)}
+		}
+
+		// Same guard as executeOnHost: the host ends up in a "user@host:path"
+		// operand, which must never be parsed as an option.
+		if err := conn.CheckSafety(); err != nil {
+			return fail(err)
+		}
+		if !t.Upload && t.PerHost {
+			if err := os.MkdirAll(t.LocalDest(conn), 0755); err != nil {
+				return fail(err)
+			}
+		}
+
+		binary, args := BuildTransferCommand(conn, t)
+		return runLocal(ctx, conn, opts, binary, args)
+	}, newRunState(len(connections)))
+}
@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestBuildTransferCommand(t *testing.T) {
+	conn := &config.Connection{
+		ID:           "web1",
+		Host:         "web1.example.com",
+		User:         "deploy",
+		Port:         2222,
+		IdentityFile: "/keys/deploy",
+		ProxyJump:    "bastion",
+	}
+
+	tests := []struct {
+		name       string
+		conn       *config.Connection
+		transfer   Transfer
+		wantBinary string
+		wantArgs   []string
+	}{
+		{
+			name:       "scp upload",
+			conn:       conn,
+			transfer:   Transfer{Tool: ToolSCP, Upload: true, Recursive: true, Sources: []string{"dist", "-evil"}, Dest: "/srv/app/"},
+			wantBinary: "scp",
+			wantArgs:   []string{"-r", "-P", "2222", "-i", "/keys/deploy", "-J", "bastion", "--", "dist", "-evil", "deploy@web1.example.com:/srv/app/"},
+		},
+		{
+			name:       "scp download per host",
+			conn:       conn,
+			transfer:   Transfer{Tool: ToolSCP, Sources: []string{"/var/log/app.log"}, Dest: "logs", PerHost: true},
+			wantBinary: "scp",
+			wantArgs:   []string{"-P", "2222", "-i", "/keys/deploy", "-J", "bastion", "--", "deploy@web1.example.com:/var/log/app.log", "logs/web1/"},
+		},
+		{
+			name:       "local path with a colon",
+			conn:       &config.Connection{ID: "a", Host: "a.example.com"},
+			transfer:   Transfer{Tool: ToolSCP, Upload: true, Sources: []string{"report:2024.txt"}, Dest: "/tmp/"},
+			wantBinary: "scp",
+			wantArgs:   []string{"--", "./report:2024.txt", "a.example.com:/tmp/"},
+		},
+		{
+			name:       "ipv6 host",
+			conn:       &config.Connection{ID: "v6", Host: "fe80::1", User: "root"},
+			transfer:   Transfer{Tool: ToolSCP, Sources: []string{"/etc/hosts"}, Dest: "."},
+			wantBinary: "scp",
+			wantArgs:   []string{"--", "root@[fe80::1]:/etc/hosts", "."},
+		},
+		{
+			name:       "rsync upload",
+			conn:       conn,
+			transfer:   Transfer{Tool: ToolRsync, Upload: true, Delete: true, Exclude: []string{".git"}, ExtraArgs: []string{"--checksum"}, Sources: []string{"site/"}, Dest: "/var/www/"},
+			wantBinary: "rsync",
+			wantArgs:   []string{"-az", "--delete", "--exclude=.git", "-e", "ssh -p 2222 -i /keys/deploy -J bastion", "--checksum", "--", "site/", "deploy@web1.example.com:/var/www/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, args := BuildTransferCommand(tt.conn, &tt.transfer)
+			if binary != tt.wantBinary || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got %s %q\nwant %s %q", binary, args, tt.wantBinary, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestRsyncShellQuoting(t *testing.T) {
+	conn := &config.Connection{ID: "a", Host: "a", IdentityFile: "/my keys/id"}
+	if got := rsyncShell(conn); got != "ssh -i '/my keys/id'" {
+		t.Errorf("rsyncShell = %q", got)
+	}
+}
+
+func TestSplitRemotePath(t *testing.T) {
+	tests := []struct {
+		arg, target, path string
+		ok                bool
+	}{
+		{"web:/etc/hosts", "web", "/etc/hosts", true},
+		{"web*:logs/", "web*", "logs/", true},
+		{"web:", "web", "", true},
+		{"./web:x", "", "", false},
+		{"/abs/a:b", "", "", false},
+		{":path", "", "", false},
+		{"plain", "", "", false},
+	}
+	for _, tt := range tests {
+		target, path, ok := SplitRemotePath(tt.arg)
+		if target != tt.target || path != tt.path || ok != tt.ok {
+			t.Errorf("SplitRemotePath(%q) = %q, %q, %v", tt.arg, target, path, ok)
+		}
+	}
+}
+
+func TestTransferContext_RefusesUnsafeHost(t *testing.T) {
+	conns := []config.Connection{{ID: "evil", Host: "-oProxyCommand=touch /tmp/pwned"}}
+	results := TransferContext(t.Context(), conns, &Transfer{Tool: ToolSCP, Upload: true, Sources: []string{"x"}, Dest: "/tmp"}, nil)
+	if results[0].Error == nil || !strings.Contains(results[0].Error.Error(), "must not start with '-'") {
+		t.Errorf("err = %v, want CheckSafety rejection", results[0].Error)
+	}
+}
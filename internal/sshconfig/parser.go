@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -11,19 +12,59 @@ import (
 	"github.com/danmartuszewski/hop/internal/config"
 )
 
-// ParsedHost represents a parsed SSH config host entry
+// ParsedHost represents a host from an SSH config, with every setting that
+// applies to it resolved the way ssh does.
 type ParsedHost struct {
 	Alias        string
 	HostName     string
 	User         string
 	Port         int
 	IdentityFile string
-	ProxyJump    string
-	ForwardAgent bool
-	Options      map[string]string
+	// IdentityFiles lists every IdentityFile that applies, in the order ssh
+	// tries them. IdentityFile is the first.
+	IdentityFiles []string
+	ProxyJump     string
+	ForwardAgent  bool
+	Options       map[string]string
 }
 
-// Parse reads an SSH config file and returns a list of parsed hosts
+// block is a Host or Match section of an SSH config, or the settings
+// before the first one, which apply to every host.
+type block struct {
+	patterns []string    // Host patterns
+	criteria []criterion // Match criteria
+	isMatch  bool
+	settings []setting
+}
+
+type criterion struct {
+	name   string
+	negate bool
+	arg    string
+}
+
+type setting struct {
+	keyword string // lower case
+	args    []string
+	raw     string // the rest of the line, for commands
+}
+
+// rawKeywords take the rest of the line as one command rather than as
+// arguments.
+var rawKeywords = map[string]bool{
+	"proxycommand":      true,
+	"remotecommand":     true,
+	"localcommand":      true,
+	"knownhostscommand": true,
+}
+
+// Parse reads an SSH config file and returns its hosts: one for every name
+// on a Host line that isn't a pattern, with the settings ssh would use for
+// it. Like ssh, the first value found for a setting wins, so settings from
+// later blocks such as "Host *" only fill in what is still unset. Wildcard
+// and negated Host patterns and Match blocks with host, originalhost, user,
+// localuser and all criteria are applied; Match blocks with other criteria
+// (exec, canonical, ...) are skipped.
 func Parse(path string) ([]ParsedHost, error) {
 	if path == "" {
 		home, err := os.UserHomeDir()
@@ -33,147 +74,421 @@ func Parse(path string) ([]ParsedHost, error) {
 		path = filepath.Join(home, ".ssh", "config")
 	}
 
-	return parseFile(path, make(map[string]bool))
+	// Relative Include paths are resolved against the directory of the
+	// config ssh was given, for included files too.
+	r := &reader{baseDir: filepath.Dir(path), visited: make(map[string]bool)}
+	r.blocks = []*block{{}}
+	if err := r.readFile(path); err != nil {
+		return nil, err
+	}
+
+	var hosts []ParsedHost
+	for _, alias := range r.aliases() {
+		hosts = append(hosts, r.evaluate(alias))
+	}
+	return hosts, nil
+}
+
+type reader struct {
+	baseDir string
+	visited map[string]bool
+	blocks  []*block
 }
 
-// parseFile parses a single SSH config file, tracking visited files to avoid cycles
-func parseFile(path string, visited map[string]bool) ([]ParsedHost, error) {
+// readFile adds the blocks of the config file at path, tracking visited
+// files to avoid include cycles. Settings before the file's first Host or
+// Match line belong to the block that included it.
+func (r *reader) readFile(path string) error {
 	// Resolve to absolute path for cycle detection
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if visited[absPath] {
-		return nil, nil // Already processed this file
+	if r.visited[absPath] {
+		return nil // Already processed this file
 	}
-	visited[absPath] = true
+	r.visited[absPath] = true
 
 	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return nil
 		}
-		return nil, err
+		return err
 	}
 	defer file.Close()
 
-	var hosts []ParsedHost
-	var current *ParsedHost
-	baseDir := filepath.Dir(path)
-
+	var managed *block // the block the hop section interrupted, while in it
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
+		// Skip the section hop sshconfig sync writes: its hosts come from
+		// hop already.
+		if line == BeginMarker && managed == nil {
+			managed = r.blocks[len(r.blocks)-1]
+			r.blocks = append(r.blocks, &block{isMatch: true, criteria: []criterion{{name: "never"}}})
+			continue
+		}
+		if managed != nil {
+			if line == EndMarker {
+				r.resume(managed)
+				managed = nil
+			}
+			continue
+		}
+
 		// Skip empty lines and comments
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
-		// Split into keyword and argument
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
-			// Try with = separator
-			parts = strings.SplitN(line, "=", 2)
+		keyword, rest := splitKeyword(line)
+		args, err := splitArgs(rest)
+		if err != nil || keyword == "" || len(args) == 0 {
+			continue // ssh rejects these lines; ignore them
 		}
-		if len(parts) < 2 {
-			continue
+
+		switch keyword {
+		case "include":
+			current := r.blocks[len(r.blocks)-1]
+			for _, pattern := range args {
+				r.include(pattern)
+			}
+			r.resume(current)
+		case "host":
+			r.blocks = append(r.blocks, &block{patterns: args})
+		case "match":
+			r.blocks = append(r.blocks, &block{isMatch: true, criteria: parseCriteria(args)})
+		default:
+			current := r.blocks[len(r.blocks)-1]
+			current.settings = append(current.settings, setting{keyword: keyword, args: args, raw: rest})
 		}
+	}
+
+	return scanner.Err()
+}
 
-		keyword := strings.ToLower(strings.TrimSpace(parts[0]))
-		argument := strings.TrimSpace(parts[1])
+// resume makes b current again after an Include or the hop section added
+// blocks after it: like ssh, the lines that follow belong to the including
+// file's Host or Match, so they go in a copy of it placed after those
+// blocks.
+func (r *reader) resume(b *block) {
+	if r.blocks[len(r.blocks)-1] == b {
+		return
+	}
+	r.blocks = append(r.blocks, &block{patterns: b.patterns, criteria: b.criteria, isMatch: b.isMatch})
+}
 
-		// Handle Include directive
-		if keyword == "include" {
-			includedHosts, err := handleInclude(argument, baseDir, visited)
-			if err != nil {
-				// Ignore include errors, continue parsing
+// include reads the files matching an Include pattern. Errors in included
+// files are ignored.
+func (r *reader) include(pattern string) {
+	// Expand ~ in pattern
+	pattern = expandPath(pattern)
+
+	// If pattern is relative, make it relative to the config's directory
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(r.baseDir, pattern)
+	}
+
+	// Expand glob patterns
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		_ = r.readFile(match)
+	}
+}
+
+// aliases returns the names on Host lines that aren't patterns, in the
+// order they first appear.
+func (r *reader) aliases() []string {
+	seen := make(map[string]bool)
+	var aliases []string
+	for _, b := range r.blocks {
+		for _, p := range b.patterns {
+			if strings.HasPrefix(p, "!") || isWildcard(p) || seen[p] {
 				continue
 			}
-			hosts = append(hosts, includedHosts...)
+			seen[p] = true
+			aliases = append(aliases, p)
+		}
+	}
+	return aliases
+}
+
+// evaluate resolves the settings for alias, first value wins.
+func (r *reader) evaluate(alias string) ParsedHost {
+	h := ParsedHost{Alias: alias, Options: make(map[string]string)}
+	set := make(map[string]bool)
+	for _, b := range r.blocks {
+		if !b.applies(alias, &h) {
 			continue
 		}
+		for _, s := range b.settings {
+			h.apply(s, set)
+		}
+	}
+	return h
+}
 
-		// Handle Host directive
-		if keyword == "host" {
-			// Save previous host if exists
-			if current != nil && !isWildcard(current.Alias) {
-				hosts = append(hosts, *current)
+func (b *block) applies(alias string, h *ParsedHost) bool {
+	if !b.isMatch {
+		return b.patterns == nil || matchPatterns(alias, b.patterns)
+	}
+	for _, c := range b.criteria {
+		var ok bool
+		switch c.name {
+		case "all":
+			ok = true
+		case "host":
+			// The host name as resolved so far, like ssh's first pass.
+			host := h.HostName
+			if host == "" {
+				host = alias
+			}
+			ok = matchPatterns(host, strings.Split(c.arg, ","))
+		case "originalhost":
+			ok = matchPatterns(alias, strings.Split(c.arg, ","))
+		case "user":
+			remoteUser := h.User
+			if remoteUser == "" {
+				remoteUser = localUser()
 			}
+			ok = matchPatterns(remoteUser, strings.Split(c.arg, ","))
+		case "localuser":
+			ok = matchPatterns(localUser(), strings.Split(c.arg, ","))
+		default:
+			return false
+		}
+		if ok == c.negate {
+			return false
+		}
+	}
+	return true
+}
 
-			current = &ParsedHost{
-				Alias:   argument,
-				Options: make(map[string]string),
+// apply records s unless an earlier block already set its keyword.
+// IdentityFile accumulates instead, as in ssh.
+func (h *ParsedHost) apply(s setting, set map[string]bool) {
+	if s.keyword == "identityfile" {
+		for _, f := range s.args {
+			f = expandPath(f)
+			if !containsString(h.IdentityFiles, f) {
+				h.IdentityFiles = append(h.IdentityFiles, f)
 			}
-			continue
 		}
+		if len(h.IdentityFiles) > 0 {
+			h.IdentityFile = h.IdentityFiles[0]
+		}
+		return
+	}
 
-		// Skip if we're not in a Host block
-		if current == nil {
-			continue
+	if set[s.keyword] {
+		return
+	}
+	set[s.keyword] = true
+
+	argument := strings.Join(s.args, " ")
+	switch s.keyword {
+	case "hostname":
+		h.HostName = expandHostTokens(argument, h.Alias)
+	case "user":
+		h.User = argument
+	case "port":
+		if port, err := strconv.Atoi(argument); err == nil {
+			h.Port = port
+		}
+	case "proxyjump":
+		if !strings.EqualFold(argument, "none") {
+			h.ProxyJump = argument
 		}
+	case "forwardagent":
+		h.ForwardAgent = strings.ToLower(argument) == "yes"
+	default:
+		// Store other options
+		if rawKeywords[s.keyword] {
+			argument = s.raw
+		}
+		h.Options[s.keyword] = argument
+	}
+}
 
-		// Parse directives within Host block
-		switch keyword {
-		case "hostname":
-			current.HostName = argument
-		case "user":
-			current.User = argument
-		case "port":
-			if port, err := strconv.Atoi(argument); err == nil {
-				current.Port = port
-			}
-		case "identityfile":
-			current.IdentityFile = expandPath(argument)
-		case "proxyjump":
-			current.ProxyJump = argument
-		case "forwardagent":
-			current.ForwardAgent = strings.ToLower(argument) == "yes"
+// parseCriteria parses the arguments of a Match line. Criteria other than
+// all take an argument; a leading "!" negates one.
+func parseCriteria(args []string) []criterion {
+	var criteria []criterion
+	for i := 0; i < len(args); i++ {
+		c := criterion{name: strings.ToLower(args[i])}
+		if strings.HasPrefix(c.name, "!") {
+			c.negate = true
+			c.name = c.name[1:]
+		}
+		switch c.name {
+		case "all", "canonical", "final":
 		default:
-			// Store other options
-			current.Options[keyword] = argument
+			if i+1 < len(args) {
+				i++
+				c.arg = args[i]
+			}
 		}
+		criteria = append(criteria, c)
 	}
+	return criteria
+}
 
-	// Don't forget the last host
-	if current != nil && !isWildcard(current.Alias) {
-		hosts = append(hosts, *current)
+// matchPatterns reports whether name matches a list of ssh patterns: at
+// least one pattern must match and no negated ("!") one may. Matching is
+// case-insensitive.
+func matchPatterns(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	found := false
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		negate := strings.HasPrefix(p, "!")
+		if negate {
+			p = p[1:]
+		}
+		if matchWildcard(name, p) {
+			if negate {
+				return false
+			}
+			found = true
+		}
 	}
+	return found
+}
 
-	if err := scanner.Err(); err != nil {
-		return hosts, err
+// matchWildcard matches name against a pattern where "*" matches any run
+// of characters and "?" any one character.
+func matchWildcard(name, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchWildcard(name[i:], pattern) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		default:
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+		}
+		name, pattern = name[1:], pattern[1:]
 	}
+	return name == ""
+}
 
-	return hosts, nil
+// splitKeyword splits a config line into its lower-cased keyword and the
+// rest, which may be separated by whitespace and/or one "=".
+func splitKeyword(line string) (string, string) {
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), ""
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+	return keyword, strings.TrimSpace(rest)
 }
 
-// handleInclude processes Include directives
-func handleInclude(pattern string, baseDir string, visited map[string]bool) ([]ParsedHost, error) {
-	// Expand ~ in pattern
-	pattern = expandPath(pattern)
+// splitArgs splits the arguments of a config line like ssh: on whitespace,
+// keeping double- or single-quoted runs together and honouring backslash
+// escapes of quotes and backslashes. An unquoted "#" starts a comment.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(`"'\`, s[i+1]) >= 0:
+			i++
+			cur.WriteByte(s[i])
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case c == '#' && !inArg:
+			return args, nil
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
 
-	// If pattern is relative, make it relative to the config file's directory
-	if !filepath.IsAbs(pattern) {
-		pattern = filepath.Join(baseDir, pattern)
+// expandHostTokens expands the %h (the alias) and %% tokens ssh allows in
+// HostName.
+func expandHostTokens(s, alias string) string {
+	if !strings.Contains(s, "%") {
+		return s
 	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'h':
+				b.WriteString(alias)
+				i++
+				continue
+			case '%':
+				b.WriteByte('%')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
 
-	// Expand glob patterns
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return nil, err
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
 	}
+	return os.Getenv("USER")
+}
 
-	var allHosts []ParsedHost
-	for _, match := range matches {
-		hosts, err := parseFile(match, visited)
-		if err != nil {
-			continue // Ignore errors in included files
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
-		allHosts = append(allHosts, hosts...)
 	}
-
-	return allHosts, nil
+	return false
 }
 
 // isWildcard returns true if the host pattern contains wildcards
@@ -3,6 +3,7 @@ package sshconfig
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -210,6 +211,61 @@ Host main-server
 	}
 }
 
+func TestParse_SettingsAfterInclude(t *testing.T) {
+	dir := t.TempDir()
+	includedPath := filepath.Join(dir, "config.d", "work.conf")
+	if err := os.MkdirAll(filepath.Dir(includedPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	included := `
+Host work
+    HostName work.example.com
+`
+	if err := os.WriteFile(includedPath, []byte(included), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The settings after the Include and after the hop section are global,
+	// not part of the last Host block before them.
+	mainConfig := `
+Include config.d/*.conf
+User globaluser
+ServerAliveInterval 60
+
+Host db
+    HostName db.example.com
+Host home
+    HostName home.example.com
+# BEGIN hop
+Host managed
+    HostName managed.example.com
+# END hop
+    Port 2200
+`
+	mainPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(mainPath, []byte(mainConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := Parse(mainPath)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	byAlias := make(map[string]ParsedHost)
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	for _, alias := range []string{"work", "db", "home"} {
+		h := byAlias[alias]
+		if h.User != "globaluser" || h.Options["serveraliveinterval"] != "60" {
+			t.Errorf("%s: User = %q, ServerAliveInterval = %q, want the top-level settings", alias, h.User, h.Options["serveraliveinterval"])
+		}
+	}
+	if byAlias["home"].Port != 2200 || byAlias["db"].Port != 0 || byAlias["work"].Port != 0 {
+		t.Errorf("ports = %d, %d, %d, want 2200 for home only", byAlias["home"].Port, byAlias["db"].Port, byAlias["work"].Port)
+	}
+}
+
 func TestParse_NonexistentFile(t *testing.T) {
 	hosts, err := Parse("/nonexistent/path/config")
 	if err != nil {
@@ -376,3 +432,225 @@ func TestResolveConflict(t *testing.T) {
 		})
 	}
 }
+
+func TestParse_SkipsManagedSection(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+
+	content := `Host before
+    HostName before.example.com
+# BEGIN hop
+Host web
+    HostName web.example.com
+# END hop
+
+Host after
+    HostName after.example.com
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := Parse(configPath)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].Alias != "before" || hosts[1].Alias != "after" {
+		t.Fatalf("hosts = %+v, want before and after only", hosts)
+	}
+	if hosts[0].HostName != "before.example.com" {
+		t.Errorf("hosts[0].HostName = %q", hosts[0].HostName)
+	}
+}
+
+func parseString(t *testing.T, content string) map[string]ParsedHost {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := Parse(configPath)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	byAlias := make(map[string]ParsedHost)
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	return byAlias
+}
+
+func TestParse_MultiPatternHost(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	content := `
+Host web1 web2 !web3 *.corp
+    User deploy
+Host web2
+    User other
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := Parse(configPath)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(hosts) != 2 || hosts[0].Alias != "web1" || hosts[1].Alias != "web2" {
+		t.Fatalf("hosts = %+v, want web1 and web2", hosts)
+	}
+	// The first value wins, so web2 keeps the user of the first block.
+	if hosts[0].User != "deploy" || hosts[1].User != "deploy" {
+		t.Errorf("users = %q, %q, want deploy", hosts[0].User, hosts[1].User)
+	}
+}
+
+func TestParse_WildcardInheritance(t *testing.T) {
+	hosts := parseString(t, `
+ServerAliveInterval 15
+
+Host db1.corp
+    User dba
+
+Host db2.corp
+    HostName %h.internal
+    ProxyJump none
+
+Host app
+    HostName app.example.com
+
+Host *.corp !db2.corp
+    ProxyJump bastion
+
+Host *.corp
+    User corp
+    Port 2222
+    ProxyJump gateway
+    ServerAliveInterval 60
+`)
+	db1 := hosts["db1.corp"]
+	if db1.User != "dba" || db1.Port != 2222 || db1.ProxyJump != "bastion" {
+		t.Errorf("db1 = %+v", db1)
+	}
+	if db1.Options["serveraliveinterval"] != "15" {
+		t.Errorf("global setting should win over Host *.corp, got %q", db1.Options["serveraliveinterval"])
+	}
+
+	db2 := hosts["db2.corp"]
+	if db2.HostName != "db2.corp.internal" || db2.User != "corp" || db2.ProxyJump != "" {
+		t.Errorf("db2 = %+v", db2)
+	}
+
+	app := hosts["app"]
+	if app.User != "" || app.Port != 0 || app.ProxyJump != "" {
+		t.Errorf("*.corp settings leaked into app: %+v", app)
+	}
+}
+
+func TestParse_Match(t *testing.T) {
+	hosts := parseString(t, `
+Host web
+    HostName web.example.com
+    User deploy
+
+Host db
+    HostName db.internal
+
+Match host *.example.com user deploy
+    Port 2200
+
+Match originalhost db
+    User postgres
+
+Match !host *.example.com
+    ForwardAgent yes
+
+Match exec "test -f /nonexistent"
+    Port 9999
+
+Match all
+    Compression yes
+`)
+	web, db := hosts["web"], hosts["db"]
+	if web.Port != 2200 || web.ForwardAgent {
+		t.Errorf("web = %+v", web)
+	}
+	if db.User != "postgres" || db.Port != 0 || !db.ForwardAgent {
+		t.Errorf("db = %+v", db)
+	}
+	if web.Options["compression"] != "yes" || db.Options["compression"] != "yes" {
+		t.Error("Match all should apply to every host")
+	}
+}
+
+func TestParse_QuotesAndIdentityFiles(t *testing.T) {
+	hosts := parseString(t, `
+Host "my host" plain
+    IdentityFile "/keys/my key"
+    IdentityFile /keys/second # trailing comment
+    ProxyCommand ssh -W "%h:%p" bastion
+
+Host *
+    IdentityFile /keys/default
+    IdentityFile /keys/second
+`)
+	h, ok := hosts["my host"]
+	if !ok {
+		t.Fatalf("expected a host named %q, got %v", "my host", hosts)
+	}
+	want := []string{"/keys/my key", "/keys/second", "/keys/default"}
+	if strings.Join(h.IdentityFiles, "|") != strings.Join(want, "|") {
+		t.Errorf("IdentityFiles = %q, want %q", h.IdentityFiles, want)
+	}
+	if h.IdentityFile != "/keys/my key" {
+		t.Errorf("IdentityFile = %q", h.IdentityFile)
+	}
+	if got := h.Options["proxycommand"]; got != `ssh -W "%h:%p" bastion` {
+		t.Errorf("ProxyCommand = %q, want the line as written", got)
+	}
+	if _, ok := hosts["plain"]; !ok {
+		t.Error("expected plain as a separate host")
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"a b\tc", []string{"a", "b", "c"}},
+		{`"a b" 'c d'`, []string{"a b", "c d"}},
+		{`a\"b`, []string{`a"b`}},
+		{`x # comment`, []string{"x"}},
+		{`""`, []string{""}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil || strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitArgs(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := splitArgs(`"open`); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"web1.corp", []string{"*.corp"}, true},
+		{"WEB1.corp", []string{"web?.CORP"}, true},
+		{"web10.corp", []string{"web?.corp"}, false},
+		{"db.corp", []string{"*.corp", "!db.*"}, false},
+		{"db.corp", []string{"!web*"}, false},
+		{"a", []string{"*"}, true},
+	}
+	for _, tt := range tests {
+		if got := matchPatterns(tt.name, tt.patterns); got != tt.want {
+			t.Errorf("matchPatterns(%q, %q) = %v, want %v", tt.name, tt.patterns, got, tt.want)
+		}
+	}
+}
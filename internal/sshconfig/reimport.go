@@ -0,0 +1,330 @@
+package sshconfig
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+// FieldChange is one value an SSH config host would change on the hop
+// connection it matches.
+type FieldChange struct {
+	// Field is the connection's YAML key ("port", "proxy_jump", ...), or
+	// "options.<keyword>" for an ssh option.
+	Field string
+	Old   string
+	New   string
+	// Accept marks the change to be applied; PlanImport accepts every one.
+	Accept bool
+}
+
+// HostChange is an SSH config host that is new to hop, a connection the
+// host would update, or a managed connection whose host is gone.
+type HostChange struct {
+	// Alias is the SSH config host.
+	Alias string
+	// ID is the hop connection: the existing one, or for a new host the ID
+	// it would be added under.
+	ID string
+	// Connection is the host as a connection for new hosts, and the
+	// existing connection otherwise.
+	Connection config.Connection
+	// Fields lists the differences for a changed connection.
+	Fields []FieldChange
+	// Accept marks a new host to be added or a removed one to be deleted.
+	Accept bool
+}
+
+// SkippedHost is an SSH config host left out of an import.
+type SkippedHost struct {
+	Alias string
+	Err   error
+}
+
+// ImportPlan is what re-importing an SSH config would do to hop's
+// connections. See PlanImport.
+type ImportPlan struct {
+	New     []HostChange
+	Changed []HostChange
+	Removed []HostChange
+	Skipped []SkippedHost
+	// Matched maps the ID of every connection that matched a host, changed
+	// or not, to the host's alias.
+	Matched map[string]string
+}
+
+// Empty reports whether the plan has nothing to add, update or remove.
+func (p *ImportPlan) Empty() bool {
+	return len(p.New) == 0 && len(p.Changed) == 0 && len(p.Removed) == 0
+}
+
+// Accepted reports whether any change in the plan is accepted.
+func (p *ImportPlan) Accepted() bool {
+	for _, changes := range [][]HostChange{p.New, p.Removed} {
+		for _, ch := range changes {
+			if ch.Accept {
+				return true
+			}
+		}
+	}
+	for _, ch := range p.Changed {
+		for _, f := range ch.Fields {
+			if f.Accept {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ImportResult counts what ImportPlan.Apply did.
+type ImportResult struct {
+	Added   int
+	Updated int
+	Removed int
+	Marked  int
+}
+
+// PlanImport compares hosts parsed from an SSH config with the existing
+// connections. A host matches the connection managed by it (ssh_config_host),
+// else an unmanaged connection with the alias as its ID, else an unmanaged
+// connection with the same host, user and port. Hosts without a match are
+// new; managed connections whose host no longer exists are removed.
+//
+// Only values the SSH config sets are compared, so a connection keeps what
+// it has on top of them (or inherits from templates and defaults).
+func PlanImport(existing []config.Connection, hosts []ParsedHost) ImportPlan {
+	plan := ImportPlan{Matched: make(map[string]string)}
+
+	taken := make(map[string]bool)
+	matched := make([]bool, len(existing))
+	for j, conn := range existing {
+		taken[conn.ID] = true
+		// Inventory connections can't be updated or removed; treating them
+		// as matched keeps them out of the plan.
+		matched[j] = conn.ReadOnly()
+	}
+	aliases := make(map[string]bool)
+
+	for i := range hosts {
+		h := &hosts[i]
+		aliases[h.Alias] = true
+
+		in := h.ToConnection()
+		// An SSH config (or an Include'd file) is an untrusted source; see
+		// Connection.CheckSafety.
+		if err := in.CheckSafety(); err != nil {
+			plan.Skipped = append(plan.Skipped, SkippedHost{Alias: h.Alias, Err: err})
+			continue
+		}
+
+		j := matchConnection(existing, matched, h.Alias, &in)
+		if j < 0 {
+			if taken[in.ID] {
+				in.ID = ResolveConflict(in.ID, taken)
+			}
+			taken[in.ID] = true
+			in.SSHConfigHost = h.Alias
+			plan.New = append(plan.New, HostChange{Alias: h.Alias, ID: in.ID, Connection: in, Accept: true})
+			continue
+		}
+
+		matched[j] = true
+		cur := existing[j]
+		plan.Matched[cur.ID] = h.Alias
+		fields := diffConnection(&cur, &in)
+		if cur.SSHConfigHost != "" && cur.SSHConfigHost != h.Alias {
+			fields = append(fields, FieldChange{Field: "ssh_config_host", Old: cur.SSHConfigHost, New: h.Alias, Accept: true})
+		}
+		if len(fields) > 0 {
+			plan.Changed = append(plan.Changed, HostChange{Alias: h.Alias, ID: cur.ID, Connection: cur, Fields: fields})
+		}
+	}
+
+	for j, cur := range existing {
+		if !matched[j] && cur.SSHConfigHost != "" && !aliases[cur.SSHConfigHost] {
+			plan.Removed = append(plan.Removed, HostChange{Alias: cur.SSHConfigHost, ID: cur.ID, Connection: cur})
+		}
+	}
+	return plan
+}
+
+// matchConnection returns the index of the connection the host matches, or
+// -1. Connections managed by another host never match.
+func matchConnection(existing []config.Connection, matched []bool, alias string, in *config.Connection) int {
+	free := func(j int) bool {
+		return !matched[j] && (existing[j].SSHConfigHost == "" || existing[j].SSHConfigHost == alias)
+	}
+	for j := range existing {
+		if !matched[j] && existing[j].SSHConfigHost == alias {
+			return j
+		}
+	}
+	for j := range existing {
+		if free(j) && existing[j].ID == alias {
+			return j
+		}
+	}
+	for j := range existing {
+		cur := &existing[j]
+		if free(j) && cur.Host == in.Host && (in.User == "" || cur.User == in.User) &&
+			portOrDefault(cur.Port) == portOrDefault(in.Port) {
+			return j
+		}
+	}
+	return -1
+}
+
+// diffConnection lists the values in that differ from cur's. Values the SSH
+// config leaves unset are not compared.
+func diffConnection(cur, in *config.Connection) []FieldChange {
+	var fields []FieldChange
+	add := func(field, old, new string) {
+		if old != new {
+			fields = append(fields, FieldChange{Field: field, Old: old, New: new, Accept: true})
+		}
+	}
+
+	add("host", cur.Host, in.Host)
+	if in.User != "" {
+		add("user", cur.User, in.User)
+	}
+	if in.Port != 0 && portOrDefault(cur.Port) != in.Port {
+		add("port", strconv.Itoa(portOrDefault(cur.Port)), strconv.Itoa(in.Port))
+	}
+	if in.IdentityFile != "" {
+		add("identity_file", cur.IdentityFile, in.IdentityFile)
+	}
+	if in.ProxyJump != "" {
+		add("proxy_jump", cur.ProxyJump, in.ProxyJump)
+	}
+	if in.ForwardAgent && !cur.ForwardAgent {
+		add("forward_agent", "false", "true")
+	}
+
+	keys := make([]string, 0, len(in.Options))
+	for k := range in.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		old := ""
+		if ck, ok := optionKey(cur.Options, k); ok {
+			old = cur.Options[ck]
+		}
+		add("options."+k, old, in.Options[k])
+	}
+	return fields
+}
+
+// Apply makes the accepted changes in c: it adds accepted new hosts, sets
+// accepted fields and deletes accepted removals. With manage, every matched
+// connection is also marked as managed by its host, so later imports update
+// it and can remove it. IDs of new hosts are re-checked against c, which may
+// have changed since the plan was made.
+func (p *ImportPlan) Apply(c *config.Config, manage bool) ImportResult {
+	var res ImportResult
+
+	taken := make(map[string]bool)
+	for _, conn := range c.Connections {
+		taken[conn.ID] = true
+	}
+	for _, ch := range p.New {
+		if !ch.Accept {
+			continue
+		}
+		conn := ch.Connection.Clone()
+		if taken[conn.ID] {
+			conn.ID = ResolveConflict(ch.Alias, taken)
+		}
+		taken[conn.ID] = true
+		c.AddConnection(conn)
+		res.Added++
+	}
+
+	for _, ch := range p.Changed {
+		conn := c.FindConnection(ch.ID)
+		if conn == nil {
+			continue
+		}
+		updated := false
+		for _, f := range ch.Fields {
+			if f.Accept {
+				setField(conn, f)
+				updated = true
+			}
+		}
+		if updated {
+			res.Updated++
+		}
+	}
+
+	if manage {
+		for id, alias := range p.Matched {
+			if conn := c.FindConnection(id); conn != nil && conn.SSHConfigHost == "" {
+				conn.SSHConfigHost = alias
+				res.Marked++
+			}
+		}
+	}
+
+	for _, ch := range p.Removed {
+		if ch.Accept && c.DeleteConnection(ch.ID) {
+			res.Removed++
+		}
+	}
+	return res
+}
+
+func setField(conn *config.Connection, f FieldChange) {
+	switch f.Field {
+	case "host":
+		conn.Host = f.New
+	case "user":
+		conn.User = f.New
+	case "port":
+		conn.Port, _ = strconv.Atoi(f.New)
+	case "identity_file":
+		conn.IdentityFile = f.New
+	case "proxy_jump":
+		conn.ProxyJump = f.New
+	case "forward_agent":
+		conn.ForwardAgent = f.New == "true"
+	case "ssh_config_host":
+		conn.SSHConfigHost = f.New
+	default:
+		key, ok := strings.CutPrefix(f.Field, "options.")
+		if !ok {
+			return
+		}
+		// Copy: the map may be shared with a template.
+		options := make(map[string]string, len(conn.Options)+1)
+		for k, v := range conn.Options {
+			options[k] = v
+		}
+		if ck, found := optionKey(options, key); found {
+			key = ck
+		}
+		options[key] = f.New
+		conn.Options = options
+	}
+}
+
+// optionKey finds key in options, ignoring case as ssh does.
+func optionKey(options map[string]string, key string) (string, bool) {
+	for k := range options {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func portOrDefault(port int) int {
+	if port == 0 {
+		return 22
+	}
+	return port
+}
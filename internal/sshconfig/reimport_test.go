@@ -0,0 +1,165 @@
+package sshconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestPlanImport(t *testing.T) {
+	existing := []config.Connection{
+		{ID: "web", Host: "10.0.0.1", User: "deploy", Port: 22, SSHConfigHost: "web"},
+		{ID: "db", Host: "10.0.0.2", User: "admin", Port: 22},
+		{ID: "api-prod", Host: "api.example.com", User: "ubuntu", Port: 22},
+		{ID: "old", Host: "10.0.0.9", SSHConfigHost: "old"},
+		{ID: "mine", Host: "10.0.0.10"},
+	}
+	hosts := []ParsedHost{
+		// Managed and changed.
+		{Alias: "web", HostName: "10.0.0.1", User: "deploy", Port: 2222, Options: map[string]string{"serveraliveinterval": "30"}},
+		// Matched by ID, unchanged.
+		{Alias: "db", HostName: "10.0.0.2", User: "admin"},
+		// Matched by host, user and port.
+		{Alias: "api", HostName: "api.example.com", User: "ubuntu", ProxyJump: "bastion"},
+		// Matched by ID, moved to another address.
+		{Alias: "mine", HostName: "192.168.1.5"},
+		// New.
+		{Alias: "cache", HostName: "10.0.0.3"},
+		{Alias: "evil", HostName: "-oProxyCommand=touch /tmp/x"},
+	}
+
+	plan := PlanImport(existing, hosts)
+
+	var newIDs []string
+	for _, ch := range plan.New {
+		newIDs = append(newIDs, ch.ID)
+		if ch.Connection.SSHConfigHost != ch.Alias {
+			t.Errorf("new %s: SSHConfigHost = %q, want %q", ch.ID, ch.Connection.SSHConfigHost, ch.Alias)
+		}
+	}
+	if want := []string{"cache"}; !reflect.DeepEqual(newIDs, want) {
+		t.Errorf("new IDs = %v, want %v", newIDs, want)
+	}
+
+	if len(plan.Changed) != 3 {
+		t.Fatalf("changed = %+v, want web, api-prod and mine", plan.Changed)
+	}
+	web := plan.Changed[0]
+	wantWeb := []FieldChange{
+		{Field: "port", Old: "22", New: "2222", Accept: true},
+		{Field: "options.serveraliveinterval", Old: "", New: "30", Accept: true},
+	}
+	if web.ID != "web" || !reflect.DeepEqual(web.Fields, wantWeb) {
+		t.Errorf("web change = %+v, want fields %+v", web, wantWeb)
+	}
+	api := plan.Changed[1]
+	if api.ID != "api-prod" || api.Alias != "api" || len(api.Fields) != 1 || api.Fields[0].Field != "proxy_jump" {
+		t.Errorf("api change = %+v, want proxy_jump on api-prod", api)
+	}
+	mine := plan.Changed[2]
+	if want := []FieldChange{{Field: "host", Old: "10.0.0.10", New: "192.168.1.5", Accept: true}}; !reflect.DeepEqual(mine.Fields, want) {
+		t.Errorf("mine fields = %+v, want %+v", mine.Fields, want)
+	}
+
+	if len(plan.Removed) != 1 || plan.Removed[0].ID != "old" || plan.Removed[0].Accept {
+		t.Errorf("removed = %+v, want old, not accepted", plan.Removed)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Alias != "evil" {
+		t.Errorf("skipped = %+v, want evil", plan.Skipped)
+	}
+	wantMatched := map[string]string{"web": "web", "db": "db", "api-prod": "api", "mine": "mine"}
+	if !reflect.DeepEqual(plan.Matched, wantMatched) {
+		t.Errorf("matched = %v, want %v", plan.Matched, wantMatched)
+	}
+}
+
+func TestPlanImport_UnsetValuesKept(t *testing.T) {
+	// The connection's user comes from defaults and its options are its
+	// own; the SSH config sets neither, so nothing changes.
+	existing := []config.Connection{
+		{ID: "web", Host: "web.example.com", User: "admin", Port: 22, Options: map[string]string{"ServerAliveInterval": "30"}},
+	}
+	hosts := []ParsedHost{
+		{Alias: "web", HostName: "web.example.com", Options: map[string]string{"serveraliveinterval": "30"}},
+	}
+	plan := PlanImport(existing, hosts)
+	if !plan.Empty() {
+		t.Errorf("plan = %+v, want empty", plan)
+	}
+}
+
+func TestPlanImport_ManagedByOtherHost(t *testing.T) {
+	existing := []config.Connection{
+		{ID: "web", Host: "10.0.0.1", SSHConfigHost: "web-old"},
+	}
+	hosts := []ParsedHost{{Alias: "web", HostName: "10.0.0.1"}}
+
+	plan := PlanImport(existing, hosts)
+	if len(plan.New) != 1 || plan.New[0].ID != "web-imported" {
+		t.Errorf("new = %+v, want web-imported", plan.New)
+	}
+	if len(plan.Removed) != 1 || plan.Removed[0].ID != "web" {
+		t.Errorf("removed = %+v, want web", plan.Removed)
+	}
+}
+
+func TestPlanImport_SkipsInventoryConnections(t *testing.T) {
+	existing := []config.Connection{
+		{ID: "web", Host: "10.0.0.1", Source: config.InventorySource("cloud")},
+		{ID: "gone", Host: "10.0.0.2", SSHConfigHost: "gone", Source: config.InventorySource("cloud")},
+	}
+	hosts := []ParsedHost{{Alias: "web", HostName: "10.0.0.1", Port: 2222}}
+
+	plan := PlanImport(existing, hosts)
+	if len(plan.Changed) != 0 || len(plan.Removed) != 0 {
+		t.Errorf("changed = %+v, removed = %+v, want inventory connections left alone", plan.Changed, plan.Removed)
+	}
+	if len(plan.New) != 1 || plan.New[0].ID != "web-imported" {
+		t.Errorf("new = %+v, want web-imported", plan.New)
+	}
+}
+
+func TestImportPlan_Apply(t *testing.T) {
+	cfg := &config.Config{Connections: []config.Connection{
+		{ID: "web", Host: "10.0.0.1", Port: 22, Options: map[string]string{"ServerAliveInterval": "60"}},
+		{ID: "db", Host: "10.0.0.2"},
+		{ID: "old", Host: "10.0.0.9", SSHConfigHost: "old"},
+	}}
+	hosts := []ParsedHost{
+		{Alias: "web", HostName: "10.0.0.1", User: "deploy", Port: 2222, Options: map[string]string{"serveraliveinterval": "30"}},
+		{Alias: "db", HostName: "10.0.0.2"},
+		{Alias: "cache", HostName: "10.0.0.3"},
+	}
+
+	plan := PlanImport(cfg.Connections, hosts)
+	// Decline the user change; prune old.
+	for i := range plan.Changed[0].Fields {
+		if plan.Changed[0].Fields[i].Field == "user" {
+			plan.Changed[0].Fields[i].Accept = false
+		}
+	}
+	plan.Removed[0].Accept = true
+
+	res := plan.Apply(cfg, true)
+	if want := (ImportResult{Added: 1, Updated: 1, Removed: 1, Marked: 2}); res != want {
+		t.Errorf("Apply() = %+v, want %+v", res, want)
+	}
+
+	web := cfg.FindConnection("web")
+	if web.User != "" || web.Port != 2222 || web.SSHConfigHost != "web" {
+		t.Errorf("web = %+v, want port 2222, no user, managed", web)
+	}
+	if want := map[string]string{"ServerAliveInterval": "30"}; !reflect.DeepEqual(web.Options, want) {
+		t.Errorf("web options = %v, want %v", web.Options, want)
+	}
+	if db := cfg.FindConnection("db"); db.SSHConfigHost != "db" {
+		t.Errorf("db SSHConfigHost = %q, want db", db.SSHConfigHost)
+	}
+	if cache := cfg.FindConnection("cache"); cache == nil || cache.SSHConfigHost != "cache" {
+		t.Errorf("cache = %+v, want a connection managed by cache", cache)
+	}
+	if cfg.FindConnection("old") != nil {
+		t.Error("old was not removed")
+	}
+}
@@ -0,0 +1,88 @@
+package sshconfig
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPath returns the user's SSH config, ~/.ssh/config.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// ConfigDPath returns the file hop sshconfig sync --config-d writes,
+// ~/.ssh/config.d/hop.conf. The .conf suffix matches both "config.d/*" and
+// "config.d/*.conf" includes.
+func ConfigDPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config.d", "hop.conf")
+}
+
+// Includes reports whether the SSH config at configPath has a top-level
+// Include directive matching target. Relative patterns are resolved against
+// ~/.ssh, as ssh does for the user config.
+func Includes(configPath, target string) (bool, error) {
+	f, err := os.Open(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	sshDir := filepath.Dir(DefaultPath())
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "include") {
+			continue
+		}
+		for _, pattern := range fields[1:] {
+			pattern = expandPath(strings.Trim(pattern, `"`))
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(sshDir, pattern)
+			}
+			if ok, _ := filepath.Match(pattern, target); ok {
+				return true, nil
+			}
+		}
+	}
+	return false, scanner.Err()
+}
+
+// WriteFile replaces the file at path with content through a temporary
+// file, keeping the file's permissions (0600 for a new one). A symlinked
+// config, e.g. one kept in a dotfiles repository, is written through the
+// link rather than replaced.
+func WriteFile(path, content string) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	// 0700: ssh refuses configs in directories others can write to.
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".hop-tmp"
+	if err := os.WriteFile(tmp, []byte(content), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package sshconfig
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+// Markers delimit the section of an SSH config that hop manages. Parse skips
+// what is between them, so hop never imports its own output.
+const (
+	BeginMarker = "# BEGIN hop"
+	EndMarker   = "# END hop"
+)
+
+// WriteOptions controls how connections are rendered as Host blocks.
+type WriteOptions struct {
+	// SkipRemoteDir leaves out the RemoteCommand that lands a session in a
+	// connection's remote_dir. ssh refuses to run a command line (and scp or
+	// sftp) for a host with a RemoteCommand unless it is given
+	// -o RemoteCommand=none.
+	SkipRemoteDir bool
+}
+
+// WriteHosts writes a Host block for each connection and returns the IDs of
+// connections it skipped because their ID can't be used as a Host alias.
+func WriteHosts(w io.Writer, conns []config.Connection, opts WriteOptions) ([]string, error) {
+	var skipped []string
+	first := true
+	for i := range conns {
+		conn := &conns[i]
+		if !validAlias(conn.ID) || conn.Host == "" {
+			skipped = append(skipped, conn.ID)
+			continue
+		}
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return skipped, err
+			}
+		}
+		first = false
+		if _, err := io.WriteString(w, hostBlock(conn, opts)); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+// hostBlock renders conn in the order ssh's own flags are built (see
+// ssh.BuildCommand), so a host behaves the same with plain ssh as with hop.
+func hostBlock(conn *config.Connection, opts WriteOptions) string {
+	var b strings.Builder
+	directive := func(key, value string) {
+		fmt.Fprintf(&b, "    %s %s\n", key, quoteArg(value))
+	}
+
+	fmt.Fprintf(&b, "Host %s\n", conn.ID)
+	directive("HostName", conn.Host)
+	if conn.User != "" {
+		directive("User", conn.User)
+	}
+	if conn.Port != 0 && conn.Port != 22 {
+		directive("Port", strconv.Itoa(conn.Port))
+	}
+	if conn.IdentityFile != "" {
+		directive("IdentityFile", conn.IdentityFile)
+	}
+	if conn.ProxyJump != "" {
+		directive("ProxyJump", conn.ProxyJump)
+	}
+	if conn.ForwardAgent {
+		directive("ForwardAgent", "yes")
+	}
+	if conn.Multiplexed() {
+		for _, opt := range [][2]string{
+			{"ControlMaster", "auto"},
+			{"ControlPath", escapeTokens(ssh.ControlPath(conn))},
+			{"ControlPersist", ssh.DefaultControlPersist},
+		} {
+			if !hasOption(conn.Options, opt[0]) {
+				directive(opt[0], opt[1])
+			}
+		}
+	}
+	if conn.RemoteDir != "" && !opts.SkipRemoteDir && !hasOption(conn.Options, "RemoteCommand") {
+		// RemoteCommand takes the rest of the line as is, so it isn't quoted.
+		fmt.Fprintf(&b, "    RemoteCommand %s\n", escapeTokens(ssh.RemoteDirCommand(conn.RemoteDir)))
+		if !hasOption(conn.Options, "RequestTTY") {
+			directive("RequestTTY", "yes")
+		}
+	}
+
+	keys := make([]string, 0, len(conn.Options))
+	for k := range conn.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		directive(k, conn.Options[k])
+	}
+	return b.String()
+}
+
+// ManagedBlock renders conns as the hop-managed section of an SSH config,
+// between BeginMarker and EndMarker. It returns the IDs of skipped
+// connections, as WriteHosts does.
+func ManagedBlock(conns []config.Connection, opts WriteOptions) (string, []string) {
+	var b strings.Builder
+	b.WriteString(BeginMarker + "\n")
+	b.WriteString("# Generated by hop sshconfig sync; changes here are overwritten.\n")
+	b.WriteString("# Edit connections with hop instead.\n\n")
+	skipped, _ := WriteHosts(&b, conns, opts)
+	b.WriteString(EndMarker + "\n")
+	return b.String(), skipped
+}
+
+// ReplaceManaged returns content with its hop-managed section replaced by
+// block, or with block added if there is none. A new section goes before
+// the first Host or Match line: ssh uses the first value it finds for each
+// option, and catch-all blocks such as "Host *" usually come last. An empty
+// block removes the section.
+func ReplaceManaged(content, block string) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case BeginMarker:
+			if begin >= 0 {
+				return "", fmt.Errorf("line %d: second %q", i+1, BeginMarker)
+			}
+			begin = i
+		case EndMarker:
+			if begin < 0 {
+				return "", fmt.Errorf("line %d: %q without %q", i+1, EndMarker, BeginMarker)
+			}
+			if end < 0 {
+				end = i
+			}
+		}
+	}
+	if begin >= 0 && end < 0 {
+		return "", fmt.Errorf("line %d: %q without %q", begin+1, BeginMarker, EndMarker)
+	}
+
+	if begin >= 0 {
+		rest := strings.Join(lines[end+1:], "")
+		if block == "" {
+			// Drop the blank line that separated the section from what follows.
+			rest = strings.TrimPrefix(rest, "\n")
+		}
+		return strings.Join(lines[:begin], "") + block + rest, nil
+	}
+	if block == "" {
+		return content, nil
+	}
+
+	at := len(lines)
+	for i, line := range lines {
+		fields := strings.Fields(strings.ToLower(line))
+		if len(fields) > 0 && (fields[0] == "host" || fields[0] == "match" ||
+			strings.HasPrefix(fields[0], "host=") || strings.HasPrefix(fields[0], "match=")) {
+			at = i
+			break
+		}
+	}
+	before := strings.Join(lines[:at], "")
+	if before != "" && !strings.HasSuffix(before, "\n") {
+		before += "\n"
+	}
+	if strings.TrimSpace(before) != "" && !strings.HasSuffix(before, "\n\n") {
+		before += "\n"
+	}
+	after := strings.Join(lines[at:], "")
+	if after != "" {
+		block += "\n"
+	}
+	return before + block + after, nil
+}
+
+// validAlias reports whether id can be written as a Host alias: ssh splits
+// Host lines on whitespace and treats *, ? and ! as pattern characters.
+func validAlias(id string) bool {
+	return id != "" && !strings.ContainsAny(id, " \t\"*?!,#")
+}
+
+// quoteArg double-quotes values containing whitespace, the way ssh_config
+// expects them.
+func quoteArg(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// escapeTokens escapes "%" in values ssh expands %-tokens in.
+func escapeTokens(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+func hasOption(options map[string]string, key string) bool {
+	for k := range options {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestWriteHosts(t *testing.T) {
+	conns := []config.Connection{
+		{
+			ID: "web", Host: "web.example.com", User: "deploy", Port: 2222,
+			IdentityFile: "~/.ssh/my key", RemoteDir: "/srv/100%",
+			Options: map[string]string{"StrictHostKeyChecking": "no", "Compression": "yes"},
+		},
+		{ID: "db", Host: "10.0.0.5", Port: 22, ProxyJump: "bastion", ForwardAgent: true},
+		{ID: "bad id", Host: "x"},
+		{ID: "web*", Host: "x"},
+	}
+
+	var b strings.Builder
+	skipped, err := WriteHosts(&b, conns, WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Host web
+    HostName web.example.com
+    User deploy
+    Port 2222
+    IdentityFile "~/.ssh/my key"
+    RemoteCommand cd -- /srv/100%%; exec "${SHELL:-/bin/sh}" -l
+    RequestTTY yes
+    Compression yes
+    StrictHostKeyChecking no
+
+Host db
+    HostName 10.0.0.5
+    ProxyJump bastion
+    ForwardAgent yes
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if strings.Join(skipped, ",") != "bad id,web*" {
+		t.Errorf("skipped = %v", skipped)
+	}
+
+	b.Reset()
+	WriteHosts(&b, conns[:1], WriteOptions{SkipRemoteDir: true})
+	if strings.Contains(b.String(), "RemoteCommand") || strings.Contains(b.String(), "RequestTTY") {
+		t.Errorf("SkipRemoteDir should leave out the landing dir:\n%s", b.String())
+	}
+}
+
+func TestWriteHosts_OptionsWin(t *testing.T) {
+	multiplex := true
+	conns := []config.Connection{{
+		ID: "web", Host: "web.example.com", RemoteDir: "/srv", Multiplex: &multiplex,
+		Options: map[string]string{"controlpath": "~/.ssh/cm-%C", "RemoteCommand": "tmux attach"},
+	}}
+	var b strings.Builder
+	WriteHosts(&b, conns, WriteOptions{})
+	out := b.String()
+	if strings.Count(out, "ControlPath") != 0 || strings.Count(out, "controlpath") != 1 {
+		t.Errorf("the connection's ControlPath should replace hop's:\n%s", out)
+	}
+	if strings.Count(out, "RemoteCommand") != 1 || strings.Contains(out, "cd --") {
+		t.Errorf("the connection's RemoteCommand should replace the landing dir:\n%s", out)
+	}
+	if !strings.Contains(out, "ControlMaster auto") {
+		t.Errorf("expected the rest of the master options:\n%s", out)
+	}
+}
+
+func TestReplaceManaged(t *testing.T) {
+	block := BeginMarker + "\nHost web\n    HostName web.example.com\n" + EndMarker + "\n"
+
+	tests := []struct {
+		name, content, block, want string
+	}{
+		{
+			name:  "empty file",
+			block: block,
+			want:  block,
+		},
+		{
+			name:    "before the first host",
+			content: "Include config.d/*\nServerAliveInterval 30\nHost old\n    HostName old\n\nHost *\n    User me\n",
+			block:   block,
+			want:    "Include config.d/*\nServerAliveInterval 30\n\n" + block + "\nHost old\n    HostName old\n\nHost *\n    User me\n",
+		},
+		{
+			name:    "no hosts",
+			content: "ServerAliveInterval 30",
+			block:   block,
+			want:    "ServerAliveInterval 30\n\n" + block,
+		},
+		{
+			name:    "replace",
+			content: "Host a\n\n# BEGIN hop\nHost stale\n# END hop\n\nHost *\n",
+			block:   block,
+			want:    "Host a\n\n" + block + "\nHost *\n",
+		},
+		{
+			name:    "remove",
+			content: "Include x\n\n# BEGIN hop\nHost stale\n# END hop\n\nHost *\n",
+			want:    "Include x\n\nHost *\n",
+		},
+		{
+			name:    "remove missing",
+			content: "Host *\n",
+			want:    "Host *\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := ReplaceManaged(tt.content, tt.block)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+
+	// Replacing is idempotent.
+	once, _ := ReplaceManaged("Host old\n", block)
+	twice, _ := ReplaceManaged(once, block)
+	if once != twice {
+		t.Errorf("second sync changed the file:\n%q\n%q", once, twice)
+	}
+
+	for _, broken := range []string{
+		"# BEGIN hop\nHost web\n",
+		"Host web\n# END hop\n",
+		"# BEGIN hop\n# BEGIN hop\n# END hop\n",
+	} {
+		if _, err := ReplaceManaged(broken, block); err == nil {
+			t.Errorf("expected an error for %q", broken)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	dotfile := filepath.Join(dir, "dotfiles", "ssh_config")
+	if err := os.MkdirAll(filepath.Dir(dotfile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dotfile, []byte("old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config")
+	if err := os.Symlink(dotfile, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(link, "new\n"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("the symlink should be kept")
+	}
+	data, _ := os.ReadFile(dotfile)
+	if string(data) != "new\n" {
+		t.Errorf("target content = %q", data)
+	}
+	if fi, _ := os.Stat(dotfile); fi.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", fi.Mode().Perm())
+	}
+
+	fresh := filepath.Join(dir, "new", "config")
+	if err := WriteFile(fresh, "x\n"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(fresh); fi.Mode().Perm() != 0600 {
+		t.Errorf("new file mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(sshDir, "config")
+	target := filepath.Join(sshDir, "config.d", "hop.conf")
+
+	if ok, err := Includes(configPath, target); ok || err != nil {
+		t.Errorf("missing config: ok = %v, err = %v", ok, err)
+	}
+	for content, want := range map[string]bool{
+		"Include config.d/*\n":                true,
+		"include ~/.ssh/config.d/*.conf\n":    true,
+		"Include other/* config.d/hop.conf\n": true,
+		"Include config.d/*.cfg\n":            false,
+		"Host x\n":                            false,
+	} {
+		if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := Includes(configPath, target); ok != want || err != nil {
+			t.Errorf("%q: ok = %v, err = %v", content, ok, err)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+// tabDelay is the pause between opening tabs, as for hop open.
+const tabDelay = 100 * time.Millisecond
+
+// bulkAction is a change applied to every marked connection.
+type bulkAction int
+
+const (
+	bulkAddTag bulkAction = iota
+	bulkRemoveTag
+	bulkSetProject
+	bulkSetEnv
+)
+
+func (a bulkAction) title() string {
+	switch a {
+	case bulkRemoveTag:
+		return "Remove Tags"
+	case bulkSetProject:
+		return "Set Project"
+	case bulkSetEnv:
+		return "Set Environment"
+	default:
+		return "Add Tags"
+	}
+}
+
+type tabsOpenedMsg struct {
+	ids []string
+	err error
+}
+
+// toggleMark marks or unmarks the connection under the cursor.
+func (m *Model) toggleMark() {
+	conn := m.selectedConnection()
+	if conn == nil {
+		return
+	}
+	if m.marked[conn.ID] {
+		delete(m.marked, conn.ID)
+	} else {
+		m.marked[conn.ID] = true
+	}
+}
+
+// markVisualRange marks every connection between the visual anchor and the
+// cursor and leaves visual mode.
+func (m *Model) markVisualRange() {
+	from, to := min(m.visualAnchor, m.cursor), max(m.visualAnchor, m.cursor)
+	for fi := from; fi <= to && fi < len(m.filtered); fi++ {
+		if conn := m.items[m.filtered[fi]].connection; conn != nil {
+			m.marked[conn.ID] = true
+		}
+	}
+	m.visual = false
+}
+
+// toggleMarkAll marks every listed connection, or unmarks them all when
+// they already are.
+func (m *Model) toggleMarkAll() {
+	conns := m.filteredConnections()
+	all := len(conns) > 0
+	for _, conn := range conns {
+		if !m.marked[conn.ID] {
+			all = false
+			break
+		}
+	}
+	for _, conn := range conns {
+		if all {
+			delete(m.marked, conn.ID)
+		} else {
+			m.marked[conn.ID] = true
+		}
+	}
+}
+
+// isMarked reports whether the listed connection at fi is marked, counting
+// the pending visual range as marked.
+func (m Model) isMarked(fi int) bool {
+	if m.visual && fi >= min(m.visualAnchor, m.cursor) && fi <= max(m.visualAnchor, m.cursor) {
+		return true
+	}
+	conn := m.items[m.filtered[fi]].connection
+	return conn != nil && m.marked[conn.ID]
+}
+
+// markedConnections returns the marked connections in config order,
+// including any hidden by the current filter.
+func (m Model) markedConnections() []config.Connection {
+	var conns []config.Connection
+	for _, conn := range m.config.Connections {
+		if m.marked[conn.ID] {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// pruneMarks drops marks of connections that no longer exist.
+func (m *Model) pruneMarks() {
+	for id := range m.marked {
+		if m.config.FindConnection(id) == nil {
+			delete(m.marked, id)
+		}
+	}
+}
+
+func (m Model) updateBulkMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	targets := m.markedConnections()
+	switch keyMsg.String() {
+	case "d", "+", "-", "p", "e":
+		if msg := readOnlyMsg(targets...); msg != "" {
+			m.statusMsg = msg
+			m.view = viewList
+			return m, nil
+		}
+	}
+	switch keyMsg.String() {
+	case "esc", "q", "b":
+		m.view = viewList
+	case "d":
+		for _, conn := range targets {
+			m.deleteIDs = append(m.deleteIDs, conn.ID)
+		}
+		m.view = viewConfirmDelete
+	case "+":
+		return m.openBulkInput(bulkAddTag)
+	case "-":
+		return m.openBulkInput(bulkRemoveTag)
+	case "p":
+		return m.openBulkInput(bulkSetProject)
+	case "e":
+		return m.openBulkInput(bulkSetEnv)
+	case "x":
+		m.exportModel = NewExportModel(targets, m.width, m.height)
+		m.view = viewExport
+	case "o":
+		terminal := ssh.DetectTerminal()
+		if !terminal.SupportsNewTab() {
+			m.statusMsg = fmt.Sprintf("Terminal %q does not support opening new tabs", terminal)
+			m.view = viewList
+			return m, nil
+		}
+		m.statusMsg = fmt.Sprintf("Opening %d tab(s) in %s...", len(targets), terminal)
+		m.view = viewList
+		return m, openTabsCmd(terminal, targets)
+	case "!":
+		return m.openExecPrompt(targets)
+	}
+	return m, nil
+}
+
+func (m Model) openBulkInput(action bulkAction) (tea.Model, tea.Cmd) {
+	m.bulkAction = action
+	m.bulkInput.SetValue("")
+	switch action {
+	case bulkAddTag, bulkRemoveTag:
+		m.bulkInput.Placeholder = "tag1, tag2"
+	case bulkSetProject, bulkSetEnv:
+		m.bulkInput.Placeholder = "leave empty to clear"
+		targets := m.markedConnections()
+		value := bulkField(targets[0], action)
+		for _, conn := range targets[1:] {
+			if bulkField(conn, action) != value {
+				value = ""
+				break
+			}
+		}
+		m.bulkInput.SetValue(value)
+	}
+	m.bulkInput.Focus()
+	m.view = viewBulkInput
+	return m, textinput.Blink
+}
+
+func bulkField(conn config.Connection, action bulkAction) string {
+	if action == bulkSetEnv {
+		return conn.Env
+	}
+	return conn.Project
+}
+
+func (m Model) updateBulkInput(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.bulkInput.Blur()
+			m.view = viewBulkMenu
+			return m, nil
+		case "enter":
+			var ids []string
+			for _, conn := range m.markedConnections() {
+				ids = append(ids, conn.ID)
+			}
+			value := m.bulkInput.Value()
+			var changed int
+			err := m.persist(func(c *config.Config) error {
+				var err error
+				changed, err = applyBulk(c, ids, m.bulkAction, value)
+				return err
+			})
+			if err != nil {
+				m.statusMsg = "Error saving: " + err.Error()
+			} else {
+				m.statusMsg = fmt.Sprintf("%s: updated %d of %d connection(s)", m.bulkAction.title(), changed, len(ids))
+			}
+			m.bulkInput.Blur()
+			m.refresh()
+			m.view = viewList
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.bulkInput, cmd = m.bulkInput.Update(msg)
+	return m, cmd
+}
+
+// applyBulk applies action with value to the connections with the given
+// IDs in c and returns how many it changed. Tags are given comma-separated
+// and compared case-insensitively; an empty project or env clears it.
+func applyBulk(c *config.Config, ids []string, action bulkAction, value string) (int, error) {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if (action == bulkAddTag || action == bulkRemoveTag) && len(tags) == 0 {
+		return 0, errors.New("no tags given")
+	}
+	value = strings.TrimSpace(value)
+
+	changed := 0
+	for _, id := range ids {
+		conn := c.FindConnection(id)
+		if conn == nil {
+			continue
+		}
+		var ok bool
+		switch action {
+		case bulkAddTag:
+			for _, tag := range tags {
+				if !hasTag(conn.Tags, tag) {
+					conn.Tags = append(conn.Tags, tag)
+					ok = true
+				}
+			}
+		case bulkRemoveTag:
+			kept := conn.Tags[:0:0]
+			for _, t := range conn.Tags {
+				if hasTag(tags, t) {
+					ok = true
+				} else {
+					kept = append(kept, t)
+				}
+			}
+			conn.Tags = kept
+		case bulkSetProject:
+			ok = conn.Project != value
+			conn.Project = value
+		case bulkSetEnv:
+			ok = conn.Env != value
+			conn.Env = value
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// openTabsCmd opens an ssh session to each connection in a new terminal
+// tab, stopping at the first failure.
+func openTabsCmd(terminal ssh.TerminalType, conns []config.Connection) tea.Cmd {
+	return func() tea.Msg {
+		var opened []string
+		for i, conn := range conns {
+			if err := terminal.OpenNewTab(ssh.BuildCommandString(&conn, &ssh.ConnectOptions{})); err != nil {
+				return tabsOpenedMsg{ids: opened, err: fmt.Errorf("failed to open tab for %s: %w", conn.ID, err)}
+			}
+			opened = append(opened, conn.ID)
+			if i < len(conns)-1 {
+				time.Sleep(tabDelay)
+			}
+		}
+		return tabsOpenedMsg{ids: opened}
+	}
+}
+
+func (m Model) renderBulkMenu() string {
+	var b strings.Builder
+
+	targets := m.markedConnections()
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Bulk Actions - %d Marked", len(targets))))
+	b.WriteString("\n\n")
+	b.WriteString(helpDescStyle.Render(markedSummary(targets)))
+	b.WriteString("\n\n")
+
+	actions := [][]string{
+		{"d", "Delete"},
+		{"+", "Add tags"},
+		{"-", "Remove tags"},
+		{"p", "Set project"},
+		{"e", "Set environment"},
+		{"x", "Export to YAML"},
+		{"o", "Open in terminal tabs"},
+		{"!", "Run a command"},
+	}
+	for _, a := range actions {
+		b.WriteString("  ")
+		b.WriteString(helpKeyStyle.Render(padRight(a[0], 3)))
+		b.WriteString(helpDescStyle.Render(a[1]))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("cancel"))
+
+	return b.String()
+}
+
+func (m Model) renderBulkInput() string {
+	var b strings.Builder
+
+	targets := m.markedConnections()
+	b.WriteString(titleStyle.Render(fmt.Sprintf("%s - %d Connection(s)", m.bulkAction.title(), len(targets))))
+	b.WriteString("\n\n")
+
+	if m.bulkAction == bulkRemoveTag {
+		tagSet := make(map[string]bool)
+		for _, conn := range targets {
+			for _, t := range conn.Tags {
+				tagSet[t] = true
+			}
+		}
+		if len(tagSet) > 0 {
+			b.WriteString(helpDescStyle.Render("Tags in use: "))
+			for _, t := range sortedMapKeys(tagSet) {
+				b.WriteString(panelTagStyle.Render(t) + " ")
+			}
+			b.WriteString("\n\n")
+		}
+	}
+
+	b.WriteString("  ")
+	b.WriteString(m.bulkInput.View())
+	b.WriteString("\n\n")
+
+	b.WriteString(helpKeyStyle.Render("enter") + " " + helpDescStyle.Render("apply"))
+	b.WriteString("  ")
+	b.WriteString(helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("back"))
+
+	return b.String()
+}
+
+// markedSummary lists connection IDs, shortened after the first few.
+func markedSummary(conns []config.Connection) string {
+	ids := make([]string, 0, len(conns))
+	for _, conn := range conns {
+		ids = append(ids, conn.ID)
+	}
+	sort.Strings(ids)
+	if len(ids) > 8 {
+		ids = append(ids[:8], fmt.Sprintf("and %d more", len(conns)-8))
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func pressKey(t *testing.T, m Model, msg tea.KeyMsg) Model {
+	t.Helper()
+	updated, _ := m.Update(msg)
+	return updated.(Model)
+}
+
+func runeKey(r string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(r)}
+}
+
+func markedIDs(m Model) []string {
+	var ids []string
+	for _, conn := range m.markedConnections() {
+		ids = append(ids, conn.ID)
+	}
+	return ids
+}
+
+func TestMarking(t *testing.T) {
+	m := NewModel(testConfig(), "1.0.0")
+	first := m.selectedConnection().ID
+
+	// Space marks the selected connection and moves down.
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeySpace})
+	if !m.marked[first] || m.cursor != 1 {
+		t.Fatalf("after space: marked = %v, cursor = %d", m.marked, m.cursor)
+	}
+	if !strings.Contains(m.View(), "1 marked") {
+		t.Error("expected the marked count in the filter bar")
+	}
+
+	// Space again on the same connection unmarks it.
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyUp})
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeySpace})
+	if len(m.marked) != 0 {
+		t.Fatalf("expected no marks, got %v", m.marked)
+	}
+
+	// v marks a range from where it started to the cursor.
+	m = pressKey(t, m, runeKey("v"))
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyDown})
+	if !m.visual || !m.isMarked(2) {
+		t.Fatal("expected a pending visual range up to the cursor")
+	}
+	m = pressKey(t, m, runeKey("v"))
+	if m.visual || len(m.marked) != 2 {
+		t.Fatalf("after v: visual = %v, marked = %v", m.visual, m.marked)
+	}
+
+	// ctrl+a marks all listed connections, then unmarks them.
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyCtrlA})
+	if len(m.marked) != 3 {
+		t.Fatalf("ctrl+a: marked = %v", m.marked)
+	}
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyCtrlA})
+	if len(m.marked) != 0 {
+		t.Fatalf("second ctrl+a: marked = %v", m.marked)
+	}
+
+	// esc clears marks.
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeySpace})
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	if len(m.marked) != 0 {
+		t.Errorf("esc should clear marks, got %v", m.marked)
+	}
+}
+
+func TestBulkMenuNeedsMarks(t *testing.T) {
+	m := NewModel(testConfig(), "1.0.0")
+	m = pressKey(t, m, runeKey("b"))
+	if m.view != viewList || m.statusMsg == "" {
+		t.Errorf("b without marks: view = %v, status = %q", m.view, m.statusMsg)
+	}
+
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyCtrlA})
+	m = pressKey(t, m, runeKey("b"))
+	if m.view != viewBulkMenu {
+		t.Fatalf("expected viewBulkMenu, got %v", m.view)
+	}
+	if !strings.Contains(m.View(), "3 Marked") {
+		t.Errorf("menu view:\n%s", m.View())
+	}
+
+	m = pressKey(t, m, runeKey("!"))
+	if m.view != viewExecPrompt || len(m.execTargets) != 3 {
+		t.Errorf("! from the menu: view = %v, targets = %d", m.view, len(m.execTargets))
+	}
+}
+
+func TestMarkedActionsUseMarks(t *testing.T) {
+	m := NewModel(testConfig(), "1.0.0")
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeySpace})
+
+	m = pressKey(t, m, runeKey("x"))
+	if m.view != viewExport || len(m.exportModel.items) != 1 {
+		t.Errorf("x with a mark: view = %v, items = %d", m.view, len(m.exportModel.items))
+	}
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+
+	m = pressKey(t, m, runeKey("!"))
+	if m.view != viewExecPrompt || len(m.execTargets) != 1 {
+		t.Errorf("! with a mark: view = %v, targets = %d", m.view, len(m.execTargets))
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	cfg := testConfig()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := cfg.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	m := NewModel(cfg, "1.0.0")
+	m.configPath = path
+
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeySpace})
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeySpace})
+	marked := markedIDs(m)
+
+	m = pressKey(t, m, runeKey("d"))
+	if m.view != viewConfirmDelete || !strings.Contains(m.View(), "Delete 2 Connections") {
+		t.Fatalf("confirm view:\n%s", m.View())
+	}
+	m = pressKey(t, m, runeKey("y"))
+	if m.view != viewList || len(m.config.Connections) != 1 {
+		t.Fatalf("after delete: view = %v, connections = %d", m.view, len(m.config.Connections))
+	}
+	for _, id := range marked {
+		if m.config.FindConnection(id) != nil {
+			t.Errorf("%s was not deleted", id)
+		}
+	}
+	if len(m.marked) != 0 {
+		t.Errorf("marks of deleted connections should be dropped, got %v", m.marked)
+	}
+}
+
+func TestBulkRefusesInventoryConnections(t *testing.T) {
+	cfg := testConfig()
+	cfg.Connections[1].Source = config.InventorySource("cloud")
+	m := NewModel(cfg, "1.0.0")
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyCtrlA})
+
+	for _, key := range []string{"d", "+", "p"} {
+		got := pressKey(t, pressKey(t, m, runeKey("b")), runeKey(key))
+		if got.view != viewList || !strings.Contains(got.statusMsg, "prod-server comes from inventory") {
+			t.Errorf("%s: view = %v, status = %q, want refused", key, got.view, got.statusMsg)
+		}
+	}
+	// Actions that don't change connections still work.
+	if got := pressKey(t, pressKey(t, m, runeKey("b")), runeKey("x")); got.view != viewExport {
+		t.Errorf("export: view = %v, want viewExport", got.view)
+	}
+}
+
+func TestBulkSetProject(t *testing.T) {
+	cfg := testConfig()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := cfg.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	m := NewModel(cfg, "1.0.0")
+	m.configPath = path
+
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyCtrlA})
+	m = pressKey(t, m, runeKey("b"))
+	m = pressKey(t, m, runeKey("p"))
+	if m.view != viewBulkInput || m.bulkInput.Value() != "myapp" {
+		t.Fatalf("view = %v, prefilled = %q", m.view, m.bulkInput.Value())
+	}
+	m.bulkInput.SetValue("shop")
+	m = pressKey(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+
+	saved, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range saved.Connections {
+		if conn.Project != "shop" {
+			t.Errorf("%s: project = %q, want shop", conn.ID, conn.Project)
+		}
+	}
+	if !strings.Contains(m.statusMsg, "updated 3 of 3") {
+		t.Errorf("status = %q", m.statusMsg)
+	}
+}
+
+func TestApplyBulk(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{Connections: []config.Connection{
+			{ID: "a", Tags: []string{"web", "Prod"}, Project: "shop", Env: "prod"},
+			{ID: "b", Tags: []string{"db"}, Project: "shop"},
+			{ID: "c"},
+		}}
+	}
+	tags := func(c *config.Config) [][]string {
+		var out [][]string
+		for _, conn := range c.Connections {
+			out = append(out, conn.Tags)
+		}
+		return out
+	}
+
+	c := newConfig()
+	n, err := applyBulk(c, []string{"a", "b", "gone"}, bulkAddTag, "prod, eu")
+	if err != nil || n != 2 {
+		t.Fatalf("add: n = %d, err = %v", n, err)
+	}
+	want := [][]string{{"web", "Prod", "eu"}, {"db", "prod", "eu"}, nil}
+	if got := tags(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("add: tags = %v, want %v", got, want)
+	}
+
+	c = newConfig()
+	if n, _ = applyBulk(c, []string{"a", "b", "c"}, bulkRemoveTag, "prod"); n != 1 {
+		t.Errorf("remove: n = %d, want 1", n)
+	}
+	if got := c.Connections[0].Tags; !reflect.DeepEqual(got, []string{"web"}) {
+		t.Errorf("remove: tags = %v", got)
+	}
+
+	c = newConfig()
+	if n, _ = applyBulk(c, []string{"a", "b"}, bulkSetEnv, " "); n != 1 || c.Connections[0].Env != "" {
+		t.Errorf("clear env: n = %d, env = %q", n, c.Connections[0].Env)
+	}
+
+	if _, err := applyBulk(newConfig(), []string{"a"}, bulkAddTag, " , "); err == nil {
+		t.Error("expected an error for no tags")
+	}
+}
@@ -1,11 +1,13 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,7 +16,11 @@ import (
 	"github.com/danmartuszewski/hop/internal/export"
 	"github.com/danmartuszewski/hop/internal/fuzzy"
 	"github.com/danmartuszewski/hop/internal/health"
+	"github.com/danmartuszewski/hop/internal/importer"
+	"github.com/danmartuszewski/hop/internal/runs"
 	"github.com/danmartuszewski/hop/internal/ssh"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+	"github.com/danmartuszewski/hop/internal/tunnel"
 )
 
 type viewState int
@@ -29,15 +35,33 @@ const (
 	viewImport
 	viewExport
 	viewThemePicker
+	viewExecPrompt
+	viewExec
+	viewBulkMenu
+	viewBulkInput
 )
 
 type sshFinishedMsg struct {
+	id  string
 	err error
 }
 
-type healthCheckResultMsg struct {
-	id     string
-	status health.Status
+// healthRoundMsg carries the results of checking every connection once.
+// Periodic rounds schedule the next one when they finish.
+type healthRoundMsg struct {
+	ids      []string
+	results  []health.Result
+	periodic bool
+}
+
+type healthTickMsg struct{}
+
+// tunnelRefreshInterval is how often the dashboard rereads the running
+// tunnels, which hop tunnel up/down change from outside.
+const tunnelRefreshInterval = 5 * time.Second
+
+type tunnelsMsg struct {
+	tunnels map[string][]tunnel.State
 }
 
 type listItem struct {
@@ -67,12 +91,22 @@ type Model struct {
 	pasteInput   textinput.Model
 	statusMsg    string
 	deleteTarget *config.Connection
+	// deleteIDs are the marked connections a bulk delete removes.
+	deleteIDs []string
+	// Multi-select: marked connection IDs, and the start of a visual range
+	// while visual is set.
+	marked       map[string]bool
+	visual       bool
+	visualAnchor int
+	bulkAction   bulkAction
+	bulkInput    textinput.Model
 	// Tag filtering
 	activeTags map[string]bool
 	allTags    []string
 	tagCursor  int
 	// Recent connections
 	history      *config.History
+	historyPath  string
 	sortByRecent bool
 	// Import modal
 	importModel ImportModel
@@ -80,9 +114,17 @@ type Model struct {
 	exportModel ExportModel
 	// Theme picker modal
 	themePickerModel ThemePickerModel
+	// Exec on the filtered connections
+	execInput   textinput.Model
+	execTargets []config.Connection
+	execModel   ExecModel
 	// Health checks
-	healthStatus  map[string]health.Status
-	healthEnabled bool
+	healthStatus   map[string]health.Status
+	healthHistory  *health.History
+	healthInterval time.Duration
+	healthEnabled  bool
+	// Running tunnels by connection ID
+	tunnels map[string][]tunnel.State
 }
 
 func NewModel(cfg *config.Config, version string) Model {
@@ -96,6 +138,15 @@ func NewModel(cfg *config.Config, version string) Model {
 	paste.CharLimit = 200
 	paste.Width = 50
 
+	execInput := textinput.New()
+	execInput.Placeholder = "uptime"
+	execInput.CharLimit = 500
+	execInput.Width = 50
+
+	bulkInput := textinput.New()
+	bulkInput.CharLimit = 200
+	bulkInput.Width = 50
+
 	// Load history (ignore errors - history is optional)
 	history, _ := config.LoadHistory()
 	if history == nil {
@@ -113,18 +164,25 @@ func NewModel(cfg *config.Config, version string) Model {
 	}
 
 	m := Model{
-		config:        cfg,
-		configPath:    config.DefaultConfigPath(),
-		version:       version,
-		filter:        ti,
-		pasteInput:    paste,
-		filtered:      []int{},
-		view:          viewList,
-		help:          NewHelpModel(),
-		activeTags:    make(map[string]bool),
-		history:       history,
-		healthStatus:  healthStatus,
-		healthEnabled: healthEnabled,
+		config:         cfg,
+		configPath:     config.DefaultConfigPath(),
+		version:        version,
+		filter:         ti,
+		pasteInput:     paste,
+		execInput:      execInput,
+		marked:         make(map[string]bool),
+		bulkInput:      bulkInput,
+		filtered:       []int{},
+		view:           viewList,
+		help:           NewHelpModel(),
+		activeTags:     make(map[string]bool),
+		history:        history,
+		historyPath:    config.DefaultHistoryPath(),
+		healthStatus:   healthStatus,
+		healthHistory:  health.NewHistory(health.HistorySize),
+		healthInterval: cfg.Defaults.HealthCheckInterval(),
+		healthEnabled:  healthEnabled,
+		tunnels:        loadTunnels(),
 	}
 
 	m.buildItems()
@@ -346,6 +404,7 @@ func (m *Model) selectedConnection() *config.Connection {
 func (m *Model) refresh() {
 	m.buildItems()
 	m.applyFilter(m.filter.Value())
+	m.pruneMarks()
 	if m.healthEnabled {
 		// Clean stale entries and mark new connections for checking
 		current := make(map[string]bool)
@@ -360,26 +419,65 @@ func (m *Model) refresh() {
 				delete(m.healthStatus, id)
 			}
 		}
+		m.healthHistory.Forget(current)
 	}
 }
 
 func (m Model) Init() tea.Cmd {
-	return m.buildHealthCheckCmd()
+	return tea.Batch(m.healthRoundCmd(true), tunnelRefreshCmd())
 }
 
+// loadTunnels groups the running tunnels by connection. Tunnels are
+// informational here, so errors just show none.
+func loadTunnels() map[string][]tunnel.State {
+	states, _ := tunnel.List()
+	byConn := make(map[string][]tunnel.State)
+	for _, st := range states {
+		byConn[st.Connection] = append(byConn[st.Connection], st)
+	}
+	return byConn
+}
+
+func tunnelRefreshCmd() tea.Cmd {
+	return tea.Tick(tunnelRefreshInterval, func(time.Time) tea.Msg {
+		return tunnelsMsg{tunnels: loadTunnels()}
+	})
+}
+
+// buildHealthCheckCmd checks every connection once, outside the periodic
+// schedule, e.g. after the config changed.
 func (m Model) buildHealthCheckCmd() tea.Cmd {
+	return m.healthRoundCmd(false)
+}
+
+func (m Model) healthRoundCmd(periodic bool) tea.Cmd {
 	if !m.healthEnabled {
 		return nil
 	}
-	var cmds []tea.Cmd
+	conns := m.healthRoundConnections(periodic)
+	return func() tea.Msg {
+		msg := healthRoundMsg{results: health.CheckAll(context.Background(), conns, health.DefaultTimeout, health.DefaultParallel), periodic: periodic}
+		for _, conn := range conns {
+			msg.ids = append(msg.ids, conn.ID)
+		}
+		return msg
+	}
+}
+
+// healthRoundConnections returns the connections a health round checks.
+// Periodic rounds leave out hosts behind a jump host that don't share a
+// master: checking them logs in to the jump host, which may ask for an
+// agent confirmation or a security key touch every time. R and config
+// changes check them too.
+func (m Model) healthRoundConnections(periodic bool) []config.Connection {
+	var conns []config.Connection
 	for _, conn := range m.config.Connections {
-		conn := conn
-		cmds = append(cmds, func() tea.Msg {
-			status := health.CheckTCP(conn.Host, conn.Port)
-			return healthCheckResultMsg{id: conn.ID, status: status}
-		})
+		if periodic && conn.ProxyJump != "" && !strings.EqualFold(conn.ProxyJump, "none") && !conn.Multiplexed() {
+			continue
+		}
+		conns = append(conns, conn)
 	}
-	return tea.Batch(cmds...)
+	return conns
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -387,6 +485,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+	case tunnelsMsg:
+		// Handled in every view so the refresh keeps ticking.
+		m.tunnels = msg.tunnels
+		return m, tunnelRefreshCmd()
+	case healthRoundMsg:
+		// Also handled in every view, for the same reason.
+		for i, id := range msg.ids {
+			m.healthStatus[id] = msg.results[i].Status
+			m.healthHistory.Add(id, msg.results[i])
+		}
+		if msg.periodic && m.healthInterval > 0 {
+			return m, tea.Tick(m.healthInterval, func(time.Time) tea.Msg { return healthTickMsg{} })
+		}
+		return m, nil
+	case healthTickMsg:
+		return m, m.healthRoundCmd(true)
 	}
 
 	switch m.view {
@@ -406,6 +520,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateExport(msg)
 	case viewThemePicker:
 		return m.updateThemePicker(msg)
+	case viewExecPrompt:
+		return m.updateExecPrompt(msg)
+	case viewExec:
+		return m.updateExec(msg)
+	case viewBulkMenu:
+		return m.updateBulkMenu(msg)
+	case viewBulkInput:
+		return m.updateBulkInput(msg)
 	default:
 		return m.updateList(msg)
 	}
@@ -413,14 +535,29 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
-	case healthCheckResultMsg:
-		m.healthStatus[msg.id] = msg.status
-		return m, nil
 	case sshFinishedMsg:
+		m.recordUsage(config.Usage{
+			ID:       msg.id,
+			Kind:     config.UsageInteractive,
+			ExitCode: config.ExitStatus(ssh.ExitCode(msg.err)),
+		})
 		if msg.err != nil {
 			m.statusMsg = fmt.Sprintf("SSH session ended with error: %v", msg.err)
 		}
 		return m, nil
+	case tabsOpenedMsg:
+		// The sessions run in other terminals, so their exit status is unknown.
+		var usages []config.Usage
+		for _, id := range msg.ids {
+			usages = append(usages, config.Usage{ID: id, Kind: config.UsageTab})
+		}
+		m.recordUsage(usages...)
+		if msg.err != nil {
+			m.statusMsg = msg.err.Error()
+		} else {
+			m.statusMsg = fmt.Sprintf("Opened %d tab(s)", len(msg.ids))
+		}
+		return m, nil
 	case tea.MouseMsg:
 		return m.handleMouse(msg)
 	case tea.KeyMsg:
@@ -457,11 +594,40 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.filter.Focus()
 			return m, textinput.Blink
 		case "esc":
-			if m.filter.Value() != "" {
+			switch {
+			case m.visual:
+				m.visual = false
+			case m.filter.Value() != "":
 				m.filter.SetValue("")
 				m.resetFilter()
+			case len(m.marked) > 0:
+				m.marked = make(map[string]bool)
 			}
 			return m, nil
+		case " ":
+			m.toggleMark()
+			if m.cursor < len(m.filtered)-1 {
+				m.cursor++
+			}
+			return m, nil
+		case "v":
+			if m.visual {
+				m.markVisualRange()
+			} else if len(m.filtered) > 0 {
+				m.visual = true
+				m.visualAnchor = m.cursor
+			}
+			return m, nil
+		case "ctrl+a":
+			m.toggleMarkAll()
+			return m, nil
+		case "b":
+			if len(m.marked) == 0 {
+				m.statusMsg = "Mark connections with space, v or ctrl+a first"
+				return m, nil
+			}
+			m.view = viewBulkMenu
+			return m, nil
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
@@ -492,11 +658,6 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		case "enter":
 			if conn := m.selectedConnection(); conn != nil {
-				// Record history before connecting
-				if m.history != nil {
-					m.history.RecordUsage(conn.ID)
-					_ = m.history.Save()
-				}
 				var binary string
 				var args []string
 				if conn.Mosh() {
@@ -506,8 +667,9 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 					args = ssh.BuildCommand(conn, &ssh.ConnectOptions{})
 				}
 				c := exec.Command(binary, args...)
+				id := conn.ID
 				return m, tea.ExecProcess(c, func(err error) tea.Msg {
-					return sshFinishedMsg{err: err}
+					return sshFinishedMsg{id: id, err: err}
 				})
 			}
 		case "a":
@@ -516,12 +678,30 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, textinput.Blink
 		case "e":
 			if conn := m.selectedConnection(); conn != nil {
+				if msg := readOnlyMsg(*conn); msg != "" {
+					m.statusMsg = msg
+					return m, nil
+				}
 				m.form = NewFormModel("Edit Connection", conn)
 				m.view = viewForm
 				return m, textinput.Blink
 			}
 		case "d":
-			if conn := m.selectedConnection(); conn != nil {
+			if len(m.marked) > 0 {
+				targets := m.markedConnections()
+				if msg := readOnlyMsg(targets...); msg != "" {
+					m.statusMsg = msg
+					return m, nil
+				}
+				for _, conn := range targets {
+					m.deleteIDs = append(m.deleteIDs, conn.ID)
+				}
+				m.view = viewConfirmDelete
+			} else if conn := m.selectedConnection(); conn != nil {
+				if msg := readOnlyMsg(*conn); msg != "" {
+					m.statusMsg = msg
+					return m, nil
+				}
 				m.deleteTarget = conn
 				m.view = viewConfirmDelete
 			}
@@ -581,12 +761,9 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		case "x":
-			// Build list of currently filtered connections for export
-			var conns []config.Connection
-			for _, idx := range m.filtered {
-				if m.items[idx].connection != nil {
-					conns = append(conns, *m.items[idx].connection)
-				}
+			conns := m.filteredConnections()
+			if len(m.marked) > 0 {
+				conns = m.markedConnections()
 			}
 			if len(conns) == 0 {
 				m.statusMsg = "No connections to export"
@@ -595,13 +772,13 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.exportModel = NewExportModel(conns, m.width, m.height)
 			m.view = viewExport
 			return m, nil
-		case "i":
-			// Build set of existing IDs
-			existingIDs := make(map[string]bool)
-			for _, conn := range m.config.Connections {
-				existingIDs[conn.ID] = true
+		case "!":
+			if len(m.marked) > 0 {
+				return m.openExecPrompt(m.markedConnections())
 			}
-			m.importModel = NewImportModel(existingIDs, "", m.configPath, m.width, m.height)
+			return m.openExecPrompt(m.filteredConnections())
+		case "i":
+			m.importModel = NewImportModel(m.config.Connections, "", m.configPath, m.width, m.height)
 			m.view = viewImport
 			return m, nil
 		case "T":
@@ -614,6 +791,53 @@ func (m Model) updateList(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// filteredConnections returns the connections currently shown in the list.
+func (m *Model) filteredConnections() []config.Connection {
+	var conns []config.Connection
+	for _, idx := range m.filtered {
+		if m.items[idx].connection != nil {
+			conns = append(conns, *m.items[idx].connection)
+		}
+	}
+	return conns
+}
+
+// persist applies fn to the config file under the config lock and adopts the
+// result, so edits made by other hop processes since the dashboard loaded the
+// config are kept instead of being overwritten. On error the in-memory config
+// is left untouched.
+func (m *Model) persist(fn func(*config.Config) error) error {
+	updated, err := config.Update(m.configPath, fn)
+	if err != nil {
+		return err
+	}
+	*m.config = *updated
+	return nil
+}
+
+// readOnlyMsg returns the status explaining why conns can't be edited or
+// deleted, or "" when none of them comes from an inventory.
+func readOnlyMsg(conns ...config.Connection) string {
+	for _, conn := range conns {
+		if conn.ReadOnly() {
+			return fmt.Sprintf("%s comes from inventory %q and is read-only", conn.ID, conn.Inventory())
+		}
+	}
+	return ""
+}
+
+// recordUsage records usages in the shared history file and refreshes the
+// in-memory copy so recent-sorting also reflects other hop processes. History
+// is optional, so failures are ignored.
+func (m *Model) recordUsage(usages ...config.Usage) {
+	if m.historyPath == "" {
+		return
+	}
+	if h, err := config.RecordUsagesToPath(m.historyPath, usages...); err == nil {
+		m.history = h
+	}
+}
+
 func (m Model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
 	switch msg.Button {
 	case tea.MouseButtonWheelUp:
@@ -729,8 +953,17 @@ func (m Model) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		if m.form.IsEditing() {
 			// Update existing
-			m.config.UpdateConnection(m.form.OriginalID(), *conn)
-			m.statusMsg = fmt.Sprintf("Updated: %s", conn.ID)
+			originalID := m.form.OriginalID()
+			if err := m.persist(func(c *config.Config) error {
+				if !c.UpdateConnection(originalID, *conn) {
+					return fmt.Errorf("connection %q no longer exists", originalID)
+				}
+				return nil
+			}); err != nil {
+				m.statusMsg = "Error saving: " + err.Error()
+			} else {
+				m.statusMsg = fmt.Sprintf("Updated: %s", conn.ID)
+			}
 		} else {
 			// Check for duplicate ID. Keep the form open with the entered
 			// values intact so the user can fix the ID instead of losing
@@ -740,13 +973,18 @@ func (m Model) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.form.submitted = false
 				return m, nil
 			}
-			m.config.AddConnection(*conn)
-			m.statusMsg = fmt.Sprintf("Added: %s", conn.ID)
-		}
-
-		// Save config
-		if err := m.config.Save(m.configPath); err != nil {
-			m.statusMsg = "Error saving: " + err.Error()
+			if err := m.persist(func(c *config.Config) error {
+				// Another hop process may have added the same ID meanwhile.
+				if c.FindConnection(conn.ID) != nil {
+					return fmt.Errorf("connection %q already exists", conn.ID)
+				}
+				c.AddConnection(*conn)
+				return nil
+			}); err != nil {
+				m.statusMsg = "Error saving: " + err.Error()
+			} else {
+				m.statusMsg = fmt.Sprintf("Added: %s", conn.ID)
+			}
 		}
 
 		m.refresh()
@@ -762,10 +1000,25 @@ func (m Model) updateConfirmDelete(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "y", "Y":
-			if m.deleteTarget != nil {
+			if len(m.deleteIDs) > 0 {
+				ids := m.deleteIDs
+				if err := m.persist(func(c *config.Config) error {
+					for _, id := range ids {
+						c.DeleteConnection(id)
+					}
+					return nil
+				}); err != nil {
+					m.statusMsg = "Error saving: " + err.Error()
+				} else {
+					m.statusMsg = fmt.Sprintf("Deleted %d connection(s)", len(ids))
+				}
+				m.refresh()
+			} else if m.deleteTarget != nil {
 				id := m.deleteTarget.ID
-				m.config.DeleteConnection(id)
-				if err := m.config.Save(m.configPath); err != nil {
+				if err := m.persist(func(c *config.Config) error {
+					c.DeleteConnection(id)
+					return nil
+				}); err != nil {
 					m.statusMsg = "Error saving: " + err.Error()
 				} else {
 					m.statusMsg = fmt.Sprintf("Deleted: %s", id)
@@ -773,10 +1026,12 @@ func (m Model) updateConfirmDelete(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.refresh()
 			}
 			m.deleteTarget = nil
+			m.deleteIDs = nil
 			m.view = viewList
 			return m, m.buildHealthCheckCmd()
 		case "n", "N", "esc":
 			m.deleteTarget = nil
+			m.deleteIDs = nil
 			m.view = viewList
 			return m, nil
 		}
@@ -811,6 +1066,70 @@ func (m Model) updatePaste(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// openExecPrompt asks for a command to run on targets.
+func (m Model) openExecPrompt(targets []config.Connection) (tea.Model, tea.Cmd) {
+	if len(targets) == 0 {
+		m.statusMsg = "No connections to run on"
+		m.view = viewList
+		return m, nil
+	}
+	m.execTargets = targets
+	m.execInput.SetValue("")
+	m.execInput.Focus()
+	m.view = viewExecPrompt
+	return m, textinput.Blink
+}
+
+func (m Model) updateExecPrompt(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			m.execInput.Blur()
+			m.view = viewList
+			return m, nil
+		case "enter":
+			command := strings.TrimSpace(m.execInput.Value())
+			if command == "" {
+				return m, nil
+			}
+			m.execInput.Blur()
+			m.execModel = NewExecModel(m.execTargets, &ssh.ExecOptions{Command: command, Parallel: 10}, command, m.width, m.height)
+			m.view = viewExec
+			return m, m.execModel.Init()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.execInput, cmd = m.execInput.Update(msg)
+	return m, cmd
+}
+
+func (m Model) updateExec(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	m.execModel, cmd = m.execModel.Update(msg)
+	if !m.execModel.Closed() {
+		return m, cmd
+	}
+
+	results := m.execModel.Results()
+	m.recordUsage(ssh.ExecUsages(results)...)
+	run := runs.New(runs.SourceTUI, "dashboard", m.execModel.command, m.execTargets)
+	run.Started = m.execModel.Started()
+	run.Transport = string(ssh.TransportSSH)
+	run.Finish(results)
+	runs.Save(run) // run history is optional
+
+	if failed := ssh.CountErrors(results); failed > 0 {
+		m.statusMsg = fmt.Sprintf("%d of %d failed (run %s)", failed, len(results), run.ID)
+	} else {
+		m.statusMsg = fmt.Sprintf("Completed on %d connection(s) (run %s)", len(results), run.ID)
+	}
+	m.execTargets = nil
+	m.view = viewList
+	return m, nil
+}
+
 func (m Model) updateTagPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -855,6 +1174,30 @@ func (m Model) updateImport(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	if m.importModel.Confirmed() && m.importModel.Syncing() {
+		plan, manage := m.importModel.Plan(), m.importModel.Manage()
+		if !plan.Accepted() && !manage {
+			m.statusMsg = "No changes selected"
+			m.view = viewList
+			return m, nil
+		}
+
+		var res sshconfig.ImportResult
+		if err := m.persist(func(c *config.Config) error {
+			res = plan.Apply(c, manage)
+			return nil
+		}); err != nil {
+			m.statusMsg = "Error saving: " + err.Error()
+		} else {
+			m.statusMsg = fmt.Sprintf("Synced: %d added, %d updated, %d removed", res.Added, res.Updated, res.Removed)
+		}
+
+		m.refresh()
+		m.collectTags()
+		m.view = viewList
+		return m, m.buildHealthCheckCmd()
+	}
+
 	if m.importModel.Confirmed() {
 		selected := m.importModel.SelectedConnections()
 		if len(selected) == 0 {
@@ -864,12 +1207,14 @@ func (m Model) updateImport(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		// Add selected connections
-		for _, conn := range selected {
-			m.config.AddConnection(conn)
-		}
-
-		// Save config
-		if err := m.config.Save(m.configPath); err != nil {
+		groups := m.importModel.SelectedGroups()
+		if err := m.persist(func(c *config.Config) error {
+			for _, conn := range selected {
+				c.AddConnection(conn)
+			}
+			importer.AddGroups(c, groups)
+			return nil
+		}); err != nil {
 			m.statusMsg = "Error saving: " + err.Error()
 		} else {
 			m.statusMsg = fmt.Sprintf("Imported %d connection(s)", len(selected))
@@ -936,12 +1281,12 @@ func (m Model) updateThemePicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	if m.themePickerModel.Confirmed() {
 		preset := m.themePickerModel.SelectedPreset()
-		previous := m.config.ThemePreset
-		m.config.ThemePreset = preset
-		if err := m.config.Save(m.configPath); err != nil {
-			// Revert config + theme on save failure so the on-disk state and
-			// the in-memory state stay in sync.
-			m.config.ThemePreset = previous
+		if err := m.persist(func(c *config.Config) error {
+			c.ThemePreset = preset
+			return nil
+		}); err != nil {
+			// Revert the theme on save failure so the on-disk state and the
+			// in-memory state stay in sync.
 			restoreTheme(m.themePickerModel.Original())
 			m.statusMsg = "Failed to save theme: " + err.Error()
 		} else {
@@ -976,6 +1321,14 @@ func (m Model) View() string {
 		return m.exportModel.View()
 	case viewThemePicker:
 		return m.themePickerModel.View()
+	case viewExecPrompt:
+		return m.renderExecPrompt()
+	case viewExec:
+		return m.execModel.View()
+	case viewBulkMenu:
+		return m.renderBulkMenu()
+	case viewBulkInput:
+		return m.renderBulkInput()
 	default:
 		return m.renderList()
 	}
@@ -1052,6 +1405,13 @@ func (m Model) renderFilterBar() string {
 		}
 	}
 
+	if m.visual {
+		filterView += "  " + filterPromptStyle.Render("VISUAL")
+	}
+	if len(m.marked) > 0 {
+		filterView += "  " + markedItemStyle.UnsetPaddingLeft().Render(fmt.Sprintf("%d marked", len(m.marked)))
+	}
+
 	return filterView
 }
 
@@ -1129,6 +1489,9 @@ func (m Model) renderListContent() string {
 		if conn.Port != 0 && conn.Port != 22 {
 			portStr = portStyle.Render(fmt.Sprintf(":%d", conn.Port))
 		}
+		if inv := conn.Inventory(); inv != "" {
+			portStr += " " + portStyle.Render("["+inv+"]")
+		}
 
 		// Calculate indent based on grouping
 		indent := ""
@@ -1139,7 +1502,8 @@ func (m Model) renderListContent() string {
 			}
 		}
 
-		// Health indicator
+		// Health indicator: a dot for the current status, then the
+		// latest round-trip time and a sparkline of recent checks.
 		healthDot := ""
 		if m.healthEnabled {
 			status := m.healthStatus[conn.ID]
@@ -1148,16 +1512,53 @@ func (m Model) renderListContent() string {
 				healthDot = healthReachableStyle.Render("●") + " "
 			case health.StatusUnreachable:
 				healthDot = healthUnreachableStyle.Render("●") + " "
+			case health.StatusPortOpen:
+				healthDot = warningStyle.Render("●") + " "
 			default:
 				healthDot = healthCheckingStyle.Render("○") + " "
 			}
+			if last, ok := m.healthHistory.Latest(conn.ID); ok && last.RTT > 0 {
+				healthDot += healthCheckingStyle.Render(formatRTT(last.RTT)) + " "
+			}
+			if spark := sparkline(m.healthHistory.Results(conn.ID), sparklineWidth); spark != "" {
+				healthDot += spark + " "
+			}
+			// The selected connection also shows what the check saw.
+			if last, ok := m.healthHistory.Latest(conn.ID); ok && isSelected {
+				if last.Banner != "" {
+					healthDot += portStyle.Render(truncateRunes(last.Banner, 40)) + " "
+				} else if last.Err != nil {
+					healthDot += portStyle.Render(truncateRunes(last.Err.Error(), 40)) + " "
+				}
+			}
+		}
+
+		// Tunnel indicator: number of running tunnels, highlighted when
+		// one of them is not up.
+		tunnels := ""
+		if states := m.tunnels[conn.ID]; len(states) > 0 {
+			style := healthReachableStyle
+			for _, st := range states {
+				if st.Status != tunnel.StatusUp {
+					style = warningStyle
+				}
+			}
+			tunnels = style.Render(fmt.Sprintf("⇄%d", len(states))) + " "
+		}
+
+		// Marked connections get a "*" after the cursor column.
+		mark := " "
+		if m.isMarked(fi) {
+			mark = markedItemStyle.UnsetPaddingLeft().Render("*")
 		}
 
 		var line string
 		if isSelected {
-			line = indent + selectedItemStyle.Render(">") + " " + selectedItemStyle.Render(padded) + "  " + userHost + portStr + " " + healthDot
+			line = indent + selectedItemStyle.Render(">") + mark + selectedItemStyle.Render(padded) + "  " + userHost + portStr + " " + healthDot + tunnels
+		} else if m.isMarked(fi) {
+			line = indent + " " + mark + markedItemStyle.Render(padded) + "  " + userHost + portStr + " " + healthDot + tunnels
 		} else {
-			line = indent + "  " + itemStyle.Render(padded) + "  " + userHost + portStr + " " + healthDot
+			line = indent + "  " + itemStyle.Render(padded) + "  " + userHost + portStr + " " + healthDot + tunnels
 		}
 
 		lines = append(lines, displayLine{text: line, filterIndex: fi})
@@ -1208,6 +1609,7 @@ func (m Model) renderFooter() string {
 		key("/", "filter"),
 		key("t", "tags"),
 		key("r", recentLabel),
+		key("space", "mark"),
 	}
 	primary := []string{
 		key("enter", "connect"),
@@ -1220,6 +1622,8 @@ func (m Model) renderFooter() string {
 		key("d", "del"),
 		key("i", "import"),
 		key("x", "export"),
+		key("!", "exec"),
+		key("b", "bulk"),
 	}
 	app := []string{
 		key("T", "theme"),
@@ -1243,8 +1647,16 @@ func (m Model) renderForm() string {
 func (m Model) renderConfirmDelete() string {
 	var b strings.Builder
 
-	b.WriteString(titleStyle.Render("Delete Connection"))
-	b.WriteString("\n\n")
+	if len(m.deleteIDs) > 0 {
+		b.WriteString(titleStyle.Render(fmt.Sprintf("Delete %d Connections", len(m.deleteIDs))))
+		b.WriteString("\n\n")
+		b.WriteString(fmt.Sprintf("Are you sure you want to delete %d marked connection(s)?\n", len(m.deleteIDs)))
+		b.WriteString(helpDescStyle.Render(markedSummary(m.markedConnections())))
+		b.WriteString("\n\n")
+	} else {
+		b.WriteString(titleStyle.Render("Delete Connection"))
+		b.WriteString("\n\n")
+	}
 
 	if m.deleteTarget != nil {
 		b.WriteString(fmt.Sprintf("Are you sure you want to delete '%s'?\n", m.deleteTarget.ID))
@@ -1288,6 +1700,26 @@ func (m Model) renderPaste() string {
 	return b.String()
 }
 
+func (m Model) renderExecPrompt() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Run a Command"))
+	b.WriteString("\n\n")
+
+	b.WriteString(helpDescStyle.Render(fmt.Sprintf("On %d connection(s): %s", len(m.execTargets), markedSummary(m.execTargets))))
+	b.WriteString("\n\n")
+
+	b.WriteString("  ")
+	b.WriteString(m.execInput.View())
+	b.WriteString("\n\n")
+
+	b.WriteString(helpKeyStyle.Render("enter") + " " + helpDescStyle.Render("run"))
+	b.WriteString("  ")
+	b.WriteString(helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("cancel"))
+
+	return b.String()
+}
+
 func (m Model) renderTagPicker() string {
 	var b strings.Builder
 
@@ -1361,8 +1793,13 @@ func sortedMapKeys[V any](m map[string]V) []string {
 	return keys
 }
 
-func Run(cfg *config.Config, version string) error {
+// Run starts the dashboard. configPath is the file edits are written back to;
+// empty means the default config path.
+func Run(cfg *config.Config, version, configPath string) error {
 	m := NewModel(cfg, version)
+	if configPath != "" {
+		m.configPath = configPath
+	}
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
 
 	_, err := p.Run()
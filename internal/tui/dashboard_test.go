@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -8,6 +9,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/x/exp/teatest"
 	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/tunnel"
 )
 
 func testConfig() *config.Config {
@@ -593,6 +595,37 @@ func TestDuplicateConnection(t *testing.T) {
 	}
 }
 
+func TestInventoryConnectionsAreReadOnly(t *testing.T) {
+	cfg := testConfig()
+	cfg.Connections = append([]config.Connection{
+		{ID: "cloud-1", Host: "10.0.0.1", Port: 22, Source: config.InventorySource("cloud")},
+	}, cfg.Connections...)
+	m := NewModel(cfg, "1.0.0")
+	m.cursor = 0
+	if conn := m.selectedConnection(); conn == nil || conn.ID != "cloud-1" {
+		t.Fatalf("selected %v, want cloud-1", conn)
+	}
+
+	for _, key := range []rune{'e', 'd'} {
+		newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{key}})
+		got := newModel.(Model)
+		if got.view != viewList || !strings.Contains(got.statusMsg, "read-only") {
+			t.Errorf("%c: view = %v, status = %q, want refused", key, got.view, got.statusMsg)
+		}
+	}
+
+	// A copy is an ordinary connection.
+	newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+	m = newModel.(Model)
+	conn, err := m.form.GetConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.ReadOnly() {
+		t.Errorf("duplicate source = %q, want a config file", conn.Source)
+	}
+}
+
 // Saving a new/duplicate connection whose ID collides with an existing one
 // must keep the form open with the entered values intact (not bounce to the
 // list and discard everything), and surface an inline error.
@@ -641,6 +674,61 @@ func TestQuit(t *testing.T) {
 	}
 }
 
+func TestSSHFinishedRecordsHistory(t *testing.T) {
+	cfg := testConfig()
+	m := NewModel(cfg, "1.0.0")
+	m.historyPath = filepath.Join(t.TempDir(), "history.yaml")
+
+	newModel, _ := m.Update(sshFinishedMsg{id: "prod-server"})
+	m = newModel.(Model)
+
+	if got := m.history.GetUseCount("prod-server"); got != 1 {
+		t.Errorf("expected in-memory use count 1, got %d", got)
+	}
+
+	loaded, err := config.LoadHistoryFromPath(m.historyPath)
+	if err != nil {
+		t.Fatalf("failed to load history: %v", err)
+	}
+	if len(loaded.Entries) != 1 {
+		t.Fatalf("expected 1 history entry on disk, got %d", len(loaded.Entries))
+	}
+	e := loaded.Entries[0]
+	if e.LastKind != config.UsageInteractive {
+		t.Errorf("LastKind = %q, want %q", e.LastKind, config.UsageInteractive)
+	}
+	if e.LastExitCode == nil || *e.LastExitCode != 0 {
+		t.Errorf("LastExitCode = %v, want 0", e.LastExitCode)
+	}
+}
+
+func TestTunnelIndicator(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	cfg := testConfig()
+	m := NewModel(cfg, "1.0.0")
+	m.width, m.height = 100, 30
+	if strings.Contains(m.renderListContent(), "⇄") {
+		t.Fatal("tunnel indicator shown without running tunnels")
+	}
+
+	// Tunnel refreshes are applied in every view, not just the list.
+	m.view = viewHelp
+	newModel, cmd := m.Update(tunnelsMsg{tunnels: map[string][]tunnel.State{
+		"prod-server": {{Connection: "prod-server", Name: "pg", Status: tunnel.StatusUp}, {Connection: "prod-server", Name: "redis", Status: tunnel.StatusRetrying}},
+	}})
+	m = newModel.(Model)
+	if cmd == nil {
+		t.Error("expected the next tunnel refresh to be scheduled")
+	}
+
+	m.view = viewList
+	for _, line := range strings.Split(m.renderListContent(), "\n") {
+		if strings.Contains(line, "prod-server") != strings.Contains(line, "⇄2") {
+			t.Errorf("unexpected tunnel indicator on line %q", line)
+		}
+	}
+}
+
 // Integration test using teatest
 func TestDashboardIntegration(t *testing.T) {
 	cfg := testConfig()
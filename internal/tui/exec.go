@@ -0,0 +1,630 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+// execRefreshInterval is how often the exec view redraws while hosts run.
+const execRefreshInterval = 100 * time.Millisecond
+
+// maxHostOutput is how much of each host's output the exec view keeps;
+// older output is dropped from the front.
+const maxHostOutput = 1 << 20
+
+// hostStatus is where a host is in an exec run.
+type hostStatus int
+
+const (
+	hostPending hostStatus = iota
+	hostRunning
+	hostOK
+	hostFailed
+	hostCancelled
+	hostSkipped
+)
+
+func (s hostStatus) String() string {
+	switch s {
+	case hostRunning:
+		return "running"
+	case hostOK:
+		return "ok"
+	case hostFailed:
+		return "failed"
+	case hostCancelled:
+		return "cancelled"
+	case hostSkipped:
+		return "skipped"
+	default:
+		return "pending"
+	}
+}
+
+func (s hostStatus) finished() bool {
+	return s != hostPending && s != hostRunning
+}
+
+func (s hostStatus) style() lipgloss.Style {
+	switch s {
+	case hostRunning:
+		return execRunningStyle
+	case hostOK:
+		return execOKStyle
+	case hostFailed:
+		return execFailedStyle
+	default:
+		return execPendingStyle
+	}
+}
+
+// execHost is one host of an exec run. Its fields are guarded by the
+// run's mutex.
+type execHost struct {
+	conn      config.Connection
+	status    hostStatus
+	started   time.Time
+	duration  time.Duration
+	exitCode  int
+	err       error
+	output    []byte
+	ctx       context.Context
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// execRun is the state shared by the exec view and the goroutines running
+// its hosts.
+type execRun struct {
+	mu     sync.Mutex
+	hosts  []*execHost
+	byID   map[string]*execHost
+	batch  string
+	cancel context.CancelFunc
+}
+
+func (r *execRun) host(conn *config.Connection) *execHost {
+	return r.byID[conn.ID]
+}
+
+// hostWriter appends to a host's output.
+type hostWriter struct {
+	run  *execRun
+	host *execHost
+}
+
+func (w hostWriter) Write(p []byte) (int, error) {
+	w.run.mu.Lock()
+	defer w.run.mu.Unlock()
+	w.host.output = append(w.host.output, p...)
+	if over := len(w.host.output) - maxHostOutput; over > 0 {
+		w.host.output = w.host.output[over:]
+	}
+	return len(p), nil
+}
+
+type execTickMsg struct{}
+
+type execDoneMsg struct {
+	results []ssh.ExecResult
+}
+
+func execTick() tea.Cmd {
+	return tea.Tick(execRefreshInterval, func(time.Time) tea.Msg { return execTickMsg{} })
+}
+
+// ExecModel runs a command on several hosts and shows a live status table.
+// A host's full output can be opened and scrolled, and single hosts or the
+// whole run can be cancelled.
+type ExecModel struct {
+	run         *execRun
+	ctx         context.Context
+	connections []config.Connection
+	opts        *ssh.ExecOptions
+	command     string
+	started     time.Time
+	elapsed     time.Duration
+	results     []ssh.ExecResult
+	done        bool
+	cursor      int
+	scrollTop   int
+	viewing     bool
+	viewport    viewport.Model
+	width       int
+	height      int
+	quitting    bool
+	closed      bool
+}
+
+// NewExecModel prepares a run of opts.Command on connections; Init starts
+// it. opts is copied; its OnStart, Output, HostContext and OnBatch hooks
+// are replaced by the view's own, and OnResult is still called.
+func NewExecModel(connections []config.Connection, opts *ssh.ExecOptions, command string, width, height int) ExecModel {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &execRun{byID: make(map[string]*execHost), cancel: cancel}
+	for _, conn := range connections {
+		h := &execHost{conn: conn}
+		h.ctx, h.cancel = context.WithCancel(ctx)
+		run.hosts = append(run.hosts, h)
+		run.byID[conn.ID] = h
+	}
+
+	o := *opts
+	o.Stream = false
+	onResult := opts.OnResult
+	o.OnResult = func(r ssh.ExecResult) {
+		run.mu.Lock()
+		run.host(r.Connection).finish(r)
+		run.mu.Unlock()
+		if onResult != nil {
+			onResult(r)
+		}
+	}
+	o.OnStart = func(conn *config.Connection) {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		h := run.host(conn)
+		h.status = hostRunning
+		h.started = time.Now()
+	}
+	o.Output = func(conn *config.Connection) (stdout, stderr io.Writer) {
+		w := hostWriter{run: run, host: run.host(conn)}
+		return w, w
+	}
+	o.HostContext = func(conn *config.Connection) context.Context {
+		return run.host(conn).ctx
+	}
+	o.OnBatch = func(e ssh.BatchEvent) {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		switch e.Kind {
+		case ssh.BatchStarted:
+			run.batch = fmt.Sprintf("batch %d/%d", e.Batch, e.Batches)
+			if e.Canary {
+				run.batch = fmt.Sprintf("canary %d/%d", e.Batch, e.Batches)
+			}
+		case ssh.BatchPausing:
+			run.batch = fmt.Sprintf("pausing %s before batch %d/%d", e.Duration, e.Batch, e.Batches)
+		case ssh.BatchGating:
+			run.batch = fmt.Sprintf("checking before batch %d/%d", e.Batch, e.Batches)
+		case ssh.BatchStopped:
+			run.batch = fmt.Sprintf("stopped: %v", e.Err)
+		}
+	}
+
+	vp := viewport.New(width, max(height-5, 1))
+	return ExecModel{
+		run:         run,
+		ctx:         ctx,
+		connections: connections,
+		opts:        &o,
+		command:     command,
+		started:     time.Now(),
+		viewport:    vp,
+		width:       width,
+		height:      height,
+	}
+}
+
+// Init starts the run.
+func (m ExecModel) Init() tea.Cmd {
+	ctx, conns, opts := m.ctx, m.connections, m.opts
+	return tea.Batch(func() tea.Msg {
+		return execDoneMsg{results: ssh.ExecuteContext(ctx, conns, opts)}
+	}, execTick())
+}
+
+// Started reports when the run was started, for callers that store it.
+func (m ExecModel) Started() time.Time {
+	return m.started
+}
+
+func (m ExecModel) Update(msg tea.Msg) (ExecModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.viewport.Width = msg.Width
+		m.viewport.Height = max(msg.Height-5, 1)
+		m.ensureVisible()
+	case execTickMsg:
+		if m.done {
+			return m, nil
+		}
+		m.elapsed = time.Since(m.started)
+		m.refreshViewport()
+		return m, execTick()
+	case execDoneMsg:
+		m.finish(msg.results)
+		m.refreshViewport()
+		if m.quitting {
+			m.closed = true
+		}
+		return m, nil
+	case tea.KeyMsg:
+		if m.viewing {
+			return m.updateOutput(msg)
+		}
+		return m.updateTable(msg)
+	}
+	return m, nil
+}
+
+func (m ExecModel) updateTable(msg tea.KeyMsg) (ExecModel, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc", "ctrl+c":
+		if m.done {
+			m.closed = true
+			return m, nil
+		}
+		m.cancelAll()
+		m.quitting = true
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.run.hosts)-1 {
+			m.cursor++
+		}
+	case "pgup":
+		m.cursor = max(m.cursor-m.visibleRows(), 0)
+	case "pgdown":
+		m.cursor = min(m.cursor+m.visibleRows(), len(m.run.hosts)-1)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.run.hosts) - 1
+	case "enter", "l", "right":
+		if len(m.run.hosts) > 0 {
+			m.viewing = true
+			m.refreshViewport()
+			m.viewport.GotoBottom()
+		}
+	case "c":
+		m.cancelHost(m.cursor)
+	case "C":
+		m.cancelAll()
+	}
+	m.ensureVisible()
+	return m, nil
+}
+
+func (m ExecModel) updateOutput(msg tea.KeyMsg) (ExecModel, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc", "h", "left":
+		m.viewing = false
+		return m, nil
+	case "ctrl+c":
+		m.viewing = false
+		return m.updateTable(msg)
+	case "c":
+		m.cancelHost(m.cursor)
+		return m, nil
+	case "n":
+		if m.cursor < len(m.run.hosts)-1 {
+			m.cursor++
+			m.refreshViewport()
+			m.viewport.GotoBottom()
+		}
+		return m, nil
+	case "p":
+		if m.cursor > 0 {
+			m.cursor--
+			m.refreshViewport()
+			m.viewport.GotoBottom()
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// refreshViewport loads the viewed host's output, following its end when
+// the view was already scrolled to the bottom.
+func (m *ExecModel) refreshViewport() {
+	if !m.viewing || m.cursor >= len(m.run.hosts) {
+		return
+	}
+	m.run.mu.Lock()
+	content := strings.ReplaceAll(string(m.run.hosts[m.cursor].output), "\r\n", "\n")
+	m.run.mu.Unlock()
+	follow := m.viewport.AtBottom()
+	m.viewport.SetContent(content)
+	if follow {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *ExecModel) cancelHost(i int) {
+	if i < 0 || i >= len(m.run.hosts) {
+		return
+	}
+	m.run.mu.Lock()
+	defer m.run.mu.Unlock()
+	h := m.run.hosts[i]
+	if !h.status.finished() {
+		h.cancelled = true
+		h.cancel()
+	}
+}
+
+func (m *ExecModel) cancelAll() {
+	m.run.mu.Lock()
+	for _, h := range m.run.hosts {
+		if !h.status.finished() {
+			h.cancelled = true
+		}
+	}
+	m.run.mu.Unlock()
+	m.run.cancel()
+}
+
+// finish records the run's results as each host's final state.
+func (m *ExecModel) finish(results []ssh.ExecResult) {
+	m.done = true
+	m.results = results
+	m.elapsed = time.Since(m.started)
+	m.run.mu.Lock()
+	defer m.run.mu.Unlock()
+	for i, r := range results {
+		m.run.hosts[i].finish(r)
+	}
+	m.run.batch = ""
+}
+
+// finish records a host's result. The run's mutex must be held.
+func (h *execHost) finish(r ssh.ExecResult) {
+	if h.status.finished() {
+		return
+	}
+	h.duration = r.Duration
+	h.exitCode = r.ExitCode
+	h.err = r.Error
+	switch {
+	case r.Error == nil:
+		h.status = hostOK
+	case h.cancelled:
+		h.status = hostCancelled
+	case r.Skipped:
+		h.status = hostSkipped
+	default:
+		h.status = hostFailed
+	}
+	if len(h.output) == 0 && r.Error != nil {
+		h.output = []byte(r.Error.Error() + "\n")
+	}
+}
+
+// Done reports whether every host has finished.
+func (m ExecModel) Done() bool {
+	return m.done
+}
+
+// Closed reports whether the user has left the view after the run ended.
+func (m ExecModel) Closed() bool {
+	return m.closed
+}
+
+// Results returns each host's result once the run is done.
+func (m ExecModel) Results() []ssh.ExecResult {
+	return m.results
+}
+
+func (m ExecModel) visibleRows() int {
+	return max(m.height-7, 1)
+}
+
+func (m *ExecModel) ensureVisible() {
+	rows := m.visibleRows()
+	if m.cursor < m.scrollTop {
+		m.scrollTop = m.cursor
+	}
+	if m.cursor >= m.scrollTop+rows {
+		m.scrollTop = m.cursor - rows + 1
+	}
+}
+
+func (m ExecModel) View() string {
+	if m.viewing {
+		return m.renderOutput()
+	}
+	return m.renderTable()
+}
+
+func (m ExecModel) renderTable() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Exec: " + m.command))
+	b.WriteString("\n")
+	b.WriteString(helpDescStyle.Render(m.summary()))
+	b.WriteString("\n\n")
+
+	m.run.mu.Lock()
+	idWidth := 2
+	for _, h := range m.run.hosts {
+		idWidth = max(idWidth, lipgloss.Width(h.conn.ID))
+	}
+	rows := m.visibleRows()
+	end := min(m.scrollTop+rows, len(m.run.hosts))
+	for i := m.scrollTop; i < end; i++ {
+		h := m.run.hosts[i]
+		marker := "  "
+		if i == m.cursor {
+			marker = selectedItemStyle.Render("> ")
+		}
+		status := h.status.style().Render(fmt.Sprintf("%-9s", h.status))
+		id := fmt.Sprintf("%-*s", idWidth, h.conn.ID)
+		if i == m.cursor {
+			id = selectedItemStyle.UnsetPaddingLeft().Render(id)
+		}
+		duration := fmt.Sprintf("%8s", hostDuration(h))
+		used := 2 + 9 + 1 + idWidth + 1 + 8 + 2
+		last := truncateRunes(lastLine(h.output), m.width-used)
+		fmt.Fprintf(&b, "%s%s %s %s  %s\n", marker, status, id, duration, hostStyle.Render(last))
+	}
+	m.run.mu.Unlock()
+
+	if len(m.run.hosts) > rows {
+		b.WriteString(helpDescStyle.Render(fmt.Sprintf("  %d-%d of %d", m.scrollTop+1, end, len(m.run.hosts))))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	key := func(k, label string) string {
+		return helpKeyStyle.Render(k) + " " + helpDescStyle.Render(label)
+	}
+	help := []string{key("↑/↓", "nav"), key("enter", "output")}
+	if m.done {
+		help = append(help, key("q", "close"))
+	} else {
+		help = append(help, key("c", "cancel host"), key("C", "cancel all"), key("q", "cancel and close"))
+	}
+	b.WriteString(strings.Join(help, "  "))
+
+	return b.String()
+}
+
+func (m ExecModel) renderOutput() string {
+	m.run.mu.Lock()
+	h := m.run.hosts[m.cursor]
+	header := fmt.Sprintf("%s  %s  %s", h.conn.ID, h.status.style().Render(h.status.String()), hostDuration(h))
+	if h.status == hostFailed && h.exitCode > 0 {
+		header += fmt.Sprintf("  exit %d", h.exitCode)
+	}
+	m.run.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(header))
+	b.WriteString("\n\n")
+	b.WriteString(m.viewport.View())
+	b.WriteString("\n\n")
+	key := func(k, label string) string {
+		return helpKeyStyle.Render(k) + " " + helpDescStyle.Render(label)
+	}
+	help := []string{key("↑/↓", "scroll"), key("n/p", "next/prev host"), key("esc", "back")}
+	if !m.done {
+		help = append(help, key("c", "cancel host"))
+	}
+	b.WriteString(strings.Join(help, "  "))
+	return b.String()
+}
+
+// summary counts hosts by status, e.g. "2 running · 5 ok · 1 failed · 3.2s".
+func (m ExecModel) summary() string {
+	m.run.mu.Lock()
+	defer m.run.mu.Unlock()
+	counts := make(map[hostStatus]int)
+	for _, h := range m.run.hosts {
+		counts[h.status]++
+	}
+	var parts []string
+	for _, s := range []hostStatus{hostRunning, hostPending, hostOK, hostFailed, hostCancelled, hostSkipped} {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	parts = append(parts, m.elapsed.Round(100*time.Millisecond).String())
+	if m.run.batch != "" {
+		parts = append(parts, m.run.batch)
+	}
+	if m.done {
+		parts = append(parts, "done")
+	}
+	return strings.Join(parts, " · ")
+}
+
+// hostDuration is how long a host ran, or has been running so far.
+func hostDuration(h *execHost) string {
+	switch {
+	case h.status == hostRunning:
+		return time.Since(h.started).Round(100 * time.Millisecond).String()
+	case h.status.finished() && h.duration > 0:
+		return h.duration.Round(time.Millisecond).String()
+	}
+	return "-"
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// lastLine returns the last non-empty line of output without escape
+// sequences, for the status table.
+func lastLine(output []byte) string {
+	s := strings.TrimRight(string(output), "\r\n\t ")
+	if i := strings.LastIndexAny(s, "\r\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	s = ansiEscape.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// truncateRunes shortens s to at most n runes.
+func truncateRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n == 1 {
+		return "…"
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// execProgram runs an ExecModel as a program of its own, for hop exec --tui.
+type execProgram struct {
+	exec ExecModel
+}
+
+func (p execProgram) Init() tea.Cmd {
+	return p.exec.Init()
+}
+
+func (p execProgram) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	p.exec, cmd = p.exec.Update(msg)
+	if p.exec.Closed() {
+		return p, tea.Quit
+	}
+	return p, cmd
+}
+
+func (p execProgram) View() string {
+	return p.exec.View()
+}
+
+// RunExec runs opts.Command on connections in the exec view and returns the
+// results once the user closes it. Keys are read from the terminal rather
+// than stdin, which may be feeding the command.
+func RunExec(cfg *config.Config, connections []config.Connection, opts *ssh.ExecOptions, command string) ([]ssh.ExecResult, error) {
+	InitTheme(cfg)
+	p := tea.NewProgram(execProgram{exec: NewExecModel(connections, opts, command, 80, 24)},
+		tea.WithAltScreen(), tea.WithInputTTY())
+	final, err := p.Run()
+	if err != nil {
+		return nil, fmt.Errorf("TUI error: %w", err)
+	}
+	return final.(execProgram).exec.Results(), nil
+}
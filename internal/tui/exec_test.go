@@ -0,0 +1,182 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+func execTestModel(ids ...string) ExecModel {
+	conns := make([]config.Connection, len(ids))
+	for i, id := range ids {
+		conns[i] = config.Connection{ID: id, Host: id + ".example.com"}
+	}
+	return NewExecModel(conns, &ssh.ExecOptions{Command: "uptime"}, "uptime", 100, 30)
+}
+
+func execKey(m ExecModel, key string) ExecModel {
+	var msg tea.KeyMsg
+	switch key {
+	case "enter":
+		msg = tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		msg = tea.KeyMsg{Type: tea.KeyEsc}
+	case "down":
+		msg = tea.KeyMsg{Type: tea.KeyDown}
+	default:
+		msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+	}
+	m, _ = m.Update(msg)
+	return m
+}
+
+func TestExecModel_HostStatuses(t *testing.T) {
+	m := execTestModel("web1", "web2", "web3")
+	web1, web2 := &m.connections[0], &m.connections[1]
+
+	m.opts.OnStart(web1)
+	m.opts.OnStart(web2)
+	stdout, _ := m.opts.Output(web1)
+	stdout.Write([]byte("first\nload average: 0.1\n"))
+	m.opts.OnResult(ssh.ExecResult{Connection: web1})
+
+	view := m.View()
+	for _, want := range []string{"Exec: uptime", "1 running", "1 pending", "1 ok", "load average: 0.1"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view missing %q:\n%s", want, view)
+		}
+	}
+
+	m, _ = m.Update(execDoneMsg{results: []ssh.ExecResult{
+		{Connection: web1},
+		{Connection: web2, ExitCode: 2, Error: errors.New("exit status 2")},
+		{Connection: &m.connections[2], Skipped: true, Error: errors.New("fail-fast")},
+	}})
+	if !m.Done() || m.Closed() {
+		t.Fatalf("done = %v, closed = %v", m.Done(), m.Closed())
+	}
+	want := []hostStatus{hostOK, hostFailed, hostSkipped}
+	for i, h := range m.run.hosts {
+		if h.status != want[i] {
+			t.Errorf("%s: status = %s, want %s", h.conn.ID, h.status, want[i])
+		}
+	}
+	if !strings.Contains(m.View(), "exit status 2") {
+		t.Error("expected failed host's error as its last output line")
+	}
+
+	m = execKey(m, "q")
+	if !m.Closed() {
+		t.Error("q after the run should close the view")
+	}
+}
+
+func TestExecModel_CancelHost(t *testing.T) {
+	m := execTestModel("web1", "web2")
+	m.opts.OnStart(&m.connections[0])
+
+	m = execKey(m, "c")
+	web1 := m.opts.HostContext(&m.connections[0])
+	if !errors.Is(web1.Err(), context.Canceled) {
+		t.Error("c should cancel the selected host")
+	}
+	if m.opts.HostContext(&m.connections[1]).Err() != nil {
+		t.Error("c should leave other hosts running")
+	}
+
+	m, _ = m.Update(execDoneMsg{results: []ssh.ExecResult{
+		{Connection: &m.connections[0], ExitCode: -1, Error: context.Canceled},
+		{Connection: &m.connections[1]},
+	}})
+	if m.run.hosts[0].status != hostCancelled {
+		t.Errorf("web1 status = %s, want cancelled", m.run.hosts[0].status)
+	}
+}
+
+func TestExecModel_QuitWhileRunning(t *testing.T) {
+	m := execTestModel("web1", "web2")
+
+	m = execKey(m, "q")
+	if m.Closed() {
+		t.Fatal("q while running should wait for the run to stop")
+	}
+	for _, conn := range m.connections {
+		if m.opts.HostContext(&conn).Err() == nil {
+			t.Errorf("%s: expected cancelled context", conn.ID)
+		}
+	}
+
+	m, _ = m.Update(execDoneMsg{results: []ssh.ExecResult{
+		{Connection: &m.connections[0], Skipped: true, Error: context.Canceled},
+		{Connection: &m.connections[1], Skipped: true, Error: context.Canceled},
+	}})
+	if !m.Closed() {
+		t.Error("expected the view to close once the run stopped")
+	}
+	if len(m.Results()) != 2 {
+		t.Errorf("results = %d, want 2", len(m.Results()))
+	}
+}
+
+func TestExecModel_OutputView(t *testing.T) {
+	m := execTestModel("web1", "web2")
+	stdout, stderr := m.opts.Output(&m.connections[1])
+	stdout.Write([]byte("hello from web2\n"))
+	stderr.Write([]byte("warning\n"))
+
+	m = execKey(m, "down")
+	m = execKey(m, "enter")
+	view := m.View()
+	if !strings.Contains(view, "hello from web2") || !strings.Contains(view, "warning") {
+		t.Errorf("output view missing web2 output:\n%s", view)
+	}
+
+	m = execKey(m, "esc")
+	if m.viewing {
+		t.Error("esc should return to the host table")
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"one\ntwo\n", "two"},
+		{"progress 10%\rprogress 50%", "progress 50%"},
+		{"\x1b[32mok\x1b[0m\n\n", "ok"},
+		{"a\tb", "a b"},
+	}
+	for _, tt := range tests {
+		if got := lastLine([]byte(tt.in)); got != tt.want {
+			t.Errorf("lastLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDashboardExecPrompt(t *testing.T) {
+	m := NewModel(testConfig(), "1.0.0")
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("!")})
+	m = updated.(Model)
+	if m.view != viewExecPrompt {
+		t.Fatalf("expected viewExecPrompt, got %v", m.view)
+	}
+	if len(m.execTargets) != 3 {
+		t.Errorf("exec targets = %d, want the 3 listed connections", len(m.execTargets))
+	}
+	if !strings.Contains(m.View(), "On 3 connection(s)") {
+		t.Errorf("prompt view:\n%s", m.View())
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(Model)
+	if m.view != viewList {
+		t.Errorf("esc should return to the list, got %v", m.view)
+	}
+}
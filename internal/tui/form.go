@@ -97,6 +97,13 @@ func NewFormModel(title string, conn *config.Connection) FormModel {
 func NewDuplicateFormModel(src *config.Connection, suggestedID string) FormModel {
 	dup := src.Clone()
 	dup.ID = suggestedID
+	// Only the original stays managed by its SSH config host.
+	dup.SSHConfigHost = ""
+	// A copy of an inventory connection is an ordinary one, saved to the
+	// main config.
+	if dup.ReadOnly() {
+		dup.Source = ""
+	}
 
 	m := NewFormModel(fmt.Sprintf("Add Connection — copy of %q", src.ID), nil)
 	m.original = dup
@@ -0,0 +1,64 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/health"
+)
+
+// sparklineWidth is how many recent checks the list shows per host.
+const sparklineWidth = 10
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the RTTs of the last n results, scaled between the
+// fastest and slowest of them. Failed checks show as a red dot. It returns
+// "" until there are at least two results.
+func sparkline(results []health.Result, n int) string {
+	if len(results) < 2 {
+		return ""
+	}
+	if len(results) > n {
+		results = results[len(results)-n:]
+	}
+
+	var lo, hi time.Duration
+	for _, r := range results {
+		if r.Status == health.StatusUnreachable {
+			continue
+		}
+		if lo == 0 || r.RTT < lo {
+			lo = r.RTT
+		}
+		if r.RTT > hi {
+			hi = r.RTT
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range results {
+		if r.Status == health.StatusUnreachable {
+			b.WriteString(healthUnreachableStyle.Render("·"))
+			continue
+		}
+		i := 0
+		if hi > lo {
+			i = int((r.RTT - lo) * time.Duration(len(sparkBars)-1) / (hi - lo))
+		}
+		b.WriteString(healthCheckingStyle.Render(string(sparkBars[i])))
+	}
+	return b.String()
+}
+
+// formatRTT formats a round-trip time compactly, e.g. "12ms" or "1.2s".
+func formatRTT(d time.Duration) string {
+	if d < time.Millisecond {
+		return "<1ms"
+	}
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
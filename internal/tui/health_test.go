@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/health"
+)
+
+func TestSparkline(t *testing.T) {
+	ok := func(ms int) health.Result {
+		return health.Result{Status: health.StatusReachable, RTT: time.Duration(ms) * time.Millisecond}
+	}
+	down := health.Result{Status: health.StatusUnreachable}
+
+	tests := []struct {
+		name    string
+		results []health.Result
+		n       int
+		want    string
+	}{
+		{"too few", []health.Result{ok(10)}, 10, ""},
+		{"scaled", []health.Result{ok(10), ok(20), ok(80)}, 10, "▁▂█"},
+		{"flat", []health.Result{ok(10), ok(10)}, 10, "▁▁"},
+		{"failures", []health.Result{ok(10), down, ok(30)}, 10, "▁·█"},
+		{"last n", []health.Result{ok(90), ok(10), ok(20)}, 2, "▁█"},
+	}
+	for _, tt := range tests {
+		if got := sparkline(tt.results, tt.n); got != tt.want {
+			t.Errorf("%s: sparkline = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRTT(t *testing.T) {
+	tests := map[time.Duration]string{
+		300 * time.Microsecond:  "<1ms",
+		12 * time.Millisecond:   "12ms",
+		1250 * time.Millisecond: "1.2s",
+	}
+	for d, want := range tests {
+		if got := formatRTT(d); got != want {
+			t.Errorf("formatRTT(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestHealthRound(t *testing.T) {
+	m := NewModel(testConfig(), "1.0.0")
+	m.healthInterval = time.Minute
+
+	round := healthRoundMsg{
+		ids: []string{"dev-server", "prod-server", "staging"},
+		results: []health.Result{
+			{Status: health.StatusReachable, RTT: 12 * time.Millisecond, Banner: "SSH-2.0-OpenSSH_9.6"},
+			{Status: health.StatusPortOpen, RTT: 3 * time.Millisecond},
+			{Status: health.StatusUnreachable},
+		},
+		periodic: true,
+	}
+	updated, cmd := m.Update(round)
+	m = updated.(Model)
+	if cmd == nil {
+		t.Error("a periodic round should schedule the next one")
+	}
+	if m.healthStatus["prod-server"] != health.StatusPortOpen {
+		t.Errorf("prod-server status = %s", m.healthStatus["prod-server"])
+	}
+	if len(m.healthHistory.Results("staging")) != 1 {
+		t.Error("expected the round in the history")
+	}
+
+	view := m.View()
+	for _, want := range []string{"12ms", "SSH-2.0-OpenSSH_9.6"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view missing %q:\n%s", want, view)
+		}
+	}
+
+	round.periodic = false
+	if _, cmd := m.Update(round); cmd != nil {
+		t.Error("a one-off round should not schedule another")
+	}
+}
+
+func TestHealthRoundConnectionsSkipsJumpHosts(t *testing.T) {
+	on := true
+	cfg := testConfig()
+	cfg.Connections = []config.Connection{
+		{ID: "direct", Host: "a"},
+		{ID: "jumped", Host: "b", ProxyJump: "bastion"},
+		{ID: "muxed", Host: "c", ProxyJump: "bastion", Multiplex: &on},
+		{ID: "nojump", Host: "d", ProxyJump: "none"},
+	}
+	m := NewModel(cfg, "1.0.0")
+
+	ids := func(conns []config.Connection) string {
+		var ids []string
+		for _, c := range conns {
+			ids = append(ids, c.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+	if got := ids(m.healthRoundConnections(true)); got != "direct,muxed,nojump" {
+		t.Errorf("periodic round checks %s", got)
+	}
+	if got := ids(m.healthRoundConnections(false)); got != "direct,jumped,muxed,nojump" {
+		t.Errorf("one-off round checks %s", got)
+	}
+}
@@ -47,7 +47,16 @@ func (m HelpModel) View() string {
 				{"g", "Go to top"},
 				{"G", "Go to bottom"},
 				{"/", "Filter connections"},
-				{"esc", "Clear filter"},
+				{"esc", "Clear filter, then marks"},
+			},
+		},
+		{
+			title: "Multi-select",
+			keys: [][]string{
+				{"space", "Mark/unmark selected"},
+				{"v", "Start/finish marking a range"},
+				{"ctrl+a", "Mark/unmark all listed"},
+				{"b", "Bulk actions on marked"},
 			},
 		},
 		{
@@ -58,10 +67,11 @@ func (m HelpModel) View() string {
 				{"p", "Paste SSH string (quick add)"},
 				{"e", "Edit selected connection"},
 				{"c", "Duplicate selected (prefilled copy)"},
-				{"d", "Delete selected connection"},
+				{"d", "Delete selected (or marked)"},
 				{"y", "Copy SSH command"},
-				{"x", "Export connections to YAML"},
-				{"R", "Refresh health checks"},
+				{"x", "Export listed (or marked) to YAML"},
+				{"!", "Run a command on listed (or marked)"},
+				{"R", "Re-check health now"},
 			},
 		},
 		{
@@ -2,10 +2,13 @@ package tui
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/importer"
 	"github.com/danmartuszewski/hop/internal/sshconfig"
 )
 
@@ -28,48 +31,39 @@ type ImportModel struct {
 	err        error
 	scrollTop  int
 	configPath string
-}
-
-// NewImportModel creates a new import model by parsing SSH config
-func NewImportModel(existingIDs map[string]bool, sshConfigPath string, hopConfigPath string, width, height int) ImportModel {
-	hosts, err := sshconfig.Parse(sshConfigPath)
-	if err != nil {
-		return ImportModel{err: err, configPath: hopConfigPath, width: width, height: height}
-	}
-
-	// Make a copy of existingIDs to track as we process
-	usedIDs := make(map[string]bool)
-	for k, v := range existingIDs {
-		usedIDs[k] = v
-	}
-
-	var items []ImportItem
-	for _, host := range hosts {
-		conn := host.ToConnection()
-		originalID := conn.ID
-		renamed := false
 
-		// Handle ID conflicts
-		if usedIDs[conn.ID] {
-			conn.ID = sshconfig.ResolveConflict(conn.ID, usedIDs)
-			renamed = true
-		}
-		usedIDs[conn.ID] = true
-
-		items = append(items, ImportItem{
-			Original:   originalID,
-			Connection: conn,
-			Renamed:    renamed,
-			Selected:   true, // All selected by default
-		})
-	}
+	// Where the items came from, and what else was found there.
+	existing []config.Connection
+	source   string // importer name
+	path     string
+	groups   map[string][]string
+	skipped  []string
+
+	// Source picker, opened with f.
+	picking   bool
+	formatIdx int
+	pathInput textinput.Model
+
+	// Sync view: how the SSH config differs from existing connections.
+	syncing bool
+	plan    sshconfig.ImportPlan
+	rows    []syncRow
+	manage  bool
+}
 
-	return ImportModel{
-		items:      items,
+// NewImportModel creates a new import model by parsing SSH config. It opens
+// in the sync view when hosts match existing connections, i.e. when the
+// config has been imported before. f switches to another source.
+func NewImportModel(existing []config.Connection, sshConfigPath string, hopConfigPath string, width, height int) ImportModel {
+	m := ImportModel{
+		existing:   existing,
 		configPath: hopConfigPath,
 		width:      width,
 		height:     height,
 	}
+	imp, _ := importer.Lookup(importer.DefaultFormat)
+	m.load(imp, sshConfigPath)
+	return m
 }
 
 func (m ImportModel) Init() tea.Cmd {
@@ -77,12 +71,29 @@ func (m ImportModel) Init() tea.Cmd {
 }
 
 func (m ImportModel) Update(msg tea.Msg) (ImportModel, tea.Cmd) {
+	if m.picking {
+		return m.updateSource(msg)
+	}
+
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 
 	case tea.KeyMsg:
+		switch msg.String() {
+		case "s":
+			if m.source == importer.DefaultFormat && m.err == nil {
+				m.syncing = !m.syncing
+				m.cursor, m.scrollTop = 0, 0
+			}
+			return m, nil
+		case "f":
+			return m.openSourcePicker()
+		}
+		if m.syncing {
+			return m.updateSync(msg), nil
+		}
 		switch msg.String() {
 		case "esc", "q":
 			m.cancelled = true
@@ -150,24 +161,42 @@ func (m ImportModel) visibleHeight() int {
 }
 
 func (m ImportModel) View() string {
+	if m.picking {
+		return m.viewSource()
+	}
+	if m.syncing && m.err == nil {
+		return m.viewSync()
+	}
+
 	var b strings.Builder
 
-	b.WriteString(titleStyle.Render("Import from SSH Config"))
+	title := "Import from SSH Config"
+	if m.source != importer.DefaultFormat {
+		title = fmt.Sprintf("Import from %s (%s)", filepath.Base(m.path), m.source)
+	}
+	b.WriteString(titleStyle.Render(title))
 	b.WriteString("\n\n")
 
+	closeHelp := helpKeyStyle.Render("f") + " " + helpDescStyle.Render("source") + "  " +
+		helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("close")
+
 	if m.err != nil {
 		b.WriteString(emptyStyle.Render(fmt.Sprintf("Error: %v", m.err)))
 		b.WriteString("\n\n")
-		b.WriteString(helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("close"))
+		b.WriteString(closeHelp)
 		return b.String()
 	}
 
 	if len(m.items) == 0 {
-		b.WriteString(emptyStyle.Render("No importable connections found in SSH config."))
-		b.WriteString("\n")
-		b.WriteString(helpDescStyle.Render("(Wildcard patterns like Host * are automatically skipped)"))
+		if m.source == importer.DefaultFormat {
+			b.WriteString(emptyStyle.Render("No importable connections found in SSH config."))
+			b.WriteString("\n")
+			b.WriteString(helpDescStyle.Render("(Wildcard patterns like Host * are automatically skipped)"))
+		} else {
+			b.WriteString(emptyStyle.Render("No importable connections found."))
+		}
 		b.WriteString("\n\n")
-		b.WriteString(helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("close"))
+		b.WriteString(closeHelp)
 		return b.String()
 	}
 
@@ -180,7 +209,19 @@ func (m ImportModel) View() string {
 	}
 
 	b.WriteString(helpDescStyle.Render(fmt.Sprintf("Select connections to import (%d/%d selected):", selectedCount, len(m.items))))
-	b.WriteString("\n\n")
+	b.WriteString("\n")
+	if len(m.skipped) > 0 {
+		b.WriteString(warningStyle.Render(fmt.Sprintf("Skipped %d: %s", len(m.skipped), m.skipped[0])))
+		if len(m.skipped) > 1 {
+			b.WriteString(helpDescStyle.Render(", ..."))
+		}
+		b.WriteString("\n")
+	}
+	if len(m.groups) > 0 {
+		b.WriteString(helpDescStyle.Render(fmt.Sprintf("Adds %d group(s) for the selected connections", len(m.groups))))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
 
 	// Display items with scrolling
 	visibleHeight := m.visibleHeight()
@@ -270,6 +311,10 @@ func (m ImportModel) View() string {
 	help += helpKeyStyle.Render("a") + " " + helpDescStyle.Render("all") + "  "
 	help += helpKeyStyle.Render("n") + " " + helpDescStyle.Render("none") + "  "
 	help += helpKeyStyle.Render("enter") + " " + helpDescStyle.Render("import") + "  "
+	if m.source == importer.DefaultFormat {
+		help += helpKeyStyle.Render("s") + " " + helpDescStyle.Render("sync view") + "  "
+	}
+	help += helpKeyStyle.Render("f") + " " + helpDescStyle.Render("source") + "  "
 	help += helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("cancel")
 	b.WriteString(help)
 
@@ -295,6 +340,26 @@ func (m ImportModel) SelectedConnections() []config.Connection {
 	return selected
 }
 
+// SelectedGroups returns the imported groups, limited to the selected
+// connections and using the IDs they are imported under.
+func (m ImportModel) SelectedGroups() map[string][]string {
+	ids := make(map[string]string)
+	for _, item := range m.items {
+		if item.Selected {
+			ids[item.Original] = item.Connection.ID
+		}
+	}
+	groups := make(map[string][]string)
+	for name, members := range m.groups {
+		for _, id := range members {
+			if newID, ok := ids[id]; ok {
+				groups[name] = append(groups[name], newID)
+			}
+		}
+	}
+	return groups
+}
+
 // HasItems returns true if there are items to import
 func (m ImportModel) HasItems() bool {
 	return len(m.items) > 0
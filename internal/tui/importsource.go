@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/importer"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+)
+
+// load replaces the modal's items with what imp reads from path (its
+// default file when empty). For SSH config it also plans a sync against
+// the existing connections.
+func (m *ImportModel) load(imp importer.Importer, path string) {
+	m.source, m.path = imp.Name(), path
+	if m.path == "" {
+		m.path = imp.DefaultPath()
+	}
+	m.items, m.groups, m.skipped, m.err = nil, nil, nil, nil
+	m.plan, m.rows, m.syncing = sshconfig.ImportPlan{}, nil, false
+	m.cursor, m.scrollTop = 0, 0
+
+	res, err := imp.Import(path, importer.Options{})
+	if err != nil {
+		m.err = err
+		return
+	}
+
+	usedIDs := make(map[string]bool)
+	for _, conn := range m.existing {
+		usedIDs[conn.ID] = true
+	}
+	m.skipped = res.Skipped
+	for _, conn := range res.Connections {
+		originalID := conn.ID
+		// Inventories are untrusted; see Connection.CheckSafety.
+		if err := conn.CheckSafety(); err != nil {
+			m.skipped = append(m.skipped, fmt.Sprintf("%s: %v", originalID, err))
+			continue
+		}
+
+		// Handle ID conflicts
+		renamed := false
+		if usedIDs[conn.ID] {
+			conn.ID = sshconfig.ResolveConflict(conn.ID, usedIDs)
+			renamed = true
+		}
+		usedIDs[conn.ID] = true
+
+		m.items = append(m.items, ImportItem{
+			Original:   originalID,
+			Connection: conn,
+			Renamed:    renamed,
+			Selected:   true, // All selected by default
+		})
+	}
+	m.groups = res.Groups
+
+	if imp.Name() == importer.DefaultFormat {
+		if hosts, err := sshconfig.Parse(path); err == nil {
+			m.plan = sshconfig.PlanImport(m.existing, hosts)
+			m.rows = buildSyncRows(&m.plan)
+			m.syncing = len(m.plan.Matched) > 0 || len(m.plan.Removed) > 0
+		}
+	}
+}
+
+func (m ImportModel) openSourcePicker() (ImportModel, tea.Cmd) {
+	m.picking = true
+	for i, imp := range importer.All() {
+		if imp.Name() == m.source {
+			m.formatIdx = i
+		}
+	}
+	m.pathInput = textinput.New()
+	m.pathInput.Prompt = ""
+	m.pathInput.CharLimit = 512
+	m.pathInput.SetValue(m.path)
+	m.pathInput.Focus()
+	return m, textinput.Blink
+}
+
+func (m ImportModel) updateSource(msg tea.Msg) (ImportModel, tea.Cmd) {
+	importers := importer.All()
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			m.picking = false
+			return m, nil
+		case "enter":
+			m.picking = false
+			m.load(importers[m.formatIdx], strings.TrimSpace(m.pathInput.Value()))
+			return m, nil
+		case "up", "shift+tab":
+			m.formatIdx = (m.formatIdx + len(importers) - 1) % len(importers)
+			m.pathInput.SetValue(importers[m.formatIdx].DefaultPath())
+			m.pathInput.CursorEnd()
+			return m, nil
+		case "down", "tab":
+			m.formatIdx = (m.formatIdx + 1) % len(importers)
+			m.pathInput.SetValue(importers[m.formatIdx].DefaultPath())
+			m.pathInput.CursorEnd()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.pathInput, cmd = m.pathInput.Update(msg)
+	return m, cmd
+}
+
+func (m ImportModel) viewSource() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Import Source"))
+	b.WriteString("\n\n")
+
+	for i, imp := range importer.All() {
+		name := fmt.Sprintf("%-12s", imp.Name())
+		if i == m.formatIdx {
+			b.WriteString(selectedItemStyle.Render("> " + name))
+		} else {
+			b.WriteString("  " + itemStyle.Render(name))
+		}
+		b.WriteString(" ")
+		b.WriteString(hostStyle.Render(imp.Description()))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	b.WriteString(helpDescStyle.Render("File: "))
+	b.WriteString(m.pathInput.View())
+	b.WriteString("\n\n")
+
+	help := helpKeyStyle.Render("↑/↓") + " " + helpDescStyle.Render("format") + "  "
+	help += helpKeyStyle.Render("enter") + " " + helpDescStyle.Render("load") + "  "
+	help += helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("back")
+	b.WriteString(help)
+
+	return b.String()
+}
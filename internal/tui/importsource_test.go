@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestImportModel_Source(t *testing.T) {
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "hosts")
+	content := "[web]\nweb1 ansible_host=10.0.0.1\nweb2 ansible_host=10.0.0.2\n\n[db]\ndb1\n"
+	if err := os.WriteFile(inventory, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	existing := []config.Connection{{ID: "web1", Host: "10.9.9.9"}}
+
+	m := NewImportModel(existing, filepath.Join(dir, "ssh_config"), "", 100, 40)
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("f")})
+	if !strings.Contains(m.View(), "Import Source") {
+		t.Fatalf("expected the source picker:\n%s", m.View())
+	}
+
+	// ssh-config is first; ansible is next.
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.pathInput.SetValue(inventory)
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.Error() != nil {
+		t.Fatal(m.Error())
+	}
+	if !strings.Contains(m.View(), "Import from hosts (ansible)") {
+		t.Errorf("expected the ansible title:\n%s", m.View())
+	}
+
+	var ids []string
+	for _, c := range m.SelectedConnections() {
+		ids = append(ids, c.ID)
+	}
+	if want := []string{"web1-imported", "web2", "db1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("IDs = %v, want %v", ids, want)
+	}
+
+	// Deselect db1: its group goes too.
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	if want := map[string][]string{"web": {"web1-imported", "web2"}}; !reflect.DeepEqual(m.SelectedGroups(), want) {
+		t.Errorf("groups = %v, want %v", m.SelectedGroups(), want)
+	}
+}
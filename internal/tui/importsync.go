@@ -0,0 +1,245 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/sshconfig"
+)
+
+type syncRowKind int
+
+const (
+	syncRowNew syncRowKind = iota
+	syncRowChanged
+	syncRowField
+	syncRowRemoved
+)
+
+// syncRow is one line of the sync view: a new host, a changed connection
+// (toggling all its fields), one of its fields, or a removed host.
+type syncRow struct {
+	kind  syncRowKind
+	index int // into the plan's New, Changed or Removed
+	field int // into Changed[index].Fields, for syncRowField
+}
+
+func buildSyncRows(plan *sshconfig.ImportPlan) []syncRow {
+	var rows []syncRow
+	for i := range plan.New {
+		rows = append(rows, syncRow{kind: syncRowNew, index: i})
+	}
+	for i, ch := range plan.Changed {
+		rows = append(rows, syncRow{kind: syncRowChanged, index: i})
+		for j := range ch.Fields {
+			rows = append(rows, syncRow{kind: syncRowField, index: i, field: j})
+		}
+	}
+	for i := range plan.Removed {
+		rows = append(rows, syncRow{kind: syncRowRemoved, index: i})
+	}
+	return rows
+}
+
+func (m ImportModel) updateSync(msg tea.KeyMsg) ImportModel {
+	switch msg.String() {
+	case "esc", "q":
+		m.cancelled = true
+	case "enter":
+		m.confirmed = true
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+			m.ensureVisible()
+		}
+	case "down", "j":
+		if m.cursor < len(m.rows)-1 {
+			m.cursor++
+			m.ensureVisible()
+		}
+	case " ", "x":
+		if m.cursor < len(m.rows) {
+			row := m.rows[m.cursor]
+			m.setRow(row, !m.rowAccepted(row))
+		}
+	case "a":
+		for _, row := range m.rows {
+			m.setRow(row, true)
+		}
+	case "n":
+		for _, row := range m.rows {
+			m.setRow(row, false)
+		}
+	case "m":
+		m.manage = !m.manage
+	}
+	return m
+}
+
+// rowAccepted reports whether a row's change is accepted; a changed
+// connection counts as accepted when all its fields are.
+func (m ImportModel) rowAccepted(row syncRow) bool {
+	switch row.kind {
+	case syncRowNew:
+		return m.plan.New[row.index].Accept
+	case syncRowChanged:
+		for _, f := range m.plan.Changed[row.index].Fields {
+			if !f.Accept {
+				return false
+			}
+		}
+		return true
+	case syncRowField:
+		return m.plan.Changed[row.index].Fields[row.field].Accept
+	default:
+		return m.plan.Removed[row.index].Accept
+	}
+}
+
+func (m ImportModel) setRow(row syncRow, accept bool) {
+	switch row.kind {
+	case syncRowNew:
+		m.plan.New[row.index].Accept = accept
+	case syncRowChanged:
+		fields := m.plan.Changed[row.index].Fields
+		for j := range fields {
+			fields[j].Accept = accept
+		}
+	case syncRowField:
+		m.plan.Changed[row.index].Fields[row.field].Accept = accept
+	default:
+		m.plan.Removed[row.index].Accept = accept
+	}
+}
+
+func (m ImportModel) viewSync() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("Sync from SSH Config"))
+	b.WriteString("\n\n")
+
+	if len(m.rows) == 0 {
+		b.WriteString(emptyStyle.Render("Connections are in sync with the SSH config."))
+		b.WriteString("\n\n")
+	} else {
+		b.WriteString(helpDescStyle.Render(fmt.Sprintf("%d new, %d changed, %d removed from the SSH config:",
+			len(m.plan.New), len(m.plan.Changed), len(m.plan.Removed))))
+		b.WriteString("\n\n")
+
+		visibleHeight := m.visibleHeight()
+		start := m.scrollTop
+		end := start + visibleHeight
+		if end > len(m.rows) {
+			end = len(m.rows)
+		}
+		for i := start; i < end; i++ {
+			b.WriteString(m.syncRowLine(m.rows[i], i == m.cursor))
+			b.WriteString("\n")
+		}
+
+		if len(m.rows) > visibleHeight {
+			if m.scrollTop > 0 {
+				b.WriteString(helpDescStyle.Render("  ↑ more above"))
+				b.WriteString("\n")
+			}
+			if end < len(m.rows) {
+				b.WriteString(helpDescStyle.Render(fmt.Sprintf("  ↓ %d more below", len(m.rows)-end)))
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	manage := "off"
+	if m.manage {
+		manage = "on"
+	}
+	b.WriteString(helpDescStyle.Render("Mark matched connections as managed by the SSH config: " + manage))
+	b.WriteString("\n\n")
+
+	help := helpKeyStyle.Render("space") + " " + helpDescStyle.Render("toggle") + "  "
+	help += helpKeyStyle.Render("a") + " " + helpDescStyle.Render("all") + "  "
+	help += helpKeyStyle.Render("n") + " " + helpDescStyle.Render("none") + "  "
+	help += helpKeyStyle.Render("m") + " " + helpDescStyle.Render("manage") + "  "
+	help += helpKeyStyle.Render("enter") + " " + helpDescStyle.Render("apply") + "  "
+	help += helpKeyStyle.Render("s") + " " + helpDescStyle.Render("import view") + "  "
+	help += helpKeyStyle.Render("f") + " " + helpDescStyle.Render("source") + "  "
+	help += helpKeyStyle.Render("esc") + " " + helpDescStyle.Render("cancel")
+	b.WriteString(help)
+
+	return b.String()
+}
+
+func (m ImportModel) syncRowLine(row syncRow, selected bool) string {
+	checkbox := "[ ]"
+	if m.rowAccepted(row) {
+		checkbox = "[x]"
+	}
+
+	var marker, text, detail string
+	switch row.kind {
+	case syncRowNew:
+		ch := m.plan.New[row.index]
+		marker, text = execOKStyle.Render("+"), ch.ID
+		detail = ch.Connection.Host
+		if ch.Connection.User != "" {
+			detail = ch.Connection.User + "@" + detail
+		}
+	case syncRowChanged:
+		ch := m.plan.Changed[row.index]
+		marker, text = warningStyle.Render("~"), ch.ID
+		if ch.Alias != ch.ID {
+			detail = "from " + ch.Alias
+		}
+	case syncRowField:
+		f := m.plan.Changed[row.index].Fields[row.field]
+		marker = "   "
+		text = fmt.Sprintf("%s: %s → %s", f.Field, syncValue(f.Old), syncValue(f.New))
+	default:
+		ch := m.plan.Removed[row.index]
+		marker, text = execFailedStyle.Render("-"), ch.ID
+		detail = "gone from the SSH config"
+	}
+
+	var line strings.Builder
+	if selected {
+		line.WriteString(selectedItemStyle.Render("> "))
+	} else {
+		line.WriteString("  ")
+	}
+	line.WriteString(marker + " ")
+	if selected {
+		line.WriteString(selectedItemStyle.Render(checkbox + " " + text))
+	} else {
+		line.WriteString(checkbox + " " + itemStyle.Render(text))
+	}
+	if detail != "" {
+		line.WriteString("  ")
+		line.WriteString(hostStyle.Render(detail))
+	}
+	return line.String()
+}
+
+func syncValue(s string) string {
+	if s == "" {
+		return "(unset)"
+	}
+	return s
+}
+
+// Syncing reports whether the modal is in the sync view, so enter applies
+// the plan rather than importing the selected hosts.
+func (m ImportModel) Syncing() bool {
+	return m.syncing
+}
+
+// Plan returns the sync plan with the changes the user accepted.
+func (m ImportModel) Plan() *sshconfig.ImportPlan {
+	return &m.plan
+}
+
+// Manage reports whether matched connections should be marked as managed.
+func (m ImportModel) Manage() bool {
+	return m.manage
+}
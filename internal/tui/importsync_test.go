@@ -0,0 +1,79 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func TestImportModel_Sync(t *testing.T) {
+	sshConfig := filepath.Join(t.TempDir(), "config")
+	content := "Host web\n    HostName 10.0.0.1\n    Port 2222\n\nHost cache\n    HostName 10.0.0.3\n"
+	if err := os.WriteFile(sshConfig, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	existing := []config.Connection{
+		{ID: "web", Host: "10.0.0.1", Port: 22},
+		{ID: "old", Host: "10.0.0.9", SSHConfigHost: "old"},
+	}
+
+	m := NewImportModel(existing, sshConfig, "", 100, 40)
+	if !m.Syncing() {
+		t.Fatal("expected the sync view when hosts match existing connections")
+	}
+	view := m.View()
+	for _, want := range []string{"1 new, 1 changed, 1 removed", "cache", "port: 22 → 2222", "old"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view missing %q:\n%s", want, view)
+		}
+	}
+
+	// Rows: + cache, ~ web, port, - old. Decline the new host, accept the
+	// removal.
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	for i := 0; i < 3; i++ {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.Confirmed() || !m.Manage() {
+		t.Fatalf("confirmed = %v, manage = %v", m.Confirmed(), m.Manage())
+	}
+
+	cfg := &config.Config{Connections: existing}
+	plan := m.Plan()
+	res := plan.Apply(cfg, m.Manage())
+	if res.Added != 0 || res.Updated != 1 || res.Removed != 1 || res.Marked != 1 {
+		t.Errorf("Apply() = %+v", res)
+	}
+	if web := cfg.FindConnection("web"); web.Port != 2222 || web.SSHConfigHost != "web" {
+		t.Errorf("web = %+v, want port 2222 and managed", web)
+	}
+}
+
+func TestImportModel_FirstImport(t *testing.T) {
+	sshConfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(sshConfig, []byte("Host web\n    HostName 10.0.0.1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewImportModel(nil, sshConfig, "", 100, 40)
+	if m.Syncing() {
+		t.Fatal("expected the import view when nothing was imported before")
+	}
+	selected := m.SelectedConnections()
+	if len(selected) != 1 || selected[0].SSHConfigHost != "web" {
+		t.Errorf("selected = %+v, want web managed by its host", selected)
+	}
+
+	// s switches views.
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+	if !m.Syncing() {
+		t.Error("expected s to switch to the sync view")
+	}
+}
@@ -20,6 +20,8 @@ var (
 
 	selectedItemStyle lipgloss.Style
 
+	markedItemStyle lipgloss.Style
+
 	projectStyle lipgloss.Style
 
 	envStyle lipgloss.Style
@@ -55,6 +57,15 @@ var (
 	healthUnreachableStyle lipgloss.Style
 
 	healthCheckingStyle lipgloss.Style
+
+	// Exec view host statuses
+	execPendingStyle lipgloss.Style
+
+	execRunningStyle lipgloss.Style
+
+	execOKStyle lipgloss.Style
+
+	execFailedStyle lipgloss.Style
 )
 
 func init() {
@@ -92,6 +103,11 @@ func refreshStyles() {
 		Foreground(currentTheme.Primary).
 		Bold(true)
 
+	markedItemStyle = lipgloss.NewStyle().
+		PaddingLeft(2).
+		Foreground(currentTheme.Accent).
+		Bold(true)
+
 	projectStyle = lipgloss.NewStyle().
 		Bold(true).
 		Foreground(currentTheme.Accent)
@@ -147,4 +163,17 @@ func refreshStyles() {
 
 	healthCheckingStyle = lipgloss.NewStyle().
 		Foreground(currentTheme.Secondary)
+
+	execPendingStyle = lipgloss.NewStyle().
+		Foreground(currentTheme.Muted)
+
+	execRunningStyle = lipgloss.NewStyle().
+		Foreground(currentTheme.Warning)
+
+	execOKStyle = lipgloss.NewStyle().
+		Foreground(currentTheme.Success)
+
+	execFailedStyle = lipgloss.NewStyle().
+		Foreground(currentTheme.Error).
+		Bold(true)
 }
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tunnel
+
+import "syscall"
+
+// detached is a no-op on platforms without sessions. hop only ships for
+// Linux and macOS; this keeps the package buildable elsewhere.
+func detached() *syscall.SysProcAttr {
+	return nil
+}
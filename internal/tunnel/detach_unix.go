@@ -0,0 +1,11 @@
+//go:build unix
+
+package tunnel
+
+import "syscall"
+
+// detached starts the process in its own session, so closing the terminal
+// (SIGHUP) doesn't stop it.
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
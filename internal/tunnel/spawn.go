@@ -0,0 +1,39 @@
+package tunnel
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Spawn starts "hop <args>" in the background, detached from the terminal
+// so it outlives the calling command, with its output appended to logPath.
+// The returned channel is closed when the process exits while the caller is
+// still running.
+func Spawn(args []string, logPath string) (<-chan struct{}, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(Dir(), 0700); err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = detached()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	return exited, nil
+}
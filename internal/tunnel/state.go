@@ -0,0 +1,192 @@
+// Package tunnel runs a connection's port forwards as background ssh
+// processes. Each forward has a supervisor process ("hop tunnel run") that
+// restarts ssh with backoff and records its state in a JSON file under the
+// hop runtime directory, which hop tunnel ls and the dashboard read.
+package tunnel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+// Status is the state of a running tunnel.
+type Status string
+
+const (
+	// StatusStarting means ssh was started and the forward isn't listening yet.
+	StatusStarting Status = "starting"
+	// StatusUp means the forward is established.
+	StatusUp Status = "up"
+	// StatusRetrying means ssh exited and the supervisor is waiting to restart it.
+	StatusRetrying Status = "retrying"
+)
+
+// State is what a supervisor records about its tunnel.
+type State struct {
+	Connection string    `json:"connection"`
+	Name       string    `json:"name"`
+	Spec       string    `json:"spec"`
+	PID        int       `json:"pid"`
+	SSHPID     int       `json:"ssh_pid,omitempty"`
+	Status     Status    `json:"status"`
+	Restarts   int       `json:"restarts"`
+	LastError  string    `json:"last_error,omitempty"`
+	Started    time.Time `json:"started"`
+	Since      time.Time `json:"since"`
+}
+
+// Dir returns the directory holding tunnel state and log files.
+func Dir() string {
+	return filepath.Join(ssh.RuntimeDir(), "tunnels")
+}
+
+// key names a tunnel's files. Connection IDs and forward names can hold any
+// character, so the name is a hash.
+func key(connID, name string) string {
+	sum := sha256.Sum256([]byte(connID + "\x00" + name))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StatePath returns the state file of a connection's forward.
+func StatePath(connID, name string) string {
+	return filepath.Join(Dir(), key(connID, name)+".json")
+}
+
+// LogPath returns the file a tunnel's supervisor logs to.
+func LogPath(connID, name string) string {
+	return filepath.Join(Dir(), key(connID, name)+".log")
+}
+
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := StatePath(s.Connection, s.Name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load returns the state of a connection's forward, or nil when its tunnel
+// is not running. A state file left behind by a dead supervisor is removed.
+func Load(connID, name string) *State {
+	return loadFile(StatePath(connID, name))
+}
+
+func loadFile(path string) *State {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil || !alive(st.PID) {
+		os.Remove(path)
+		return nil
+	}
+	return &st
+}
+
+// List returns every running tunnel, ordered by connection and name.
+func List() ([]State, error) {
+	entries, err := os.ReadDir(Dir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var states []State
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if st := loadFile(filepath.Join(Dir(), e.Name())); st != nil {
+			states = append(states, *st)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Connection != states[j].Connection {
+			return states[i].Connection < states[j].Connection
+		}
+		return states[i].Name < states[j].Name
+	})
+	return states, nil
+}
+
+// Stop terminates a tunnel's supervisor, which closes its ssh process. A
+// supervisor that doesn't exit within a few seconds is killed.
+func Stop(st *State) error {
+	path := StatePath(st.Connection, st.Name)
+	if err := signal(st.PID, syscall.SIGTERM); err != nil {
+		if !alive(st.PID) {
+			os.Remove(path)
+			return nil
+		}
+		return err
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for alive(st.PID) {
+		if time.Now().After(deadline) {
+			signal(st.PID, syscall.SIGKILL)
+			if st.SSHPID > 0 {
+				signal(st.SSHPID, syscall.SIGKILL)
+			}
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	os.Remove(path)
+	return nil
+}
+
+// Wait polls a tunnel started with Spawn until it is up, its first attempt
+// has failed, its supervisor has exited or timeout passes. It returns nil if
+// the supervisor is not running.
+func Wait(connID, name string, exited <-chan struct{}, timeout time.Duration) *State {
+	deadline := time.After(timeout)
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		st := Load(connID, name)
+		if st != nil && st.Status != StatusStarting {
+			return st
+		}
+		select {
+		case <-exited:
+			return Load(connID, name)
+		case <-deadline:
+			return st
+		case <-tick.C:
+		}
+	}
+}
+
+func signal(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// alive reports whether a process with pid exists.
+func alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := signal(pid, syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
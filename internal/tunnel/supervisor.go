@@ -0,0 +1,241 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+	"github.com/danmartuszewski/hop/internal/ssh"
+)
+
+// Supervisor keeps one forward open: it runs ssh, checks that the forward
+// is listening, and restarts ssh with exponential backoff when it exits or
+// the forward goes away.
+type Supervisor struct {
+	Connection *config.Connection
+	Forward    *config.Forward
+
+	// Command returns the process for one attempt. It defaults to ssh with
+	// ssh.BuildForwardCommand.
+	Command func() *exec.Cmd
+	// MinBackoff and MaxBackoff bound the wait between restarts (default
+	// 1s and 1m). The wait doubles after each failure and is reset once a
+	// process has stayed up for Stable (default 30s).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Stable     time.Duration
+	// HealthInterval is how often the forward is checked once up (default
+	// 10s). It is restarted after three failed checks in a row.
+	HealthInterval time.Duration
+	// Log receives a line per start and failure; nil discards them.
+	Log *log.Logger
+
+	state State
+}
+
+const (
+	// startPoll is how often a starting forward is checked.
+	startPoll = 200 * time.Millisecond
+	// remoteGrace is how long ssh must run before a remote forward, which
+	// can't be checked from here, counts as up. ExitOnForwardFailure makes
+	// ssh exit before this if the server refuses the forward.
+	remoteGrace = 2 * time.Second
+	// maxHealthFailures is how many failed checks in a row restart ssh.
+	maxHealthFailures = 3
+)
+
+func (s *Supervisor) defaults() {
+	if s.Command == nil {
+		s.Command = func() *exec.Cmd {
+			return exec.Command("ssh", ssh.BuildForwardCommand(s.Connection, s.Forward)...)
+		}
+	}
+	if s.MinBackoff == 0 {
+		s.MinBackoff = time.Second
+	}
+	if s.MaxBackoff == 0 {
+		s.MaxBackoff = time.Minute
+	}
+	if s.Stable == 0 {
+		s.Stable = 30 * time.Second
+	}
+	if s.HealthInterval == 0 {
+		s.HealthInterval = 10 * time.Second
+	}
+	if s.Log == nil {
+		s.Log = log.New(io.Discard, "", 0)
+	}
+}
+
+// Run supervises the forward until ctx is canceled, then stops ssh and
+// removes the state file. It fails if the tunnel is already running.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.defaults()
+	if err := s.Connection.CheckSafety(); err != nil {
+		return err
+	}
+	if st := Load(s.Connection.ID, s.Forward.Name); st != nil && st.PID != os.Getpid() {
+		return fmt.Errorf("tunnel %s/%s is already running (pid %d)", s.Connection.ID, s.Forward.Name, st.PID)
+	}
+	if err := os.MkdirAll(Dir(), 0700); err != nil {
+		return err
+	}
+
+	flag, spec := ssh.ForwardSpec(s.Forward)
+	now := time.Now()
+	s.state = State{
+		Connection: s.Connection.ID,
+		Name:       s.Forward.Name,
+		Spec:       flag + " " + spec,
+		PID:        os.Getpid(),
+		Started:    now,
+	}
+	defer os.Remove(StatePath(s.Connection.ID, s.Forward.Name))
+
+	backoff := s.MinBackoff
+	for {
+		start := time.Now()
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			s.Log.Printf("stopped")
+			return nil
+		}
+		if time.Since(start) >= s.Stable {
+			backoff = s.MinBackoff
+		}
+
+		s.state.Restarts++
+		s.state.SSHPID = 0
+		s.state.LastError = err.Error()
+		s.setStatus(StatusRetrying)
+		s.Log.Printf("%v; restarting in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			s.Log.Printf("stopped")
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.MaxBackoff)
+	}
+}
+
+// runOnce runs one ssh process until it exits, its forward fails the
+// health check, or ctx is canceled.
+func (s *Supervisor) runOnce(ctx context.Context) error {
+	cmd := s.Command()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.state.SSHPID = cmd.Process.Pid
+	s.setStatus(StatusStarting)
+	s.Log.Printf("started %s (pid %d)", s.state.Spec, cmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	started := time.Now()
+	timer := time.NewTimer(startPoll)
+	defer timer.Stop()
+	failures := 0
+	for {
+		select {
+		case err := <-done:
+			return exitError(err, stderr.String())
+		case <-ctx.Done():
+			cmd.Process.Signal(syscall.SIGTERM)
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				cmd.Process.Kill()
+				<-done
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if s.healthy(started) {
+			failures = 0
+			if s.state.Status != StatusUp {
+				s.setStatus(StatusUp)
+				s.Log.Printf("up")
+			}
+		} else if s.state.Status == StatusUp {
+			failures++
+			if failures >= maxHealthFailures {
+				cmd.Process.Kill()
+				<-done
+				return errors.New("forward stopped listening")
+			}
+		}
+
+		if s.state.Status == StatusUp {
+			timer.Reset(s.HealthInterval)
+		} else {
+			timer.Reset(startPoll)
+		}
+	}
+}
+
+// healthy reports whether the forward is established. Local and dynamic
+// forwards are checked by trying to bind their listen address: if that
+// fails, ssh holds it. This avoids opening a connection through the tunnel
+// (which the target would see) on every check.
+func (s *Supervisor) healthy(started time.Time) bool {
+	if s.Forward.EffectiveType() == config.ForwardRemote {
+		return time.Since(started) >= remoteGrace
+	}
+	ln, err := net.Listen("tcp", probeAddr(s.Forward))
+	if err != nil {
+		return true
+	}
+	ln.Close()
+	return false
+}
+
+// probeAddr is the address ssh listens on for a local or dynamic forward.
+// Without a bind address ssh listens on loopback.
+func probeAddr(f *config.Forward) string {
+	host := f.BindAddress
+	switch host {
+	case "", "localhost":
+		host = "127.0.0.1"
+	case "*":
+		host = ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(f.ListenPort))
+}
+
+func (s *Supervisor) setStatus(status Status) {
+	s.state.Status = status
+	s.state.Since = time.Now()
+	if err := s.state.save(); err != nil {
+		s.Log.Printf("saving state: %v", err)
+	}
+}
+
+// exitError describes why ssh exited, preferring its last stderr line
+// ("connect to host ... Connection refused") over the exit status.
+func exitError(err error, stderr string) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if msg := strings.TrimSpace(lines[len(lines)-1]); msg != "" {
+		return errors.New(msg)
+	}
+	if err == nil {
+		return errors.New("ssh exited")
+	}
+	return fmt.Errorf("ssh exited: %w", err)
+}
@@ -0,0 +1,206 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/danmartuszewski/hop/internal/config"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startSupervisor(t *testing.T, s *Supervisor) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	return func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Run() = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("supervisor did not stop")
+		}
+	}
+}
+
+func TestSupervisor_RestartsWithBackoff(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	conn := &config.Connection{ID: "db1", Host: "db1.example.com"}
+	fwd := &config.Forward{Name: "pg", ListenPort: 15432, Target: "localhost:5432"}
+
+	stop := startSupervisor(t, &Supervisor{
+		Connection: conn,
+		Forward:    fwd,
+		Command: func() *exec.Cmd {
+			return exec.Command("sh", "-c", "echo 'first line' >&2; echo 'Connection refused' >&2; exit 255")
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond,
+	})
+
+	var st *State
+	waitFor(t, "three restarts", func() bool {
+		st = Load("db1", "pg")
+		return st != nil && st.Restarts >= 3
+	})
+	if st.Status != StatusRetrying && st.Status != StatusStarting {
+		t.Errorf("status = %s", st.Status)
+	}
+	if st.LastError != "Connection refused" {
+		t.Errorf("LastError = %q, want ssh's last stderr line", st.LastError)
+	}
+	if st.Spec != "-L 15432:localhost:5432" || st.PID != os.Getpid() {
+		t.Errorf("state = %+v", st)
+	}
+
+	stop()
+	if _, err := os.Stat(StatePath("db1", "pg")); !os.IsNotExist(err) {
+		t.Errorf("state file left after stop: %v", err)
+	}
+}
+
+func TestSupervisor_HealthCheck(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	// The test holds the listen port in place of ssh.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	conn := &config.Connection{ID: "db1", Host: "db1.example.com"}
+	fwd := &config.Forward{Name: "pg", ListenPort: port, Target: "localhost:5432"}
+
+	stop := startSupervisor(t, &Supervisor{
+		Connection:     conn,
+		Forward:        fwd,
+		Command:        func() *exec.Cmd { return exec.Command("sleep", "30") },
+		MinBackoff:     10 * time.Millisecond,
+		HealthInterval: 20 * time.Millisecond,
+	})
+	defer stop()
+
+	var st *State
+	waitFor(t, "tunnel up", func() bool {
+		st = Load("db1", "pg")
+		return st != nil && st.Status == StatusUp
+	})
+	if st.SSHPID == 0 || st.Restarts != 0 {
+		t.Errorf("state = %+v", st)
+	}
+
+	ln.Close()
+	waitFor(t, "restart after the forward stopped listening", func() bool {
+		st = Load("db1", "pg")
+		return st != nil && st.Restarts == 1
+	})
+	if st.LastError != "forward stopped listening" {
+		t.Errorf("LastError = %q", st.LastError)
+	}
+}
+
+func TestSupervisor_AlreadyRunning(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if err := os.MkdirAll(Dir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	other := exec.Command("sleep", "30")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Process.Kill(); other.Wait() })
+	st := State{Connection: "db1", Name: "pg", PID: other.Process.Pid, Status: StatusUp}
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Supervisor{
+		Connection: &config.Connection{ID: "db1", Host: "db1"},
+		Forward:    &config.Forward{Name: "pg", ListenPort: 15432, Target: "localhost:5432"},
+	}
+	if err := s.Run(context.Background()); err == nil {
+		t.Fatal("Run() should refuse to start a second supervisor")
+	}
+}
+
+func TestListAndStop(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if err := os.MkdirAll(Dir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := exec.Command("sleep", "30")
+	if err := proc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() { proc.Wait(); close(exited) }()
+	t.Cleanup(func() { proc.Process.Kill() })
+
+	live := State{Connection: "web", Name: "socks", PID: proc.Process.Pid, Status: StatusUp}
+	stale := State{Connection: "api", Name: "debug", PID: 0, Status: StatusUp}
+	for _, st := range []State{live, stale} {
+		if err := st.save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	states, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Connection != "web" {
+		t.Fatalf("List() = %+v, want only the live tunnel", states)
+	}
+	if _, err := os.Stat(StatePath("api", "debug")); !os.IsNotExist(err) {
+		t.Error("stale state file not removed")
+	}
+
+	if err := Stop(&states[0]); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not terminate the supervisor")
+	}
+	if Load("web", "socks") != nil {
+		t.Error("tunnel still listed after Stop")
+	}
+}
+
+func TestProbeAddr(t *testing.T) {
+	tests := []struct {
+		bind string
+		want string
+	}{
+		{"", "127.0.0.1:8080"},
+		{"localhost", "127.0.0.1:8080"},
+		{"*", ":8080"},
+		{"0.0.0.0", "0.0.0.0:8080"},
+		{"::1", "[::1]:8080"},
+	}
+	for _, tt := range tests {
+		if got := probeAddr(&config.Forward{BindAddress: tt.bind, ListenPort: 8080}); got != tt.want {
+			t.Errorf("probeAddr(%q) = %q, want %q", tt.bind, got, tt.want)
+		}
+	}
+}